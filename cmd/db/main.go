@@ -7,6 +7,18 @@ import (
 	"log"
 )
 
+// auditAppendOnly запрещает изменять и удалять записи журнала аудита.
+var auditAppendOnly = []string{
+	`CREATE OR REPLACE FUNCTION audit_entries_append_only() RETURNS trigger AS $$
+BEGIN
+	RAISE EXCEPTION 'audit log is append-only';
+END
+$$ LANGUAGE plpgsql`,
+	`DROP TRIGGER IF EXISTS audit_entries_append_only ON audit_entries`,
+	`CREATE TRIGGER audit_entries_append_only
+	BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_entries
+	FOR EACH STATEMENT EXECUTE FUNCTION audit_entries_append_only()`,
+}
 
 func main() {
 
@@ -20,8 +32,30 @@ func main() {
 		log.Fatal(err)
 	}
 
-	if err := db.AutoMigrate(&entity.User{}); err != nil {
+	// Уникальные индексы создаются только по каноническим значениям
+	if err := canonicalizeUsers(db); err != nil {
+		log.Fatal(err)
+	}
+
+	// Решается до AutoMigrate, пока колонки email_verified нет
+	backfillVerified := needsEmailVerifiedBackfill(db)
+
+	if err := db.AutoMigrate(&entity.User{}, &entity.RefreshToken{}, &entity.OneTimeToken{}, &entity.RecoveryCode{}, &entity.WebAuthnCredential{}, &entity.OAuthClient{}, &entity.AuthorizationCode{}, &entity.OAuthConsent{}, &entity.FederatedIdentity{}, &entity.APIKey{}, &entity.Permission{}, &entity.Role{}, &entity.UserRole{}, &entity.RelationTuple{}, &entity.RelationRevision{}, &entity.Organization{}, &entity.Membership{}, &entity.Invitation{}, &entity.LoginEvent{}, &entity.AuditEntry{}, &entity.PasswordHistory{}); err != nil {
 		log.Fatalf("failed to migrate")
 	}
 
+	if backfillVerified {
+		if err := backfillEmailVerified(db); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// Журнал аудита только дополняется: изменение и удаление записей
+	// запрещены на уровне базы
+	for _, statement := range auditAppendOnly {
+		if err := db.Exec(statement).Error; err != nil {
+			log.Fatalf("failed to protect audit log: %v", err)
+		}
+	}
+
 }
\ No newline at end of file
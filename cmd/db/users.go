@@ -0,0 +1,100 @@
+package main
+
+import (
+	"auth/internal/entity"
+	"auth/internal/identity"
+	"fmt"
+	"log"
+	"sort"
+
+	"gorm.io/gorm"
+)
+
+// canonicalizeUsers приводит имена и почты существующих аккаунтов к виду
+// identity.Canonical до создания уникальных индексов. Если после приведения
+// совпадают несколько аккаунтов, ничего не меняется: коллизии выводятся,
+// и миграция останавливается, пока их не разрешат вручную.
+func canonicalizeUsers(db *gorm.DB) error {
+	if !db.Migrator().HasTable(&entity.User{}) {
+		return nil
+	}
+
+	// Удаленные мягко записи тоже попадают в уникальный индекс
+	var users []entity.User
+	if err := db.Unscoped().Select("id", "user_name", "email").Order("id").Find(&users).Error; err != nil {
+		return fmt.Errorf("failed to load users: %w", err)
+	}
+
+	byUserName := make(map[string][]uint)
+	byEmail := make(map[string][]uint)
+	for _, user := range users {
+		userName := identity.Canonical(user.UserName)
+		byUserName[userName] = append(byUserName[userName], user.ID)
+		email := identity.Canonical(user.Email)
+		byEmail[email] = append(byEmail[email], user.ID)
+	}
+
+	collisions := reportCollisions("user_name", byUserName) + reportCollisions("email", byEmail)
+	if collisions > 0 {
+		return fmt.Errorf("%d canonical collisions found, resolve them and run the migration again", collisions)
+	}
+
+	updated := 0
+	err := db.Transaction(func(tx *gorm.DB) error {
+		for _, user := range users {
+			userName, email := identity.Canonical(user.UserName), identity.Canonical(user.Email)
+			if userName == user.UserName && email == user.Email {
+				continue
+			}
+
+			if err := tx.Unscoped().Model(&entity.User{}).Where("id = ?", user.ID).UpdateColumns(map[string]interface{}{
+				"user_name": userName,
+				"email":     email,
+			}).Error; err != nil {
+				return fmt.Errorf("failed to canonicalize user %d: %w", user.ID, err)
+			}
+			updated++
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	log.Printf("users canonicalized: %d", updated)
+	return nil
+}
+
+func reportCollisions(column string, values map[string][]uint) int {
+	keys := make([]string, 0, len(values))
+	for value, ids := range values {
+		if len(ids) > 1 {
+			keys = append(keys, value)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, value := range keys {
+		log.Printf("%s %q is shared by users %v after canonicalization", column, value, values[value])
+	}
+	return len(keys)
+}
+
+// needsEmailVerifiedBackfill - таблица пользователей уже есть, а колонки
+// email_verified еще нет. Проверяется до AutoMigrate.
+func needsEmailVerifiedBackfill(db *gorm.DB) bool {
+	migrator := db.Migrator()
+	return migrator.HasTable(&entity.User{}) && !migrator.HasColumn(&entity.User{}, "EmailVerified")
+}
+
+// backfillEmailVerified считает подтвержденными аккаунты, созданные до
+// появления подтверждения почты, иначе после миграции они не смогут войти.
+func backfillEmailVerified(db *gorm.DB) error {
+	result := db.Model(&entity.User{}).Where("email_verified = ?", false).Update("email_verified", true)
+	if result.Error != nil {
+		return fmt.Errorf("failed to backfill email_verified: %w", result.Error)
+	}
+
+	log.Printf("existing users marked as verified: %d", result.RowsAffected)
+	return nil
+}
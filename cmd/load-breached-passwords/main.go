@@ -0,0 +1,144 @@
+package main
+
+import (
+	"auth/internal/breach"
+	"auth/internal/config"
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Сборка локального файла утекших паролей из выгрузки HIBP Pwned Passwords.
+// Источник - либо один файл, упорядоченный по хешу ("HASH:COUNT"), либо
+// каталог файлов диапазонов XXXXX.txt со строками "SUFFIX:COUNT", как их
+// сохраняет официальный загрузчик. Результат пишется во временный файл и
+// атомарно заменяет старый; сервисы подхватывают его после перезапуска.
+func main() {
+	source := flag.String("source", "", "ordered-by-hash dump file or directory of range files")
+	out := flag.String("out", "", "output file, defaults to password_policy.breached_passwords_path")
+	minCount := flag.Int("min-count", 1, "skip hashes seen fewer times than this")
+	flag.Parse()
+
+	if *source == "" {
+		log.Fatal("-source is required")
+	}
+
+	if *out == "" {
+		cfg, err := config.LoadConfig("config.yaml")
+		if err != nil {
+			log.Fatal(err)
+		}
+		*out = cfg.PasswordPolicyConfig.BreachedPasswordsPath
+	}
+	if *out == "" {
+		log.Fatal("-out is required when breached_passwords_path is not configured")
+	}
+
+	written, err := build(*source, *out, *minCount)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("breached passwords file %s is ready: %d hashes\n", *out, written)
+}
+
+func build(source, out string, minCount int) (int, error) {
+	info, err := os.Stat(source)
+	if err != nil {
+		return 0, err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(out), filepath.Base(out)+".*.tmp")
+	if err != nil {
+		return 0, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	writer := breach.NewWriter(tmp)
+	if info.IsDir() {
+		err = loadRanges(writer, source, minCount)
+	} else {
+		err = loadFile(writer, source, "", minCount)
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if err := writer.Flush(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Sync(); err != nil {
+		return 0, err
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, err
+	}
+	if err := os.Rename(tmp.Name(), out); err != nil {
+		return 0, err
+	}
+
+	return writer.Written(), nil
+}
+
+// loadRanges читает файлы диапазонов по порядку префиксов, так что
+// итоговый файл остается отсортированным.
+func loadRanges(writer *breach.Writer, dir string, minCount int) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		prefix := strings.TrimSuffix(entry.Name(), filepath.Ext(entry.Name()))
+		if entry.Type().IsRegular() && len(prefix) == breach.PrefixLength {
+			names = append(names, entry.Name())
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		return strings.ToUpper(names[i]) < strings.ToUpper(names[j])
+	})
+
+	for _, name := range names {
+		prefix := strings.TrimSuffix(name, filepath.Ext(name))
+		if err := loadFile(writer, filepath.Join(dir, name), prefix, minCount); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func loadFile(writer *breach.Writer, path, prefix string, minCount int) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		if strings.TrimSpace(scanner.Text()) == "" {
+			continue
+		}
+
+		hash, count, err := breach.ParseLine(scanner.Text())
+		if err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		if count < minCount {
+			continue
+		}
+		if err := writer.Add(prefix+hash, count); err != nil {
+			return fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+	}
+
+	return scanner.Err()
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"auth/internal/breach"
+	"crypto/sha1"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func hashOf(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func writeFile(t *testing.T, path, content string) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// checkCorpus открывает собранный файл и проверяет счетчики паролей.
+func checkCorpus(t *testing.T, path string, want map[string]int) {
+	t.Helper()
+	corpus, err := breach.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer corpus.Close()
+	for password, count := range want {
+		if got := corpus.Count(password); got != count {
+			t.Errorf("Count(%q) = %d, want %d", password, got, count)
+		}
+	}
+}
+
+func TestBuildFromDump(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "pwned-passwords-sha1-ordered-by-hash.txt")
+	// Выгрузка уже отсортирована: хеш "password" начинается с 5B, "qwerty" - с B1
+	writeFile(t, source, hashOf("password")+":9545824\r\n\r\n"+hashOf("qwerty")+":1\r\n")
+	out := filepath.Join(dir, "breached.txt")
+
+	written, err := build(source, out, 2)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if written != 1 {
+		t.Fatalf("written = %d, want 1", written)
+	}
+	// Хеши ниже -min-count в файл не попадают
+	checkCorpus(t, out, map[string]int{"password": 9545824, "qwerty": 0})
+}
+
+func TestBuildFromRanges(t *testing.T) {
+	dir := t.TempDir()
+	ranges := filepath.Join(dir, "ranges")
+	if err := os.Mkdir(ranges, 0o700); err != nil {
+		t.Fatal(err)
+	}
+
+	passwords := map[string]int{"password": 9545824, "qwerty": 3912816, "letmein": 7}
+	files := make(map[string]string)
+	for password, count := range passwords {
+		hash := hashOf(password)
+		files[hash[:breach.PrefixLength]] += hash[breach.PrefixLength:] + ":" + strconv.Itoa(count) + "\n"
+	}
+	for prefix, content := range files {
+		// Имена файлов бывают и в нижнем регистре
+		writeFile(t, filepath.Join(ranges, strings.ToLower(prefix)+".txt"), content)
+	}
+	writeFile(t, filepath.Join(ranges, "README.md"), "not a range file")
+
+	out := filepath.Join(dir, "breached.txt")
+	written, err := build(ranges, out, 1)
+	if err != nil {
+		t.Fatalf("build: %v", err)
+	}
+	if written != len(passwords) {
+		t.Fatalf("written = %d, want %d", written, len(passwords))
+	}
+	checkCorpus(t, out, passwords)
+}
+
+func TestBuildKeepsOldFileOnError(t *testing.T) {
+	dir := t.TempDir()
+	out := filepath.Join(dir, "breached.txt")
+	writeFile(t, out, hashOf("password")+":3\n")
+
+	// Неотсортированная выгрузка отклоняется целиком
+	source := filepath.Join(dir, "dump.txt")
+	writeFile(t, source, hashOf("qwerty")+":1\n"+hashOf("password")+":1\n")
+
+	if _, err := build(source, out, 1); err == nil {
+		t.Fatal("build accepted an unsorted dump")
+	}
+	checkCorpus(t, out, map[string]int{"password": 3})
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 {
+		t.Fatalf("temporary file was left behind: %v", entries)
+	}
+}
+
+func TestBuildRejectsMalformedLine(t *testing.T) {
+	dir := t.TempDir()
+	source := filepath.Join(dir, "dump.txt")
+	writeFile(t, source, hashOf("password")+"\n")
+
+	_, err := build(source, filepath.Join(dir, "breached.txt"), 1)
+	if err == nil || !strings.Contains(err.Error(), "dump.txt:1") {
+		t.Fatalf("err = %v, want an error pointing at dump.txt:1", err)
+	}
+}
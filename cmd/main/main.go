@@ -2,18 +2,35 @@ package main
 
 import (
 	authservice "auth/internal/auth-service"
+	"auth/internal/authz"
+	authzservice "auth/internal/authz-service"
 	"auth/internal/config"
+	"auth/internal/encryption"
+	"auth/internal/federation"
 	"auth/internal/kafka/kafka-writer/mock_writer"
+	"auth/internal/keyring"
+	"auth/internal/oauth"
 	passwordservice "auth/internal/password-service"
+	"auth/internal/passwordpolicy"
+	"auth/internal/ratelimit"
+	"auth/internal/redis"
 	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	"auth/internal/webauthn"
 	pb "auth/proto/auth"
+	pbauthz "auth/proto/authz"
 	pb2 "auth/proto/password"
 	"context"
+	"errors"
+	"fmt"
 	"log/slog"
 	"net"
+	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"time"
+
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/reflection"
 )
@@ -36,19 +53,105 @@ func main() {
 		os.Exit(1)
 	}
 
+	// Инициализация ключей подписи токенов. Ключ, сгенерированный в памяти,
+	// не виден другим экземплярам, поэтому без файла запускаемся только в
+	// режиме разработки
+	if cfg.JWTConfig.PrivateKeyPath == "" {
+		if !cfg.JWTConfig.EphemeralKeys {
+			logger.Error("jwt private_key_path is not set, set ephemeral_keys to run without it in development")
+			os.Exit(1)
+		}
+		logger.Warn("signing keys are generated in memory and are not shared between instances")
+	}
+	// Ротированный ключ тоже остается в памяти одного процесса: другие
+	// экземпляры и этот же после перезапуска его токены не примут
+	if cfg.JWTConfig.RotationInterval > 0 && !cfg.JWTConfig.EphemeralKeys {
+		logger.Error("jwt rotation_interval rotates keys in memory of one instance, set it to 0 and rotate private_key_path instead")
+		os.Exit(1)
+	}
+	keys, err := keyring.New(cfg.JWTConfig.Algorithm, cfg.JWTConfig.PrivateKeyPath, cfg.JWTConfig.KeyRetention, logger)
+	if err != nil {
+		logger.Error("failed to initialize signing keys", "error", err)
+		os.Exit(1)
+	}
+
+	// Ключ шифрования секретов второго фактора
+	if cfg.MFAConfig.EncryptionKey == "" {
+		logger.Error("mfa encryption key is not set, provide it in MFA_ENCRYPTION_KEY")
+		os.Exit(1)
+	}
+	cipher, err := encryption.NewCipher(cfg.MFAConfig.EncryptionKey)
+	if err != nil {
+		logger.Error("failed to initialize encryption", "error", err)
+		os.Exit(1)
+	}
+
+	// Инициализация Redis; без адреса работаем с хранилищем в памяти
+	var cache redis.Redis
+	if cfg.RedisConfig.RedisAddress != "" {
+		cache = redis.NewRedisImpl(cfg.RedisConfig.RedisAddress, cfg.RedisConfig.RedisPassword, cfg.RedisConfig.RedisDB)
+	} else {
+		logger.Warn("redis is not configured, using in-memory store")
+		cache = redis.NewInMemory()
+	}
+
+	// Настройки WebAuthn для входа по passkey
+	passkeys, err := webauthn.New(webauthn.Config{
+		RPID:             cfg.WebAuthnConfig.RPID,
+		RPName:           cfg.WebAuthnConfig.RPName,
+		Origins:          cfg.WebAuthnConfig.Origins,
+		UserVerification: cfg.WebAuthnConfig.UserVerification,
+	})
+	if err != nil {
+		logger.Error("failed to initialize webauthn", "error", err)
+		os.Exit(1)
+	}
+
+	// Схема отношений для проверки прав на уровне объектов
+	authzSchema, err := authz.NewSchema(cfg.AuthzConfig)
+	if err != nil {
+		logger.Error("failed to load authz schema", "error", err)
+		os.Exit(1)
+	}
+
 	// Создаем мок для кафки
 	mockKafkaWriter := mock_writer.MockKafkaWriterImpl{}
 
+	// Ограничение частоты вызовов; счетчики общие для реплик через Redis
+	limiter, err := ratelimit.New(cfg.RateLimitConfig, cache, logger)
+	if err != nil {
+		logger.Error("failed to initialize rate limiter", "error", err)
+		os.Exit(1)
+	}
+
+	// Политика паролей общая для сервиса аутентификации и сервиса паролей
+	passwords, err := passwordpolicy.New(cfg.PasswordPolicyConfig)
+	if err != nil {
+		logger.Error("failed to initialize password policy", "error", err)
+		os.Exit(1)
+	}
+	defer passwords.Close()
+
+	// Секрет, которым сервис аутентификации подтверждает вызовы ChangePassword
+	serviceToken, err := passwordservice.NewServiceToken()
+	if err != nil {
+		logger.Error("failed to generate service token", "error", err)
+		os.Exit(1)
+	}
+
 	// Инициализация gRPC серверов
-	authServer := grpc.NewServer()
-	passwordServer := grpc.NewServer()
+	authServer := grpc.NewServer(grpc.UnaryInterceptor(limiter.UnaryServerInterceptor))
+	passwordServer := grpc.NewServer(grpc.UnaryInterceptor(limiter.UnaryServerInterceptor))
 
 	// Инициализация сервисов
-	authService := authservice.NewGRPCServer(storage, logger)
-	passwordService := passwordservice.NewPasswordService(cfg, storage, &mockKafkaWriter) // Kafka writer можно добавить позже
+	tokenManager := token.NewManager(cfg, storage, keys, cache, logger)
+	authService := authservice.NewGRPCServer(cfg, storage, tokenManager, keys, &mockKafkaWriter, cipher, cache, passkeys, passwords, serviceToken, logger)
+	authzService := authzservice.NewAuthzService(authzSchema, storage, tokenManager, logger)
+	passwordService := passwordservice.NewPasswordService(cfg, storage, &mockKafkaWriter, passwords, serviceToken) // Kafka writer можно добавить позже
 
 	// Регистрация сервисов на gRPC серверах
 	pb.RegisterAuthServiceServer(authServer, authService)
+	pbauthz.RegisterAuthzServiceServer(authServer, authzService)
 	pb2.RegisterPasswordServiceServer(passwordServer, passwordService)
 
 	// Включение reflection для отладки
@@ -68,13 +171,28 @@ func main() {
 		os.Exit(1)
 	}
 
+	// HTTP сервер для публичных эндпоинтов
+	mux := http.NewServeMux()
+	mux.Handle("/.well-known/jwks.json", keys)
+	oauth.NewServer(cfg, storage, tokenManager, cache, logger).RegisterRoutes(mux)
+	federation.NewHandler(cfg, &http.Client{Timeout: 10 * time.Second}, storage, cache, authService, logger).RegisterRoutes(mux)
+
+	httpServer := &http.Server{
+		Addr:    fmt.Sprintf(":%d", cfg.HTTPServerConfig.HTTPServerPort),
+		Handler: mux,
+	}
+
 	// Контекст для управления жизненным циклом серверов
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	// Запуск gRPC серверов
+	// Плановая ротация ключей подписи
+	go keys.StartRotation(ctx, cfg.JWTConfig.RotationInterval)
+
+	// Запуск серверов
 	go startGRPCServer(ctx, authServer, authListener, logger, "auth", cancel)
 	go startGRPCServer(ctx, passwordServer, passwordListener, logger, "password", cancel)
+	go startHTTPServer(ctx, httpServer, logger, cancel)
 
 	// Обработка сигналов завершения
 	handleShutdownSignals(ctx, cancel, logger)
@@ -82,6 +200,9 @@ func main() {
 	// Грациозное завершение работы серверов
 	authServer.GracefulStop()
 	passwordServer.GracefulStop()
+	if err := httpServer.Shutdown(context.Background()); err != nil {
+		logger.Error("failed to shutdown http server", "error", err)
+	}
 }
 
 // startGRPCServer запускает gRPC сервер
@@ -93,6 +214,15 @@ func startGRPCServer(ctx context.Context, server *grpc.Server, listener net.List
 	}
 }
 
+// startHTTPServer запускает HTTP сервер
+func startHTTPServer(ctx context.Context, server *http.Server, logger *slog.Logger, cancel context.CancelFunc) {
+	logger.Info("starting HTTP server", "address", server.Addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.Error("failed to serve HTTP server", "error", err)
+		cancelFromContext(cancel)
+	}
+}
+
 // handleShutdownSignals обрабатывает сигналы завершения
 func handleShutdownSignals(ctx context.Context, cancel context.CancelFunc, logger *slog.Logger) {
 	sigCH := make(chan os.Signal, 1)
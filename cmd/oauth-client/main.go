@@ -0,0 +1,80 @@
+package main
+
+import (
+	"auth/internal/config"
+	"auth/internal/entity"
+	"auth/internal/oauth"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+)
+
+// Регистрация OAuth-клиента. Секрет выводится один раз, в базе хранится
+// только его хеш.
+func main() {
+	name := flag.String("name", "", "human readable client name shown on the consent page")
+	redirectURIs := flag.String("redirect-uris", "", "comma separated list of allowed redirect URIs")
+	grantTypes := flag.String("grant-types", oauth.GrantAuthorizationCode+","+oauth.GrantRefreshToken, "comma separated list of allowed grant types")
+	scopes := flag.String("scopes", "", "comma separated list of allowed scopes")
+	public := flag.Bool("public", false, "public client without a secret (SPA, mobile)")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig("config.yaml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	storage, err := postgres.NewStoragePostgres(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	clientID, err := token.RandomString(16)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	client := &entity.OAuthClient{
+		ClientID:     clientID,
+		Name:         *name,
+		RedirectURIs: list(*redirectURIs),
+		GrantTypes:   list(*grantTypes),
+		Scopes:       list(*scopes),
+		Public:       *public,
+	}
+
+	if strings.Contains(client.GrantTypes, oauth.GrantAuthorizationCode) && client.RedirectURIs == "" {
+		log.Fatal("authorization_code clients need at least one redirect URI")
+	}
+
+	var secret string
+	if !client.Public {
+		if secret, err = token.RandomString(32); err != nil {
+			log.Fatal(err)
+		}
+		client.SecretHash = token.Hash(secret)
+	}
+
+	if err := storage.SaveOAuthClient(client); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Println("client_id:", clientID)
+	if secret != "" {
+		fmt.Println("client_secret:", secret)
+	}
+}
+
+// list переводит список через запятую в формат хранения через пробел.
+func list(s string) string {
+	var items []string
+	for _, item := range strings.Split(s, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return strings.Join(items, " ")
+}
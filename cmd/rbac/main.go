@@ -0,0 +1,71 @@
+package main
+
+import (
+	"auth/internal/config"
+	"auth/internal/rbac"
+	"auth/internal/storage/postgres"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Начальная настройка ролей: создает роль (если ее нет) и назначает ее
+// пользователю. Нужна, чтобы выдать первое право roles:manage, дальше
+// роли управляются через RPC.
+func main() {
+	userName := flag.String("user", "", "username to assign the role to")
+	roleName := flag.String("role", "admin", "role name")
+	permissions := flag.String("permissions", rbac.PermissionManageRoles, "comma separated permissions for a new role")
+	flag.Parse()
+
+	if *userName == "" {
+		log.Fatal("-user is required")
+	}
+	if err := rbac.ValidateRoleName(*roleName); err != nil {
+		log.Fatal(err)
+	}
+
+	var perms []string
+	for _, permission := range strings.Split(*permissions, ",") {
+		if permission = strings.TrimSpace(permission); permission == "" {
+			continue
+		}
+		if err := rbac.ValidatePermission(permission); err != nil {
+			log.Fatalf("%s: %v", permission, err)
+		}
+		perms = append(perms, permission)
+	}
+
+	cfg, err := config.LoadConfig("config.yaml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	storage, err := postgres.NewStoragePostgres(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	user, err := storage.GetUserByUserName(*userName)
+	if err != nil {
+		log.Fatalf("failed to find user %q: %v", *userName, err)
+	}
+
+	role, err := storage.GetRoleByName(*roleName)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		role, err = storage.CreateRole(*roleName, "", perms)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if err := storage.AssignRole(user.ID, role.ID); err != nil {
+		log.Fatal(err)
+	}
+
+	fmt.Printf("role %s assigned to %s\n", role.Name, user.UserName)
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"auth/internal/audit"
+	"auth/internal/config"
+	"auth/internal/storage/postgres"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+const batchSize = 1000
+
+// Проверка цепочки журнала аудита. Печатает хеш последней записи; если
+// передать его через -anchor при следующем запуске, будет обнаружено и
+// удаление записей с конца журнала.
+func main() {
+	anchor := flag.String("anchor", "", "head hash from a previous run that must still be present in the chain")
+	flag.Parse()
+
+	cfg, err := config.LoadConfig("config.yaml")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	storage, err := postgres.NewStoragePostgres(cfg)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	verifier, err := VerifyAuditChain(storage, *anchor)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "audit chain is broken: %v\n", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("audit chain is intact: %d entries, last id %d, head %s\n", verifier.Checked(), verifier.LastID(), verifier.Head())
+}
+
+// VerifyAuditChain проходит журнал целиком по порядку записей.
+func VerifyAuditChain(storage postgres.Storage, anchor string) (*audit.Verifier, error) {
+	verifier := &audit.Verifier{}
+	anchorFound := anchor == ""
+
+	for {
+		entries, err := storage.AuditEntriesAfter(verifier.LastID(), batchSize)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read audit log: %w", err)
+		}
+		if err := verifier.Add(entries); err != nil {
+			return nil, err
+		}
+
+		for _, entry := range entries {
+			if entry.Hash == anchor {
+				anchorFound = true
+			}
+		}
+
+		if len(entries) < batchSize {
+			break
+		}
+	}
+
+	if !anchorFound {
+		return nil, fmt.Errorf("anchor %s is not in the chain, entries were removed", anchor)
+	}
+
+	return verifier, nil
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	"auth/internal/storage/postgres"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+// testChain возвращает цепочку из n записей.
+func testChain(n int) []entity.AuditEntry {
+	entries := make([]entity.AuditEntry, n)
+	prev := ""
+	for i := range entries {
+		entries[i] = entity.AuditEntry{
+			ID:        uint64(i + 1),
+			CreatedAt: time.Date(2024, 5, 1, 12, i, 0, 0, time.UTC),
+			Action:    audit.ActionLoginSuccess,
+			Result:    audit.ResultSuccess,
+			Details:   "{}",
+			PrevHash:  prev,
+		}
+		entries[i].Hash = audit.Hash(&entries[i])
+		prev = entries[i].Hash
+	}
+	return entries
+}
+
+// chainStorage отдает записи пачками, как AuditEntriesAfter в postgres.
+// Остальные методы хранилища не реализованы.
+type chainStorage struct {
+	postgres.Storage
+	entries []entity.AuditEntry
+	err     error
+	reads   int
+}
+
+func (c *chainStorage) AuditEntriesAfter(afterID uint64, limit int) ([]entity.AuditEntry, error) {
+	c.reads++
+	if c.err != nil {
+		return nil, c.err
+	}
+	var entries []entity.AuditEntry
+	for _, entry := range c.entries {
+		if entry.ID > afterID && len(entries) < limit {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, nil
+}
+
+func TestVerifyAuditChain(t *testing.T) {
+	entries := testChain(batchSize + 2)
+
+	tests := []struct {
+		name      string
+		entries   []entity.AuditEntry
+		anchor    string
+		wantReads int
+		wantErr   string
+	}{
+		{name: "empty", entries: nil, wantReads: 1},
+		{name: "several batches", entries: entries, wantReads: 2},
+		// Полная пачка не означает конец журнала
+		{name: "exactly one batch", entries: entries[:batchSize], wantReads: 2},
+		{name: "anchor in the chain", entries: entries, anchor: entries[10].Hash, wantReads: 2},
+		{name: "anchor is the head", entries: entries, anchor: entries[len(entries)-1].Hash, wantReads: 2},
+		// Записи удалены с конца вместе с якорем
+		{name: "anchor removed", entries: entries[:5], anchor: entries[10].Hash, wantErr: "anchor"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			storage := &chainStorage{entries: tt.entries}
+
+			verifier, err := VerifyAuditChain(storage, tt.anchor)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("error = %v, want %q", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("VerifyAuditChain: %v", err)
+			}
+			if verifier.Checked() != len(tt.entries) {
+				t.Fatalf("checked %d entries, want %d", verifier.Checked(), len(tt.entries))
+			}
+			if storage.reads != tt.wantReads {
+				t.Fatalf("read %d batches, want %d", storage.reads, tt.wantReads)
+			}
+		})
+	}
+}
+
+func TestVerifyAuditChainBroken(t *testing.T) {
+	entries := testChain(batchSize + 2)
+	entries[batchSize+1].Action = audit.ActionLogout
+
+	_, err := VerifyAuditChain(&chainStorage{entries: entries}, "")
+	var chainErr *audit.ChainError
+	if !errors.As(err, &chainErr) || chainErr.ID != batchSize+2 {
+		t.Fatalf("error = %v, want ChainError for entry %d", err, batchSize+2)
+	}
+}
+
+func TestVerifyAuditChainReadError(t *testing.T) {
+	storage := &chainStorage{err: errors.New("database is down")}
+
+	if _, err := VerifyAuditChain(storage, ""); err == nil || !strings.Contains(err.Error(), "database is down") {
+		t.Fatalf("error = %v", err)
+	}
+}
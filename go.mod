@@ -7,6 +7,7 @@ require (
 	github.com/segmentio/kafka-go v0.4.47
 	go.uber.org/dig v1.18.0
 	golang.org/x/crypto v0.28.0
+	google.golang.org/genproto/googleapis/rpc v0.0.0-20241015192408-796eee8c2d53
 	google.golang.org/grpc v1.69.0
 	google.golang.org/protobuf v1.36.0
 	gopkg.in/yaml.v2 v2.4.0
@@ -37,7 +38,6 @@ require (
 	github.com/stretchr/testify v1.10.0
 	golang.org/x/net v0.30.0 // indirect
 	golang.org/x/sys v0.26.0 // indirect
-	golang.org/x/text v0.19.0 // indirect
-	google.golang.org/genproto/googleapis/rpc v0.0.0-20241015192408-796eee8c2d53 // indirect
+	golang.org/x/text v0.19.0
 	gorm.io/driver/postgres v1.5.11
 )
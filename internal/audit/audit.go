@@ -0,0 +1,145 @@
+package audit
+
+import (
+	"auth/internal/entity"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log/slog"
+	"net"
+	"time"
+
+	"google.golang.org/grpc/peer"
+)
+
+// Действия, которые попадают в журнал.
+const (
+	ActionRegister         = "user.register"
+	ActionLoginSuccess     = "login.success"
+	ActionLoginFailure     = "login.failure"
+	ActionPasswordChange   = "password.change"
+	ActionPasswordReset    = "password.reset"
+	ActionLogout           = "token.logout"
+	ActionTokenRevoke      = "token.revoke"
+	ActionAPIKeyCreate     = "api_key.create"
+	ActionAPIKeyRevoke     = "api_key.revoke"
+	ActionRoleCreate       = "role.create"
+	ActionRoleAssign       = "role.assign"
+	ActionRoleUnassign     = "role.unassign"
+	ActionAccountUnlock    = "account.unlock"
+	ActionInvitationCreate = "invitation.create"
+	ActionInvitationRevoke = "invitation.revoke"
+	ActionRelationsWrite   = "relations.write"
+	ActionRelationsDelete  = "relations.delete"
+	ActionPermissionDenied = "permission.denied"
+)
+
+// Результаты действия.
+const (
+	ResultSuccess = "success"
+	ResultFailure = "failure"
+)
+
+// Store дописывает записи в конец цепочки.
+type Store interface {
+	AppendAuditEntry(entry *entity.AuditEntry, seal func(entry *entity.AuditEntry) string) error
+}
+
+// Event - действие для журнала. Нулевые ActorID и SubjectID означают, что
+// пользователь неизвестен; пустой Result - успех.
+type Event struct {
+	Action    string
+	ActorID   uint
+	SubjectID uint
+	Result    string
+	Details   map[string]string
+}
+
+// Log пишет события в журнал аудита. Ошибка записи логируется и не
+// прерывает само действие.
+type Log struct {
+	store  Store
+	logger *slog.Logger
+}
+
+func NewLog(store Store, logger *slog.Logger) *Log {
+	return &Log{store: store, logger: logger}
+}
+
+func (l *Log) Record(ctx context.Context, event Event) {
+	entry, err := newEntry(ctx, event)
+	if err != nil {
+		l.logger.Error("failed to build audit entry", "action", event.Action, "error", err)
+		return
+	}
+
+	if err := l.store.AppendAuditEntry(entry, Hash); err != nil {
+		l.logger.Error("failed to write audit entry", "action", event.Action, "error", err)
+	}
+}
+
+func newEntry(ctx context.Context, event Event) (*entity.AuditEntry, error) {
+	details := "{}"
+	if len(event.Details) > 0 {
+		data, err := json.Marshal(event.Details)
+		if err != nil {
+			return nil, err
+		}
+		details = string(data)
+	}
+
+	result := event.Result
+	if result == "" {
+		result = ResultSuccess
+	}
+
+	// Postgres хранит время с точностью до микросекунды, хеш должен
+	// считаться по тому же значению, что будет прочитано
+	return &entity.AuditEntry{
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+		Action:    event.Action,
+		ActorID:   optionalID(event.ActorID),
+		SubjectID: optionalID(event.SubjectID),
+		Result:    result,
+		IP:        peerIP(ctx),
+		Details:   details,
+	}, nil
+}
+
+// Hash считает хеш записи вместе с PrevHash.
+func Hash(entry *entity.AuditEntry) string {
+	// Массив JSON однозначно разделяет поля, порядок полей фиксирован
+	data, _ := json.Marshal([]any{
+		entry.PrevHash,
+		entry.CreatedAt.UnixMicro(),
+		entry.Action,
+		entry.ActorID,
+		entry.SubjectID,
+		entry.Result,
+		entry.IP,
+		entry.Details,
+	})
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func optionalID(id uint) *uint {
+	if id == 0 {
+		return nil
+	}
+	return &id
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return ""
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
@@ -0,0 +1,161 @@
+package audit
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/peer"
+)
+
+// memoryStore - цепочка в памяти, устроенная как в postgres.
+type memoryStore struct {
+	entries []entity.AuditEntry
+	err     error
+}
+
+func (m *memoryStore) AppendAuditEntry(entry *entity.AuditEntry, seal func(entry *entity.AuditEntry) string) error {
+	if m.err != nil {
+		return m.err
+	}
+	entry.ID = uint64(len(m.entries) + 1)
+	if len(m.entries) > 0 {
+		entry.PrevHash = m.entries[len(m.entries)-1].Hash
+	}
+	entry.Hash = seal(entry)
+	m.entries = append(m.entries, *entry)
+	return nil
+}
+
+func newTestLog(store Store) *Log {
+	return NewLog(store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+}
+
+func testEntry() entity.AuditEntry {
+	actor, subject := uint(1), uint(2)
+	return entity.AuditEntry{
+		CreatedAt: time.Date(2024, 5, 1, 12, 0, 0, 123456000, time.UTC),
+		Action:    ActionRoleAssign,
+		ActorID:   &actor,
+		SubjectID: &subject,
+		Result:    ResultSuccess,
+		IP:        "198.51.100.4",
+		Details:   `{"role":"admin"}`,
+		PrevHash:  "prev",
+	}
+}
+
+func TestHash(t *testing.T) {
+	base := testEntry()
+	want := Hash(&base)
+	if len(want) != 64 {
+		t.Fatalf("hash = %q, want hex sha256", want)
+	}
+
+	// ID и сам Hash в хеш не входят
+	same := testEntry()
+	same.ID, same.Hash = 42, "stored"
+	if Hash(&same) != want {
+		t.Fatal("hash depends on ID or Hash")
+	}
+
+	other := uint(3)
+	tests := []struct {
+		name   string
+		modify func(entry *entity.AuditEntry)
+	}{
+		{name: "prev hash", modify: func(entry *entity.AuditEntry) { entry.PrevHash = "other" }},
+		{name: "created at", modify: func(entry *entity.AuditEntry) { entry.CreatedAt = entry.CreatedAt.Add(time.Microsecond) }},
+		{name: "action", modify: func(entry *entity.AuditEntry) { entry.Action = ActionRoleUnassign }},
+		{name: "actor", modify: func(entry *entity.AuditEntry) { entry.ActorID = &other }},
+		{name: "no actor", modify: func(entry *entity.AuditEntry) { entry.ActorID = nil }},
+		{name: "subject", modify: func(entry *entity.AuditEntry) { entry.SubjectID = &other }},
+		{name: "result", modify: func(entry *entity.AuditEntry) { entry.Result = ResultFailure }},
+		{name: "ip", modify: func(entry *entity.AuditEntry) { entry.IP = "203.0.113.9" }},
+		{name: "details", modify: func(entry *entity.AuditEntry) { entry.Details = `{"role":"owner"}` }},
+		// Границы полей не сдвигаются: "a"+"bc" и "ab"+"c" дают разные хеши
+		{name: "shifted boundary", modify: func(entry *entity.AuditEntry) { entry.IP, entry.Details = "198.51.100.4{", `"role":"admin"}` }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entry := testEntry()
+			tt.modify(&entry)
+			if Hash(&entry) == want {
+				t.Fatal("hash did not change")
+			}
+		})
+	}
+}
+
+func TestRecord(t *testing.T) {
+	store := &memoryStore{}
+	log := newTestLog(store)
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("198.51.100.4"), Port: 40000}})
+
+	log.Record(ctx, Event{Action: ActionRoleAssign, ActorID: 1, SubjectID: 2, Details: map[string]string{"role": "admin"}})
+	log.Record(context.Background(), Event{Action: ActionLoginFailure, Result: ResultFailure})
+
+	if len(store.entries) != 2 {
+		t.Fatalf("got %d entries, want 2", len(store.entries))
+	}
+	first, second := store.entries[0], store.entries[1]
+
+	if first.Result != ResultSuccess || first.IP != "198.51.100.4" || first.Details != `{"role":"admin"}` {
+		t.Fatalf("first entry = %+v", first)
+	}
+	if first.ActorID == nil || *first.ActorID != 1 || first.SubjectID == nil || *first.SubjectID != 2 {
+		t.Fatalf("first entry ids = %v, %v", first.ActorID, first.SubjectID)
+	}
+	if !first.CreatedAt.Equal(first.CreatedAt.Truncate(time.Microsecond)) || first.CreatedAt.Location() != time.UTC {
+		t.Fatalf("created at = %v, want UTC with microsecond precision", first.CreatedAt)
+	}
+
+	// Неизвестный пользователь хранится как NULL, пустые детали - как объект
+	if second.ActorID != nil || second.SubjectID != nil || second.IP != "" || second.Details != "{}" || second.Result != ResultFailure {
+		t.Fatalf("second entry = %+v", second)
+	}
+	if second.PrevHash != first.Hash || second.Hash != Hash(&second) {
+		t.Fatal("second entry is not chained to the first")
+	}
+}
+
+func TestRecordStoreError(t *testing.T) {
+	store := &memoryStore{err: errors.New("database is down")}
+
+	// Ошибка записи не прерывает действие
+	newTestLog(store).Record(context.Background(), Event{Action: ActionLogout})
+	if len(store.entries) != 0 {
+		t.Fatalf("entries = %v", store.entries)
+	}
+}
+
+func TestPeerIP(t *testing.T) {
+	tests := []struct {
+		name string
+		addr net.Addr
+		want string
+	}{
+		{name: "ipv4", addr: &net.TCPAddr{IP: net.ParseIP("198.51.100.4"), Port: 40000}, want: "198.51.100.4"},
+		{name: "ipv6", addr: &net.TCPAddr{IP: net.ParseIP("2001:db8::1"), Port: 40000}, want: "2001:db8::1"},
+		{name: "without port", addr: &net.UnixAddr{Name: "/run/auth.sock", Net: "unix"}, want: "/run/auth.sock"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: tt.addr})
+			if got := peerIP(ctx); got != tt.want {
+				t.Fatalf("peerIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	if got := peerIP(context.Background()); got != "" {
+		t.Fatalf("peerIP without peer = %q", got)
+	}
+}
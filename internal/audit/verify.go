@@ -0,0 +1,56 @@
+package audit
+
+import (
+	"auth/internal/entity"
+	"fmt"
+)
+
+// ChainError - первая запись, на которой цепочка не сходится.
+type ChainError struct {
+	ID     uint64
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	return fmt.Sprintf("audit entry %d: %s", e.ID, e.Reason)
+}
+
+// Verifier проверяет цепочку по частям, в порядке записей.
+type Verifier struct {
+	head    string
+	lastID  uint64
+	checked int
+}
+
+// Add проверяет очередные записи: каждая должна ссылаться на хеш
+// предыдущей, а ее хеш - совпадать с пересчитанным.
+func (v *Verifier) Add(entries []entity.AuditEntry) error {
+	for i := range entries {
+		entry := &entries[i]
+		if entry.PrevHash != v.head {
+			return &ChainError{ID: entry.ID, Reason: "previous hash does not match, an entry was removed or reordered"}
+		}
+		if Hash(entry) != entry.Hash {
+			return &ChainError{ID: entry.ID, Reason: "hash does not match, the entry was modified"}
+		}
+
+		v.head = entry.Hash
+		v.lastID = entry.ID
+		v.checked++
+	}
+	return nil
+}
+
+// Head - хеш последней проверенной записи. Сохраненный снаружи, он
+// позволяет позже обнаружить удаление записей с конца журнала.
+func (v *Verifier) Head() string {
+	return v.head
+}
+
+func (v *Verifier) LastID() uint64 {
+	return v.lastID
+}
+
+func (v *Verifier) Checked() int {
+	return v.checked
+}
@@ -0,0 +1,116 @@
+package audit
+
+import (
+	"auth/internal/entity"
+	"context"
+	"errors"
+	"testing"
+)
+
+// testChain возвращает цепочку из n записей.
+func testChain(t *testing.T, n int) []entity.AuditEntry {
+	t.Helper()
+	store := &memoryStore{}
+	log := newTestLog(store)
+	for i := range n {
+		log.Record(context.Background(), Event{Action: ActionLoginSuccess, ActorID: uint(i + 1)})
+	}
+	if len(store.entries) != n {
+		t.Fatalf("got %d entries, want %d", len(store.entries), n)
+	}
+	return store.entries
+}
+
+func TestVerifierIntact(t *testing.T) {
+	entries := testChain(t, 5)
+
+	// Цепочку можно проверять частями
+	verifier := &Verifier{}
+	for _, batch := range [][]entity.AuditEntry{entries[:2], entries[2:2], entries[2:]} {
+		if err := verifier.Add(batch); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+
+	if verifier.Checked() != 5 || verifier.LastID() != 5 || verifier.Head() != entries[4].Hash {
+		t.Fatalf("checked %d, last id %d, head %s", verifier.Checked(), verifier.LastID(), verifier.Head())
+	}
+}
+
+func TestVerifierDetectsTampering(t *testing.T) {
+	tests := []struct {
+		name   string
+		tamper func(entries []entity.AuditEntry) []entity.AuditEntry
+		wantID uint64
+	}{
+		{
+			name: "modified field",
+			tamper: func(entries []entity.AuditEntry) []entity.AuditEntry {
+				entries[2].Result = ResultFailure
+				return entries
+			},
+			wantID: 3,
+		},
+		{
+			// Пересчитанный хеш не спасает: следующая запись ссылается на старый
+			name: "modified and resealed",
+			tamper: func(entries []entity.AuditEntry) []entity.AuditEntry {
+				entries[2].Action = ActionLogout
+				entries[2].Hash = Hash(&entries[2])
+				return entries
+			},
+			wantID: 4,
+		},
+		{
+			name: "removed entry",
+			tamper: func(entries []entity.AuditEntry) []entity.AuditEntry {
+				return append(entries[:1], entries[2:]...)
+			},
+			wantID: 3,
+		},
+		{
+			name: "reordered entries",
+			tamper: func(entries []entity.AuditEntry) []entity.AuditEntry {
+				entries[1], entries[2] = entries[2], entries[1]
+				return entries
+			},
+			wantID: 3,
+		},
+		{
+			name: "removed head",
+			tamper: func(entries []entity.AuditEntry) []entity.AuditEntry {
+				return entries[1:]
+			},
+			wantID: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			entries := tt.tamper(testChain(t, 5))
+
+			err := (&Verifier{}).Add(entries)
+			var chainErr *ChainError
+			if !errors.As(err, &chainErr) {
+				t.Fatalf("Add error = %v, want ChainError", err)
+			}
+			if chainErr.ID != tt.wantID {
+				t.Fatalf("broken entry = %d, want %d (%v)", chainErr.ID, tt.wantID, err)
+			}
+		})
+	}
+}
+
+func TestVerifierStopsAtBrokenEntry(t *testing.T) {
+	entries := testChain(t, 4)
+	entries[2].IP = "203.0.113.9"
+
+	verifier := &Verifier{}
+	if err := verifier.Add(entries); err == nil {
+		t.Fatal("Add accepted a modified entry")
+	}
+	// Состояние остается на последней верной записи
+	if verifier.Checked() != 2 || verifier.LastID() != 2 || verifier.Head() != entries[1].Hash {
+		t.Fatalf("checked %d, last id %d", verifier.Checked(), verifier.LastID())
+	}
+}
@@ -0,0 +1,297 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	apiKeyPrefix = "ak_"
+	// 4 байта префикса дают 8 hex символов, по ним ключ узнают в списке
+	apiKeyPrefixSize = 4
+	apiKeySecretSize = 32
+
+	// Лимит действует в каждой организации пользователя отдельно
+	maxAPIKeysPerUser   = 25
+	maxAPIKeyScopes     = 20
+	maxAPIKeyNameLen    = 100
+	maxAPIKeyScopeLen   = 64
+	apiKeyTouchInterval = time.Minute
+)
+
+// CreateAPIKey создает ключ в активной организации пользователя.
+func (s *AuthService) CreateAPIKey(ctx context.Context, req *pb.CreateAPIKeyRequest) (*pb.CreateAPIKeyResponse, error) {
+	user, claims, err := s.currentUserClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.GetName())
+	if name == "" || len(name) > maxAPIKeyNameLen {
+		return nil, status.Errorf(codes.InvalidArgument, "name must be between 1 and %d characters", maxAPIKeyNameLen)
+	}
+	if req.GetExpiresIn() < 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "expires_in must not be negative")
+	}
+
+	scopes, err := normalizeAPIKeyScopes(req.GetScopes())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	keys, err := s.storage.ListAPIKeys(user.ID, claims.OrganizationID())
+	if err != nil {
+		s.logger.Error("failed to list api keys", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to create api key")
+	}
+	active := 0
+	for _, key := range keys {
+		if apiKeyActive(&key) {
+			active++
+		}
+	}
+	if active >= maxAPIKeysPerUser {
+		return nil, status.Errorf(codes.ResourceExhausted, "too many api keys, revoke unused ones first")
+	}
+
+	prefix, secret, err := newAPIKey()
+	if err != nil {
+		s.logger.Error("failed to generate api key", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to create api key")
+	}
+
+	key := &entity.APIKey{
+		UserID:         user.ID,
+		OrganizationID: claims.OrganizationID(),
+		Name:           name,
+		Prefix:         prefix,
+		KeyHash:        token.Hash(secret),
+		Scopes:         strings.Join(scopes, " "),
+	}
+	if req.GetExpiresIn() > 0 {
+		expiresAt := time.Now().Add(time.Duration(req.GetExpiresIn()) * time.Second)
+		key.ExpiresAt = &expiresAt
+	}
+
+	if err := s.storage.SaveAPIKey(key); err != nil {
+		s.logger.Error("failed to save api key", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to create api key")
+	}
+
+	if err := s.sendNotificationEvent(user.Email, "a new api key was created", map[string]string{
+		"type":   "api_key_created",
+		"name":   key.Name,
+		"prefix": key.Prefix,
+	}); err != nil {
+		s.logger.Warn("failed to send notification", "error", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:    audit.ActionAPIKeyCreate,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Details:   map[string]string{"prefix": key.Prefix},
+	})
+	s.logger.Info("api key created", "user_id", user.ID, "prefix", key.Prefix)
+	return &pb.CreateAPIKeyResponse{
+		Key:    secret,
+		ApiKey: apiKeyToProto(key),
+	}, nil
+}
+
+// ListAPIKeys возвращает ключи, созданные в активной организации.
+func (s *AuthService) ListAPIKeys(ctx context.Context, req *pb.ListAPIKeysRequest) (*pb.ListAPIKeysResponse, error) {
+	user, claims, err := s.currentUserClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keys, err := s.storage.ListAPIKeys(user.ID, claims.OrganizationID())
+	if err != nil {
+		s.logger.Error("failed to list api keys", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to list api keys")
+	}
+
+	response := &pb.ListAPIKeysResponse{ApiKeys: make([]*pb.APIKey, 0, len(keys))}
+	for i := range keys {
+		response.ApiKeys = append(response.ApiKeys, apiKeyToProto(&keys[i]))
+	}
+
+	return response, nil
+}
+
+// RevokeAPIKey отзывает ключ активной организации; ключ другой организации
+// не найден так же, как чужой.
+func (s *AuthService) RevokeAPIKey(ctx context.Context, req *pb.RevokeAPIKeyRequest) (*pb.RevokeAPIKeyResponse, error) {
+	user, claims, err := s.currentUserClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.RevokeAPIKey(user.ID, claims.OrganizationID(), uint(req.GetId())); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Errorf(codes.NotFound, "api key not found")
+		}
+		s.logger.Error("failed to revoke api key", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to revoke api key")
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:    audit.ActionAPIKeyRevoke,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Details:   map[string]string{"key_id": strconv.FormatUint(req.GetId(), 10)},
+	})
+	s.logger.Info("api key revoked", "user_id", user.ID, "key_id", req.GetId())
+	return &pb.RevokeAPIKeyResponse{Message: "api key revoked"}, nil
+}
+
+// ValidateAPIKey проверяет ключ и возвращает его владельца. Как и
+// ValidateToken, на неверный ключ отвечает Valid: false и Unauthenticated.
+func (s *AuthService) ValidateAPIKey(ctx context.Context, req *pb.ValidateAPIKeyRequest) (*pb.ValidateAPIKeyResponse, error) {
+	if !strings.HasPrefix(req.GetApiKey(), apiKeyPrefix) {
+		return &pb.ValidateAPIKeyResponse{Valid: false}, status.Errorf(codes.Unauthenticated, "invalid api key")
+	}
+
+	key, err := s.storage.GetAPIKeyByHash(token.Hash(req.GetApiKey()))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Warn("unknown api key")
+			return &pb.ValidateAPIKeyResponse{Valid: false}, status.Errorf(codes.Unauthenticated, "invalid api key")
+		}
+		s.logger.Error("failed to get api key", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to validate api key")
+	}
+
+	if !apiKeyActive(key) {
+		s.logger.Warn("inactive api key", "prefix", key.Prefix)
+		return &pb.ValidateAPIKeyResponse{Valid: false}, status.Errorf(codes.Unauthenticated, "invalid api key")
+	}
+
+	user, err := s.storage.GetUserByID(key.UserID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return &pb.ValidateAPIKeyResponse{Valid: false}, status.Errorf(codes.Unauthenticated, "invalid api key")
+		}
+		s.logger.Error("failed to get user", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to validate api key")
+	}
+
+	// Ключ организации перестает действовать вместе с членством
+	if key.OrganizationID != 0 {
+		if _, err := s.storage.GetMembership(key.OrganizationID, user.ID); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				s.logger.Warn("api key owner left organization", "prefix", key.Prefix)
+				return &pb.ValidateAPIKeyResponse{Valid: false}, status.Errorf(codes.Unauthenticated, "invalid api key")
+			}
+			s.logger.Error("failed to get membership", "error", err)
+			return nil, status.Errorf(codes.Internal, "failed to validate api key")
+		}
+	}
+
+	// Время последнего использования пишем не чаще раза в минуту, чтобы
+	// частые вызовы не превращались в запись на каждый запрос
+	if key.LastUsedAt == nil || time.Since(*key.LastUsedAt) > apiKeyTouchInterval {
+		if err := s.storage.TouchAPIKey(key.ID); err != nil {
+			s.logger.Warn("failed to update api key last use", "error", err)
+		}
+	}
+
+	response := &pb.ValidateAPIKeyResponse{
+		Valid:    true,
+		Username: user.UserName,
+		UserId:   strconv.FormatUint(uint64(user.ID), 10),
+		Email:    user.Email,
+		Scopes:   strings.Fields(key.Scopes),
+		KeyId:    uint64(key.ID),
+	}
+	if key.ExpiresAt != nil {
+		response.ExpiresAt = key.ExpiresAt.Unix()
+	}
+	if key.OrganizationID != 0 {
+		response.OrganizationId = strconv.FormatUint(uint64(key.OrganizationID), 10)
+	}
+
+	return response, nil
+}
+
+// newAPIKey возвращает видимый префикс и полный ключ вида ak_<prefix>_<secret>.
+func newAPIKey() (string, string, error) {
+	b := make([]byte, apiKeyPrefixSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", "", err
+	}
+	prefix := apiKeyPrefix + hex.EncodeToString(b)
+
+	secret, err := token.RandomString(apiKeySecretSize)
+	if err != nil {
+		return "", "", err
+	}
+
+	return prefix, prefix + "_" + secret, nil
+}
+
+// normalizeAPIKeyScopes убирает повторы; scope не может содержать пробелы,
+// так как в базе они хранятся через пробел.
+func normalizeAPIKeyScopes(scopes []string) ([]string, error) {
+	if len(scopes) > maxAPIKeyScopes {
+		return nil, errors.New("too many scopes")
+	}
+
+	seen := make(map[string]struct{}, len(scopes))
+	normalized := make([]string, 0, len(scopes))
+	for _, scope := range scopes {
+		scope = strings.TrimSpace(scope)
+		if scope == "" || len(scope) > maxAPIKeyScopeLen || strings.ContainsAny(scope, " \t\r\n") {
+			return nil, errors.New("invalid scope " + strconv.Quote(scope))
+		}
+		if _, ok := seen[scope]; ok {
+			continue
+		}
+		seen[scope] = struct{}{}
+		normalized = append(normalized, scope)
+	}
+
+	return normalized, nil
+}
+
+func apiKeyActive(key *entity.APIKey) bool {
+	if key.RevokedAt != nil {
+		return false
+	}
+	return key.ExpiresAt == nil || time.Now().Before(*key.ExpiresAt)
+}
+
+func apiKeyToProto(key *entity.APIKey) *pb.APIKey {
+	result := &pb.APIKey{
+		Id:        uint64(key.ID),
+		Name:      key.Name,
+		Prefix:    key.Prefix,
+		Scopes:    strings.Fields(key.Scopes),
+		CreatedAt: key.CreatedAt.Unix(),
+		Revoked:   key.RevokedAt != nil,
+	}
+	if key.ExpiresAt != nil {
+		result.ExpiresAt = key.ExpiresAt.Unix()
+	}
+	if key.LastUsedAt != nil {
+		result.LastUsedAt = key.LastUsedAt.Unix()
+	}
+	if key.OrganizationID != 0 {
+		result.OrganizationId = strconv.FormatUint(uint64(key.OrganizationID), 10)
+	}
+	return result
+}
@@ -0,0 +1,305 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+var apiKeyFormat = regexp.MustCompile(`^(ak_[0-9a-f]{8})_[A-Za-z0-9_-]+$`)
+
+// createAPIKey создает ключ от имени пользователя и возвращает его целиком.
+func createAPIKey(t *testing.T, s *testService, user *entity.User, scopes ...string) *pb.CreateAPIKeyResponse {
+	t.Helper()
+	created, err := s.CreateAPIKey(s.authorized(t, user), &pb.CreateAPIKeyRequest{Name: "ci", Scopes: scopes})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+	return created
+}
+
+func TestCreateAPIKey(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	ctx := s.authorized(t, user)
+
+	created, err := s.CreateAPIKey(ctx, &pb.CreateAPIKeyRequest{
+		Name:      "  deploy  ",
+		Scopes:    []string{"reports:read", " reports:write ", "reports:read"},
+		ExpiresIn: 3600,
+	})
+	if err != nil {
+		t.Fatalf("CreateAPIKey: %v", err)
+	}
+
+	match := apiKeyFormat.FindStringSubmatch(created.GetKey())
+	if match == nil {
+		t.Fatalf("key %q does not match ak_<prefix>_<secret>", created.GetKey())
+	}
+	key := created.GetApiKey()
+	if key.GetPrefix() != match[1] || key.GetName() != "deploy" {
+		t.Fatalf("api key = %v", key)
+	}
+	if want := []string{"reports:read", "reports:write"}; !slices.Equal(key.GetScopes(), want) {
+		t.Fatalf("scopes = %v, want %v", key.GetScopes(), want)
+	}
+	if key.GetExpiresAt() == 0 {
+		t.Fatal("expires_at is not set")
+	}
+
+	// Хранится только хеш ключа
+	stored, err := s.storage.GetAPIKeyByHash(token.Hash(created.GetKey()))
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash: %v", err)
+	}
+	if strings.Contains(stored.KeyHash, created.GetKey()) {
+		t.Fatal("api key is stored in plain text")
+	}
+
+	listed, err := s.ListAPIKeys(ctx, &pb.ListAPIKeysRequest{})
+	if err != nil {
+		t.Fatalf("ListAPIKeys: %v", err)
+	}
+	if len(listed.GetApiKeys()) != 1 || listed.GetApiKeys()[0].GetPrefix() != key.GetPrefix() {
+		t.Fatalf("ListAPIKeys = %v", listed.GetApiKeys())
+	}
+
+	if s.writer.last(t, "api_key_created")["prefix"] != key.GetPrefix() {
+		t.Fatal("notification does not name the key prefix")
+	}
+	if !slices.Contains(s.storage.auditActions(), audit.ActionAPIKeyCreate) {
+		t.Fatalf("audit actions = %v, want %s", s.storage.auditActions(), audit.ActionAPIKeyCreate)
+	}
+}
+
+func TestCreateAPIKeyRejects(t *testing.T) {
+	tooManyScopes := make([]string, maxAPIKeyScopes+1)
+	for i := range tooManyScopes {
+		tooManyScopes[i] = "scope" + strconv.Itoa(i)
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.CreateAPIKeyRequest
+	}{
+		{name: "empty name", req: &pb.CreateAPIKeyRequest{Name: "   "}},
+		{name: "long name", req: &pb.CreateAPIKeyRequest{Name: strings.Repeat("n", maxAPIKeyNameLen+1)}},
+		{name: "negative expiry", req: &pb.CreateAPIKeyRequest{Name: "ci", ExpiresIn: -1}},
+		{name: "empty scope", req: &pb.CreateAPIKeyRequest{Name: "ci", Scopes: []string{" "}}},
+		{name: "scope with space", req: &pb.CreateAPIKeyRequest{Name: "ci", Scopes: []string{"reports read"}}},
+		{name: "long scope", req: &pb.CreateAPIKeyRequest{Name: "ci", Scopes: []string{strings.Repeat("s", maxAPIKeyScopeLen+1)}}},
+		{name: "too many scopes", req: &pb.CreateAPIKeyRequest{Name: "ci", Scopes: tooManyScopes}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			user := s.addUser(t, "alice", true)
+
+			_, err := s.CreateAPIKey(s.authorized(t, user), tt.req)
+			requireCode(t, err, codes.InvalidArgument)
+		})
+	}
+}
+
+func TestCreateAPIKeyLimit(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	ctx := s.authorized(t, user)
+
+	var first *pb.CreateAPIKeyResponse
+	for i := range maxAPIKeysPerUser {
+		created := createAPIKey(t, s, user)
+		if i == 0 {
+			first = created
+		}
+	}
+
+	_, err := s.CreateAPIKey(ctx, &pb.CreateAPIKeyRequest{Name: "one more"})
+	requireCode(t, err, codes.ResourceExhausted)
+
+	// Отозванные ключи в лимит не входят
+	if _, err := s.RevokeAPIKey(ctx, &pb.RevokeAPIKeyRequest{Id: first.GetApiKey().GetId()}); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	if _, err := s.CreateAPIKey(ctx, &pb.CreateAPIKeyRequest{Name: "one more"}); err != nil {
+		t.Fatalf("CreateAPIKey after revoke: %v", err)
+	}
+}
+
+func TestValidateAPIKey(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	created := createAPIKey(t, s, user, "reports:read")
+
+	response, err := s.ValidateAPIKey(context.Background(), &pb.ValidateAPIKeyRequest{ApiKey: created.GetKey()})
+	if err != nil {
+		t.Fatalf("ValidateAPIKey: %v", err)
+	}
+	if !response.GetValid() || response.GetUsername() != user.UserName || response.GetUserId() != strconv.FormatUint(uint64(user.ID), 10) {
+		t.Fatalf("ValidateAPIKey = %v", response)
+	}
+	if !slices.Equal(response.GetScopes(), []string{"reports:read"}) || response.GetKeyId() != created.GetApiKey().GetId() {
+		t.Fatalf("ValidateAPIKey = %v", response)
+	}
+
+	stored, err := s.storage.GetAPIKeyByHash(token.Hash(created.GetKey()))
+	if err != nil {
+		t.Fatalf("GetAPIKeyByHash: %v", err)
+	}
+	if stored.LastUsedAt == nil {
+		t.Fatal("last use is not recorded")
+	}
+}
+
+func TestValidateAPIKeyRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		key  func(t *testing.T, s *testService, user *entity.User) string
+	}{
+		{
+			name: "no prefix",
+			key: func(t *testing.T, s *testService, user *entity.User) string {
+				return strings.TrimPrefix(createAPIKey(t, s, user).GetKey(), apiKeyPrefix)
+			},
+		},
+		{
+			name: "unknown key",
+			key: func(t *testing.T, s *testService, user *entity.User) string {
+				return apiKeyPrefix + "00000000_unknown"
+			},
+		},
+		{
+			name: "modified secret",
+			key: func(t *testing.T, s *testService, user *entity.User) string {
+				return createAPIKey(t, s, user).GetKey() + "x"
+			},
+		},
+		{
+			name: "revoked key",
+			key: func(t *testing.T, s *testService, user *entity.User) string {
+				created := createAPIKey(t, s, user)
+				if _, err := s.RevokeAPIKey(s.authorized(t, user), &pb.RevokeAPIKeyRequest{Id: created.GetApiKey().GetId()}); err != nil {
+					t.Fatalf("RevokeAPIKey: %v", err)
+				}
+				return created.GetKey()
+			},
+		},
+		{
+			name: "expired key",
+			key: func(t *testing.T, s *testService, user *entity.User) string {
+				created := createAPIKey(t, s, user)
+				s.storage.expireAPIKey(uint(created.GetApiKey().GetId()))
+				return created.GetKey()
+			},
+		},
+		{
+			name: "owner left the organization",
+			key: func(t *testing.T, s *testService, user *entity.User) string {
+				s.storage.addMembership(7, user.ID, "member")
+				created := createAPIKey(t, s, user)
+				if created.GetApiKey().GetOrganizationId() != "7" {
+					t.Fatalf("organization_id = %q, want 7", created.GetApiKey().GetOrganizationId())
+				}
+				s.storage.removeMembership(7, user.ID)
+				return created.GetKey()
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			user := s.addUser(t, "alice", true)
+
+			response, err := s.ValidateAPIKey(context.Background(), &pb.ValidateAPIKeyRequest{ApiKey: tt.key(t, s, user)})
+			requireCode(t, err, codes.Unauthenticated)
+			if response.GetValid() {
+				t.Fatal("Valid = true for a rejected key")
+			}
+		})
+	}
+}
+
+func TestRevokeAPIKey(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	bob := s.addUser(t, "bob", true)
+	created := createAPIKey(t, s, alice)
+	id := created.GetApiKey().GetId()
+
+	// Чужой ключ не отзывается и не раскрывается
+	_, err := s.RevokeAPIKey(s.authorized(t, bob), &pb.RevokeAPIKeyRequest{Id: id})
+	requireCode(t, err, codes.NotFound)
+	if _, err := s.ValidateAPIKey(context.Background(), &pb.ValidateAPIKeyRequest{ApiKey: created.GetKey()}); err != nil {
+		t.Fatalf("key revoked by another user: %v", err)
+	}
+
+	ctx := s.authorized(t, alice)
+	if _, err := s.RevokeAPIKey(ctx, &pb.RevokeAPIKeyRequest{Id: id}); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+	_, err = s.RevokeAPIKey(ctx, &pb.RevokeAPIKeyRequest{Id: id})
+	requireCode(t, err, codes.NotFound)
+
+	listed, err := s.ListAPIKeys(ctx, &pb.ListAPIKeysRequest{})
+	if err != nil {
+		t.Fatalf("ListAPIKeys: %v", err)
+	}
+	if len(listed.GetApiKeys()) != 1 || !listed.GetApiKeys()[0].GetRevoked() {
+		t.Fatalf("ListAPIKeys = %v, want one revoked key", listed.GetApiKeys())
+	}
+	if !slices.Contains(s.storage.auditActions(), audit.ActionAPIKeyRevoke) {
+		t.Fatalf("audit actions = %v, want %s", s.storage.auditActions(), audit.ActionAPIKeyRevoke)
+	}
+}
+
+func TestAPIKeysScopedToOrganization(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	s.storage.addMembership(7, alice.ID, "member")
+	s.storage.addMembership(8, alice.ID, "member")
+
+	contexts := map[uint]context.Context{
+		0: s.authorizedIn(t, alice, 0),
+		7: s.authorizedIn(t, alice, 7),
+		8: s.authorizedIn(t, alice, 8),
+	}
+	created := make(map[uint]*pb.APIKey)
+	for organizationID, ctx := range contexts {
+		response, err := s.CreateAPIKey(ctx, &pb.CreateAPIKeyRequest{Name: "ci"})
+		if err != nil {
+			t.Fatalf("CreateAPIKey in %d: %v", organizationID, err)
+		}
+		created[organizationID] = response.GetApiKey()
+	}
+
+	// Каждая организация видит только свои ключи
+	for organizationID, ctx := range contexts {
+		listed, err := s.ListAPIKeys(ctx, &pb.ListAPIKeysRequest{})
+		if err != nil {
+			t.Fatalf("ListAPIKeys in %d: %v", organizationID, err)
+		}
+		if len(listed.GetApiKeys()) != 1 || listed.GetApiKeys()[0].GetId() != created[organizationID].GetId() {
+			t.Fatalf("ListAPIKeys in %d = %v, want only %v", organizationID, listed.GetApiKeys(), created[organizationID])
+		}
+	}
+
+	// Ключ другой организации не отзывается
+	for _, from := range []uint{0, 8} {
+		_, err := s.RevokeAPIKey(contexts[from], &pb.RevokeAPIKeyRequest{Id: created[7].GetId()})
+		requireCode(t, err, codes.NotFound)
+	}
+	if _, err := s.RevokeAPIKey(contexts[7], &pb.RevokeAPIKeyRequest{Id: created[7].GetId()}); err != nil {
+		t.Fatalf("RevokeAPIKey: %v", err)
+	}
+}
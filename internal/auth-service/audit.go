@@ -0,0 +1,96 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	"auth/internal/rbac"
+	pb "auth/proto/auth"
+	"context"
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	defaultAuditPageSize = 100
+	maxAuditPageSize     = 500
+)
+
+// QueryAuditLog возвращает записи журнала аудита от новых к старым.
+func (s *AuthService) QueryAuditLog(ctx context.Context, req *pb.QueryAuditLogRequest) (*pb.QueryAuditLogResponse, error) {
+	if _, err := s.requirePermission(ctx, rbac.PermissionReadAudit); err != nil {
+		return nil, err
+	}
+
+	filter := entity.AuditFilter{Action: req.GetAction()}
+	var err error
+	if req.GetActorId() != "" {
+		if filter.ActorID, err = parseID(req.GetActorId()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid actor_id")
+		}
+	}
+	if req.GetSubjectId() != "" {
+		if filter.SubjectID, err = parseID(req.GetSubjectId()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid subject_id")
+		}
+	}
+	if req.GetSince() > 0 {
+		filter.Since = time.Unix(req.GetSince(), 0)
+	}
+	if req.GetUntil() > 0 {
+		filter.Until = time.Unix(req.GetUntil(), 0)
+	}
+
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultAuditPageSize
+	}
+	pageSize = min(pageSize, maxAuditPageSize)
+
+	var beforeID uint64
+	if req.GetPageToken() != "" {
+		if beforeID, err = strconv.ParseUint(req.GetPageToken(), 10, 64); err != nil || beforeID == 0 {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid page_token")
+		}
+	}
+
+	entries, err := s.storage.ListAuditEntries(filter, beforeID, pageSize)
+	if err != nil {
+		s.logger.Error("failed to list audit entries", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to query audit log")
+	}
+
+	response := &pb.QueryAuditLogResponse{Entries: make([]*pb.AuditEntry, 0, len(entries))}
+	for i := range entries {
+		response.Entries = append(response.Entries, auditEntryToProto(&entries[i]))
+	}
+	if len(entries) == pageSize {
+		response.NextPageToken = strconv.FormatUint(entries[len(entries)-1].ID, 10)
+	}
+
+	return response, nil
+}
+
+func auditEntryToProto(entry *entity.AuditEntry) *pb.AuditEntry {
+	result := &pb.AuditEntry{
+		Id:        strconv.FormatUint(entry.ID, 10),
+		CreatedAt: entry.CreatedAt.Unix(),
+		Action:    entry.Action,
+		Result:    entry.Result,
+		Ip:        entry.IP,
+		PrevHash:  entry.PrevHash,
+		Hash:      entry.Hash,
+	}
+	if entry.ActorID != nil {
+		result.ActorId = strconv.FormatUint(uint64(*entry.ActorID), 10)
+	}
+	if entry.SubjectID != nil {
+		result.SubjectId = strconv.FormatUint(uint64(*entry.SubjectID), 10)
+	}
+	// Details пишутся только через audit.Log, поэтому всегда объект строк
+	_ = json.Unmarshal([]byte(entry.Details), &result.Details)
+
+	return result
+}
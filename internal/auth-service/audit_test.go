@@ -0,0 +1,226 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	"auth/internal/rbac"
+	pb "auth/proto/auth"
+	"context"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+var auditStart = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// auditFixture - журнал из четырех записей с интервалом в час.
+type auditFixture struct {
+	*testService
+	auditor      *entity.User
+	alice, bob   *entity.User
+	auditorCtx   context.Context
+	roleAssignID string
+}
+
+func newAuditFixture(t *testing.T) *auditFixture {
+	t.Helper()
+	f := &auditFixture{testService: newTestService(t)}
+	f.auditor = f.addUser(t, "auditor", true)
+	f.storage.grantRole(t, f.auditor, "auditor", rbac.PermissionReadAudit)
+	f.alice = f.addUser(t, "alice", true)
+	f.bob = f.addUser(t, "bob", true)
+	f.auditorCtx = f.authorized(t, f.auditor)
+
+	entries := []entity.AuditEntry{
+		{Action: audit.ActionLoginSuccess, ActorID: &f.alice.ID, SubjectID: &f.alice.ID},
+		{Action: audit.ActionLoginFailure, Result: audit.ResultFailure},
+		{Action: audit.ActionRoleAssign, ActorID: &f.auditor.ID, SubjectID: &f.alice.ID, IP: "198.51.100.4", Details: `{"role":"admin"}`},
+		{Action: audit.ActionLoginSuccess, ActorID: &f.bob.ID, SubjectID: &f.bob.ID},
+	}
+	for i := range entries {
+		entry := &entries[i]
+		entry.CreatedAt = auditStart.Add(time.Duration(i) * time.Hour)
+		if entry.Result == "" {
+			entry.Result = audit.ResultSuccess
+		}
+		if entry.Details == "" {
+			entry.Details = "{}"
+		}
+		if err := f.storage.AppendAuditEntry(entry, audit.Hash); err != nil {
+			t.Fatalf("AppendAuditEntry: %v", err)
+		}
+	}
+	f.roleAssignID = strconv.FormatUint(entries[2].ID, 10)
+	return f
+}
+
+func auditIDs(entries []*pb.AuditEntry) string {
+	ids := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		ids = append(ids, entry.GetId())
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestQueryAuditLog(t *testing.T) {
+	f := newAuditFixture(t)
+
+	tests := []struct {
+		name    string
+		req     *pb.QueryAuditLogRequest
+		wantIDs string
+		want    codes.Code
+	}{
+		{name: "everything", req: &pb.QueryAuditLogRequest{}, wantIDs: "4,3,2,1"},
+		{name: "action", req: &pb.QueryAuditLogRequest{Action: audit.ActionLoginSuccess}, wantIDs: "4,1"},
+		{name: "actor", req: &pb.QueryAuditLogRequest{ActorId: userID(f.alice)}, wantIDs: "1"},
+		{name: "subject", req: &pb.QueryAuditLogRequest{SubjectId: userID(f.alice)}, wantIDs: "3,1"},
+		{name: "since", req: &pb.QueryAuditLogRequest{Since: auditStart.Add(time.Hour).Unix()}, wantIDs: "4,3,2"},
+		{name: "until is exclusive", req: &pb.QueryAuditLogRequest{Until: auditStart.Add(2 * time.Hour).Unix()}, wantIDs: "2,1"},
+		{name: "time range", req: &pb.QueryAuditLogRequest{Since: auditStart.Add(time.Hour).Unix(), Until: auditStart.Add(2 * time.Hour).Unix()}, wantIDs: "2"},
+		{name: "page token", req: &pb.QueryAuditLogRequest{PageToken: "3"}, wantIDs: "2,1"},
+		{name: "invalid actor id", req: &pb.QueryAuditLogRequest{ActorId: "alice"}, want: codes.InvalidArgument},
+		{name: "invalid subject id", req: &pb.QueryAuditLogRequest{SubjectId: "-1"}, want: codes.InvalidArgument},
+		{name: "invalid page token", req: &pb.QueryAuditLogRequest{PageToken: "next"}, want: codes.InvalidArgument},
+		{name: "zero page token", req: &pb.QueryAuditLogRequest{PageToken: "0"}, want: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := f.QueryAuditLog(f.auditorCtx, tt.req)
+			requireCode(t, err, tt.want)
+			if err != nil {
+				return
+			}
+			if got := auditIDs(response.GetEntries()); got != tt.wantIDs {
+				t.Fatalf("entry ids = %s, want %s", got, tt.wantIDs)
+			}
+		})
+	}
+}
+
+func TestQueryAuditLogPagination(t *testing.T) {
+	f := newAuditFixture(t)
+
+	first, err := f.QueryAuditLog(f.auditorCtx, &pb.QueryAuditLogRequest{PageSize: 3})
+	if err != nil {
+		t.Fatalf("QueryAuditLog: %v", err)
+	}
+	if got := auditIDs(first.GetEntries()); got != "4,3,2" || first.GetNextPageToken() != "2" {
+		t.Fatalf("first page = %s, next %q", got, first.GetNextPageToken())
+	}
+
+	second, err := f.QueryAuditLog(f.auditorCtx, &pb.QueryAuditLogRequest{PageSize: 3, PageToken: first.GetNextPageToken()})
+	if err != nil {
+		t.Fatalf("QueryAuditLog: %v", err)
+	}
+	if got := auditIDs(second.GetEntries()); got != "1" || second.GetNextPageToken() != "" {
+		t.Fatalf("second page = %s, next %q", got, second.GetNextPageToken())
+	}
+}
+
+func TestQueryAuditLogEntry(t *testing.T) {
+	f := newAuditFixture(t)
+
+	response, err := f.QueryAuditLog(f.auditorCtx, &pb.QueryAuditLogRequest{Action: audit.ActionRoleAssign})
+	if err != nil {
+		t.Fatalf("QueryAuditLog: %v", err)
+	}
+	if len(response.GetEntries()) != 1 {
+		t.Fatalf("got %d entries, want 1", len(response.GetEntries()))
+	}
+	entry := response.GetEntries()[0]
+
+	if entry.GetId() != f.roleAssignID || entry.GetCreatedAt() != auditStart.Add(2*time.Hour).Unix() {
+		t.Fatalf("entry = %v", entry)
+	}
+	if entry.GetActorId() != userID(f.auditor) || entry.GetSubjectId() != userID(f.alice) || entry.GetIp() != "198.51.100.4" {
+		t.Fatalf("entry = %v", entry)
+	}
+	if entry.GetDetails()["role"] != "admin" || entry.GetResult() != audit.ResultSuccess {
+		t.Fatalf("entry = %v", entry)
+	}
+	if entry.GetHash() == "" || entry.GetPrevHash() == "" {
+		t.Fatalf("entry has no chain hashes: %v", entry)
+	}
+
+	// Запись без пользователя отдается с пустыми ID
+	response, err = f.QueryAuditLog(f.auditorCtx, &pb.QueryAuditLogRequest{Action: audit.ActionLoginFailure})
+	if err != nil {
+		t.Fatalf("QueryAuditLog: %v", err)
+	}
+	if entry := response.GetEntries()[0]; entry.GetActorId() != "" || entry.GetSubjectId() != "" {
+		t.Fatalf("entry = %v", entry)
+	}
+}
+
+func TestQueryAuditLogRequiresPermission(t *testing.T) {
+	f := newAuditFixture(t)
+
+	_, err := f.QueryAuditLog(f.authorized(t, f.alice), &pb.QueryAuditLogRequest{})
+	requireCode(t, err, codes.PermissionDenied)
+	_, err = f.QueryAuditLog(context.Background(), &pb.QueryAuditLogRequest{})
+	requireCode(t, err, codes.Unauthenticated)
+}
+
+func TestAuditChainOfServiceActions(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	ctx := context.Background()
+
+	_, err := s.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "wrong-password"})
+	requireCode(t, err, codes.Unauthenticated)
+	if _, err := s.Login(ctx, &pb.LoginRequest{Login: "alice", Password: testPassword}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	_, err = s.QueryAuditLog(s.authorized(t, user), &pb.QueryAuditLogRequest{})
+	requireCode(t, err, codes.PermissionDenied)
+
+	s.storage.mu.Lock()
+	entries := append([]entity.AuditEntry(nil), s.storage.auditLog...)
+	s.storage.mu.Unlock()
+
+	verifier := &audit.Verifier{}
+	if err := verifier.Add(entries); err != nil {
+		t.Fatalf("chain of service actions is broken: %v", err)
+	}
+	if verifier.Checked() != 3 {
+		t.Fatalf("checked %d entries, want 3 (actions %v)", verifier.Checked(), s.storage.auditActions())
+	}
+}
+
+func TestLoginAuditOmitsTypedLogin(t *testing.T) {
+	s := newTestService(t)
+	s.addUser(t, "alice", true)
+	ctx := context.Background()
+
+	// В поле входа попадают чужие адреса и пароли
+	for _, login := range []string{"mallory@example.com", testPassword, "alice"} {
+		if _, err := s.Login(ctx, &pb.LoginRequest{Login: login, Password: "wrong-password"}); err == nil {
+			t.Fatalf("Login %q with a wrong password succeeded", login)
+		}
+	}
+	if _, err := s.Login(ctx, &pb.LoginRequest{Login: "alice", Password: testPassword}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	s.storage.mu.Lock()
+	defer s.storage.mu.Unlock()
+	if len(s.storage.auditLog) != 4 {
+		t.Fatalf("audit entries = %d, want 4", len(s.storage.auditLog))
+	}
+	for i, entry := range s.storage.auditLog {
+		for _, typed := range []string{"mallory", testPassword, "alice"} {
+			if strings.Contains(entry.Details, typed) {
+				t.Fatalf("entry %d details = %s, want no typed login", i, entry.Details)
+			}
+		}
+		// Известный пользователь определяется по ID
+		if known := i >= 2; known != (entry.SubjectID != nil) {
+			t.Fatalf("entry %d subject = %v", i, entry.SubjectID)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package authservice
+
+import (
+	"auth/internal/token"
+	"context"
+	"errors"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// authenticate проверяет access-токен из метаданных "authorization: Bearer <token>".
+func (s *AuthService) authenticate(ctx context.Context) (*token.Claims, error) {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return nil, status.Errorf(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return nil, status.Errorf(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	tokenString, found := strings.CutPrefix(values[0], "Bearer ")
+	if !found {
+		return nil, status.Errorf(codes.Unauthenticated, "invalid authorization metadata")
+	}
+
+	claims, err := s.tokens.Parse(tokenString)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrTokenRevoked) {
+			s.logger.Warn("invalid token", "error", err)
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token")
+		}
+		s.logger.Error("failed to validate token", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to validate token")
+	}
+
+	// Токен OAuth-клиента ограничен выданными scope и не дает доступа к
+	// собственным RPC сервиса от имени пользователя
+	if claims.ClientID != "" {
+		s.logger.Warn("oauth client token used as a session", "client_id", claims.ClientID)
+		return nil, status.Errorf(codes.PermissionDenied, "oauth client tokens are not accepted")
+	}
+
+	return claims, nil
+}
@@ -0,0 +1,38 @@
+package authservice
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/segmentio/kafka-go"
+)
+
+const notificationTopic = "auth_info"
+
+// sendNotificationEvent публикует событие для сервиса уведомлений.
+// Поля extra добавляются к email и message.
+func (s *AuthService) sendNotificationEvent(email, message string, extra map[string]string) error {
+	event := map[string]string{
+		"email":   email,
+		"message": message,
+	}
+	for k, v := range extra {
+		event[k] = v
+	}
+
+	eventJSON, err := json.Marshal(event)
+	if err != nil {
+		s.logger.Error("failed to marshal event", "error", err)
+		return err
+	}
+
+	if err := s.kafkaWriter.WriteMessages(context.Background(), kafka.Message{
+		Topic: notificationTopic,
+		Value: eventJSON,
+	}); err != nil {
+		s.logger.Error("failed to send kafka message", "error", err)
+		return err
+	}
+
+	return nil
+}
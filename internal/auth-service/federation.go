@@ -0,0 +1,25 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	pb "auth/proto/auth"
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// CompleteFederatedLogin завершает вход через внешнего провайдера тем же
+// путем, что и Login, и записывает его в историю входов и журнал аудита.
+// login - почта от провайдера. Используется internal/federation.
+func (s *AuthService) CompleteFederatedLogin(ctx context.Context, user *entity.User, login string) (*pb.LoginResponse, error) {
+	response, err := s.completeLogin(user, false)
+	s.recordLogin(ctx, user, login, loginMethodFederated, response.GetMfaRequired(), err)
+	return response, err
+}
+
+// RecordFederatedFailure записывает неудачный вход через внешнего
+// провайдера; user пуст, если до пользователя дело не дошло.
+func (s *AuthService) RecordFederatedFailure(ctx context.Context, user *entity.User, login, reason string) {
+	s.recordLogin(ctx, user, login, loginMethodFederated, false, status.Error(codes.Unauthenticated, reason))
+}
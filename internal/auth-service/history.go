@@ -0,0 +1,215 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	pb "auth/proto/auth"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+// Способы входа в истории.
+const (
+	loginMethodPassword = "password"
+	loginMethodMFA      = "mfa"
+	loginMethodPasskey  = "passkey"
+	// Вход через внешнего OIDC провайдера
+	loginMethodFederated = "federated"
+)
+
+const (
+	defaultHistoryPageSize = 50
+	maxHistoryPageSize     = 200
+	maxUserAgentLength     = 256
+	maxLoginLength         = 256
+)
+
+// GetLoginHistory возвращает попытки входа текущего пользователя от новых
+// к старым. История общая для всех организаций: вход относится к учетной
+// записи и происходит раньше, чем выбрана активная организация, а попытка,
+// видимая только в одной организации, скрыла бы от владельца взлом.
+func (s *AuthService) GetLoginHistory(ctx context.Context, req *pb.GetLoginHistoryRequest) (*pb.GetLoginHistoryResponse, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	pageSize := int(req.GetPageSize())
+	if pageSize <= 0 {
+		pageSize = defaultHistoryPageSize
+	}
+	pageSize = min(pageSize, maxHistoryPageSize)
+
+	var beforeID uint
+	if req.GetPageToken() != "" {
+		if beforeID, err = parseID(req.GetPageToken()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid page_token")
+		}
+	}
+
+	events, err := s.storage.ListLoginEvents(user.ID, beforeID, pageSize)
+	if err != nil {
+		s.logger.Error("failed to list login events", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to get login history")
+	}
+
+	response := &pb.GetLoginHistoryResponse{Events: make([]*pb.LoginEvent, 0, len(events))}
+	for _, event := range events {
+		response.Events = append(response.Events, &pb.LoginEvent{
+			Id:        strconv.FormatUint(uint64(event.ID), 10),
+			CreatedAt: event.CreatedAt.Unix(),
+			Method:    event.Method,
+			Result:    event.Result,
+			Reason:    event.Reason,
+			Ip:        event.IP,
+			UserAgent: event.UserAgent,
+			NewDevice: event.NewDevice,
+		})
+	}
+	if len(events) == pageSize {
+		response.NextPageToken = strconv.FormatUint(uint64(events[len(events)-1].ID), 10)
+	}
+
+	return response, nil
+}
+
+// recordLogin сохраняет попытку входа и при успешном входе с нового
+// устройства уведомляет пользователя. Ошибки записи на вход не влияют.
+func (s *AuthService) recordLogin(ctx context.Context, user *entity.User, login, method string, mfaRequired bool, loginErr error) {
+	ip, userAgent := clientInfo(ctx)
+	login = truncate(login, maxLoginLength)
+	event := &entity.LoginEvent{
+		Login:       login,
+		Method:      method,
+		Result:      entity.LoginResultSuccess,
+		IP:          ip,
+		UserAgent:   userAgent,
+		Fingerprint: loginFingerprint(ip, userAgent),
+	}
+
+	switch {
+	case loginErr != nil:
+		event.Result = entity.LoginResultFailure
+		event.Reason = status.Convert(loginErr).Message()
+	case mfaRequired:
+		event.Result = entity.LoginResultMFARequired
+	}
+
+	if user != nil {
+		event.UserID = &user.ID
+		if event.Login == "" {
+			event.Login = user.UserName
+		}
+		if event.Result == entity.LoginResultSuccess {
+			event.NewDevice = s.isNewDevice(user.ID, event.Fingerprint)
+		}
+	}
+
+	if err := s.storage.SaveLoginEvent(event); err != nil {
+		s.logger.Error("failed to save login event", "error", err)
+	}
+
+	// Промежуточный шаг перед вторым фактором в аудит не пишется. Введенный
+	// логин туда не попадает: журнал неизменяем, а в поле входа нередко
+	// оказываются чужой адрес или пароль. Пользователя определяют ID
+	if event.Result != entity.LoginResultMFARequired {
+		record := audit.Event{
+			Action:  audit.ActionLoginSuccess,
+			Details: map[string]string{"method": method},
+		}
+		if event.Result == entity.LoginResultFailure {
+			record.Action = audit.ActionLoginFailure
+			record.Result = audit.ResultFailure
+			record.Details["reason"] = event.Reason
+		}
+		if user != nil {
+			record.ActorID = user.ID
+			record.SubjectID = user.ID
+		}
+		s.audit.Record(ctx, record)
+	}
+
+	if event.NewDevice {
+		s.logger.Info("sign-in from a new device", "user_id", user.ID, "ip", ip)
+		if err := s.sendNotificationEvent(user.Email, "new sign-in to your account", map[string]string{
+			"type":       "new_sign_in",
+			"ip":         ip,
+			"user_agent": userAgent,
+			"method":     method,
+			"time":       time.Now().UTC().Format(time.RFC3339),
+		}); err != nil {
+			s.logger.Warn("failed to send new sign-in notification", "error", err)
+		}
+	}
+}
+
+// isNewDevice - отпечаток еще не встречался среди успешных входов. Самый
+// первый вход новым не считается, чтобы не уведомлять сразу после
+// регистрации.
+func (s *AuthService) isNewDevice(userID uint, fingerprint string) bool {
+	seen, err := s.storage.HasSuccessfulLogin(userID, fingerprint)
+	if err != nil {
+		s.logger.Error("failed to check login fingerprint", "error", err)
+		return false
+	}
+	if seen {
+		return false
+	}
+
+	known, err := s.storage.HasSuccessfulLogin(userID, "")
+	if err != nil {
+		s.logger.Error("failed to check login history", "error", err)
+		return false
+	}
+
+	return known
+}
+
+// clientInfo возвращает адрес клиента и user agent из метаданных.
+func clientInfo(ctx context.Context) (string, string) {
+	var ip string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		ip = p.Addr.String()
+		if host, _, err := net.SplitHostPort(ip); err == nil {
+			ip = host
+		}
+	}
+
+	var userAgent string
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("user-agent"); len(values) > 0 {
+		userAgent = values[0]
+	}
+
+	return ip, truncate(userAgent, maxUserAgentLength)
+}
+
+// truncate обрезает строку до limit байт по границе символа и заменяет
+// невалидные последовательности: Postgres не сохранит событие с
+// невалидным UTF-8, и клиент мог бы так спрятать свои попытки входа.
+func truncate(s string, limit int) string {
+	s = strings.ToValidUTF8(s, "\uFFFD")
+	if len(s) <= limit {
+		return s
+	}
+	for limit > 0 && !utf8.RuneStart(s[limit]) {
+		limit--
+	}
+	return s[:limit]
+}
+
+func loginFingerprint(ip, userAgent string) string {
+	sum := sha256.Sum256([]byte(ip + "\x00" + userAgent))
+	return hex.EncodeToString(sum[:])
+}
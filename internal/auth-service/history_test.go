@@ -0,0 +1,248 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	pb "auth/proto/auth"
+	"context"
+	"net"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// clientContext - вызов с адреса ip и с заголовком user-agent.
+func clientContext(ip, userAgent string) context.Context {
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(ip), Port: 40000}})
+	return metadata.NewIncomingContext(ctx, metadata.Pairs("user-agent", userAgent))
+}
+
+// loginHistory возвращает историю входов пользователя целиком.
+func loginHistory(t *testing.T, s *testService, user *entity.User) []*pb.LoginEvent {
+	t.Helper()
+	history, err := s.GetLoginHistory(s.authorized(t, user), &pb.GetLoginHistoryRequest{})
+	if err != nil {
+		t.Fatalf("GetLoginHistory: %v", err)
+	}
+	return history.GetEvents()
+}
+
+func TestLoginHistory(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	ctx := clientContext("198.51.100.4", "firefox")
+
+	_, err := s.Login(ctx, &pb.LoginRequest{Login: "alice", Password: "wrong-password"})
+	requireCode(t, err, codes.Unauthenticated)
+	if _, err := s.Login(ctx, &pb.LoginRequest{Login: "alice@example.com", Password: testPassword}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	// Попытка входа в несуществующую учетную запись в чужую историю не попадает
+	_, err = s.Login(ctx, &pb.LoginRequest{Login: "mallory", Password: testPassword})
+	requireCode(t, err, codes.NotFound)
+
+	events := loginHistory(t, s, user)
+	if len(events) != 2 {
+		t.Fatalf("got %d events, want 2", len(events))
+	}
+	success, failure := events[0], events[1]
+	if success.GetResult() != entity.LoginResultSuccess || success.GetMethod() != loginMethodPassword || success.GetReason() != "" {
+		t.Fatalf("success event = %v", success)
+	}
+	if failure.GetResult() != entity.LoginResultFailure || failure.GetReason() != "invalid username or password" {
+		t.Fatalf("failure event = %v", failure)
+	}
+	if success.GetIp() != "198.51.100.4" || success.GetUserAgent() != "firefox" {
+		t.Fatalf("client = %s / %s", success.GetIp(), success.GetUserAgent())
+	}
+
+	want := []string{audit.ActionLoginFailure, audit.ActionLoginSuccess, audit.ActionLoginFailure}
+	var got []string
+	for _, action := range s.storage.auditActions() {
+		if strings.HasPrefix(action, "login.") {
+			got = append(got, action)
+		}
+	}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("audit actions = %v, want %v", got, want)
+	}
+}
+
+func TestLoginHistoryMultiByte(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	userAgent := strings.Repeat("ю", maxUserAgentLength)
+	ctx := clientContext("198.51.100.4", userAgent)
+
+	_, err := s.Login(ctx, &pb.LoginRequest{Login: "a" + strings.Repeat("я", maxLoginLength), Password: testPassword})
+	requireCode(t, err, codes.NotFound)
+	if _, err := s.Login(ctx, &pb.LoginRequest{Login: "alice", Password: testPassword}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	// Обе попытки сохранены, хотя обрезка пришлась на середину символа
+	s.storage.mu.Lock()
+	logins := slices.Clone(s.storage.logins)
+	s.storage.mu.Unlock()
+	if len(logins) != 2 {
+		t.Fatalf("saved %d login events, want 2", len(logins))
+	}
+	if got := logins[0].Login; len(got) > maxLoginLength || !strings.HasPrefix("a"+strings.Repeat("я", maxLoginLength), got) {
+		t.Fatalf("saved login %q is not a prefix of at most %d bytes", got, maxLoginLength)
+	}
+
+	events := loginHistory(t, s, user)
+	if len(events) != 1 {
+		t.Fatalf("got %d events, want 1", len(events))
+	}
+	if got := events[0].GetUserAgent(); len(got) != maxUserAgentLength || !strings.HasPrefix(userAgent, got) {
+		t.Fatalf("user agent %q is not a prefix of %d bytes", got, maxUserAgentLength)
+	}
+}
+
+func TestLoginHistoryMFA(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	secret := enableTOTP(t, s, user)
+	ctx := clientContext("198.51.100.4", "firefox")
+
+	response, err := s.Login(ctx, &pb.LoginRequest{Login: "alice", Password: testPassword})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if _, err := s.VerifyMFA(ctx, &pb.VerifyMFARequest{MfaToken: response.GetMfaToken(), Code: totpCode(t, secret, 1)}); err != nil {
+		t.Fatalf("VerifyMFA: %v", err)
+	}
+
+	events := loginHistory(t, s, user)
+	if len(events) < 2 {
+		t.Fatalf("got %d events, want at least 2", len(events))
+	}
+	if events[1].GetResult() != entity.LoginResultMFARequired || events[1].GetMethod() != loginMethodPassword {
+		t.Fatalf("first step = %v", events[1])
+	}
+	if events[0].GetResult() != entity.LoginResultSuccess || events[0].GetMethod() != loginMethodMFA {
+		t.Fatalf("second step = %v", events[0])
+	}
+}
+
+func TestNewDeviceNotification(t *testing.T) {
+	s := newTestService(t)
+	s.addUser(t, "alice", true)
+
+	tests := []struct {
+		name          string
+		ip            string
+		userAgent     string
+		password      string
+		wantNewDevice bool
+	}{
+		// Первый вход после регистрации новым не считается
+		{name: "first sign-in", ip: "198.51.100.4", userAgent: "firefox", password: testPassword},
+		{name: "same device", ip: "198.51.100.4", userAgent: "firefox", password: testPassword},
+		{name: "failed attempt from a new device", ip: "203.0.113.9", userAgent: "curl", password: "wrong-password"},
+		{name: "new browser", ip: "198.51.100.4", userAgent: "safari", password: testPassword, wantNewDevice: true},
+		{name: "new address", ip: "203.0.113.9", userAgent: "firefox", password: testPassword, wantNewDevice: true},
+		{name: "known again", ip: "203.0.113.9", userAgent: "firefox", password: testPassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			before := s.writer.count("new_sign_in")
+			s.Login(clientContext(tt.ip, tt.userAgent), &pb.LoginRequest{Login: "alice", Password: tt.password})
+
+			notified := s.writer.count("new_sign_in") > before
+			if notified != tt.wantNewDevice {
+				t.Fatalf("notified = %v, want %v", notified, tt.wantNewDevice)
+			}
+			if notified {
+				event := s.writer.last(t, "new_sign_in")
+				if event["ip"] != tt.ip || event["user_agent"] != tt.userAgent || event["method"] != loginMethodPassword {
+					t.Fatalf("notification = %v", event)
+				}
+			}
+		})
+	}
+}
+
+func TestGetLoginHistoryPagination(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	other := s.addUser(t, "bob", true)
+	for _, owner := range []*entity.User{user, other, user, user, other, user, user} {
+		if err := s.storage.SaveLoginEvent(&entity.LoginEvent{UserID: &owner.ID, Result: entity.LoginResultSuccess}); err != nil {
+			t.Fatalf("SaveLoginEvent: %v", err)
+		}
+	}
+	ctx := s.authorized(t, user)
+
+	var ids []string
+	pageToken := ""
+	for pages := 1; ; pages++ {
+		page, err := s.GetLoginHistory(ctx, &pb.GetLoginHistoryRequest{PageSize: 2, PageToken: pageToken})
+		if err != nil {
+			t.Fatalf("GetLoginHistory: %v", err)
+		}
+		for _, event := range page.GetEvents() {
+			ids = append(ids, event.GetId())
+		}
+		if pageToken = page.GetNextPageToken(); pageToken == "" {
+			break
+		}
+		if pages > 5 {
+			t.Fatal("pagination does not terminate")
+		}
+	}
+	if want := "7,6,4,3,1"; strings.Join(ids, ",") != want {
+		t.Fatalf("event ids = %v, want %s", ids, want)
+	}
+
+	_, err := s.GetLoginHistory(ctx, &pb.GetLoginHistoryRequest{PageToken: "next"})
+	requireCode(t, err, codes.InvalidArgument)
+	_, err = s.GetLoginHistory(context.Background(), &pb.GetLoginHistoryRequest{})
+	requireCode(t, err, codes.Unauthenticated)
+}
+
+func TestClientInfo(t *testing.T) {
+	long := strings.Repeat("u", maxUserAgentLength+10)
+
+	tests := []struct {
+		name          string
+		ctx           context.Context
+		wantIP        string
+		wantUserAgent string
+	}{
+		{name: "ipv4", ctx: clientContext("198.51.100.4", "firefox"), wantIP: "198.51.100.4", wantUserAgent: "firefox"},
+		{name: "ipv6", ctx: clientContext("2001:db8::1", "firefox"), wantIP: "2001:db8::1", wantUserAgent: "firefox"},
+		{name: "no peer", ctx: metadata.NewIncomingContext(context.Background(), metadata.Pairs("user-agent", "curl")), wantUserAgent: "curl"},
+		{name: "no metadata", ctx: context.Background()},
+		{name: "long user agent", ctx: clientContext("198.51.100.4", long), wantIP: "198.51.100.4", wantUserAgent: long[:maxUserAgentLength]},
+		// Обрезка не разрывает двухбайтовый символ на границе
+		{name: "multi-byte user agent", ctx: clientContext("198.51.100.4", "u"+strings.Repeat("я", maxUserAgentLength)), wantIP: "198.51.100.4", wantUserAgent: "u" + strings.Repeat("я", maxUserAgentLength/2-1)},
+		{name: "invalid utf-8", ctx: clientContext("198.51.100.4", "fire\xfffox"), wantIP: "198.51.100.4", wantUserAgent: "fire\uFFFDfox"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, userAgent := clientInfo(tt.ctx)
+			if ip != tt.wantIP || userAgent != tt.wantUserAgent {
+				t.Fatalf("clientInfo = %q, %q; want %q, %q", ip, userAgent, tt.wantIP, tt.wantUserAgent)
+			}
+		})
+	}
+}
+
+func TestLoginFingerprint(t *testing.T) {
+	base := loginFingerprint("198.51.100.4", "firefox")
+	if base != loginFingerprint("198.51.100.4", "firefox") {
+		t.Fatal("fingerprint is not deterministic")
+	}
+	// Разделитель не дает склеить адрес и user agent по-другому
+	if base == loginFingerprint("198.51.100.4f", "irefox") {
+		t.Fatal("fingerprints of different clients collide")
+	}
+}
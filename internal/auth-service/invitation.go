@@ -0,0 +1,346 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	"auth/internal/identity"
+	"auth/internal/passwordpolicy"
+	"auth/internal/rbac"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"errors"
+	"strconv"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// Статусы приглашения в ответах.
+const (
+	invitationPending  = "pending"
+	invitationAccepted = "accepted"
+	invitationRevoked  = "revoked"
+	invitationExpired  = "expired"
+)
+
+// CreateInvitation приглашает человека по email. Роль owner может выдать
+// только владелец организации.
+func (s *AuthService) CreateInvitation(ctx context.Context, req *pb.CreateInvitationRequest) (*pb.CreateInvitationResponse, error) {
+	user, membership, err := s.requireOrgAdmin(ctx, req.GetOrganizationId())
+	if err != nil {
+		return nil, err
+	}
+
+	role := req.GetRole()
+	if role == "" {
+		role = rbac.OrgRoleMember
+	}
+	if !rbac.ValidOrgRole(role) {
+		return nil, status.Errorf(codes.InvalidArgument, "role must be one of owner, admin, member")
+	}
+	if role == rbac.OrgRoleOwner && membership.Role != rbac.OrgRoleOwner {
+		return nil, status.Errorf(codes.PermissionDenied, "only owners can invite owners")
+	}
+
+	email, err := identity.NormalizeEmail(req.GetEmail())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "email is not valid")
+	}
+
+	// Уже состоящего в организации приглашать незачем
+	invitee, err := s.storage.GetUserByEmail(email)
+	switch {
+	case err == nil:
+		if _, err := s.storage.GetMembership(membership.OrganizationID, invitee.ID); err == nil {
+			return nil, status.Errorf(codes.AlreadyExists, "user is already a member of the organization")
+		} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Error("failed to get membership", "error", err)
+			return nil, status.Errorf(codes.Internal, "failed to create invitation")
+		}
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		s.logger.Error("failed to get user", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to create invitation")
+	}
+
+	// Непрозрачный токен не зависит от ключей подписи и живет ровно столько,
+	// сколько приглашение; в базе хранится только его хеш
+	inviteToken, err := token.RandomString(32)
+	if err != nil {
+		s.logger.Error("failed to generate invitation token", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to create invitation")
+	}
+
+	invitation := &entity.Invitation{
+		OrganizationID: membership.OrganizationID,
+		Email:          email,
+		Role:           role,
+		InvitedBy:      user.ID,
+		TokenHash:      token.Hash(inviteToken),
+		ExpiresAt:      time.Now().Add(token.InvitationExpiration),
+	}
+	if err := s.storage.SaveInvitation(invitation); err != nil {
+		s.logger.Error("failed to save invitation", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to create invitation")
+	}
+
+	if err := s.sendNotificationEvent(email, "you were invited to join "+membership.Organization.Name, map[string]string{
+		"type":         "organization_invitation",
+		"token":        inviteToken,
+		"organization": membership.Organization.Name,
+		"role":         role,
+		"invited_by":   user.UserName,
+	}); err != nil {
+		// Недоставленное приглашение бесполезно: отзываем его
+		if err := s.storage.RevokeInvitation(invitation.OrganizationID, invitation.ID); err != nil {
+			s.logger.Warn("failed to revoke undelivered invitation", "error", err)
+		}
+		return nil, status.Errorf(codes.Internal, "failed to send invitation")
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:  audit.ActionInvitationCreate,
+		ActorID: user.ID,
+		Details: map[string]string{
+			"organization_id": strconv.FormatUint(uint64(invitation.OrganizationID), 10),
+			"invitation_id":   strconv.FormatUint(uint64(invitation.ID), 10),
+			"email":           email,
+			"role":            role,
+		},
+	})
+	s.logger.Info("invitation created", "organization_id", invitation.OrganizationID, "invitation_id", invitation.ID, "user_id", user.ID)
+	return &pb.CreateInvitationResponse{Invitation: invitationToProto(invitation)}, nil
+}
+
+// AcceptInvitation принимает приглашение. Вошедший пользователь принимает
+// его своим токеном, если почта совпадает; для нового адреса учетная запись
+// создается сразу, и в ответе возвращаются токены.
+func (s *AuthService) AcceptInvitation(ctx context.Context, req *pb.AcceptInvitationRequest) (*pb.AcceptInvitationResponse, error) {
+	invitation, err := s.pendingInvitation(req.GetToken())
+	if err != nil {
+		return nil, err
+	}
+
+	response := &pb.AcceptInvitationResponse{
+		OrganizationId: strconv.FormatUint(uint64(invitation.OrganizationID), 10),
+		Role:           invitation.Role,
+	}
+
+	if hasAuthorization(ctx) {
+		user, err := s.currentUser(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if identity.Canonical(user.Email) != identity.Canonical(invitation.Email) {
+			return nil, status.Errorf(codes.PermissionDenied, "invitation was sent to a different email")
+		}
+
+		if err := s.storage.AcceptInvitation(invitation.ID, user.ID); err != nil {
+			return nil, s.acceptInvitationError(err)
+		}
+
+		s.logger.Info("invitation accepted", "invitation_id", invitation.ID, "user_id", user.ID)
+		response.Message = "invitation accepted"
+		return response, nil
+	}
+
+	if _, err := s.storage.GetUserByEmail(invitation.Email); err == nil {
+		return nil, status.Errorf(codes.FailedPrecondition, "an account with this email already exists, sign in to accept the invitation")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.logger.Error("failed to get user", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to accept invitation")
+	}
+
+	username, err := identity.NormalizeUsername(req.GetUsername())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	if err := s.checkPassword(req.GetPassword(), passwordpolicy.UserInfo{Username: username, Email: invitation.Email}, nil); err != nil {
+		return nil, err
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.GetPassword()), bcrypt.DefaultCost)
+	if err != nil {
+		s.logger.Error("failed to hash password", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to hash password")
+	}
+
+	user, err := s.storage.CreateUserFromInvitation(invitation.ID, username, invitation.Email, req.GetAge(), hashedPassword)
+	if err != nil {
+		if errors.Is(err, postgres.ErrUserAlreadyExists) {
+			return nil, status.Errorf(codes.AlreadyExists, "username or email is already taken")
+		}
+		return nil, s.acceptInvitationError(err)
+	}
+
+	pair, err := s.tokens.IssueGrant(user, token.Grant{OrganizationID: invitation.OrganizationID})
+	if err != nil {
+		s.logger.Error("failed to generate token", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to generate token")
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:    audit.ActionRegister,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Details:   map[string]string{"username": user.UserName, "invitation_id": strconv.FormatUint(uint64(invitation.ID), 10)},
+	})
+	s.logger.Info("user registered by invitation", "invitation_id", invitation.ID, "user_id", user.ID)
+	response.Message = "account created and invitation accepted"
+	response.Token = pair.AccessToken
+	response.RefreshToken = pair.RefreshToken
+	response.ExpiresIn = pair.ExpiresIn
+	return response, nil
+}
+
+func (s *AuthService) RevokeInvitation(ctx context.Context, req *pb.RevokeInvitationRequest) (*pb.RevokeInvitationResponse, error) {
+	user, membership, err := s.requireOrgAdmin(ctx, req.GetOrganizationId())
+	if err != nil {
+		return nil, err
+	}
+
+	id, err := parseID(req.GetId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid id")
+	}
+
+	if err := s.storage.RevokeInvitation(membership.OrganizationID, id); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Errorf(codes.NotFound, "pending invitation not found")
+		}
+		s.logger.Error("failed to revoke invitation", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to revoke invitation")
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:  audit.ActionInvitationRevoke,
+		ActorID: user.ID,
+		Details: map[string]string{
+			"organization_id": strconv.FormatUint(uint64(membership.OrganizationID), 10),
+			"invitation_id":   strconv.FormatUint(uint64(id), 10),
+		},
+	})
+	s.logger.Info("invitation revoked", "invitation_id", id, "user_id", user.ID)
+	return &pb.RevokeInvitationResponse{Message: "invitation revoked"}, nil
+}
+
+func (s *AuthService) ListInvitations(ctx context.Context, req *pb.ListInvitationsRequest) (*pb.ListInvitationsResponse, error) {
+	_, membership, err := s.requireOrgAdmin(ctx, req.GetOrganizationId())
+	if err != nil {
+		return nil, err
+	}
+
+	invitations, err := s.storage.ListInvitations(membership.OrganizationID)
+	if err != nil {
+		s.logger.Error("failed to list invitations", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to list invitations")
+	}
+
+	response := &pb.ListInvitationsResponse{Invitations: make([]*pb.Invitation, 0, len(invitations))}
+	for i := range invitations {
+		response.Invitations = append(response.Invitations, invitationToProto(&invitations[i]))
+	}
+
+	return response, nil
+}
+
+// pendingInvitation находит приглашение по хешу токена и проверяет, что
+// оно все еще ожидает принятия.
+func (s *AuthService) pendingInvitation(raw string) (*entity.Invitation, error) {
+	invalid := status.Errorf(codes.InvalidArgument, "invalid or expired invitation")
+	if raw == "" {
+		return nil, invalid
+	}
+
+	invitation, err := s.storage.GetInvitationByTokenHash(token.Hash(raw))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Warn("unknown invitation token")
+			return nil, invalid
+		}
+		s.logger.Error("failed to get invitation", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to accept invitation")
+	}
+
+	if invitationStatus(invitation) != invitationPending {
+		s.logger.Warn("invitation is not pending", "invitation_id", invitation.ID)
+		return nil, invalid
+	}
+
+	return invitation, nil
+}
+
+func (s *AuthService) acceptInvitationError(err error) error {
+	switch {
+	case errors.Is(err, postgres.ErrInvitationUsed):
+		return status.Errorf(codes.InvalidArgument, "invalid or expired invitation")
+	case errors.Is(err, postgres.ErrAlreadyMember):
+		return status.Errorf(codes.AlreadyExists, "user is already a member of the organization")
+	}
+	s.logger.Error("failed to accept invitation", "error", err)
+	return status.Errorf(codes.Internal, "failed to accept invitation")
+}
+
+// requireOrgAdmin возвращает текущего пользователя и его членство, если он
+// owner или admin организации. Пустой organizationID - активная организация.
+func (s *AuthService) requireOrgAdmin(ctx context.Context, rawOrganizationID string) (*entity.User, *entity.Membership, error) {
+	user, claims, err := s.currentUserClaims(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	organizationID := claims.OrganizationID()
+	if rawOrganizationID != "" {
+		if organizationID, err = parseID(rawOrganizationID); err != nil {
+			return nil, nil, status.Errorf(codes.InvalidArgument, "invalid organization_id")
+		}
+	}
+	if organizationID == 0 {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "no active organization, pass organization_id")
+	}
+
+	membership, err := s.membership(organizationID, user.ID)
+	if err != nil {
+		return nil, nil, err
+	}
+	if membership.Role != rbac.OrgRoleOwner && membership.Role != rbac.OrgRoleAdmin {
+		return nil, nil, status.Errorf(codes.PermissionDenied, "organization owner or admin role required")
+	}
+
+	return user, membership, nil
+}
+
+func hasAuthorization(ctx context.Context) bool {
+	md, ok := metadata.FromIncomingContext(ctx)
+	return ok && len(md.Get("authorization")) > 0
+}
+
+func invitationStatus(invitation *entity.Invitation) string {
+	switch {
+	case invitation.AcceptedAt != nil:
+		return invitationAccepted
+	case invitation.RevokedAt != nil:
+		return invitationRevoked
+	case time.Now().After(invitation.ExpiresAt):
+		return invitationExpired
+	}
+	return invitationPending
+}
+
+func invitationToProto(invitation *entity.Invitation) *pb.Invitation {
+	return &pb.Invitation{
+		Id:             strconv.FormatUint(uint64(invitation.ID), 10),
+		OrganizationId: strconv.FormatUint(uint64(invitation.OrganizationID), 10),
+		Email:          invitation.Email,
+		Role:           invitation.Role,
+		InvitedBy:      strconv.FormatUint(uint64(invitation.InvitedBy), 10),
+		CreatedAt:      invitation.CreatedAt.Unix(),
+		ExpiresAt:      invitation.ExpiresAt.Unix(),
+		Status:         invitationStatus(invitation),
+	}
+}
@@ -0,0 +1,333 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	"auth/internal/rbac"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"errors"
+	"slices"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+// orgFixture - организация acme: alice владелец, bob администратор,
+// carol участник; dave зарегистрирован, но в организации не состоит.
+type orgFixture struct {
+	*testService
+	org                     *pb.Organization
+	alice, bob, carol, dave *entity.User
+}
+
+func newOrgFixture(t *testing.T) *orgFixture {
+	t.Helper()
+	s := newTestService(t)
+	f := &orgFixture{
+		testService: s,
+		alice:       s.addUser(t, "alice", true),
+		bob:         s.addUser(t, "bob", true),
+		carol:       s.addUser(t, "carol", true),
+		dave:        s.addUser(t, "dave", true),
+	}
+	f.org = createOrganization(t, s, f.alice, "acme")
+	id, _ := parseID(f.org.GetId())
+	s.storage.addMembership(id, f.bob.ID, rbac.OrgRoleAdmin)
+	s.storage.addMembership(id, f.carol.ID, rbac.OrgRoleMember)
+	return f
+}
+
+// invite создает приглашение от имени inviter и возвращает его вместе с
+// токеном из письма.
+func (f *orgFixture) invite(t *testing.T, inviter *entity.User, email, role string) (*pb.Invitation, string) {
+	t.Helper()
+	created, err := f.CreateInvitation(f.authorized(t, inviter), &pb.CreateInvitationRequest{
+		OrganizationId: f.org.GetId(),
+		Email:          email,
+		Role:           role,
+	})
+	if err != nil {
+		t.Fatalf("CreateInvitation: %v", err)
+	}
+	return created.GetInvitation(), f.writer.last(t, "organization_invitation")["token"]
+}
+
+func TestCreateInvitation(t *testing.T) {
+	f := newOrgFixture(t)
+
+	invitation, inviteToken := f.invite(t, f.bob, " Erin@Example.COM ", "")
+	if invitation.GetEmail() != "erin@example.com" || invitation.GetRole() != rbac.OrgRoleMember {
+		t.Fatalf("invitation = %v", invitation)
+	}
+	if invitation.GetStatus() != invitationPending || invitation.GetOrganizationId() != f.org.GetId() {
+		t.Fatalf("invitation = %v", invitation)
+	}
+
+	event := f.writer.last(t, "organization_invitation")
+	if event["email"] != "erin@example.com" || event["organization"] != "Org acme" || event["invited_by"] != "bob" {
+		t.Fatalf("notification = %v", event)
+	}
+	// В базе только хеш токена из письма
+	stored, err := f.storage.GetInvitationByTokenHash(token.Hash(inviteToken))
+	if err != nil {
+		t.Fatalf("GetInvitationByTokenHash: %v", err)
+	}
+	if stored.TokenHash == inviteToken {
+		t.Fatal("invitation token is stored in plain text")
+	}
+	if !slices.Contains(f.storage.auditActions(), audit.ActionInvitationCreate) {
+		t.Fatalf("audit actions = %v, want %s", f.storage.auditActions(), audit.ActionInvitationCreate)
+	}
+
+	// Владелец может пригласить владельца
+	owner, _ := f.invite(t, f.alice, "frank@example.com", rbac.OrgRoleOwner)
+	if owner.GetRole() != rbac.OrgRoleOwner {
+		t.Fatalf("role = %q, want owner", owner.GetRole())
+	}
+}
+
+func TestCreateInvitationRejects(t *testing.T) {
+	f := newOrgFixture(t)
+
+	tests := []struct {
+		name   string
+		caller *entity.User
+		orgID  string
+		email  string
+		role   string
+		want   codes.Code
+	}{
+		{name: "member invites", caller: f.carol, email: "erin@example.com", want: codes.PermissionDenied},
+		{name: "not a member", caller: f.dave, orgID: f.org.GetId(), email: "erin@example.com", want: codes.PermissionDenied},
+		{name: "admin invites owner", caller: f.bob, email: "erin@example.com", role: rbac.OrgRoleOwner, want: codes.PermissionDenied},
+		{name: "unknown role", caller: f.alice, email: "erin@example.com", role: "guest", want: codes.InvalidArgument},
+		{name: "invalid email", caller: f.alice, email: "erin", want: codes.InvalidArgument},
+		{name: "invalid organization id", caller: f.alice, orgID: "acme", email: "erin@example.com", want: codes.InvalidArgument},
+		{name: "already a member", caller: f.alice, email: "Carol@Example.com", want: codes.AlreadyExists},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.CreateInvitation(f.authorized(t, tt.caller), &pb.CreateInvitationRequest{
+				OrganizationId: tt.orgID,
+				Email:          tt.email,
+				Role:           tt.role,
+			})
+			requireCode(t, err, tt.want)
+		})
+	}
+}
+
+func TestCreateInvitationUndelivered(t *testing.T) {
+	f := newOrgFixture(t)
+	ctx := f.authorized(t, f.alice)
+	f.writer.err = errors.New("kafka is down")
+
+	_, err := f.CreateInvitation(ctx, &pb.CreateInvitationRequest{Email: "erin@example.com"})
+	requireCode(t, err, codes.Internal)
+
+	// Неотправленное приглашение сразу отзывается
+	listed, err := f.ListInvitations(ctx, &pb.ListInvitationsRequest{})
+	if err != nil {
+		t.Fatalf("ListInvitations: %v", err)
+	}
+	if len(listed.GetInvitations()) != 1 || listed.GetInvitations()[0].GetStatus() != invitationRevoked {
+		t.Fatalf("invitations = %v, want one revoked", listed.GetInvitations())
+	}
+}
+
+func TestAcceptInvitationSignedIn(t *testing.T) {
+	f := newOrgFixture(t)
+	_, inviteToken := f.invite(t, f.bob, f.dave.Email, rbac.OrgRoleAdmin)
+
+	// Приглашение привязано к адресу
+	_, err := f.AcceptInvitation(f.authorized(t, f.carol), &pb.AcceptInvitationRequest{Token: inviteToken})
+	requireCode(t, err, codes.PermissionDenied)
+
+	ctx := f.authorized(t, f.dave)
+	accepted, err := f.AcceptInvitation(ctx, &pb.AcceptInvitationRequest{Token: inviteToken})
+	if err != nil {
+		t.Fatalf("AcceptInvitation: %v", err)
+	}
+	if accepted.GetOrganizationId() != f.org.GetId() || accepted.GetRole() != rbac.OrgRoleAdmin || accepted.GetToken() != "" {
+		t.Fatalf("AcceptInvitation = %v", accepted)
+	}
+	id, _ := parseID(f.org.GetId())
+	if membership, err := f.storage.GetMembership(id, f.dave.ID); err != nil || membership.Role != rbac.OrgRoleAdmin {
+		t.Fatalf("membership = %v, %v; want admin", membership, err)
+	}
+
+	_, err = f.AcceptInvitation(ctx, &pb.AcceptInvitationRequest{Token: inviteToken})
+	requireCode(t, err, codes.InvalidArgument)
+
+	listed, err := f.ListInvitations(f.authorized(t, f.alice), &pb.ListInvitationsRequest{})
+	if err != nil {
+		t.Fatalf("ListInvitations: %v", err)
+	}
+	if listed.GetInvitations()[0].GetStatus() != invitationAccepted {
+		t.Fatalf("status = %q, want accepted", listed.GetInvitations()[0].GetStatus())
+	}
+}
+
+func TestAcceptInvitationNewAccount(t *testing.T) {
+	f := newOrgFixture(t)
+	_, inviteToken := f.invite(t, f.alice, "erin@example.com", "")
+
+	accepted, err := f.AcceptInvitation(context.Background(), &pb.AcceptInvitationRequest{
+		Token:    inviteToken,
+		Username: "Erin",
+		Password: testPassword,
+		Age:      30,
+	})
+	if err != nil {
+		t.Fatalf("AcceptInvitation: %v", err)
+	}
+	if accepted.GetToken() == "" || accepted.GetRefreshToken() == "" {
+		t.Fatalf("AcceptInvitation = %v, want a token pair", accepted)
+	}
+
+	claims, err := f.tokens.Parse(accepted.GetToken())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if claims.Username != "erin" || claims.OrgID != f.org.GetId() || claims.OrgRole != rbac.OrgRoleMember {
+		t.Fatalf("claims = %+v", claims)
+	}
+	// Ссылка пришла на этот адрес, поэтому он сразу подтвержден
+	user, err := f.storage.GetUserByEmail("erin@example.com")
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	if !user.EmailVerified {
+		t.Fatal("email of an invited user is not verified")
+	}
+	if !slices.Contains(f.storage.auditActions(), audit.ActionRegister) {
+		t.Fatalf("audit actions = %v, want %s", f.storage.auditActions(), audit.ActionRegister)
+	}
+}
+
+func TestAcceptInvitationNewAccountRejects(t *testing.T) {
+	tests := []struct {
+		name     string
+		email    string
+		username string
+		password string
+		want     codes.Code
+	}{
+		{name: "account exists", email: "dave@example.com", username: "dave2", password: testPassword, want: codes.FailedPrecondition},
+		{name: "invalid username", email: "erin@example.com", username: "e", password: testPassword, want: codes.InvalidArgument},
+		{name: "username taken", email: "erin@example.com", username: "Carol", password: testPassword, want: codes.AlreadyExists},
+		{name: "weak password", email: "erin@example.com", username: "erin", password: "short", want: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOrgFixture(t)
+			_, inviteToken := f.invite(t, f.alice, tt.email, "")
+
+			_, err := f.AcceptInvitation(context.Background(), &pb.AcceptInvitationRequest{
+				Token:    inviteToken,
+				Username: tt.username,
+				Password: tt.password,
+			})
+			requireCode(t, err, tt.want)
+
+			// Неудачная попытка не расходует приглашение
+			if stored, _ := f.storage.GetInvitationByTokenHash(token.Hash(inviteToken)); stored.AcceptedAt != nil {
+				t.Fatal("invitation accepted by a failed request")
+			}
+		})
+	}
+}
+
+func TestAcceptInvitationRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		token func(t *testing.T, f *orgFixture) string
+	}{
+		{
+			name:  "empty token",
+			token: func(*testing.T, *orgFixture) string { return "" },
+		},
+		{
+			name:  "unknown token",
+			token: func(*testing.T, *orgFixture) string { return "unknown" },
+		},
+		{
+			name: "revoked",
+			token: func(t *testing.T, f *orgFixture) string {
+				invitation, inviteToken := f.invite(t, f.alice, f.dave.Email, "")
+				if _, err := f.RevokeInvitation(f.authorized(t, f.alice), &pb.RevokeInvitationRequest{Id: invitation.GetId()}); err != nil {
+					t.Fatalf("RevokeInvitation: %v", err)
+				}
+				return inviteToken
+			},
+		},
+		{
+			name: "expired",
+			token: func(t *testing.T, f *orgFixture) string {
+				invitation, inviteToken := f.invite(t, f.alice, f.dave.Email, "")
+				id, _ := parseID(invitation.GetId())
+				f.storage.expireInvitation(id)
+				return inviteToken
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			f := newOrgFixture(t)
+
+			_, err := f.AcceptInvitation(f.authorized(t, f.dave), &pb.AcceptInvitationRequest{Token: tt.token(t, f)})
+			requireCode(t, err, codes.InvalidArgument)
+		})
+	}
+}
+
+func TestRevokeInvitation(t *testing.T) {
+	f := newOrgFixture(t)
+	invitation, _ := f.invite(t, f.alice, "erin@example.com", "")
+	other := createOrganization(t, f.testService, f.dave, "globex")
+
+	tests := []struct {
+		name   string
+		caller *entity.User
+		req    *pb.RevokeInvitationRequest
+		want   codes.Code
+	}{
+		{name: "member", caller: f.carol, req: &pb.RevokeInvitationRequest{Id: invitation.GetId()}, want: codes.PermissionDenied},
+		{name: "invalid id", caller: f.bob, req: &pb.RevokeInvitationRequest{Id: "erin"}, want: codes.InvalidArgument},
+		{name: "invitation of another organization", caller: f.dave, req: &pb.RevokeInvitationRequest{OrganizationId: other.GetId(), Id: invitation.GetId()}, want: codes.NotFound},
+		{name: "admin", caller: f.bob, req: &pb.RevokeInvitationRequest{Id: invitation.GetId()}},
+		{name: "already revoked", caller: f.bob, req: &pb.RevokeInvitationRequest{Id: invitation.GetId()}, want: codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := f.RevokeInvitation(f.authorized(t, tt.caller), tt.req)
+			requireCode(t, err, tt.want)
+		})
+	}
+
+	if !slices.Contains(f.storage.auditActions(), audit.ActionInvitationRevoke) {
+		t.Fatalf("audit actions = %v, want %s", f.storage.auditActions(), audit.ActionInvitationRevoke)
+	}
+}
+
+func TestListInvitationsRequiresAdmin(t *testing.T) {
+	f := newOrgFixture(t)
+	f.invite(t, f.alice, "erin@example.com", "")
+
+	_, err := f.ListInvitations(f.authorized(t, f.carol), &pb.ListInvitationsRequest{})
+	requireCode(t, err, codes.PermissionDenied)
+
+	listed, err := f.ListInvitations(f.authorized(t, f.bob), &pb.ListInvitationsRequest{})
+	if err != nil {
+		t.Fatalf("ListInvitations: %v", err)
+	}
+	if len(listed.GetInvitations()) != 1 || listed.GetInvitations()[0].GetEmail() != "erin@example.com" {
+		t.Fatalf("invitations = %v", listed.GetInvitations())
+	}
+}
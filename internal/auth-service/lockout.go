@@ -0,0 +1,89 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	"auth/internal/rbac"
+	pb "auth/proto/auth"
+	"context"
+	"errors"
+	"math"
+	"strconv"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// UnlockAccount снимает блокировку входа и обнуляет счетчик неудач.
+func (s *AuthService) UnlockAccount(ctx context.Context, req *pb.UnlockAccountRequest) (*pb.UnlockAccountResponse, error) {
+	admin, err := s.requirePermission(ctx, rbac.PermissionUnlockAccounts)
+	if err != nil {
+		return nil, err
+	}
+
+	userID, err := parseID(req.GetUserId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid user_id")
+	}
+
+	user, err := s.storage.GetUserByID(userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Errorf(codes.NotFound, "user not found")
+		}
+		s.logger.Error("failed to get user", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to unlock account")
+	}
+
+	if err := s.lockout.Reset(user.ID); err != nil {
+		s.logger.Error("failed to reset lockout", "user_id", user.ID, "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to unlock account")
+	}
+
+	s.audit.Record(ctx, audit.Event{Action: audit.ActionAccountUnlock, ActorID: admin.ID, SubjectID: user.ID})
+	s.logger.Info("account unlocked", "user_id", user.ID, "admin_id", admin.ID)
+	return &pb.UnlockAccountResponse{Message: "account unlocked"}, nil
+}
+
+// checkLockout отклоняет вход в заблокированную учетную запись. Если
+// хранилище счетчиков недоступно, вход не блокируется.
+func (s *AuthService) checkLockout(user *entity.User) error {
+	remaining, err := s.lockout.LockedFor(user.ID)
+	if err != nil {
+		s.logger.Error("failed to check lockout", "user_id", user.ID, "error", err)
+		return nil
+	}
+	if remaining <= 0 {
+		return nil
+	}
+
+	s.logger.Warn("login to locked account", "username", user.UserName)
+	return status.Errorf(codes.ResourceExhausted, "account is temporarily locked, try again in %d seconds", retrySeconds(remaining))
+}
+
+// registerLoginFailure учитывает неудачный вход и уведомляет пользователя,
+// если учетная запись заблокирована.
+func (s *AuthService) registerLoginFailure(user *entity.User) {
+	duration, err := s.lockout.Fail(user.ID)
+	if err != nil {
+		s.logger.Error("failed to register login failure", "user_id", user.ID, "error", err)
+		return
+	}
+	if duration <= 0 {
+		return
+	}
+
+	s.logger.Warn("account locked", "username", user.UserName, "duration", duration)
+	if err := s.sendNotificationEvent(user.Email, "your account was temporarily locked after repeated failed sign-in attempts", map[string]string{
+		"type":         "account_locked",
+		"locked_until": strconv.FormatInt(time.Now().Add(duration).Unix(), 10),
+	}); err != nil {
+		s.logger.Warn("failed to send lockout notification", "error", err)
+	}
+}
+
+func retrySeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
@@ -0,0 +1,141 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/config"
+	"auth/internal/entity"
+	"auth/internal/rbac"
+	pb "auth/proto/auth"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const lockoutThreshold = 3
+
+func newLockoutService(t *testing.T) *testService {
+	return newTestServiceWithConfig(t, func(cfg *config.Config) {
+		cfg.LockoutConfig = config.LockoutConfig{Threshold: lockoutThreshold, BaseDuration: time.Minute, MaxDuration: time.Hour}
+	})
+}
+
+// failLogins выполняет n входов с неверным паролем.
+func failLogins(t *testing.T, s *testService, user *entity.User, n int) {
+	t.Helper()
+	for range n {
+		_, err := s.Login(context.Background(), &pb.LoginRequest{Login: user.UserName, Password: "wrong-password"})
+		requireCode(t, err, codes.Unauthenticated)
+	}
+}
+
+func TestLoginLockout(t *testing.T) {
+	s := newLockoutService(t)
+	user := s.addUser(t, "alice", true)
+	ctx := context.Background()
+
+	failLogins(t, s, user, lockoutThreshold)
+
+	event := s.writer.last(t, "account_locked")
+	if event["email"] != user.Email || event["locked_until"] == "" {
+		t.Fatalf("notification = %v", event)
+	}
+
+	// Пока блокировка действует, верный пароль тоже отклоняется
+	_, err := s.Login(ctx, &pb.LoginRequest{Login: user.Email, Password: testPassword})
+	requireCode(t, err, codes.ResourceExhausted)
+	if message := status.Convert(err).Message(); !strings.Contains(message, "60 seconds") {
+		t.Fatalf("message = %q, want the retry delay", message)
+	}
+
+	// Другие учетные записи не затронуты
+	bob := s.addUser(t, "bob", true)
+	if _, err := s.Login(ctx, &pb.LoginRequest{Login: bob.UserName, Password: testPassword}); err != nil {
+		t.Fatalf("Login(bob): %v", err)
+	}
+}
+
+func TestLoginResetsFailures(t *testing.T) {
+	s := newLockoutService(t)
+	user := s.addUser(t, "alice", true)
+	ctx := context.Background()
+
+	failLogins(t, s, user, lockoutThreshold-1)
+	if _, err := s.Login(ctx, &pb.LoginRequest{Login: user.UserName, Password: testPassword}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	// После успешного входа отсчет начинается заново
+	failLogins(t, s, user, lockoutThreshold-1)
+	if _, err := s.Login(ctx, &pb.LoginRequest{Login: user.UserName, Password: testPassword}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if s.writer.count("account_locked") != 0 {
+		t.Fatal("account locked below the threshold")
+	}
+}
+
+func TestLoginLockoutDisabled(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+
+	failLogins(t, s, user, 10)
+	if _, err := s.Login(context.Background(), &pb.LoginRequest{Login: user.UserName, Password: testPassword}); err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+}
+
+func TestUnlockAccount(t *testing.T) {
+	s := newLockoutService(t)
+	admin := s.addUser(t, "admin-user", true)
+	s.storage.grantRole(t, admin, "support", rbac.PermissionUnlockAccounts)
+	user := s.addUser(t, "alice", true)
+	failLogins(t, s, user, lockoutThreshold)
+
+	tests := []struct {
+		name   string
+		caller *entity.User
+		userID string
+		want   codes.Code
+	}{
+		{name: "without permission", caller: user, userID: userID(user), want: codes.PermissionDenied},
+		{name: "invalid user id", caller: admin, userID: "alice", want: codes.InvalidArgument},
+		{name: "unknown user", caller: admin, userID: "999", want: codes.NotFound},
+		{name: "unlock", caller: admin, userID: userID(user)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.UnlockAccount(s.authorized(t, tt.caller), &pb.UnlockAccountRequest{UserId: tt.userID})
+			requireCode(t, err, tt.want)
+		})
+	}
+
+	if _, err := s.Login(context.Background(), &pb.LoginRequest{Login: user.UserName, Password: testPassword}); err != nil {
+		t.Fatalf("Login after unlock: %v", err)
+	}
+	if !slices.Contains(s.storage.auditActions(), audit.ActionAccountUnlock) {
+		t.Fatalf("audit actions = %v, want %s", s.storage.auditActions(), audit.ActionAccountUnlock)
+	}
+}
+
+func TestRetrySeconds(t *testing.T) {
+	tests := []struct {
+		remaining time.Duration
+		want      int64
+	}{
+		{remaining: time.Minute, want: 60},
+		{remaining: 59*time.Second + time.Millisecond, want: 60},
+		{remaining: time.Millisecond, want: 1},
+	}
+
+	for _, tt := range tests {
+		if got := retrySeconds(tt.remaining); got != tt.want {
+			t.Errorf("retrySeconds(%v) = %d, want %d", tt.remaining, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	"auth/internal/totp"
+	pb "auth/proto/auth"
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Допускаем расхождение часов клиента на один шаг в обе стороны
+	totpSkew = 1
+	// После стольких неверных кодов токен второго шага отзывается
+	maxMFAAttempts = 5
+
+	mfaAttemptsPrefix = "mfa_attempts:"
+)
+
+var errInvalidMFACode = errors.New("invalid mfa code")
+
+func (s *AuthService) EnrollTOTP(ctx context.Context, req *pb.EnrollTOTPRequest) (*pb.EnrollTOTPResponse, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, status.Errorf(codes.FailedPrecondition, "totp is already enabled")
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		s.logger.Error("failed to generate totp secret", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to enroll totp")
+	}
+
+	encrypted, err := s.cipher.Encrypt([]byte(secret), totp.AssociatedData(user.ID))
+	if err != nil {
+		s.logger.Error("failed to encrypt totp secret", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to enroll totp")
+	}
+
+	if err := s.storage.SetTOTPSecret(user.ID, encrypted); err != nil {
+		s.logger.Error("failed to save totp secret", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to enroll totp")
+	}
+
+	s.logger.Info("totp enrollment started", "user_id", user.ID)
+	return &pb.EnrollTOTPResponse{
+		Secret: secret,
+		Uri:    totp.URI(s.cfg.MFAConfig.TOTPIssuer, user.Email, secret),
+	}, nil
+}
+
+func (s *AuthService) ConfirmTOTP(ctx context.Context, req *pb.ConfirmTOTPRequest) (*pb.ConfirmTOTPResponse, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if user.TOTPEnabled {
+		return nil, status.Errorf(codes.FailedPrecondition, "totp is already enabled")
+	}
+	if len(user.TOTPSecret) == 0 {
+		return nil, status.Errorf(codes.FailedPrecondition, "totp enrollment has not been started")
+	}
+
+	if err := s.verifyTOTP(user, req.GetCode()); err != nil {
+		return nil, s.mfaError(err)
+	}
+
+	if err := s.storage.EnableTOTP(user.ID); err != nil {
+		s.logger.Error("failed to enable totp", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to confirm totp")
+	}
+
+	s.logger.Info("totp enabled", "user_id", user.ID)
+	return &pb.ConfirmTOTPResponse{Message: "totp successfully enabled"}, nil
+}
+
+// DisableTOTP требует действующий код, чтобы украденный access-токен
+// не позволял снять второй фактор.
+func (s *AuthService) DisableTOTP(ctx context.Context, req *pb.DisableTOTPRequest) (*pb.DisableTOTPResponse, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TOTPEnabled {
+		return nil, status.Errorf(codes.FailedPrecondition, "totp is not enabled")
+	}
+
+	// Подбор кода с украденным токеном ограничен той же блокировкой
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+
+	if err := s.verifyTOTP(user, req.GetCode()); err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			s.registerLoginFailure(user)
+		}
+		return nil, s.mfaError(err)
+	}
+
+	if err := s.storage.DisableTOTP(user.ID); err != nil {
+		s.logger.Error("failed to disable totp", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to disable totp")
+	}
+
+	s.logger.Info("totp disabled", "user_id", user.ID)
+	return &pb.DisableTOTPResponse{Message: "totp successfully disabled"}, nil
+}
+
+// VerifyMFA завершает вход: принимает токен второго шага из Login и код
+// TOTP либо резервный код.
+func (s *AuthService) VerifyMFA(ctx context.Context, req *pb.VerifyMFARequest) (*pb.VerifyMFAResponse, error) {
+	response, user, err := s.verifyMFA(req)
+	s.recordLogin(ctx, user, "", loginMethodMFA, false, err)
+	return response, err
+}
+
+func (s *AuthService) verifyMFA(req *pb.VerifyMFARequest) (*pb.VerifyMFAResponse, *entity.User, error) {
+	claims, err := s.tokens.ParseMFAChallenge(req.GetMfaToken())
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrTokenRevoked) {
+			s.logger.Warn("invalid mfa token", "error", err)
+			return nil, nil, status.Errorf(codes.Unauthenticated, "invalid mfa token")
+		}
+		s.logger.Error("failed to validate mfa token", "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "failed to verify mfa")
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Unauthenticated, "invalid mfa token")
+	}
+
+	user, err := s.storage.GetUserByID(userID)
+	if err != nil {
+		s.logger.Error("failed to get user", "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "failed to verify mfa")
+	}
+
+	if !user.TOTPEnabled {
+		return nil, user, status.Errorf(codes.FailedPrecondition, "totp is not enabled")
+	}
+
+	// Неверные коды учитываются в той же блокировке, что и пароли
+	if err := s.checkLockout(user); err != nil {
+		return nil, user, err
+	}
+
+	if req.GetRecoveryCode() != "" {
+		err = s.verifyRecoveryCode(user, req.GetRecoveryCode())
+	} else {
+		err = s.verifyTOTP(user, req.GetCode())
+	}
+	if err != nil {
+		if errors.Is(err, errInvalidMFACode) {
+			s.registerLoginFailure(user)
+			s.registerMFAFailure(claims)
+		}
+		return nil, user, s.mfaError(err)
+	}
+
+	// Токен второго шага одноразовый
+	if err := s.tokens.Revoke(claims); err != nil {
+		s.logger.Error("failed to revoke mfa token", "error", err)
+		return nil, user, status.Errorf(codes.Internal, "failed to verify mfa")
+	}
+
+	response, err := s.completeLogin(user, true)
+	if err != nil {
+		return nil, user, err
+	}
+
+	return &pb.VerifyMFAResponse{
+		Token:        response.Token,
+		RefreshToken: response.RefreshToken,
+		ExpiresIn:    response.ExpiresIn,
+	}, user, nil
+}
+
+// registerMFAFailure считает неверные коды по токену второго шага и
+// отзывает его после maxMFAAttempts, чтобы код нельзя было подбирать с
+// одним токеном. Если счетчик недоступен, токен отзывается сразу.
+func (s *AuthService) registerMFAFailure(claims *token.Claims) {
+	attempts, err := s.cache.Incr(mfaAttemptsPrefix+claims.ID, token.MFAChallengeExpiration)
+	if err != nil {
+		s.logger.Error("failed to count mfa failures", "error", err)
+	}
+	if err == nil && attempts < maxMFAAttempts {
+		return
+	}
+
+	if err := s.tokens.Revoke(claims); err != nil {
+		s.logger.Error("failed to revoke mfa token", "error", err)
+		return
+	}
+	s.logger.Warn("mfa token revoked after failed attempts", "subject", claims.Subject)
+}
+
+// currentUser загружает пользователя по access-токену из метаданных.
+func (s *AuthService) currentUser(ctx context.Context) (*entity.User, error) {
+	user, _, err := s.currentUserClaims(ctx)
+	return user, err
+}
+
+// currentUserClaims возвращает пользователя вместе с claims токена, из
+// которых берется активная организация.
+func (s *AuthService) currentUserClaims(ctx context.Context) (*entity.User, *token.Claims, error) {
+	claims, err := s.authenticate(ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, nil, status.Errorf(codes.Unauthenticated, "invalid token")
+	}
+
+	user, err := s.storage.GetUserByID(userID)
+	if err != nil {
+		s.logger.Error("failed to get user", "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "failed to get user")
+	}
+
+	return user, claims, nil
+}
+
+// verifyTOTP проверяет код и запоминает его шаг, чтобы код нельзя было
+// использовать повторно.
+func (s *AuthService) verifyTOTP(user *entity.User, code string) error {
+	secret, err := s.cipher.Decrypt(user.TOTPSecret, totp.AssociatedData(user.ID))
+	if err != nil {
+		return err
+	}
+
+	counter, ok := totp.Validate(string(secret), code, time.Now(), totpSkew)
+	if !ok || counter <= user.TOTPLastCounter {
+		return errInvalidMFACode
+	}
+
+	if err := s.storage.UseTOTPCounter(user.ID, counter); err != nil {
+		if errors.Is(err, postgres.ErrTOTPCodeAlreadyUsed) {
+			return errInvalidMFACode
+		}
+		return err
+	}
+
+	return nil
+}
+
+func (s *AuthService) mfaError(err error) error {
+	if errors.Is(err, errInvalidMFACode) {
+		s.logger.Warn("invalid mfa code")
+		return status.Errorf(codes.Unauthenticated, "invalid mfa code")
+	}
+	s.logger.Error("failed to verify mfa code", "error", err)
+	return status.Errorf(codes.Internal, "failed to verify mfa code")
+}
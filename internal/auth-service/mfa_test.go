@@ -0,0 +1,254 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	"auth/internal/totp"
+	pb "auth/proto/auth"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// totpCode возвращает код для шага, сдвинутого на offset от текущего.
+func totpCode(t *testing.T, secret string, offset int64) string {
+	t.Helper()
+	code, err := totp.Code(secret, totp.Counter(time.Now())+offset)
+	if err != nil {
+		t.Fatalf("totp.Code: %v", err)
+	}
+	return code
+}
+
+// wrongCode возвращает код, который не совпадает ни с одним шагом окна.
+func wrongCode(t *testing.T, secret string) string {
+	t.Helper()
+	for digit := '0'; digit <= '9'; digit++ {
+		code := strings.Repeat(string(digit), totp.Digits)
+		if _, ok := totp.Validate(secret, code, time.Now(), totpSkew+1); !ok {
+			return code
+		}
+	}
+	t.Fatal("every candidate code is valid")
+	return ""
+}
+
+// enableTOTP подключает TOTP пользователю и возвращает секрет. Код
+// текущего шага при этом израсходован.
+func enableTOTP(t *testing.T, s *testService, user *entity.User) string {
+	t.Helper()
+	ctx := s.authorized(t, user)
+	enrolled, err := s.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+	if err != nil {
+		t.Fatalf("EnrollTOTP: %v", err)
+	}
+	if _, err := s.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: totpCode(t, enrolled.GetSecret(), 0)}); err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+	return enrolled.GetSecret()
+}
+
+// mfaChallenge выполняет вход по паролю и возвращает токен второго шага.
+func mfaChallenge(t *testing.T, s *testService, user *entity.User) string {
+	t.Helper()
+	response, err := s.Login(context.Background(), &pb.LoginRequest{Login: user.UserName, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if !response.GetMfaRequired() || response.GetMfaToken() == "" || response.GetToken() != "" {
+		t.Fatalf("Login response = %v, want an mfa challenge only", response)
+	}
+	return response.GetMfaToken()
+}
+
+func TestTOTPEnrollment(t *testing.T) {
+	s := newTestService(t)
+	s.cfg.MFAConfig.TOTPIssuer = "Auth Test"
+	user := s.addUser(t, "alice", true)
+	ctx := s.authorized(t, user)
+
+	_, err := s.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: "123456"})
+	requireCode(t, err, codes.FailedPrecondition)
+
+	enrolled, err := s.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+	if err != nil {
+		t.Fatalf("EnrollTOTP: %v", err)
+	}
+	if want := totp.URI("Auth Test", user.Email, enrolled.GetSecret()); enrolled.GetUri() != want {
+		t.Fatalf("uri = %q, want %q", enrolled.GetUri(), want)
+	}
+
+	// Секрет хранится зашифрованным и привязан к пользователю
+	stored, err := s.storage.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	if strings.Contains(string(stored.TOTPSecret), enrolled.GetSecret()) {
+		t.Fatal("totp secret is stored in plain text")
+	}
+	if _, err := s.cipher.Decrypt(stored.TOTPSecret, totp.AssociatedData(user.ID+1)); err == nil {
+		t.Fatal("totp secret decrypts for another user")
+	}
+
+	_, err = s.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: wrongCode(t, enrolled.GetSecret())})
+	requireCode(t, err, codes.Unauthenticated)
+
+	if _, err := s.ConfirmTOTP(ctx, &pb.ConfirmTOTPRequest{Code: totpCode(t, enrolled.GetSecret(), 0)}); err != nil {
+		t.Fatalf("ConfirmTOTP: %v", err)
+	}
+
+	_, err = s.EnrollTOTP(ctx, &pb.EnrollTOTPRequest{})
+	requireCode(t, err, codes.FailedPrecondition)
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	secret := enableTOTP(t, s, user)
+	ctx := context.Background()
+
+	challenge := mfaChallenge(t, s, user)
+
+	// Токен второго шага не заменяет access-токен
+	_, err := s.ValidateToken(ctx, &pb.ValidateTokenRequest{Token: challenge})
+	requireCode(t, err, codes.Unauthenticated)
+
+	// Код, уже принятый при подключении, повторно не принимается
+	stored, err := s.storage.GetUserByID(user.ID)
+	if err != nil {
+		t.Fatalf("GetUserByID: %v", err)
+	}
+	confirmed, err := totp.Code(secret, stored.TOTPLastCounter)
+	if err != nil {
+		t.Fatalf("totp.Code: %v", err)
+	}
+	_, err = s.VerifyMFA(ctx, &pb.VerifyMFARequest{MfaToken: challenge, Code: confirmed})
+	requireCode(t, err, codes.Unauthenticated)
+
+	code := totpCode(t, secret, 1)
+	response, err := s.VerifyMFA(ctx, &pb.VerifyMFARequest{MfaToken: challenge, Code: code})
+	if err != nil {
+		t.Fatalf("VerifyMFA: %v", err)
+	}
+	if response.GetToken() == "" || response.GetRefreshToken() == "" {
+		t.Fatalf("VerifyMFA response = %v, want a token pair", response)
+	}
+
+	// Токен второго шага одноразовый
+	_, err = s.VerifyMFA(ctx, &pb.VerifyMFARequest{MfaToken: challenge, Code: totpCode(t, secret, 1)})
+	requireCode(t, err, codes.Unauthenticated)
+
+	// Принятый код нельзя использовать для следующего входа
+	_, err = s.VerifyMFA(ctx, &pb.VerifyMFARequest{MfaToken: mfaChallenge(t, s, user), Code: code})
+	requireCode(t, err, codes.Unauthenticated)
+}
+
+func TestVerifyMFARejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		token func(t *testing.T, s *testService, user *entity.User) string
+		want  codes.Code
+	}{
+		{
+			name: "malformed token",
+			token: func(t *testing.T, s *testService, user *entity.User) string {
+				return "not-a-token"
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "access token",
+			token: func(t *testing.T, s *testService, user *entity.User) string {
+				pair, err := s.tokens.Issue(user)
+				if err != nil {
+					t.Fatalf("Issue: %v", err)
+				}
+				return pair.AccessToken
+			},
+			want: codes.Unauthenticated,
+		},
+		{
+			name: "challenge of a user without totp",
+			token: func(t *testing.T, s *testService, user *entity.User) string {
+				other := s.addUser(t, "bob", true)
+				challenge, err := s.tokens.IssueMFAChallenge(other)
+				if err != nil {
+					t.Fatalf("IssueMFAChallenge: %v", err)
+				}
+				return challenge
+			},
+			want: codes.FailedPrecondition,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			user := s.addUser(t, "alice", true)
+			secret := enableTOTP(t, s, user)
+
+			_, err := s.VerifyMFA(context.Background(), &pb.VerifyMFARequest{
+				MfaToken: tt.token(t, s, user),
+				Code:     totpCode(t, secret, 1),
+			})
+			requireCode(t, err, tt.want)
+		})
+	}
+}
+
+func TestVerifyMFARevokesChallengeAfterFailures(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	secret := enableTOTP(t, s, user)
+	ctx := context.Background()
+	challenge := mfaChallenge(t, s, user)
+
+	for i := range maxMFAAttempts {
+		_, err := s.VerifyMFA(ctx, &pb.VerifyMFARequest{MfaToken: challenge, Code: wrongCode(t, secret)})
+		requireCode(t, err, codes.Unauthenticated)
+		if i < maxMFAAttempts-1 && status.Convert(err).Message() != "invalid mfa code" {
+			t.Fatalf("attempt #%d: %v", i+1, err)
+		}
+	}
+
+	// После исчерпания попыток не проходит и верный код
+	_, err := s.VerifyMFA(ctx, &pb.VerifyMFARequest{MfaToken: challenge, Code: totpCode(t, secret, 1)})
+	requireCode(t, err, codes.Unauthenticated)
+	if message := status.Convert(err).Message(); message != "invalid mfa token" {
+		t.Fatalf("message = %q, want the challenge to be revoked", message)
+	}
+
+	// Новый вход дает новый токен второго шага
+	if _, err := s.VerifyMFA(ctx, &pb.VerifyMFARequest{MfaToken: mfaChallenge(t, s, user), Code: totpCode(t, secret, 1)}); err != nil {
+		t.Fatalf("VerifyMFA with a new challenge: %v", err)
+	}
+}
+
+func TestDisableTOTP(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	ctx := s.authorized(t, user)
+
+	_, err := s.DisableTOTP(ctx, &pb.DisableTOTPRequest{Code: "123456"})
+	requireCode(t, err, codes.FailedPrecondition)
+
+	secret := enableTOTP(t, s, user)
+
+	_, err = s.DisableTOTP(ctx, &pb.DisableTOTPRequest{Code: wrongCode(t, secret)})
+	requireCode(t, err, codes.Unauthenticated)
+
+	if _, err := s.DisableTOTP(ctx, &pb.DisableTOTPRequest{Code: totpCode(t, secret, 1)}); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+
+	response, err := s.Login(context.Background(), &pb.LoginRequest{Login: user.UserName, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	if response.GetMfaRequired() || response.GetToken() == "" {
+		t.Fatalf("Login response = %v, want tokens without mfa", response)
+	}
+}
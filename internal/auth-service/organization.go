@@ -0,0 +1,172 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	"auth/internal/rbac"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const maxOrganizationNameLength = 100
+
+var organizationSlugPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9-]{1,61}[a-z0-9]$`)
+
+// CreateOrganization создает организацию, создатель становится ее
+// владельцем.
+func (s *AuthService) CreateOrganization(ctx context.Context, req *pb.CreateOrganizationRequest) (*pb.CreateOrganizationResponse, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.GetName())
+	if name == "" || len(name) > maxOrganizationNameLength {
+		return nil, status.Errorf(codes.InvalidArgument, "name must be between 1 and %d characters", maxOrganizationNameLength)
+	}
+	slug := strings.ToLower(strings.TrimSpace(req.GetSlug()))
+	if !organizationSlugPattern.MatchString(slug) {
+		return nil, status.Errorf(codes.InvalidArgument, "slug must be 3-63 lowercase letters, digits or '-'")
+	}
+
+	organization, err := s.storage.CreateOrganization(name, slug, user.ID, rbac.OrgRoleOwner)
+	if err != nil {
+		if errors.Is(err, postgres.ErrOrganizationExists) {
+			return nil, status.Errorf(codes.AlreadyExists, "organization with this slug already exists")
+		}
+		s.logger.Error("failed to create organization", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to create organization")
+	}
+
+	s.logger.Info("organization created", "organization_id", organization.ID, "user_id", user.ID)
+	return &pb.CreateOrganizationResponse{Organization: organizationToProto(organization)}, nil
+}
+
+// ListMembers доступен любому участнику организации.
+func (s *AuthService) ListMembers(ctx context.Context, req *pb.ListMembersRequest) (*pb.ListMembersResponse, error) {
+	user, claims, err := s.currentUserClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	organizationID := claims.OrganizationID()
+	if req.GetOrganizationId() != "" {
+		if organizationID, err = parseID(req.GetOrganizationId()); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid organization_id")
+		}
+	}
+	if organizationID == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "no active organization, pass organization_id")
+	}
+
+	if _, err := s.membership(organizationID, user.ID); err != nil {
+		return nil, err
+	}
+
+	members, err := s.storage.ListMembers(organizationID)
+	if err != nil {
+		s.logger.Error("failed to list members", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to list members")
+	}
+
+	response := &pb.ListMembersResponse{Members: make([]*pb.Member, 0, len(members))}
+	for _, member := range members {
+		response.Members = append(response.Members, &pb.Member{
+			UserId:   strconv.FormatUint(uint64(member.UserID), 10),
+			Username: member.User.UserName,
+			Email:    member.User.Email,
+			Role:     member.Role,
+			JoinedAt: member.CreatedAt.Unix(),
+		})
+	}
+
+	return response, nil
+}
+
+// SwitchOrganization выдает новую пару токенов с другой активной
+// организацией и отзывает текущий access-токен.
+func (s *AuthService) SwitchOrganization(ctx context.Context, req *pb.SwitchOrganizationRequest) (*pb.SwitchOrganizationResponse, error) {
+	user, claims, err := s.currentUserClaims(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	organizationID, err := parseID(req.GetOrganizationId())
+	if err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "invalid organization_id")
+	}
+
+	if _, err := s.membership(organizationID, user.ID); err != nil {
+		return nil, err
+	}
+
+	if req.GetRefreshToken() != "" {
+		if err := s.tokens.RevokeRefreshToken(req.GetRefreshToken()); err != nil {
+			if errors.Is(err, token.ErrInvalidRefreshToken) {
+				return nil, status.Errorf(codes.Unauthenticated, "invalid refresh token")
+			}
+			s.logger.Error("failed to revoke refresh token", "error", err)
+			return nil, status.Errorf(codes.Internal, "failed to switch organization")
+		}
+	}
+
+	pair, err := s.tokens.IssueGrant(user, token.Grant{OrganizationID: organizationID})
+	if err != nil {
+		s.logger.Error("failed to generate token", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to generate token")
+	}
+
+	if err := s.tokens.Revoke(claims); err != nil {
+		s.logger.Warn("failed to revoke previous access token", "error", err)
+	}
+
+	s.logger.Info("organization switched", "user_id", user.ID, "organization_id", organizationID)
+	return &pb.SwitchOrganizationResponse{
+		Token:          pair.AccessToken,
+		RefreshToken:   pair.RefreshToken,
+		ExpiresIn:      pair.ExpiresIn,
+		OrganizationId: strconv.FormatUint(uint64(pair.OrganizationID), 10),
+		Role:           pair.OrgRole,
+	}, nil
+}
+
+// membership возвращает членство пользователя. Отсутствие членства и
+// несуществующая организация неразличимы для вызывающего.
+func (s *AuthService) membership(organizationID, userID uint) (*entity.Membership, error) {
+	membership, err := s.storage.GetMembership(organizationID, userID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Errorf(codes.PermissionDenied, "not a member of this organization")
+		}
+		s.logger.Error("failed to get membership", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to get membership")
+	}
+
+	return membership, nil
+}
+
+func parseID(raw string) (uint, error) {
+	id, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil || id == 0 {
+		return 0, errors.New("invalid id")
+	}
+	return uint(id), nil
+}
+
+func organizationToProto(organization *entity.Organization) *pb.Organization {
+	return &pb.Organization{
+		Id:        strconv.FormatUint(uint64(organization.ID), 10),
+		Name:      organization.Name,
+		Slug:      organization.Slug,
+		CreatedAt: organization.CreatedAt.Unix(),
+	}
+}
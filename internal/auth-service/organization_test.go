@@ -0,0 +1,240 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	"auth/internal/rbac"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"slices"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+)
+
+// createOrganization создает организацию, владельцем которой становится user.
+func createOrganization(t *testing.T, s *testService, user *entity.User, slug string) *pb.Organization {
+	t.Helper()
+	created, err := s.CreateOrganization(s.authorized(t, user), &pb.CreateOrganizationRequest{Name: "Org " + slug, Slug: slug})
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	return created.GetOrganization()
+}
+
+func bearer(accessToken string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+accessToken))
+}
+
+func TestCreateOrganization(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+
+	created, err := s.CreateOrganization(s.authorized(t, user), &pb.CreateOrganizationRequest{Name: "  Acme Inc  ", Slug: " Acme-Inc "})
+	if err != nil {
+		t.Fatalf("CreateOrganization: %v", err)
+	}
+	organization := created.GetOrganization()
+	if organization.GetName() != "Acme Inc" || organization.GetSlug() != "acme-inc" || organization.GetId() == "" {
+		t.Fatalf("organization = %v", organization)
+	}
+
+	id, err := parseID(organization.GetId())
+	if err != nil {
+		t.Fatalf("organization id %q: %v", organization.GetId(), err)
+	}
+	membership, err := s.storage.GetMembership(id, user.ID)
+	if err != nil || membership.Role != rbac.OrgRoleOwner {
+		t.Fatalf("creator membership = %v, %v; want owner", membership, err)
+	}
+
+	// Новый токен выдается с единственной организацией пользователя
+	pair, err := s.tokens.Issue(user)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	claims, err := s.tokens.Parse(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if claims.OrgID != organization.GetId() || claims.OrgRole != rbac.OrgRoleOwner {
+		t.Fatalf("org claims = %q/%q, want %s/owner", claims.OrgID, claims.OrgRole, organization.GetId())
+	}
+
+	other := s.addUser(t, "bob", true)
+	_, err = s.CreateOrganization(s.authorized(t, other), &pb.CreateOrganizationRequest{Name: "Acme", Slug: "acme-inc"})
+	requireCode(t, err, codes.AlreadyExists)
+}
+
+func TestCreateOrganizationRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		req  *pb.CreateOrganizationRequest
+	}{
+		{name: "empty name", req: &pb.CreateOrganizationRequest{Name: "  ", Slug: "acme"}},
+		{name: "long name", req: &pb.CreateOrganizationRequest{Name: strings.Repeat("n", maxOrganizationNameLength+1), Slug: "acme"}},
+		{name: "short slug", req: &pb.CreateOrganizationRequest{Name: "Acme", Slug: "ac"}},
+		{name: "long slug", req: &pb.CreateOrganizationRequest{Name: "Acme", Slug: strings.Repeat("a", 64)}},
+		{name: "slug with underscore", req: &pb.CreateOrganizationRequest{Name: "Acme", Slug: "acme_inc"}},
+		{name: "slug with leading dash", req: &pb.CreateOrganizationRequest{Name: "Acme", Slug: "-acme"}},
+		{name: "slug with trailing dash", req: &pb.CreateOrganizationRequest{Name: "Acme", Slug: "acme-"}},
+		{name: "slug with dot", req: &pb.CreateOrganizationRequest{Name: "Acme", Slug: "acme.io"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			user := s.addUser(t, "alice", true)
+
+			_, err := s.CreateOrganization(s.authorized(t, user), tt.req)
+			requireCode(t, err, codes.InvalidArgument)
+		})
+	}
+}
+
+func TestListMembers(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	bob := s.addUser(t, "bob", true)
+	carol := s.addUser(t, "carol", true)
+	organization := createOrganization(t, s, alice, "acme")
+	id, _ := parseID(organization.GetId())
+	s.storage.addMembership(id, bob.ID, rbac.OrgRoleMember)
+
+	tests := []struct {
+		name  string
+		user  *entity.User
+		orgID string
+		want  codes.Code
+	}{
+		{name: "active organization", user: alice},
+		{name: "explicit organization", user: bob, orgID: organization.GetId()},
+		{name: "not a member", user: carol, orgID: organization.GetId(), want: codes.PermissionDenied},
+		{name: "unknown organization", user: alice, orgID: "999", want: codes.PermissionDenied},
+		{name: "no active organization", user: carol, want: codes.InvalidArgument},
+		{name: "invalid organization id", user: alice, orgID: "acme", want: codes.InvalidArgument},
+		{name: "zero organization id", user: alice, orgID: "0", want: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := s.ListMembers(s.authorized(t, tt.user), &pb.ListMembersRequest{OrganizationId: tt.orgID})
+			requireCode(t, err, tt.want)
+			if tt.want != codes.OK {
+				return
+			}
+
+			var members []string
+			for _, member := range response.GetMembers() {
+				members = append(members, member.GetUsername()+":"+member.GetRole())
+			}
+			if want := []string{"alice:owner", "bob:member"}; !slices.Equal(members, want) {
+				t.Fatalf("members = %v, want %v", members, want)
+			}
+		})
+	}
+}
+
+func TestSwitchOrganization(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	bob := s.addUser(t, "bob", true)
+	createOrganization(t, s, alice, "acme")
+	other := createOrganization(t, s, bob, "globex")
+	otherID, _ := parseID(other.GetId())
+	s.storage.addMembership(otherID, alice.ID, rbac.OrgRoleAdmin)
+
+	pair, err := s.tokens.Issue(alice)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	ctx := bearer(pair.AccessToken)
+
+	switched, err := s.SwitchOrganization(ctx, &pb.SwitchOrganizationRequest{
+		OrganizationId: other.GetId(),
+		RefreshToken:   pair.RefreshToken,
+	})
+	if err != nil {
+		t.Fatalf("SwitchOrganization: %v", err)
+	}
+	if switched.GetOrganizationId() != other.GetId() || switched.GetRole() != rbac.OrgRoleAdmin {
+		t.Fatalf("SwitchOrganization = %v", switched)
+	}
+	claims, err := s.tokens.Parse(switched.GetToken())
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if claims.OrgID != other.GetId() || claims.OrgRole != rbac.OrgRoleAdmin {
+		t.Fatalf("org claims = %q/%q", claims.OrgID, claims.OrgRole)
+	}
+
+	// Прежние access- и refresh-токены больше не действуют
+	_, err = s.ListMembers(ctx, &pb.ListMembersRequest{})
+	requireCode(t, err, codes.Unauthenticated)
+	stored, err := s.storage.GetRefreshToken(token.Hash(pair.RefreshToken))
+	if err != nil {
+		t.Fatalf("GetRefreshToken: %v", err)
+	}
+	if stored.RevokedAt == nil {
+		t.Fatal("previous refresh token is not revoked")
+	}
+
+	// С новым токеном активна другая организация
+	listed, err := s.ListMembers(bearer(switched.GetToken()), &pb.ListMembersRequest{})
+	if err != nil {
+		t.Fatalf("ListMembers: %v", err)
+	}
+	if len(listed.GetMembers()) != 2 || listed.GetMembers()[0].GetUsername() != "bob" {
+		t.Fatalf("members = %v", listed.GetMembers())
+	}
+}
+
+func TestSwitchOrganizationRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		member bool
+		req    func(org *pb.Organization) *pb.SwitchOrganizationRequest
+		want   codes.Code
+	}{
+		{
+			name: "not a member",
+			req: func(org *pb.Organization) *pb.SwitchOrganizationRequest {
+				return &pb.SwitchOrganizationRequest{OrganizationId: org.GetId()}
+			},
+			want: codes.PermissionDenied,
+		},
+		{
+			name: "invalid organization id",
+			req: func(*pb.Organization) *pb.SwitchOrganizationRequest {
+				return &pb.SwitchOrganizationRequest{OrganizationId: "globex"}
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name:   "unknown refresh token",
+			member: true,
+			req: func(org *pb.Organization) *pb.SwitchOrganizationRequest {
+				return &pb.SwitchOrganizationRequest{OrganizationId: org.GetId(), RefreshToken: "unknown"}
+			},
+			want: codes.Unauthenticated,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			alice := s.addUser(t, "alice", true)
+			bob := s.addUser(t, "bob", true)
+			org := createOrganization(t, s, bob, "globex")
+			if tt.member {
+				id, _ := parseID(org.GetId())
+				s.storage.addMembership(id, alice.ID, rbac.OrgRoleMember)
+			}
+
+			_, err := s.SwitchOrganization(s.authorized(t, alice), tt.req(org))
+			requireCode(t, err, tt.want)
+		})
+	}
+}
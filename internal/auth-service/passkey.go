@@ -0,0 +1,271 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	"auth/internal/redis"
+	"auth/internal/token"
+	"auth/internal/webauthn"
+	pb "auth/proto/auth"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	passkeyRegistrationPrefix = "webauthn:registration:"
+	passkeyLoginPrefix        = "webauthn:login:"
+)
+
+func (s *AuthService) BeginPasskeyRegistration(ctx context.Context, req *pb.BeginPasskeyRegistrationRequest) (*pb.BeginPasskeyRegistrationResponse, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	existing, err := s.passkeyDescriptors(user.ID)
+	if err != nil {
+		s.logger.Error("failed to list passkeys", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to begin passkey registration")
+	}
+
+	options, session, err := s.webauthn.BeginRegistration(userHandle(user), user.UserName, user.UserName, existing)
+	if err != nil {
+		s.logger.Error("failed to begin passkey registration", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to begin passkey registration")
+	}
+	session.UserID = user.ID
+
+	if err := s.saveWebAuthnSession(passkeyRegistrationPrefix+strconv.FormatUint(uint64(user.ID), 10), session); err != nil {
+		s.logger.Error("failed to save webauthn session", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to begin passkey registration")
+	}
+
+	optionsJSON, err := json.Marshal(map[string]interface{}{"publicKey": options})
+	if err != nil {
+		s.logger.Error("failed to marshal passkey options", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to begin passkey registration")
+	}
+
+	return &pb.BeginPasskeyRegistrationResponse{OptionsJson: string(optionsJSON)}, nil
+}
+
+func (s *AuthService) FinishPasskeyRegistration(ctx context.Context, req *pb.FinishPasskeyRegistrationRequest) (*pb.FinishPasskeyRegistrationResponse, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	session, err := s.takeWebAuthnSession(passkeyRegistrationPrefix + strconv.FormatUint(uint64(user.ID), 10))
+	if err != nil {
+		return nil, s.webauthnSessionError(err)
+	}
+
+	credential, err := s.webauthn.FinishRegistration(session, []byte(req.GetCredentialJson()))
+	if err != nil {
+		s.logger.Warn("passkey registration rejected", "user_id", user.ID, "error", err)
+		return nil, status.Errorf(codes.InvalidArgument, "passkey registration failed")
+	}
+
+	if _, err := s.storage.GetWebAuthnCredential(credential.ID); err == nil {
+		return nil, status.Errorf(codes.AlreadyExists, "passkey is already registered")
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.logger.Error("failed to get passkey", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to register passkey")
+	}
+
+	if err := s.storage.SaveWebAuthnCredential(user.ID, credential.ID, credential.PublicKey, credential.SignCount, credential.Transports); err != nil {
+		s.logger.Error("failed to save passkey", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to register passkey")
+	}
+
+	if err := s.sendNotificationEvent(user.Email, "a new passkey was added to your account", map[string]string{
+		"type": "passkey_registered",
+	}); err != nil {
+		s.logger.Warn("failed to send notification", "error", err)
+	}
+
+	s.logger.Info("passkey registered", "user_id", user.ID)
+	return &pb.FinishPasskeyRegistrationResponse{Message: "passkey successfully registered"}, nil
+}
+
+// BeginPasskeyLogin начинает вход по passkey. Без имени пользователя
+// аутентификатор сам предлагает подходящий discoverable credential.
+func (s *AuthService) BeginPasskeyLogin(ctx context.Context, req *pb.BeginPasskeyLoginRequest) (*pb.BeginPasskeyLoginResponse, error) {
+	var (
+		userID uint
+		allow  []webauthn.Descriptor
+	)
+	if req.GetUsername() != "" {
+		user, err := s.getUserByLogin(req.GetUsername())
+		if err != nil {
+			s.logger.Warn("failed to get user", "username", req.GetUsername(), "error", err)
+			return nil, status.Errorf(codes.NotFound, "user not found")
+		}
+
+		allow, err = s.passkeyDescriptors(user.ID)
+		if err != nil {
+			s.logger.Error("failed to list passkeys", "error", err)
+			return nil, status.Errorf(codes.Internal, "failed to begin passkey login")
+		}
+		if len(allow) == 0 {
+			return nil, status.Errorf(codes.FailedPrecondition, "user has no passkeys")
+		}
+		userID = user.ID
+	}
+
+	options, session, err := s.webauthn.BeginLogin(allow)
+	if err != nil {
+		s.logger.Error("failed to begin passkey login", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to begin passkey login")
+	}
+	session.UserID = userID
+
+	sessionID, err := token.RandomString(32)
+	if err != nil {
+		s.logger.Error("failed to generate session id", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to begin passkey login")
+	}
+
+	if err := s.saveWebAuthnSession(passkeyLoginPrefix+sessionID, session); err != nil {
+		s.logger.Error("failed to save webauthn session", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to begin passkey login")
+	}
+
+	optionsJSON, err := json.Marshal(map[string]interface{}{"publicKey": options})
+	if err != nil {
+		s.logger.Error("failed to marshal passkey options", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to begin passkey login")
+	}
+
+	return &pb.BeginPasskeyLoginResponse{SessionId: sessionID, OptionsJson: string(optionsJSON)}, nil
+}
+
+// FinishPasskeyLogin проверяет подпись и выдает токены как Login.
+// Passkey с проверкой пользователя (UV) считается вторым фактором.
+func (s *AuthService) FinishPasskeyLogin(ctx context.Context, req *pb.FinishPasskeyLoginRequest) (*pb.LoginResponse, error) {
+	response, user, err := s.finishPasskeyLogin(req)
+	s.recordLogin(ctx, user, "", loginMethodPasskey, response.GetMfaRequired(), err)
+	return response, err
+}
+
+func (s *AuthService) finishPasskeyLogin(req *pb.FinishPasskeyLoginRequest) (*pb.LoginResponse, *entity.User, error) {
+	session, err := s.takeWebAuthnSession(passkeyLoginPrefix + req.GetSessionId())
+	if err != nil {
+		return nil, nil, s.webauthnSessionError(err)
+	}
+
+	assertion, err := s.webauthn.ParseAssertion([]byte(req.GetCredentialJson()))
+	if err != nil {
+		s.logger.Warn("invalid passkey assertion", "error", err)
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid passkey assertion")
+	}
+
+	credential, err := s.storage.GetWebAuthnCredential(assertion.CredentialID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Warn("unknown passkey")
+			return nil, nil, status.Errorf(codes.Unauthenticated, "passkey login failed")
+		}
+		s.logger.Error("failed to get passkey", "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "failed to finish passkey login")
+	}
+
+	if session.UserID != 0 && credential.UserID != session.UserID {
+		s.logger.Warn("passkey belongs to another user", "user_id", session.UserID)
+		return nil, nil, status.Errorf(codes.Unauthenticated, "passkey login failed")
+	}
+
+	user, err := s.storage.GetUserByID(credential.UserID)
+	if err != nil {
+		s.logger.Error("failed to get user", "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "failed to finish passkey login")
+	}
+
+	if err := s.checkLockout(user); err != nil {
+		return nil, user, err
+	}
+
+	if len(assertion.UserHandle) != 0 && !bytes.Equal(assertion.UserHandle, userHandle(user)) {
+		s.logger.Warn("passkey user handle mismatch", "user_id", user.ID)
+		s.registerLoginFailure(user)
+		return nil, user, status.Errorf(codes.Unauthenticated, "passkey login failed")
+	}
+
+	signCount, userVerified, err := s.webauthn.FinishLogin(session, assertion, credential.PublicKey, credential.SignCount)
+	if err != nil {
+		s.logger.Warn("passkey login rejected", "user_id", user.ID, "error", err)
+		s.registerLoginFailure(user)
+		return nil, user, status.Errorf(codes.Unauthenticated, "passkey login failed")
+	}
+
+	if err := s.storage.UpdateWebAuthnSignCount(credential.ID, signCount); err != nil {
+		s.logger.Error("failed to update passkey sign count", "error", err)
+		return nil, user, status.Errorf(codes.Internal, "failed to finish passkey login")
+	}
+
+	response, err := s.completeLogin(user, userVerified)
+	return response, user, err
+}
+
+func (s *AuthService) passkeyDescriptors(userID uint) ([]webauthn.Descriptor, error) {
+	credentials, err := s.storage.ListWebAuthnCredentials(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	descriptors := make([]webauthn.Descriptor, 0, len(credentials))
+	for _, c := range credentials {
+		var transports []string
+		if c.Transports != "" {
+			transports = strings.Split(c.Transports, ",")
+		}
+		descriptors = append(descriptors, webauthn.Descriptor{ID: c.CredentialID, Transports: transports})
+	}
+
+	return descriptors, nil
+}
+
+func (s *AuthService) saveWebAuthnSession(key string, session *webauthn.Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	return s.cache.Put(key, string(data), s.webauthn.Timeout())
+}
+
+// takeWebAuthnSession атомарно читает и удаляет сессию: один challenge
+// годится только для одной попытки, даже при параллельных запросах.
+func (s *AuthService) takeWebAuthnSession(key string) (*webauthn.Session, error) {
+	data, err := s.cache.Take(key)
+	if err != nil {
+		return nil, err
+	}
+
+	var session webauthn.Session
+	if err := json.Unmarshal([]byte(data), &session); err != nil {
+		return nil, err
+	}
+
+	return &session, nil
+}
+
+func (s *AuthService) webauthnSessionError(err error) error {
+	if errors.Is(err, redis.ErrNotFound) {
+		return status.Errorf(codes.FailedPrecondition, "passkey ceremony has expired or was not started")
+	}
+	s.logger.Error("failed to load webauthn session", "error", err)
+	return status.Errorf(codes.Internal, "failed to load passkey ceremony")
+}
+
+// userHandle - идентификатор пользователя для WebAuthn, без личных данных.
+func userHandle(user *entity.User) []byte {
+	return []byte(strconv.FormatUint(uint64(user.ID), 10))
+}
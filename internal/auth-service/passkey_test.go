@@ -0,0 +1,244 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	"auth/internal/webauthn/webauthntest"
+	pb "auth/proto/auth"
+	"context"
+	"encoding/json"
+	"sync"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// registerPasskey проходит регистрацию passkey программным аутентификатором.
+func registerPasskey(t *testing.T, s *testService, user *entity.User, authenticator *webauthntest.Authenticator) {
+	t.Helper()
+	ctx := s.authorized(t, user)
+
+	begin, err := s.BeginPasskeyRegistration(ctx, &pb.BeginPasskeyRegistrationRequest{})
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration: %v", err)
+	}
+	credential, err := authenticator.Register([]byte(begin.GetOptionsJson()))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	if _, err := s.FinishPasskeyRegistration(ctx, &pb.FinishPasskeyRegistrationRequest{CredentialJson: string(credential)}); err != nil {
+		t.Fatalf("FinishPasskeyRegistration: %v", err)
+	}
+}
+
+// beginPasskeyLogin начинает вход и подписывает challenge аутентификатором.
+func beginPasskeyLogin(t *testing.T, s *testService, username string, authenticator *webauthntest.Authenticator) *pb.FinishPasskeyLoginRequest {
+	t.Helper()
+	begin, err := s.BeginPasskeyLogin(context.Background(), &pb.BeginPasskeyLoginRequest{Username: username})
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin: %v", err)
+	}
+	assertion, err := authenticator.Login([]byte(begin.GetOptionsJson()))
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	return &pb.FinishPasskeyLoginRequest{SessionId: begin.GetSessionId(), CredentialJson: string(assertion)}
+}
+
+func passkeyLogin(t *testing.T, s *testService, username string, authenticator *webauthntest.Authenticator) (*pb.LoginResponse, error) {
+	t.Helper()
+	return s.FinishPasskeyLogin(context.Background(), beginPasskeyLogin(t, s, username, authenticator))
+}
+
+func TestPasskeyRegistrationAndLogin(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	authenticator := webauthntest.New(testOrigin)
+
+	registerPasskey(t, s, alice, authenticator)
+	if event := s.writer.last(t, "passkey_registered"); event["email"] != alice.Email {
+		t.Fatalf("notification = %v", event)
+	}
+
+	// По имени пользователя и без него, через discoverable credential
+	for i, username := range []string{"alice", ""} {
+		response, err := passkeyLogin(t, s, username, authenticator)
+		if err != nil {
+			t.Fatalf("FinishPasskeyLogin %q: %v", username, err)
+		}
+		if response.GetToken() == "" || response.GetMfaRequired() {
+			t.Fatalf("FinishPasskeyLogin %q = %v, want a token pair", username, response)
+		}
+
+		credentials, err := s.storage.ListWebAuthnCredentials(alice.ID)
+		if err != nil {
+			t.Fatalf("ListWebAuthnCredentials: %v", err)
+		}
+		if len(credentials) != 1 || credentials[0].SignCount != uint32(i+1) {
+			t.Fatalf("credentials = %+v, want one with sign count %d", credentials, i+1)
+		}
+	}
+
+	// Тот же ключ второй раз не регистрируется
+	ctx := s.authorized(t, alice)
+	begin, err := s.BeginPasskeyRegistration(ctx, &pb.BeginPasskeyRegistrationRequest{})
+	if err != nil {
+		t.Fatalf("BeginPasskeyRegistration: %v", err)
+	}
+	var options struct {
+		PublicKey struct {
+			ExcludeCredentials []json.RawMessage `json:"excludeCredentials"`
+		} `json:"publicKey"`
+	}
+	if err := json.Unmarshal([]byte(begin.GetOptionsJson()), &options); err != nil {
+		t.Fatal(err)
+	}
+	if len(options.PublicKey.ExcludeCredentials) != 1 {
+		t.Fatalf("excludeCredentials = %d, want the registered passkey", len(options.PublicKey.ExcludeCredentials))
+	}
+}
+
+func TestPasskeySessionRejects(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	authenticator := webauthntest.New(testOrigin)
+	registerPasskey(t, s, alice, authenticator)
+
+	req := beginPasskeyLogin(t, s, "alice", authenticator)
+	if _, err := s.FinishPasskeyLogin(context.Background(), req); err != nil {
+		t.Fatalf("FinishPasskeyLogin: %v", err)
+	}
+
+	// Сессия одноразовая
+	_, err := s.FinishPasskeyLogin(context.Background(), req)
+	requireCode(t, err, codes.FailedPrecondition)
+
+	// Истекшая сессия удаляется из кэша так же, как использованная
+	req = beginPasskeyLogin(t, s, "alice", authenticator)
+	if err := s.cache.Delete(passkeyLoginPrefix + req.GetSessionId()); err != nil {
+		t.Fatal(err)
+	}
+	_, err = s.FinishPasskeyLogin(context.Background(), req)
+	requireCode(t, err, codes.FailedPrecondition)
+
+	// Регистрация без начатой церемонии
+	_, err = s.FinishPasskeyRegistration(s.authorized(t, alice), &pb.FinishPasskeyRegistrationRequest{CredentialJson: "{}"})
+	requireCode(t, err, codes.FailedPrecondition)
+}
+
+func TestPasskeySessionConcurrentReplay(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	authenticator := webauthntest.New(testOrigin)
+	registerPasskey(t, s, alice, authenticator)
+	req := beginPasskeyLogin(t, s, "alice", authenticator)
+
+	const attempts = 8
+	var wg sync.WaitGroup
+	results := make(chan codes.Code, attempts)
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := s.FinishPasskeyLogin(context.Background(), req)
+			results <- status.Code(err)
+		}()
+	}
+	wg.Wait()
+	close(results)
+
+	succeeded := 0
+	for code := range results {
+		switch code {
+		case codes.OK:
+			succeeded++
+		case codes.FailedPrecondition:
+		default:
+			t.Fatalf("code = %v, want OK or FailedPrecondition", code)
+		}
+	}
+	if succeeded != 1 {
+		t.Fatalf("challenge was used %d times, want once", succeeded)
+	}
+}
+
+func TestPasskeyOfAnotherUser(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	bob := s.addUser(t, "bob", true)
+	registerPasskey(t, s, alice, webauthntest.New(testOrigin))
+	bobAuthenticator := webauthntest.New(testOrigin)
+	registerPasskey(t, s, bob, bobAuthenticator)
+
+	begin, err := s.BeginPasskeyLogin(context.Background(), &pb.BeginPasskeyLoginRequest{Username: "alice"})
+	if err != nil {
+		t.Fatalf("BeginPasskeyLogin: %v", err)
+	}
+
+	// Аутентификатор Боба подписывает challenge, выданный для Алисы
+	var options map[string]map[string]interface{}
+	if err := json.Unmarshal([]byte(begin.GetOptionsJson()), &options); err != nil {
+		t.Fatal(err)
+	}
+	delete(options["publicKey"], "allowCredentials")
+	optionsJSON, err := json.Marshal(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertion, err := bobAuthenticator.Login(optionsJSON)
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+
+	_, err = s.FinishPasskeyLogin(context.Background(), &pb.FinishPasskeyLoginRequest{SessionId: begin.GetSessionId(), CredentialJson: string(assertion)})
+	requireCode(t, err, codes.Unauthenticated)
+}
+
+func TestPasskeySignCountRegression(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	authenticator := webauthntest.New(testOrigin)
+	registerPasskey(t, s, alice, authenticator)
+
+	if _, err := passkeyLogin(t, s, "alice", authenticator); err != nil {
+		t.Fatalf("FinishPasskeyLogin: %v", err)
+	}
+
+	// Клон ключа присылает счетчик, который сервер уже видел
+	authenticator.SetSignCount(0)
+	_, err := passkeyLogin(t, s, "alice", authenticator)
+	requireCode(t, err, codes.Unauthenticated)
+
+	credentials, err := s.storage.ListWebAuthnCredentials(alice.ID)
+	if err != nil {
+		t.Fatalf("ListWebAuthnCredentials: %v", err)
+	}
+	if credentials[0].SignCount != 1 {
+		t.Fatalf("sign count = %d, want 1", credentials[0].SignCount)
+	}
+}
+
+func TestPasskeyLoginLockout(t *testing.T) {
+	s := newLockoutService(t)
+	alice := s.addUser(t, "alice", true)
+	authenticator := webauthntest.New(testOrigin)
+	registerPasskey(t, s, alice, authenticator)
+
+	// Подписи чужим ключом считаются неудачными входами
+	if err := authenticator.ReplaceKeys(); err != nil {
+		t.Fatal(err)
+	}
+	for range lockoutThreshold {
+		_, err := passkeyLogin(t, s, "alice", authenticator)
+		requireCode(t, err, codes.Unauthenticated)
+	}
+	if event := s.writer.last(t, "account_locked"); event["email"] != alice.Email {
+		t.Fatalf("lockout notification = %v", event)
+	}
+
+	// Заблокированная учетная запись не входит и с верным ключом
+	valid := webauthntest.New(testOrigin)
+	registerPasskey(t, s, alice, valid)
+	_, err := passkeyLogin(t, s, "alice", valid)
+	requireCode(t, err, codes.ResourceExhausted)
+}
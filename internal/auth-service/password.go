@@ -0,0 +1,76 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	"auth/internal/identity"
+	"auth/internal/passwordpolicy"
+	pb "auth/proto/auth"
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// EvaluatePassword оценивает пароль по политике для индикатора стойкости.
+// Не требует авторизации и ничего не сохраняет.
+func (s *AuthService) EvaluatePassword(ctx context.Context, req *pb.EvaluatePasswordRequest) (*pb.EvaluatePasswordResponse, error) {
+	user := passwordpolicy.UserInfo{Username: req.GetUsername(), Email: req.GetEmail()}
+	// Сравниваем с тем видом, в котором данные будут сохранены
+	if username, err := identity.NormalizeUsername(user.Username); err == nil {
+		user.Username = username
+	}
+	if email, err := identity.NormalizeEmail(user.Email); err == nil {
+		user.Email = email
+	}
+
+	result := s.passwords.Evaluate(req.GetPassword(), user)
+
+	response := &pb.EvaluatePasswordResponse{
+		Score:       int32(result.Score),
+		Strength:    passwordpolicy.ScoreLabels[result.Score],
+		EntropyBits: result.Entropy,
+		Acceptable:  result.Acceptable(),
+		Violations:  make([]*pb.PasswordViolation, 0, len(result.Violations)),
+	}
+	for _, violation := range result.Violations {
+		response.Violations = append(response.Violations, &pb.PasswordViolation{
+			Rule:        violation.Rule,
+			Description: violation.Description,
+		})
+	}
+
+	return response, nil
+}
+
+// checkPassword возвращает InvalidArgument с нарушенными правилами политики.
+// history - хеши недавних паролей существующего пользователя, для новых nil.
+func (s *AuthService) checkPassword(password string, user passwordpolicy.UserInfo, history [][]byte) error {
+	result := s.passwords.Evaluate(password, user)
+	result.CheckReuse(password, history)
+	if !result.Acceptable() {
+		rules := make([]string, 0, len(result.Violations))
+		for _, violation := range result.Violations {
+			rules = append(rules, violation.Rule)
+		}
+		s.logger.Warn("password rejected by policy", "rules", rules)
+	}
+
+	return result.Err()
+}
+
+// passwordHistory возвращает текущий и прежние хеши пароля в пределах
+// настроенной глубины истории.
+func (s *AuthService) passwordHistory(user *entity.User) ([][]byte, error) {
+	size := s.passwords.HistorySize()
+	if size == 0 {
+		return nil, nil
+	}
+
+	hashes, err := s.storage.GetPasswordHistory(user.ID, size-1)
+	if err != nil {
+		s.logger.Error("failed to get password history", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to check password history")
+	}
+
+	return append([][]byte{user.HashedPassword}, hashes...), nil
+}
@@ -0,0 +1,109 @@
+package authservice
+
+import (
+	"auth/internal/config"
+	"auth/internal/passwordpolicy"
+	pb "auth/proto/auth"
+	"context"
+	"slices"
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// strictPolicy требует все классы символов и не пускает имя пользователя.
+func strictPolicy(cfg *config.Config) {
+	cfg.PasswordPolicyConfig = config.PasswordPolicyConfig{
+		MinLength:      10,
+		RequireLower:   true,
+		RequireUpper:   true,
+		RequireDigit:   true,
+		RequireSymbol:  true,
+		MinScore:       3,
+		ForbidUserInfo: true,
+	}
+}
+
+// violatedRules возвращает правила из ErrorInfo в деталях ошибки.
+func violatedRules(t *testing.T, err error) []string {
+	t.Helper()
+	for _, detail := range status.Convert(err).Details() {
+		if info, ok := detail.(*errdetails.ErrorInfo); ok {
+			rules := make([]string, 0, len(info.GetMetadata()))
+			for rule := range info.GetMetadata() {
+				rules = append(rules, rule)
+			}
+			slices.Sort(rules)
+			return rules
+		}
+	}
+	t.Fatalf("error %v has no ErrorInfo detail", err)
+	return nil
+}
+
+func TestEvaluatePassword(t *testing.T) {
+	s := newTestServiceWithConfig(t, strictPolicy)
+
+	tests := []struct {
+		name           string
+		req            *pb.EvaluatePasswordRequest
+		wantAcceptable bool
+		wantRules      []string
+	}{
+		{name: "acceptable", req: &pb.EvaluatePasswordRequest{Password: "Violet-Harbor-Lantern-58"}, wantAcceptable: true},
+		{name: "weak", req: &pb.EvaluatePasswordRequest{Password: "short"}, wantRules: []string{
+			passwordpolicy.RuleMinLength, passwordpolicy.RuleUppercase, passwordpolicy.RuleDigit,
+			passwordpolicy.RuleSymbol, passwordpolicy.RuleWeak,
+		}},
+		// Имя сравнивается в нормализованном виде
+		{
+			name:      "username",
+			req:       &pb.EvaluatePasswordRequest{Password: "Harbor-alice-Lantern-58", Username: "  ALICE "},
+			wantRules: []string{passwordpolicy.RuleContainsUserInfo},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := s.EvaluatePassword(context.Background(), tt.req)
+			if err != nil {
+				t.Fatalf("EvaluatePassword: %v", err)
+			}
+			if response.GetAcceptable() != tt.wantAcceptable {
+				t.Fatalf("Acceptable = %v, want %v", response.GetAcceptable(), tt.wantAcceptable)
+			}
+			if response.GetStrength() != passwordpolicy.ScoreLabels[response.GetScore()] {
+				t.Fatalf("strength = %q for score %d", response.GetStrength(), response.GetScore())
+			}
+
+			rules := make([]string, 0, len(response.GetViolations()))
+			for _, violation := range response.GetViolations() {
+				rules = append(rules, violation.GetRule())
+			}
+			if !slices.Equal(rules, tt.wantRules) && len(rules)+len(tt.wantRules) > 0 {
+				t.Fatalf("rules = %v, want %v", rules, tt.wantRules)
+			}
+		})
+	}
+}
+
+func TestRegisterEnforcesPasswordPolicy(t *testing.T) {
+	s := newTestServiceWithConfig(t, strictPolicy)
+	ctx := context.Background()
+
+	_, err := s.Register(ctx, &pb.RegisterRequest{Username: "alice", Email: "alice@example.com", Age: 30, Password: "Alice-Harbor-Lantern-58"})
+	requireCode(t, err, codes.InvalidArgument)
+	if got, want := violatedRules(t, err), []string{passwordpolicy.RuleContainsUserInfo}; !slices.Equal(got, want) {
+		t.Fatalf("rules = %v, want %v", got, want)
+	}
+	if _, err := s.storage.GetUserByUserName("alice"); err == nil {
+		t.Fatal("user was saved despite the policy violation")
+	}
+
+	_, err = s.Register(ctx, &pb.RegisterRequest{Username: "alice", Email: "alice@example.com", Age: 30, Password: "Violet-Harbor-Lantern-58"})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+}
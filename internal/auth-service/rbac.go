@@ -0,0 +1,261 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	"auth/internal/rbac"
+	"auth/internal/storage/postgres"
+	pb "auth/proto/auth"
+	"context"
+	"errors"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const maxRoleDescriptionLength = 256
+
+// CreateRole создает роль с набором разрешений. Повторы в списке отбрасываются.
+func (s *AuthService) CreateRole(ctx context.Context, req *pb.CreateRoleRequest) (*pb.CreateRoleResponse, error) {
+	admin, err := s.requirePermission(ctx, rbac.PermissionManageRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	name := strings.TrimSpace(req.GetName())
+	if err := rbac.ValidateRoleName(name); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+	description := strings.TrimSpace(req.GetDescription())
+	if len(description) > maxRoleDescriptionLength {
+		return nil, status.Errorf(codes.InvalidArgument, "description must be at most %d characters", maxRoleDescriptionLength)
+	}
+	if len(req.GetPermissions()) > rbac.MaxPermissionsPerRole {
+		return nil, status.Errorf(codes.InvalidArgument, "too many permissions")
+	}
+
+	seen := make(map[string]struct{}, len(req.GetPermissions()))
+	permissions := make([]string, 0, len(req.GetPermissions()))
+	for _, permission := range req.GetPermissions() {
+		permission = strings.TrimSpace(permission)
+		if err := rbac.ValidatePermission(permission); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "%q: %v", permission, err)
+		}
+		if _, ok := seen[permission]; ok {
+			continue
+		}
+		seen[permission] = struct{}{}
+		permissions = append(permissions, permission)
+	}
+
+	role, err := s.storage.CreateRole(name, description, permissions)
+	if err != nil {
+		if errors.Is(err, postgres.ErrRoleAlreadyExists) {
+			return nil, status.Errorf(codes.AlreadyExists, "role already exists")
+		}
+		s.logger.Error("failed to create role", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to create role")
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:  audit.ActionRoleCreate,
+		ActorID: admin.ID,
+		Details: map[string]string{"role": role.Name, "permissions": strings.Join(roleToProto(role).GetPermissions(), ",")},
+	})
+	s.logger.Info("role created", "role", role.Name, "admin_id", admin.ID)
+	return &pb.CreateRoleResponse{Role: roleToProto(role)}, nil
+}
+
+// ListRoles возвращает все роли вместе с их разрешениями.
+func (s *AuthService) ListRoles(ctx context.Context, req *pb.ListRolesRequest) (*pb.ListRolesResponse, error) {
+	if _, err := s.requirePermission(ctx, rbac.PermissionManageRoles); err != nil {
+		return nil, err
+	}
+
+	roles, err := s.storage.ListRoles()
+	if err != nil {
+		s.logger.Error("failed to list roles", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to list roles")
+	}
+
+	response := &pb.ListRolesResponse{Roles: make([]*pb.Role, 0, len(roles))}
+	for i := range roles {
+		response.Roles = append(response.Roles, roleToProto(&roles[i]))
+	}
+
+	return response, nil
+}
+
+// AssignRole назначает роль. Уже выданные токены получат новую роль при
+// следующем обновлении, CheckPermission видит ее сразу.
+func (s *AuthService) AssignRole(ctx context.Context, req *pb.AssignRoleRequest) (*pb.AssignRoleResponse, error) {
+	admin, err := s.requirePermission(ctx, rbac.PermissionManageRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	user, role, err := s.userAndRole(req.GetUserId(), req.GetRole())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.AssignRole(user.ID, role.ID); err != nil {
+		s.logger.Error("failed to assign role", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to assign role")
+	}
+
+	if err := s.sendNotificationEvent(user.Email, "you were granted the role "+role.Name, map[string]string{
+		"type": "role_assigned",
+		"role": role.Name,
+	}); err != nil {
+		s.logger.Warn("failed to send notification", "error", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:    audit.ActionRoleAssign,
+		ActorID:   admin.ID,
+		SubjectID: user.ID,
+		Details:   map[string]string{"role": role.Name},
+	})
+	s.logger.Info("role assigned", "user_id", user.ID, "role", role.Name, "admin_id", admin.ID)
+	return &pb.AssignRoleResponse{Message: "role assigned"}, nil
+}
+
+// UnassignRole снимает с пользователя роль, которая у него есть.
+func (s *AuthService) UnassignRole(ctx context.Context, req *pb.UnassignRoleRequest) (*pb.UnassignRoleResponse, error) {
+	admin, err := s.requirePermission(ctx, rbac.PermissionManageRoles)
+	if err != nil {
+		return nil, err
+	}
+
+	user, role, err := s.userAndRole(req.GetUserId(), req.GetRole())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.storage.UnassignRole(user.ID, role.ID); err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Errorf(codes.NotFound, "user does not have this role")
+		}
+		s.logger.Error("failed to unassign role", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to unassign role")
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:    audit.ActionRoleUnassign,
+		ActorID:   admin.ID,
+		SubjectID: user.ID,
+		Details:   map[string]string{"role": role.Name},
+	})
+	s.logger.Info("role unassigned", "user_id", user.ID, "role", role.Name, "admin_id", admin.ID)
+	return &pb.UnassignRoleResponse{Message: "role unassigned"}, nil
+}
+
+// CheckPermission проверяет право по текущим ролям из базы, а не по
+// claims токена, поэтому снятие роли действует сразу.
+func (s *AuthService) CheckPermission(ctx context.Context, req *pb.CheckPermissionRequest) (*pb.CheckPermissionResponse, error) {
+	caller, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	userID := uint64(caller.ID)
+	if req.GetUserId() != "" {
+		if userID, err = strconv.ParseUint(req.GetUserId(), 10, 64); err != nil {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid user_id")
+		}
+	}
+	if err := rbac.ValidatePermission(req.GetPermission()); err != nil {
+		return nil, status.Errorf(codes.InvalidArgument, "%v", err)
+	}
+
+	// Права других пользователей видны только администраторам ролей
+	if uint(userID) != caller.ID {
+		if _, err := s.requirePermission(ctx, rbac.PermissionManageRoles); err != nil {
+			return nil, err
+		}
+	}
+
+	roles, err := s.storage.GetUserRoles(uint(userID))
+	if err != nil {
+		s.logger.Error("failed to get user roles", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to check permission")
+	}
+
+	return &pb.CheckPermissionResponse{
+		Allowed: rbac.HasPermission(roles, req.GetPermission()),
+		Roles:   rbac.RoleNames(roles),
+	}, nil
+}
+
+// requirePermission возвращает текущего пользователя, если у него есть
+// право permission.
+func (s *AuthService) requirePermission(ctx context.Context, permission string) (*entity.User, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	roles, err := s.storage.GetUserRoles(user.ID)
+	if err != nil {
+		s.logger.Error("failed to get user roles", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to check permission")
+	}
+
+	if !rbac.HasPermission(roles, permission) {
+		s.logger.Warn("permission denied", "user_id", user.ID, "permission", permission)
+		s.audit.Record(ctx, audit.Event{
+			Action:  audit.ActionPermissionDenied,
+			ActorID: user.ID,
+			Result:  audit.ResultFailure,
+			Details: map[string]string{"permission": permission},
+		})
+		return nil, status.Errorf(codes.PermissionDenied, "permission denied")
+	}
+
+	return user, nil
+}
+
+func (s *AuthService) userAndRole(rawUserID, roleName string) (*entity.User, *entity.Role, error) {
+	userID, err := strconv.ParseUint(rawUserID, 10, 64)
+	if err != nil {
+		return nil, nil, status.Errorf(codes.InvalidArgument, "invalid user_id")
+	}
+
+	user, err := s.storage.GetUserByID(uint(userID))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, status.Errorf(codes.NotFound, "user not found")
+		}
+		s.logger.Error("failed to get user", "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "failed to get user")
+	}
+
+	role, err := s.storage.GetRoleByName(strings.TrimSpace(roleName))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, nil, status.Errorf(codes.NotFound, "role not found")
+		}
+		s.logger.Error("failed to get role", "error", err)
+		return nil, nil, status.Errorf(codes.Internal, "failed to get role")
+	}
+
+	return user, role, nil
+}
+
+func roleToProto(role *entity.Role) *pb.Role {
+	permissions := make([]string, 0, len(role.Permissions))
+	for _, permission := range role.Permissions {
+		permissions = append(permissions, permission.Name)
+	}
+
+	return &pb.Role{
+		Id:          uint64(role.ID),
+		Name:        role.Name,
+		Description: role.Description,
+		Permissions: permissions,
+	}
+}
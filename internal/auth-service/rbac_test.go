@@ -0,0 +1,266 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	"auth/internal/rbac"
+	pb "auth/proto/auth"
+	"slices"
+	"strconv"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+// addAdmin создает пользователя с правом управлять ролями.
+func (s *testService) addAdmin(t *testing.T) *entity.User {
+	t.Helper()
+	admin := s.addUser(t, "admin-user", true)
+	s.storage.grantRole(t, admin, "security", rbac.PermissionManageRoles)
+	return admin
+}
+
+func userID(user *entity.User) string {
+	return strconv.FormatUint(uint64(user.ID), 10)
+}
+
+func TestCreateRole(t *testing.T) {
+	s := newTestService(t)
+	ctx := s.authorized(t, s.addAdmin(t))
+
+	created, err := s.CreateRole(ctx, &pb.CreateRoleRequest{
+		Name:        " billing ",
+		Description: " Billing team ",
+		Permissions: []string{"invoices:read", " invoices:write ", "invoices:read"},
+	})
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	role := created.GetRole()
+	if role.GetName() != "billing" || role.GetDescription() != "Billing team" {
+		t.Fatalf("role = %v", role)
+	}
+	if want := []string{"invoices:read", "invoices:write"}; !slices.Equal(role.GetPermissions(), want) {
+		t.Fatalf("permissions = %v, want %v", role.GetPermissions(), want)
+	}
+	if !slices.Contains(s.storage.auditActions(), audit.ActionRoleCreate) {
+		t.Fatalf("audit actions = %v, want %s", s.storage.auditActions(), audit.ActionRoleCreate)
+	}
+
+	_, err = s.CreateRole(ctx, &pb.CreateRoleRequest{Name: "billing"})
+	requireCode(t, err, codes.AlreadyExists)
+
+	listed, err := s.ListRoles(ctx, &pb.ListRolesRequest{})
+	if err != nil {
+		t.Fatalf("ListRoles: %v", err)
+	}
+	var names []string
+	for _, role := range listed.GetRoles() {
+		names = append(names, role.GetName())
+	}
+	if want := []string{"billing", "security"}; !slices.Equal(names, want) {
+		t.Fatalf("ListRoles = %v, want %v", names, want)
+	}
+}
+
+func TestCreateRoleRejects(t *testing.T) {
+	tooManyPermissions := make([]string, rbac.MaxPermissionsPerRole+1)
+	for i := range tooManyPermissions {
+		tooManyPermissions[i] = "resource:action" + strconv.Itoa(i)
+	}
+
+	tests := []struct {
+		name string
+		req  *pb.CreateRoleRequest
+	}{
+		{name: "empty name", req: &pb.CreateRoleRequest{Name: "  "}},
+		{name: "upper case name", req: &pb.CreateRoleRequest{Name: "Billing"}},
+		{name: "long description", req: &pb.CreateRoleRequest{Name: "billing", Description: strings.Repeat("d", maxRoleDescriptionLength+1)}},
+		{name: "permission without action", req: &pb.CreateRoleRequest{Name: "billing", Permissions: []string{"invoices"}}},
+		{name: "wildcard permission", req: &pb.CreateRoleRequest{Name: "billing", Permissions: []string{"invoices:*"}}},
+		{name: "too many permissions", req: &pb.CreateRoleRequest{Name: "billing", Permissions: tooManyPermissions}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			_, err := s.CreateRole(s.authorized(t, s.addAdmin(t)), tt.req)
+			requireCode(t, err, codes.InvalidArgument)
+		})
+	}
+}
+
+func TestRoleManagementRequiresPermission(t *testing.T) {
+	s := newTestService(t)
+	s.addAdmin(t)
+	user := s.addUser(t, "alice", true)
+	// Другие права не дают управлять ролями
+	s.storage.grantRole(t, user, "auditor", rbac.PermissionReadAudit)
+	ctx := s.authorized(t, user)
+
+	tests := []struct {
+		name string
+		call func() error
+	}{
+		{name: "create", call: func() error {
+			_, err := s.CreateRole(ctx, &pb.CreateRoleRequest{Name: "billing"})
+			return err
+		}},
+		{name: "list", call: func() error {
+			_, err := s.ListRoles(ctx, &pb.ListRolesRequest{})
+			return err
+		}},
+		{name: "assign", call: func() error {
+			_, err := s.AssignRole(ctx, &pb.AssignRoleRequest{UserId: userID(user), Role: "security"})
+			return err
+		}},
+		{name: "unassign", call: func() error {
+			_, err := s.UnassignRole(ctx, &pb.UnassignRoleRequest{UserId: userID(user), Role: "auditor"})
+			return err
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			denied := countAction(s.storage.auditActions(), audit.ActionPermissionDenied)
+			requireCode(t, tt.call(), codes.PermissionDenied)
+			if got := countAction(s.storage.auditActions(), audit.ActionPermissionDenied); got != denied+1 {
+				t.Fatalf("permission denials recorded = %d, want %d", got, denied+1)
+			}
+		})
+	}
+
+	if _, err := s.storage.GetRoleByName("billing"); err == nil {
+		t.Fatal("role created without permission")
+	}
+}
+
+func countAction(actions []string, action string) int {
+	count := 0
+	for _, a := range actions {
+		if a == action {
+			count++
+		}
+	}
+	return count
+}
+
+func TestAssignRole(t *testing.T) {
+	s := newTestService(t)
+	adminCtx := s.authorized(t, s.addAdmin(t))
+	user := s.addUser(t, "alice", true)
+	userCtx := s.authorized(t, user)
+	if _, err := s.CreateRole(adminCtx, &pb.CreateRoleRequest{Name: "auditor", Permissions: []string{rbac.PermissionReadAudit}}); err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+
+	check := func() *pb.CheckPermissionResponse {
+		t.Helper()
+		response, err := s.CheckPermission(userCtx, &pb.CheckPermissionRequest{Permission: rbac.PermissionReadAudit})
+		if err != nil {
+			t.Fatalf("CheckPermission: %v", err)
+		}
+		return response
+	}
+	if check().GetAllowed() {
+		t.Fatal("permission allowed before the role is assigned")
+	}
+
+	if _, err := s.AssignRole(adminCtx, &pb.AssignRoleRequest{UserId: userID(user), Role: "auditor"}); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+	// Токен выдан до назначения роли, но проверка видит ее сразу
+	if response := check(); !response.GetAllowed() || !slices.Equal(response.GetRoles(), []string{"auditor"}) {
+		t.Fatalf("CheckPermission after assign = %v", response)
+	}
+	if s.writer.last(t, "role_assigned")["role"] != "auditor" {
+		t.Fatal("notification does not name the role")
+	}
+
+	// Новый токен содержит роль в claims
+	pair, err := s.tokens.Issue(user)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	claims, err := s.tokens.Parse(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if !slices.Equal(claims.Roles, []string{"auditor"}) {
+		t.Fatalf("roles claim = %v, want [auditor]", claims.Roles)
+	}
+
+	if _, err := s.UnassignRole(adminCtx, &pb.UnassignRoleRequest{UserId: userID(user), Role: "auditor"}); err != nil {
+		t.Fatalf("UnassignRole: %v", err)
+	}
+	if check().GetAllowed() {
+		t.Fatal("permission allowed after the role is unassigned")
+	}
+	_, err = s.UnassignRole(adminCtx, &pb.UnassignRoleRequest{UserId: userID(user), Role: "auditor"})
+	requireCode(t, err, codes.NotFound)
+
+	for _, action := range []string{audit.ActionRoleAssign, audit.ActionRoleUnassign} {
+		if !slices.Contains(s.storage.auditActions(), action) {
+			t.Fatalf("audit actions = %v, want %s", s.storage.auditActions(), action)
+		}
+	}
+}
+
+func TestAssignRoleRejects(t *testing.T) {
+	tests := []struct {
+		name   string
+		userID func(user *entity.User) string
+		role   string
+		want   codes.Code
+	}{
+		{name: "invalid user id", userID: func(*entity.User) string { return "alice" }, role: "security", want: codes.InvalidArgument},
+		{name: "unknown user", userID: func(*entity.User) string { return "999" }, role: "security", want: codes.NotFound},
+		{name: "unknown role", userID: userID, role: "billing", want: codes.NotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			ctx := s.authorized(t, s.addAdmin(t))
+			user := s.addUser(t, "alice", true)
+
+			_, err := s.AssignRole(ctx, &pb.AssignRoleRequest{UserId: tt.userID(user), Role: tt.role})
+			requireCode(t, err, tt.want)
+		})
+	}
+}
+
+func TestCheckPermission(t *testing.T) {
+	s := newTestService(t)
+	admin := s.addAdmin(t)
+	alice := s.addUser(t, "alice", true)
+	bob := s.addUser(t, "bob", true)
+	s.storage.grantRole(t, bob, "auditor", rbac.PermissionReadAudit)
+
+	tests := []struct {
+		name        string
+		caller      *entity.User
+		req         *pb.CheckPermissionRequest
+		want        codes.Code
+		wantAllowed bool
+	}{
+		{name: "own permission", caller: bob, req: &pb.CheckPermissionRequest{Permission: rbac.PermissionReadAudit}, wantAllowed: true},
+		{name: "own missing permission", caller: alice, req: &pb.CheckPermissionRequest{Permission: rbac.PermissionReadAudit}},
+		{name: "own id", caller: bob, req: &pb.CheckPermissionRequest{UserId: userID(bob), Permission: rbac.PermissionReadAudit}, wantAllowed: true},
+		{name: "other user by admin", caller: admin, req: &pb.CheckPermissionRequest{UserId: userID(bob), Permission: rbac.PermissionReadAudit}, wantAllowed: true},
+		{name: "other user without permission", caller: alice, req: &pb.CheckPermissionRequest{UserId: userID(bob), Permission: rbac.PermissionReadAudit}, want: codes.PermissionDenied},
+		{name: "invalid user id", caller: admin, req: &pb.CheckPermissionRequest{UserId: "bob", Permission: rbac.PermissionReadAudit}, want: codes.InvalidArgument},
+		{name: "invalid permission", caller: bob, req: &pb.CheckPermissionRequest{Permission: "audit"}, want: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := s.CheckPermission(s.authorized(t, tt.caller), tt.req)
+			requireCode(t, err, tt.want)
+			if response.GetAllowed() != tt.wantAllowed {
+				t.Fatalf("Allowed = %v, want %v", response.GetAllowed(), tt.wantAllowed)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"crypto/rand"
+	"encoding/base32"
+	"errors"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	recoveryCodeCount = 10
+	// 10 байт дают 16 символов base32, то есть 80 бит энтропии
+	recoveryCodeSize = 10
+)
+
+func (s *AuthService) GenerateRecoveryCodes(ctx context.Context, req *pb.GenerateRecoveryCodesRequest) (*pb.GenerateRecoveryCodesResponse, error) {
+	user, err := s.currentUser(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if !user.TOTPEnabled {
+		return nil, status.Errorf(codes.FailedPrecondition, "totp is not enabled")
+	}
+
+	recoveryCodes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		code, err := newRecoveryCode()
+		if err != nil {
+			s.logger.Error("failed to generate recovery code", "error", err)
+			return nil, status.Errorf(codes.Internal, "failed to generate recovery codes")
+		}
+		recoveryCodes = append(recoveryCodes, code)
+		hashes = append(hashes, token.Hash(normalizeRecoveryCode(code)))
+	}
+
+	if err := s.storage.ReplaceRecoveryCodes(user.ID, hashes); err != nil {
+		s.logger.Error("failed to save recovery codes", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to generate recovery codes")
+	}
+
+	if err := s.sendNotificationEvent(user.Email, "new recovery codes were generated", map[string]string{
+		"type": "recovery_codes_generated",
+	}); err != nil {
+		s.logger.Warn("failed to send notification", "error", err)
+	}
+
+	s.logger.Info("recovery codes generated", "user_id", user.ID)
+	return &pb.GenerateRecoveryCodesResponse{Codes: recoveryCodes}, nil
+}
+
+// verifyRecoveryCode гасит резервный код и сообщает пользователю о его
+// использовании.
+func (s *AuthService) verifyRecoveryCode(user *entity.User, code string) error {
+	if err := s.storage.UseRecoveryCode(user.ID, token.Hash(normalizeRecoveryCode(code))); err != nil {
+		if errors.Is(err, postgres.ErrRecoveryCodeNotFound) {
+			return errInvalidMFACode
+		}
+		return err
+	}
+
+	remaining, err := s.storage.CountRecoveryCodes(user.ID)
+	if err != nil {
+		s.logger.Warn("failed to count recovery codes", "error", err)
+	}
+
+	if err := s.sendNotificationEvent(user.Email, "a recovery code was used to sign in", map[string]string{
+		"type":      "recovery_code_used",
+		"remaining": strconv.FormatInt(remaining, 10),
+	}); err != nil {
+		s.logger.Warn("failed to send notification", "error", err)
+	}
+
+	s.logger.Warn("recovery code used", "user_id", user.ID, "remaining", remaining)
+	return nil
+}
+
+// newRecoveryCode возвращает код вида XXXX-XXXX-XXXX-XXXX.
+func newRecoveryCode() (string, error) {
+	b := make([]byte, recoveryCodeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	raw := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(b)
+
+	groups := make([]string, 0, len(raw)/4)
+	for i := 0; i < len(raw); i += 4 {
+		groups = append(groups, raw[i:i+4])
+	}
+	return strings.Join(groups, "-"), nil
+}
+
+// normalizeRecoveryCode допускает ввод в любом регистре, с дефисами и без.
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.NewReplacer("-", "", " ", "").Replace(code)
+}
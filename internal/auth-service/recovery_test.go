@@ -0,0 +1,157 @@
+package authservice
+
+import (
+	pb "auth/proto/auth"
+	"context"
+	"regexp"
+	"strings"
+	"testing"
+
+	"google.golang.org/grpc/codes"
+)
+
+var recoveryCodeFormat = regexp.MustCompile(`^[A-Z2-7]{4}(-[A-Z2-7]{4}){3}$`)
+
+func TestGenerateRecoveryCodes(t *testing.T) {
+	s := newTestService(t)
+	user := s.addUser(t, "alice", true)
+	ctx := s.authorized(t, user)
+
+	_, err := s.GenerateRecoveryCodes(ctx, &pb.GenerateRecoveryCodesRequest{})
+	requireCode(t, err, codes.FailedPrecondition)
+
+	enableTOTP(t, s, user)
+	first, err := s.GenerateRecoveryCodes(ctx, &pb.GenerateRecoveryCodesRequest{})
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+
+	if len(first.GetCodes()) != recoveryCodeCount {
+		t.Fatalf("got %d codes, want %d", len(first.GetCodes()), recoveryCodeCount)
+	}
+	seen := make(map[string]bool)
+	for _, code := range first.GetCodes() {
+		if !recoveryCodeFormat.MatchString(code) {
+			t.Fatalf("code %q does not match XXXX-XXXX-XXXX-XXXX", code)
+		}
+		if seen[code] {
+			t.Fatalf("code %q generated twice", code)
+		}
+		seen[code] = true
+	}
+	if s.writer.count("recovery_codes_generated") != 1 {
+		t.Fatal("no notification about generated codes")
+	}
+
+	// Новый набор заменяет прежний
+	if _, err := s.GenerateRecoveryCodes(ctx, &pb.GenerateRecoveryCodesRequest{}); err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	_, err = s.VerifyMFA(context.Background(), &pb.VerifyMFARequest{
+		MfaToken:     mfaChallenge(t, s, user),
+		RecoveryCode: first.GetCodes()[0],
+	})
+	requireCode(t, err, codes.Unauthenticated)
+}
+
+func TestVerifyMFAWithRecoveryCode(t *testing.T) {
+	tests := []struct {
+		name   string
+		format func(code string) string
+	}{
+		{name: "as issued", format: func(code string) string { return code }},
+		{name: "lower case", format: strings.ToLower},
+		{name: "without dashes", format: func(code string) string { return strings.ReplaceAll(code, "-", "") }},
+		{name: "with spaces", format: func(code string) string { return " " + strings.ReplaceAll(code, "-", " ") + " " }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			user := s.addUser(t, "alice", true)
+			enableTOTP(t, s, user)
+			generated, err := s.GenerateRecoveryCodes(s.authorized(t, user), &pb.GenerateRecoveryCodesRequest{})
+			if err != nil {
+				t.Fatalf("GenerateRecoveryCodes: %v", err)
+			}
+			code := tt.format(generated.GetCodes()[0])
+			ctx := context.Background()
+
+			response, err := s.VerifyMFA(ctx, &pb.VerifyMFARequest{MfaToken: mfaChallenge(t, s, user), RecoveryCode: code})
+			if err != nil {
+				t.Fatalf("VerifyMFA: %v", err)
+			}
+			if response.GetToken() == "" {
+				t.Fatalf("VerifyMFA response = %v, want a token pair", response)
+			}
+
+			event := s.writer.last(t, "recovery_code_used")
+			if want := "9"; event["remaining"] != want {
+				t.Fatalf("remaining = %q, want %q", event["remaining"], want)
+			}
+
+			// Код одноразовый
+			_, err = s.VerifyMFA(ctx, &pb.VerifyMFARequest{MfaToken: mfaChallenge(t, s, user), RecoveryCode: code})
+			requireCode(t, err, codes.Unauthenticated)
+		})
+	}
+}
+
+func TestRecoveryCodesRejects(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	bob := s.addUser(t, "bob", true)
+	enableTOTP(t, s, alice)
+	bobSecret := enableTOTP(t, s, bob)
+
+	bobCodes, err := s.GenerateRecoveryCodes(s.authorized(t, bob), &pb.GenerateRecoveryCodesRequest{})
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+
+	tests := []struct {
+		name string
+		code string
+	}{
+		{name: "code of another user", code: bobCodes.GetCodes()[0]},
+		{name: "unknown code", code: "AAAA-AAAA-AAAA-AAAA"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := s.VerifyMFA(context.Background(), &pb.VerifyMFARequest{
+				MfaToken:     mfaChallenge(t, s, alice),
+				RecoveryCode: tt.code,
+			})
+			requireCode(t, err, codes.Unauthenticated)
+		})
+	}
+
+	// Отключение TOTP удаляет резервные коды
+	if _, err := s.DisableTOTP(s.authorized(t, bob), &pb.DisableTOTPRequest{Code: totpCode(t, bobSecret, 1)}); err != nil {
+		t.Fatalf("DisableTOTP: %v", err)
+	}
+	if remaining, _ := s.storage.CountRecoveryCodes(bob.ID); remaining != 0 {
+		t.Fatalf("%d recovery codes left after disabling totp", remaining)
+	}
+}
+
+func TestNormalizeRecoveryCode(t *testing.T) {
+	tests := []struct {
+		code string
+		want string
+	}{
+		{code: "ABCD-EFGH-IJKL-MNOP", want: "ABCDEFGHIJKLMNOP"},
+		{code: "abcd-efgh-ijkl-mnop", want: "ABCDEFGHIJKLMNOP"},
+		{code: "  abcd efgh ijkl mnop\t", want: "ABCDEFGHIJKLMNOP"},
+		{code: "ABCDEFGHIJKLMNOP", want: "ABCDEFGHIJKLMNOP"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.code, func(t *testing.T) {
+			if got := normalizeRecoveryCode(tt.code); got != tt.want {
+				t.Fatalf("normalizeRecoveryCode(%q) = %q, want %q", tt.code, got, tt.want)
+			}
+		})
+	}
+}
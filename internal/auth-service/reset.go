@@ -0,0 +1,156 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	passwordservice "auth/internal/password-service"
+	"auth/internal/passwordpolicy"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	pb2 "auth/proto/password"
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	passwordServiceAddress = "localhost:8082" // из редиса брать порты и хосты
+	resetCodeExpiration    = 15 * time.Minute
+	resetRequestLimit      = 3
+	resetRequestWindow     = time.Hour
+)
+
+// RequestPasswordReset выпускает одноразовый код сброса и отправляет его
+// на почту. Ответ не зависит от того, существует ли аккаунт.
+func (s *AuthService) RequestPasswordReset(ctx context.Context, req *pb.RequestPasswordResetRequest) (*pb.RequestPasswordResetResponse, error) {
+	resp := &pb.RequestPasswordResetResponse{Message: "if the account exists, a reset code has been sent"}
+
+	user, err := s.storage.GetUserByEmail(req.GetEmail())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Warn("password reset requested for unknown email")
+			return resp, nil
+		}
+		s.logger.Error("failed to get user", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to request password reset")
+	}
+
+	requested, err := s.storage.CountOneTimeTokens(user.ID, entity.PurposePasswordReset, time.Now().Add(-resetRequestWindow))
+	if err != nil {
+		s.logger.Error("failed to count reset codes", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to request password reset")
+	}
+	if requested >= resetRequestLimit {
+		s.logger.Warn("password reset limit reached", "user_id", user.ID)
+		return resp, nil
+	}
+
+	// Действует только последний выданный код
+	if err := s.storage.InvalidateOneTimeTokens(user.ID, entity.PurposePasswordReset); err != nil {
+		s.logger.Error("failed to invalidate reset codes", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to request password reset")
+	}
+
+	code, err := token.RandomString(32)
+	if err != nil {
+		s.logger.Error("failed to generate reset code", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to request password reset")
+	}
+
+	if err := s.storage.SaveOneTimeToken(user.ID, entity.PurposePasswordReset, token.Hash(code), time.Now().Add(resetCodeExpiration)); err != nil {
+		s.logger.Error("failed to save reset code", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to request password reset")
+	}
+
+	if err := s.sendNotificationEvent(user.Email, "password reset requested", map[string]string{
+		"type": entity.PurposePasswordReset,
+		"code": code,
+	}); err != nil {
+		s.logger.Error("failed to send reset code", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to request password reset")
+	}
+
+	s.logger.Info("password reset requested", "user_id", user.ID)
+	return resp, nil
+}
+
+// ConfirmPasswordReset меняет пароль по коду из письма. Код гасится только
+// после смены пароля, поэтому при отказе попытку можно повторить с ним же.
+func (s *AuthService) ConfirmPasswordReset(ctx context.Context, req *pb.ConfirmPasswordResetRequest) (*pb.ConfirmPasswordResetResponse, error) {
+	user, err := s.storage.GetUserByEmail(req.GetEmail())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid or expired reset code")
+		}
+		s.logger.Error("failed to get user", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to reset password")
+	}
+
+	stored, err := s.storage.GetOneTimeToken(entity.PurposePasswordReset, token.Hash(req.GetCode()))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Warn("unknown reset code", "user_id", user.ID)
+			return nil, status.Errorf(codes.InvalidArgument, "invalid or expired reset code")
+		}
+		s.logger.Error("failed to get reset code", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to reset password")
+	}
+
+	// Код привязан к аккаунту, для которого был выпущен
+	if stored.UserID != user.ID || stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		s.logger.Warn("reset code rejected", "user_id", user.ID)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid or expired reset code")
+	}
+
+	// Политику проверяем до обращения к сервису паролей
+	history, err := s.passwordHistory(user)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.checkPassword(req.GetNewPassword(), passwordpolicy.UserInfo{Username: user.UserName, Email: user.Email}, history); err != nil {
+		return nil, err
+	}
+
+	conn, err := grpc.NewClient(passwordServiceAddress, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	if err != nil {
+		s.logger.Error("failed to connect to password service", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to connect to password service")
+	}
+	defer conn.Close()
+
+	client := pb2.NewPasswordServiceClient(conn)
+
+	_, err = client.ChangePassword(passwordservice.WithServiceToken(ctx, s.serviceToken), &pb2.ChangePasswordRequest{
+		Email:       user.Email,
+		NewPassword: req.GetNewPassword(),
+	})
+	if err != nil {
+		if status.Code(err) == codes.InvalidArgument {
+			return nil, err
+		}
+		s.logger.Error("failed to reset password", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to reset password")
+	}
+
+	// Погашение условное: из параллельных запросов с одним кодом успешен
+	// только один
+	if err := s.storage.MarkOneTimeTokenUsed(stored.ID); err != nil {
+		if errors.Is(err, postgres.ErrOneTimeTokenAlreadyUsed) {
+			s.logger.Warn("reset code already used", "user_id", user.ID)
+			return nil, status.Errorf(codes.InvalidArgument, "invalid or expired reset code")
+		}
+		s.logger.Error("failed to mark reset code as used", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to reset password")
+	}
+
+	s.audit.Record(ctx, audit.Event{Action: audit.ActionPasswordReset, ActorID: user.ID, SubjectID: user.ID})
+	s.logger.Info("password reset successfully", "user_id", user.ID)
+	return &pb.ConfirmPasswordResetResponse{Message: "successfully reset the password"}, nil
+}
@@ -0,0 +1,215 @@
+package authservice
+
+import (
+	"auth/internal/config"
+	"auth/internal/entity"
+	"auth/internal/passwordpolicy"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+)
+
+func TestRequestPasswordReset(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	user := s.addUser(t, "alice", true)
+
+	unknown, err := s.RequestPasswordReset(ctx, &pb.RequestPasswordResetRequest{Email: "nobody@example.com"})
+	if err != nil {
+		t.Fatalf("RequestPasswordReset for unknown email: %v", err)
+	}
+
+	var issued []string
+	for i := range resetRequestLimit + 1 {
+		known, err := s.RequestPasswordReset(ctx, &pb.RequestPasswordResetRequest{Email: "Alice@Example.com"})
+		if err != nil {
+			t.Fatalf("RequestPasswordReset #%d: %v", i+1, err)
+		}
+		// Ответ одинаковый, в том числе после исчерпания лимита
+		if known.GetMessage() != unknown.GetMessage() {
+			t.Fatalf("messages differ: %q and %q", known.GetMessage(), unknown.GetMessage())
+		}
+		if i < resetRequestLimit {
+			issued = append(issued, s.writer.last(t, entity.PurposePasswordReset)["code"])
+		}
+	}
+	if got := s.writer.count(entity.PurposePasswordReset); got != resetRequestLimit {
+		t.Fatalf("sent %d reset codes, want %d", got, resetRequestLimit)
+	}
+
+	// Действует только последний выданный код
+	for i, code := range issued {
+		stored, err := s.storage.GetOneTimeToken(entity.PurposePasswordReset, token.Hash(code))
+		if err != nil {
+			t.Fatalf("GetOneTimeToken: %v", err)
+		}
+		if stored.UserID != user.ID {
+			t.Fatalf("code issued for user %d, want %d", stored.UserID, user.ID)
+		}
+		if active := stored.UsedAt == nil; active != (i == len(issued)-1) {
+			t.Fatalf("code #%d active = %v", i+1, active)
+		}
+	}
+}
+
+func TestConfirmPasswordResetRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		email string
+		code  func(t *testing.T, s *testService, alice, bob *entity.User) string
+		want  codes.Code
+	}{
+		{
+			name:  "unknown email",
+			email: "nobody@example.com",
+			code: func(t *testing.T, s *testService, alice, bob *entity.User) string {
+				return saveOneTimeToken(t, s, alice, entity.PurposePasswordReset, time.Hour)
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "unknown code",
+			code: func(t *testing.T, s *testService, alice, bob *entity.User) string {
+				return "unknown"
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "code of another user",
+			code: func(t *testing.T, s *testService, alice, bob *entity.User) string {
+				return saveOneTimeToken(t, s, bob, entity.PurposePasswordReset, time.Hour)
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "expired code",
+			code: func(t *testing.T, s *testService, alice, bob *entity.User) string {
+				return saveOneTimeToken(t, s, alice, entity.PurposePasswordReset, -time.Second)
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "used code",
+			code: func(t *testing.T, s *testService, alice, bob *entity.User) string {
+				code := saveOneTimeToken(t, s, alice, entity.PurposePasswordReset, time.Hour)
+				stored, err := s.storage.GetOneTimeToken(entity.PurposePasswordReset, token.Hash(code))
+				if err != nil {
+					t.Fatalf("GetOneTimeToken: %v", err)
+				}
+				if err := s.storage.MarkOneTimeTokenUsed(stored.ID); err != nil {
+					t.Fatalf("MarkOneTimeTokenUsed: %v", err)
+				}
+				return code
+			},
+			want: codes.InvalidArgument,
+		},
+		{
+			name: "email verification token",
+			code: func(t *testing.T, s *testService, alice, bob *entity.User) string {
+				return saveOneTimeToken(t, s, alice, entity.PurposeEmailVerification, time.Hour)
+			},
+			want: codes.InvalidArgument,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			alice := s.addUser(t, "alice", true)
+			bob := s.addUser(t, "bob", true)
+
+			email := tt.email
+			if email == "" {
+				email = alice.Email
+			}
+			_, err := s.ConfirmPasswordReset(context.Background(), &pb.ConfirmPasswordResetRequest{
+				Email:       email,
+				Code:        tt.code(t, s, alice, bob),
+				NewPassword: "amber-glacier-compass-91",
+			})
+			requireCode(t, err, tt.want)
+		})
+	}
+}
+
+func TestConfirmPasswordResetKeepsCodeOnPolicyViolation(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+	code := saveOneTimeToken(t, s, alice, entity.PurposePasswordReset, time.Hour)
+
+	_, err := s.ConfirmPasswordReset(context.Background(), &pb.ConfirmPasswordResetRequest{
+		Email:       alice.Email,
+		Code:        code,
+		NewPassword: "short",
+	})
+	requireCode(t, err, codes.InvalidArgument)
+
+	// С тем же кодом можно повторить попытку с другим паролем
+	stored, err := s.storage.GetOneTimeToken(entity.PurposePasswordReset, token.Hash(code))
+	if err != nil {
+		t.Fatalf("GetOneTimeToken: %v", err)
+	}
+	if stored.UsedAt != nil {
+		t.Fatal("reset code was spent on a rejected password")
+	}
+}
+
+func TestConfirmPasswordResetRejectsReuse(t *testing.T) {
+	const previousPassword = "amber-glacier-compass-91"
+
+	tests := []struct {
+		name        string
+		historySize int
+		password    string
+		wantReused  bool
+	}{
+		{name: "current password", historySize: 1, password: testPassword, wantReused: true},
+		{name: "previous password", historySize: 2, password: previousPassword, wantReused: true},
+		// Прежний пароль вне настроенной глубины истории не проверяется
+		{name: "previous password beyond history", historySize: 1, password: previousPassword},
+		{name: "history disabled", password: testPassword},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestServiceWithConfig(t, func(cfg *config.Config) {
+				cfg.PasswordPolicyConfig.HistorySize = tt.historySize
+			})
+			alice := s.addUser(t, "alice", true)
+			previous, err := bcrypt.GenerateFromPassword([]byte(previousPassword), bcrypt.MinCost)
+			if err != nil {
+				t.Fatalf("bcrypt: %v", err)
+			}
+			s.storage.passwords[alice.ID] = [][]byte{previous}
+			code := saveOneTimeToken(t, s, alice, entity.PurposePasswordReset, time.Hour)
+
+			_, err = s.ConfirmPasswordReset(context.Background(), &pb.ConfirmPasswordResetRequest{
+				Email:       alice.Email,
+				Code:        code,
+				NewPassword: tt.password,
+			})
+			if tt.wantReused {
+				requireCode(t, err, codes.InvalidArgument)
+				if got, want := violatedRules(t, err), []string{passwordpolicy.RulePasswordReused}; !slices.Equal(got, want) {
+					t.Fatalf("rules = %v, want %v", got, want)
+				}
+			}
+
+			// Код гасится только после смены пароля, а сервиса паролей в
+			// тесте нет: при любом отказе код остается действительным
+			stored, err := s.storage.GetOneTimeToken(entity.PurposePasswordReset, token.Hash(code))
+			if err != nil {
+				t.Fatalf("GetOneTimeToken: %v", err)
+			}
+			if stored.UsedAt != nil {
+				t.Fatal("reset code spent although the password was not changed")
+			}
+		})
+	}
+}
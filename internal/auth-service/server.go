@@ -1,53 +1,83 @@
 package authservice
 
 import (
+	"auth/internal/audit"
+	"auth/internal/config"
+	"auth/internal/encryption"
+	"auth/internal/entity"
+	"auth/internal/identity"
+	"auth/internal/kafka/kafka-writer/mock_writer"
+	"auth/internal/keyring"
+	"auth/internal/lockout"
+	"auth/internal/passwordpolicy"
+	"auth/internal/redis"
 	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	"auth/internal/webauthn"
 	pb "auth/proto/auth"
-	pb2 "auth/proto/password"
 	"context"
 	"errors"
 	"log/slog"
-	"time"
 
-	"github.com/asaskevich/govalidator"
-	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
-	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
-	"google.golang.org/grpc/credentials/insecure"
 	"google.golang.org/grpc/status"
 )
 
-const (
-	secret           = "your-secret-key" // Вынесите в конфигурацию
-	tokenExpiration  = 72 * time.Hour
-	passwordMinLength = 8
-)
-
 type AuthService struct {
 	pb.UnimplementedAuthServiceServer
+	cfg     *config.Config
 	storage postgres.Storage
-	logger  *slog.Logger
+	tokens  *token.Manager
+	keys        *keyring.KeyRing
+	kafkaWriter mock_writer.KafkaWriterInterface
+	cipher      *encryption.Cipher
+	cache       redis.Redis
+	lockout     *lockout.Guard
+	passwords   *passwordpolicy.Policy
+	// serviceToken для внутренних вызовов PasswordService
+	serviceToken string
+	audit        *audit.Log
+	webauthn     *webauthn.WebAuthn
+	logger       *slog.Logger
 }
 
-func NewGRPCServer(database postgres.Storage, logger *slog.Logger) *AuthService {
+func NewGRPCServer(cfg *config.Config, database postgres.Storage, tokens *token.Manager, keys *keyring.KeyRing, kafkaWriter mock_writer.KafkaWriterInterface, cipher *encryption.Cipher, cache redis.Redis, passkeys *webauthn.WebAuthn, passwords *passwordpolicy.Policy, serviceToken string, logger *slog.Logger) *AuthService {
 	return &AuthService{
-		storage: database,
-		logger:  logger,
+		cfg:          cfg,
+		storage:      database,
+		tokens:       tokens,
+		keys:         keys,
+		kafkaWriter:  kafkaWriter,
+		cipher:       cipher,
+		cache:        cache,
+		lockout:      lockout.NewGuard(cfg.LockoutConfig, cache),
+		passwords:    passwords,
+		serviceToken: serviceToken,
+		audit:        audit.NewLog(database, logger),
+		webauthn:     passkeys,
+		logger:       logger,
 	}
 }
 
 func (s *AuthService) Register(ctx context.Context, req *pb.RegisterRequest) (*pb.RegisterResponse, error) {
-	// Валидация email
-	if !govalidator.IsEmail(req.Email) {
+	// Валидация и нормализация email
+	email, err := identity.NormalizeEmail(req.Email)
+	if err != nil {
 		s.logger.Warn("invalid email", "email", req.Email)
 		return &pb.RegisterResponse{Message: "email is not valid"}, nil
 	}
 
+	// Валидация и нормализация имени пользователя
+	username, err := identity.NormalizeUsername(req.Username)
+	if err != nil {
+		s.logger.Warn("invalid username", "username", req.Username, "error", err)
+		return &pb.RegisterResponse{Message: err.Error()}, nil
+	}
+
 	// Валидация пароля
-	if len(req.Password) < passwordMinLength {
-		s.logger.Warn("password is too short", "length", len(req.Password))
-		return &pb.RegisterResponse{Message: "password must be at least 8 characters long"}, nil
+	if err := s.checkPassword(req.Password, passwordpolicy.UserInfo{Username: username, Email: email}, nil); err != nil {
+		return nil, err
 	}
 
 	// Хеширование пароля
@@ -58,89 +88,244 @@ func (s *AuthService) Register(ctx context.Context, req *pb.RegisterRequest) (*p
 	}
 
 	// Сохранение пользователя
-	if err := s.storage.SaveUser(req.Username, req.Email, req.Age, hashedPassword); err != nil {
+	if err := s.storage.SaveUser(username, email, req.Age, hashedPassword); err != nil {
+		if errors.Is(err, postgres.ErrUserAlreadyExists) {
+			s.logger.Warn("user already exists", "username", username)
+			return nil, status.Errorf(codes.AlreadyExists, "username or email is already taken")
+		}
 		s.logger.Error("failed to save user", "error", err)
 		return &pb.RegisterResponse{Message: "internal server error"}, status.Errorf(codes.Internal, "failed to save user")
 	}
 
-	s.logger.Info("user registered successfully", "username", req.Username)
-	return &pb.RegisterResponse{Message: "successfully registered"}, nil
+	// Отправка письма для подтверждения почты
+	user, err := s.storage.GetUserByUserName(username)
+	if err != nil {
+		s.logger.Error("failed to get user", "error", err)
+		return &pb.RegisterResponse{Message: "internal server error"}, status.Errorf(codes.Internal, "failed to get user")
+	}
+
+	if err := s.sendVerification(user); err != nil {
+		s.logger.Error("failed to send verification", "error", err)
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:    audit.ActionRegister,
+		ActorID:   user.ID,
+		SubjectID: user.ID,
+		Details:   map[string]string{"username": username},
+	})
+	s.logger.Info("user registered successfully", "username", username)
+	return &pb.RegisterResponse{Message: "successfully registered, check your email to verify the account"}, nil
 }
 
 func (s *AuthService) Login(ctx context.Context, req *pb.LoginRequest) (*pb.LoginResponse, error) {
-	username := req.GetUsername()
+	response, user, err := s.passwordLogin(req)
+	s.recordLogin(ctx, user, req.GetLogin(), loginMethodPassword, response.GetMfaRequired(), err)
+	return response, err
+}
+
+// passwordLogin проверяет пароль и возвращает найденного пользователя
+// для истории входов.
+func (s *AuthService) passwordLogin(req *pb.LoginRequest) (*pb.LoginResponse, *entity.User, error) {
+	login := req.GetLogin()
 	password := req.GetPassword()
 
-	// Получение пользователя
-	user, err := s.storage.GetUserByUserName(username)
+	// Получение пользователя по имени или почте
+	user, err := s.getUserByLogin(login)
 	if err != nil {
-		s.logger.Error("failed to get user", "username", username, "error", err)
-		return nil, status.Errorf(codes.NotFound, "user not found")
+		s.logger.Error("failed to get user", "login", login, "error", err)
+		return nil, nil, status.Errorf(codes.NotFound, "user not found")
+	}
+
+	// Заблокированная учетная запись не проверяет пароль вовсе
+	if err := s.checkLockout(user); err != nil {
+		return nil, user, err
 	}
 
 	// Проверка пароля
 	if err := bcrypt.CompareHashAndPassword(user.HashedPassword, []byte(password)); err != nil {
-		s.logger.Warn("invalid password", "username", username)
-		return nil, status.Errorf(codes.Unauthenticated, "invalid username or password")
+		s.logger.Warn("invalid password", "username", user.UserName)
+		s.registerLoginFailure(user)
+		return nil, user, status.Errorf(codes.Unauthenticated, "invalid username or password")
 	}
 
-	// Генерация JWT токена
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
-		"username": user.UserName,
-		"exp":      time.Now().Add(tokenExpiration).Unix(),
-	})
+	response, err := s.completeLogin(user, false)
+	return response, user, err
+}
+
+func (s *AuthService) getUserByLogin(login string) (*entity.User, error) {
+	if identity.IsEmail(login) {
+		return s.storage.GetUserByEmail(login)
+	}
+	return s.storage.GetUserByUserName(login)
+}
+
+// completeLogin выполняет общие для всех способов входа проверки и
+// выдает токены, либо токен второго шага, если он еще не пройден.
+func (s *AuthService) completeLogin(user *entity.User, secondFactorPassed bool) (*pb.LoginResponse, error) {
+	// Блокировка действует для всех способов входа, включая внешних провайдеров
+	if err := s.checkLockout(user); err != nil {
+		return nil, err
+	}
+
+	// Проверка подтверждения почты
+	if !user.EmailVerified {
+		s.logger.Warn("email is not verified", "username", user.UserName)
+		return nil, status.Errorf(codes.FailedPrecondition, "email is not verified")
+	}
+
+	// При включенном TOTP вместо токенов выдается токен второго шага
+	if user.TOTPEnabled && !secondFactorPassed {
+		mfaToken, err := s.tokens.IssueMFAChallenge(user)
+		if err != nil {
+			s.logger.Error("failed to generate mfa token", "error", err)
+			return nil, status.Errorf(codes.Internal, "failed to generate token")
+		}
+
+		s.logger.Info("mfa required", "username", user.UserName)
+		return &pb.LoginResponse{MfaRequired: true, MfaToken: mfaToken}, nil
+	}
+
+	// Счетчик неудач сбрасывается только после полного входа: иначе
+	// верный пароль обнулял бы неудачные попытки второго фактора
+	if err := s.lockout.Reset(user.ID); err != nil {
+		s.logger.Warn("failed to reset login failures", "user_id", user.ID, "error", err)
+	}
 
-	tokenString, err := token.SignedString([]byte(secret))
+	// Генерация пары токенов
+	pair, err := s.tokens.Issue(user)
 	if err != nil {
 		s.logger.Error("failed to generate token", "error", err)
 		return nil, status.Errorf(codes.Internal, "failed to generate token")
 	}
 
-	s.logger.Info("user logged in successfully", "username", username)
-	return &pb.LoginResponse{Token: tokenString}, nil
+	s.logger.Info("user logged in successfully", "username", user.UserName)
+	return &pb.LoginResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
+	}, nil
 }
 
-func (s *AuthService) ValidateToken(ctx context.Context, req *pb.ValidateTokenRequest) (*pb.ValidateTokenResponse, error) {
-	token, err := jwt.Parse(req.Token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("unexpected signing method")
+func (s *AuthService) RefreshToken(ctx context.Context, req *pb.RefreshTokenRequest) (*pb.RefreshTokenResponse, error) {
+	pair, err := s.tokens.Refresh(req.GetRefreshToken())
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidRefreshToken) || errors.Is(err, token.ErrRefreshTokenReused) {
+			s.logger.Warn("refresh token rejected", "error", err)
+			return nil, status.Errorf(codes.Unauthenticated, "invalid refresh token")
 		}
-		return []byte(secret), nil
-	})
+		s.logger.Error("failed to refresh token", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to refresh token")
+	}
+
+	s.logger.Info("token refreshed successfully")
+	return &pb.RefreshTokenResponse{
+		Token:        pair.AccessToken,
+		RefreshToken: pair.RefreshToken,
+		ExpiresIn:    pair.ExpiresIn,
+	}, nil
+}
+
+func (s *AuthService) ValidateToken(ctx context.Context, req *pb.ValidateTokenRequest) (*pb.ValidateTokenResponse, error) {
+	claims, err := s.tokens.Parse(req.Token)
 	if err != nil {
-		s.logger.Warn("invalid token", "error", err)
-		return &pb.ValidateTokenResponse{Valid: false}, status.Errorf(codes.Unauthenticated, "invalid token")
+		if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrTokenRevoked) {
+			s.logger.Warn("invalid token", "error", err)
+			return &pb.ValidateTokenResponse{Valid: false}, status.Errorf(codes.Unauthenticated, "invalid token")
+		}
+		s.logger.Error("failed to validate token", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to validate token")
 	}
 
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
-		username := claims["username"].(string)
-		s.logger.Info("token validated successfully", "username", username)
-		return &pb.ValidateTokenResponse{Valid: true, Username: username}, nil
+	s.logger.Info("token validated successfully", "username", claims.Username)
+	return &pb.ValidateTokenResponse{
+		Valid:            true,
+		Username:         claims.Username,
+		UserId:           claims.Subject,
+		Email:            claims.Email,
+		ExpiresAt:        claims.ExpiresAt.Unix(),
+		IssuedAt:         claims.IssuedAt.Unix(),
+		Audience:         claims.Audience,
+		Roles:            claims.Roles,
+		OrganizationId:   claims.OrgID,
+		OrganizationRole: claims.OrgRole,
+		ClientId:         claims.ClientID,
+		Scope:            claims.Scope,
+	}, nil
+}
+
+func (s *AuthService) Logout(ctx context.Context, req *pb.LogoutRequest) (*pb.LogoutResponse, error) {
+	// Владелец токена нужен только для журнала аудита
+	var userID uint
+	if claims, err := s.tokens.Parse(req.GetToken()); err == nil {
+		userID, _ = claims.UserID()
 	}
 
-	s.logger.Warn("invalid token claims")
-	return &pb.ValidateTokenResponse{Valid: false}, nil
+	if err := s.tokens.RevokeAccessToken(req.GetToken()); err != nil {
+		if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrTokenRevoked) {
+			s.logger.Warn("invalid token", "error", err)
+			return nil, status.Errorf(codes.Unauthenticated, "invalid token")
+		}
+		s.logger.Error("failed to revoke token", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to revoke token")
+	}
+
+	if req.GetRefreshToken() != "" {
+		if err := s.tokens.RevokeRefreshToken(req.GetRefreshToken()); err != nil && !errors.Is(err, token.ErrInvalidRefreshToken) {
+			s.logger.Error("failed to revoke refresh token", "error", err)
+			return nil, status.Errorf(codes.Internal, "failed to revoke refresh token")
+		}
+	}
+
+	s.audit.Record(ctx, audit.Event{Action: audit.ActionLogout, ActorID: userID, SubjectID: userID})
+	s.logger.Info("user logged out successfully")
+	return &pb.LogoutResponse{Message: "successfully logged out"}, nil
 }
 
-func (s *AuthService) ResetPassword(ctx context.Context, req *pb.ResetPasswordRequest) (*pb.ResetPasswordResponse, error) {
-	conn, err := grpc.NewClient("localhost:8082", grpc.WithTransportCredentials(insecure.NewCredentials())) // из редиса брать порты и хосты
-	if err != nil {
-		s.logger.Error("failed to connect to password service", "error", err)
-		return &pb.ResetPasswordResponse{Message: "internal server error"}, status.Errorf(codes.Internal, "failed to connect to password service")
+// RevokeToken отзывает access- или refresh-токен. Как и в RFC 7009,
+// неизвестный или уже недействительный токен не считается ошибкой.
+func (s *AuthService) RevokeToken(ctx context.Context, req *pb.RevokeTokenRequest) (*pb.RevokeTokenResponse, error) {
+	revokers := []func(string) error{s.tokens.RevokeAccessToken, s.tokens.RevokeRefreshToken}
+	if req.GetTokenTypeHint() == "refresh_token" {
+		revokers[0], revokers[1] = revokers[1], revokers[0]
 	}
-	defer conn.Close()
 
-	client := pb2.NewPasswordServiceClient(conn)
-	
-	_, err = client.ChangePassword(ctx, &pb2.ChangePasswordRequest{
-		Email:       req.GetEmail(),
-		NewPassword: req.GetNewPassword(),
-	})
-	if err != nil {
-		s.logger.Error("failed to reset password", "error", err)
-		return &pb.ResetPasswordResponse{Message: "internal server error"}, status.Errorf(codes.Internal, "failed to reset password")
+	for _, revoke := range revokers {
+		err := revoke(req.GetToken())
+		if err == nil {
+			s.audit.Record(ctx, audit.Event{
+				Action:  audit.ActionTokenRevoke,
+				Details: map[string]string{"token_type_hint": req.GetTokenTypeHint()},
+			})
+			s.logger.Info("token revoked successfully")
+			break
+		}
+		if !errors.Is(err, token.ErrInvalidToken) && !errors.Is(err, token.ErrTokenRevoked) && !errors.Is(err, token.ErrInvalidRefreshToken) {
+			s.logger.Error("failed to revoke token", "error", err)
+			return nil, status.Errorf(codes.Internal, "failed to revoke token")
+		}
 	}
 
-	s.logger.Info("password reset successfully", "email", req.Email)
-	return &pb.ResetPasswordResponse{Message: "successfully reset the password"}, nil
-}
\ No newline at end of file
+	return &pb.RevokeTokenResponse{Message: "token revoked"}, nil
+}
+
+func (s *AuthService) GetJWKS(ctx context.Context, req *pb.GetJWKSRequest) (*pb.GetJWKSResponse, error) {
+	set := s.keys.JWKS()
+
+	keys := make([]*pb.JWK, 0, len(set.Keys))
+	for _, k := range set.Keys {
+		keys = append(keys, &pb.JWK{
+			Kty: k.Kty,
+			Kid: k.Kid,
+			Use: k.Use,
+			Alg: k.Alg,
+			N:   k.N,
+			E:   k.E,
+			Crv: k.Crv,
+			X:   k.X,
+			Y:   k.Y,
+		})
+	}
+
+	return &pb.GetJWKSResponse{Keys: keys}, nil
+}
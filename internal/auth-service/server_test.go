@@ -0,0 +1,223 @@
+package authservice
+
+import (
+	"auth/internal/config"
+	"auth/internal/keyring"
+	"auth/internal/redis"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+)
+
+// revocationCaches - хранилища, на которых проверяется отзыв токенов:
+// InMemory всегда, Redis - если задан TEST_REDIS_ADDRESS.
+func revocationCaches(t *testing.T) map[string]func() redis.Redis {
+	t.Helper()
+	caches := map[string]func() redis.Redis{
+		"memory": func() redis.Redis { return redis.NewInMemory() },
+	}
+	if address := os.Getenv("TEST_REDIS_ADDRESS"); address != "" {
+		caches["redis"] = func() redis.Redis { return redis.NewRedisImpl(address, "", 0) }
+	}
+	return caches
+}
+
+func login(t *testing.T, s *testService, username string) *pb.LoginResponse {
+	t.Helper()
+	response, err := s.Login(context.Background(), &pb.LoginRequest{Login: username, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	return response
+}
+
+func TestLogout(t *testing.T) {
+	for name, cache := range revocationCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServiceWith(t, func(*config.Config) {}, cache())
+			s.addUser(t, "alice", true)
+			pair := login(t, s, "alice")
+
+			if _, err := s.ValidateToken(context.Background(), &pb.ValidateTokenRequest{Token: pair.GetToken()}); err != nil {
+				t.Fatalf("ValidateToken before logout: %v", err)
+			}
+
+			if _, err := s.Logout(context.Background(), &pb.LogoutRequest{Token: pair.GetToken(), RefreshToken: pair.GetRefreshToken()}); err != nil {
+				t.Fatalf("Logout: %v", err)
+			}
+
+			_, err := s.ValidateToken(context.Background(), &pb.ValidateTokenRequest{Token: pair.GetToken()})
+			requireCode(t, err, codes.Unauthenticated)
+
+			_, err = s.RefreshToken(context.Background(), &pb.RefreshTokenRequest{RefreshToken: pair.GetRefreshToken()})
+			requireCode(t, err, codes.Unauthenticated)
+
+			// Повторный выход тем же токеном
+			_, err = s.Logout(context.Background(), &pb.LogoutRequest{Token: pair.GetToken()})
+			requireCode(t, err, codes.Unauthenticated)
+
+			// Другие сессии пользователя не затронуты
+			other := login(t, s, "alice")
+			if _, err := s.ValidateToken(context.Background(), &pb.ValidateTokenRequest{Token: other.GetToken()}); err != nil {
+				t.Fatalf("ValidateToken of another session: %v", err)
+			}
+		})
+	}
+}
+
+func TestRevokeToken(t *testing.T) {
+	for name, cache := range revocationCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			s := newTestServiceWith(t, func(*config.Config) {}, cache())
+			s.addUser(t, "alice", true)
+			pair := login(t, s, "alice")
+
+			tests := []struct {
+				name  string
+				token string
+				hint  string
+			}{
+				{"access token", pair.GetToken(), ""},
+				{"refresh token", pair.GetRefreshToken(), "refresh_token"},
+				{"refresh token without hint", login(t, s, "alice").GetRefreshToken(), ""},
+				{"access token with wrong hint", login(t, s, "alice").GetToken(), "refresh_token"},
+				// RFC 7009: неизвестный токен не ошибка
+				{"unknown token", "not-a-token", ""},
+			}
+			for _, tt := range tests {
+				if _, err := s.RevokeToken(context.Background(), &pb.RevokeTokenRequest{Token: tt.token, TokenTypeHint: tt.hint}); err != nil {
+					t.Fatalf("%s: RevokeToken: %v", tt.name, err)
+				}
+			}
+
+			_, err := s.ValidateToken(context.Background(), &pb.ValidateTokenRequest{Token: pair.GetToken()})
+			requireCode(t, err, codes.Unauthenticated)
+			_, err = s.ValidateToken(context.Background(), &pb.ValidateTokenRequest{Token: tests[3].token})
+			requireCode(t, err, codes.Unauthenticated)
+
+			for _, refreshToken := range []string{tests[1].token, tests[2].token} {
+				_, err = s.RefreshToken(context.Background(), &pb.RefreshTokenRequest{RefreshToken: refreshToken})
+				requireCode(t, err, codes.Unauthenticated)
+			}
+		})
+	}
+}
+
+// expirationCache запоминает срок, с которым сохранялись записи.
+type expirationCache struct {
+	redis.Redis
+
+	mu          sync.Mutex
+	expirations map[string]time.Duration
+}
+
+func (c *expirationCache) Put(key, value string, expiration time.Duration) error {
+	c.mu.Lock()
+	c.expirations[key] = expiration
+	c.mu.Unlock()
+	return c.Redis.Put(key, value, expiration)
+}
+
+func TestRevocationExpiresWithToken(t *testing.T) {
+	for name, cache := range revocationCaches(t) {
+		t.Run(name, func(t *testing.T) {
+			recorder := &expirationCache{Redis: cache(), expirations: make(map[string]time.Duration)}
+			s := newTestServiceWith(t, func(*config.Config) {}, recorder)
+			s.addUser(t, "alice", true)
+
+			for _, revoke := range []func(string) error{
+				func(accessToken string) error {
+					_, err := s.Logout(context.Background(), &pb.LogoutRequest{Token: accessToken})
+					return err
+				},
+				func(accessToken string) error {
+					_, err := s.RevokeToken(context.Background(), &pb.RevokeTokenRequest{Token: accessToken})
+					return err
+				},
+			} {
+				accessToken := login(t, s, "alice").GetToken()
+				claims, err := s.tokens.Parse(accessToken)
+				if err != nil {
+					t.Fatalf("Parse: %v", err)
+				}
+				leeway := s.cfg.JWTConfig.Leeway
+				longest := time.Until(claims.ExpiresAt.Time) + leeway
+				if err := revoke(accessToken); err != nil {
+					t.Fatalf("revoke: %v", err)
+				}
+				shortest := time.Until(claims.ExpiresAt.Time) + leeway
+
+				recorder.mu.Lock()
+				expiration, ok := recorder.expirations["revoked:"+claims.ID]
+				recorder.mu.Unlock()
+				if !ok {
+					t.Fatalf("no revocation entry for jti %s in %v", claims.ID, recorder.expirations)
+				}
+
+				// Запись живет до exp токена плюс leeway и не дольше
+				if expiration < shortest || expiration > longest {
+					t.Fatalf("revocation expiration = %v, want between %v and %v", expiration, shortest, longest)
+				}
+				if longest > token.AccessTokenExpiration+leeway {
+					t.Fatalf("access token lives %v, want at most %v", longest-leeway, token.AccessTokenExpiration)
+				}
+			}
+		})
+	}
+}
+
+func TestGetJWKSAfterRotate(t *testing.T) {
+	s := newTestService(t)
+	alice := s.addUser(t, "alice", true)
+
+	before, err := s.tokens.Issue(alice)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	oldKid := s.keys.Keys()[0].ID
+	if err := s.keys.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	after, err := s.tokens.Issue(alice)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	response, err := s.GetJWKS(context.Background(), &pb.GetJWKSRequest{})
+	if err != nil {
+		t.Fatalf("GetJWKS: %v", err)
+	}
+
+	// Токены проверяются только опубликованными ключами
+	published := make(map[string]keyring.JWK)
+	for _, k := range response.GetKeys() {
+		published[k.GetKid()] = keyring.JWK{
+			Kty: k.GetKty(), Kid: k.GetKid(), Use: k.GetUse(), Alg: k.GetAlg(),
+			N: k.GetN(), E: k.GetE(), Crv: k.GetCrv(), X: k.GetX(), Y: k.GetY(),
+		}
+	}
+	keyfunc := func(parsed *jwt.Token) (interface{}, error) {
+		kid, _ := parsed.Header["kid"].(string)
+		jwk, ok := published[kid]
+		if !ok {
+			return nil, keyring.ErrUnknownKey
+		}
+		return jwk.PublicKey()
+	}
+
+	for name, pair := range map[string]*token.Pair{"before rotation": before, "after rotation": after} {
+		if _, err := jwt.Parse(pair.AccessToken, keyfunc, jwt.WithValidMethods(keyring.Algorithms)); err != nil {
+			t.Fatalf("token issued %s does not verify against GetJWKS: %v", name, err)
+		}
+	}
+	if _, ok := published[oldKid]; !ok || len(published) != 2 {
+		t.Fatalf("published kids = %v, want the active and the retired %s", published, oldKid)
+	}
+}
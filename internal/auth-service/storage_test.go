@@ -0,0 +1,980 @@
+package authservice
+
+import (
+	"auth/internal/config"
+	"auth/internal/encryption"
+	"auth/internal/entity"
+	"auth/internal/identity"
+	"auth/internal/keyring"
+	"auth/internal/passwordpolicy"
+	"auth/internal/redis"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	"auth/internal/webauthn"
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"io"
+	"log/slog"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/segmentio/kafka-go"
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// memoryStorage хранит в памяти то, что нужно тестам сервиса.
+// Остальные методы Storage не реализованы и паникуют при вызове.
+type memoryStorage struct {
+	postgres.Storage
+
+	mu       sync.Mutex
+	nextID   uint
+	users    map[uint]*entity.User
+	oneTime  map[string]*entity.OneTimeToken
+	refresh  map[string]*entity.RefreshToken
+	logins   []entity.LoginEvent
+	auditLog []entity.AuditEntry
+	// recovery - резервные коды пользователя: хеш и признак использования
+	recovery    map[uint]map[string]bool
+	apiKeys     []*entity.APIKey
+	memberships []entity.Membership
+	roles       []*entity.Role
+	orgs        []entity.Organization
+	invitations []*entity.Invitation
+	// userRoles - идентификаторы ролей пользователя
+	userRoles map[uint][]uint
+	// passwords - прежние хеши паролей пользователя, от новых к старым
+	passwords map[uint][][]byte
+	passkeys  []*entity.WebAuthnCredential
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		users:     make(map[uint]*entity.User),
+		oneTime:   make(map[string]*entity.OneTimeToken),
+		refresh:   make(map[string]*entity.RefreshToken),
+		recovery:  make(map[uint]map[string]bool),
+		userRoles: make(map[uint][]uint),
+		passwords: make(map[uint][][]byte),
+	}
+}
+
+func (m *memoryStorage) SaveUser(userName string, email string, age int32, hashedPassword []byte) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	userName, email = identity.Canonical(userName), identity.Canonical(email)
+	for _, user := range m.users {
+		if user.UserName == userName || user.Email == email {
+			return postgres.ErrUserAlreadyExists
+		}
+	}
+	m.nextID++
+	user := &entity.User{UserName: userName, Email: email, Age: age, HashedPassword: hashedPassword}
+	user.ID = m.nextID
+	m.users[user.ID] = user
+	return nil
+}
+
+func (m *memoryStorage) findUser(match func(*entity.User) bool) (*entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if match(user) {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) GetUserByUserName(userName string) (*entity.User, error) {
+	userName = identity.Canonical(userName)
+	return m.findUser(func(u *entity.User) bool { return u.UserName == userName })
+}
+
+func (m *memoryStorage) GetUserByEmail(email string) (*entity.User, error) {
+	email = identity.Canonical(email)
+	return m.findUser(func(u *entity.User) bool { return u.Email == email })
+}
+
+func (m *memoryStorage) GetUserByID(id uint) (*entity.User, error) {
+	return m.findUser(func(u *entity.User) bool { return u.ID == id })
+}
+
+// updateUser меняет сохраненного пользователя под блокировкой.
+func (m *memoryStorage) updateUser(id uint, update func(*entity.User)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	update(user)
+	return nil
+}
+
+func (m *memoryStorage) SetEmailVerified(userID uint) error {
+	return m.updateUser(userID, func(u *entity.User) { u.EmailVerified = true })
+}
+
+func (m *memoryStorage) SetTOTPSecret(userID uint, encryptedSecret []byte) error {
+	return m.updateUser(userID, func(u *entity.User) {
+		u.TOTPSecret = encryptedSecret
+		u.TOTPEnabled = false
+		u.TOTPLastCounter = 0
+	})
+}
+
+func (m *memoryStorage) EnableTOTP(userID uint) error {
+	return m.updateUser(userID, func(u *entity.User) { u.TOTPEnabled = true })
+}
+
+func (m *memoryStorage) DisableTOTP(userID uint) error {
+	return m.updateUser(userID, func(u *entity.User) {
+		u.TOTPSecret = nil
+		u.TOTPEnabled = false
+		u.TOTPLastCounter = 0
+		delete(m.recovery, u.ID)
+	})
+}
+
+func (m *memoryStorage) UseTOTPCounter(userID uint, counter int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[userID]
+	if !ok || user.TOTPLastCounter >= counter {
+		return postgres.ErrTOTPCodeAlreadyUsed
+	}
+	user.TOTPLastCounter = counter
+	return nil
+}
+
+func (m *memoryStorage) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	codes := make(map[string]bool, len(codeHashes))
+	for _, hash := range codeHashes {
+		codes[hash] = false
+	}
+	m.recovery[userID] = codes
+	return nil
+}
+
+func (m *memoryStorage) UseRecoveryCode(userID uint, codeHash string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	used, ok := m.recovery[userID][codeHash]
+	if !ok || used {
+		return postgres.ErrRecoveryCodeNotFound
+	}
+	m.recovery[userID][codeHash] = true
+	return nil
+}
+
+func (m *memoryStorage) CountRecoveryCodes(userID uint) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var count int64
+	for _, used := range m.recovery[userID] {
+		if !used {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memoryStorage) GetPasswordHistory(userID uint, limit int) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hashes := m.passwords[userID]
+	return hashes[:min(len(hashes), limit)], nil
+}
+
+func (m *memoryStorage) SaveWebAuthnCredential(userID uint, credentialID []byte, publicKey []byte, signCount uint32, transports []string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	credential := &entity.WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    publicKey,
+		SignCount:    signCount,
+		Transports:   strings.Join(transports, ","),
+	}
+	credential.ID = m.nextID
+	m.passkeys = append(m.passkeys, credential)
+	return nil
+}
+
+func (m *memoryStorage) GetWebAuthnCredential(credentialID []byte) (*entity.WebAuthnCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, credential := range m.passkeys {
+		if bytes.Equal(credential.CredentialID, credentialID) {
+			copied := *credential
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) ListWebAuthnCredentials(userID uint) ([]entity.WebAuthnCredential, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var credentials []entity.WebAuthnCredential
+	for _, credential := range m.passkeys {
+		if credential.UserID == userID {
+			credentials = append(credentials, *credential)
+		}
+	}
+	return credentials, nil
+}
+
+func (m *memoryStorage) UpdateWebAuthnSignCount(id uint, signCount uint32) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, credential := range m.passkeys {
+		if credential.ID == id {
+			now := time.Now()
+			credential.SignCount, credential.LastUsedAt = signCount, &now
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) CreateRole(name string, description string, permissions []string) (*entity.Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, role := range m.roles {
+		if role.Name == name {
+			return nil, postgres.ErrRoleAlreadyExists
+		}
+	}
+	m.nextID++
+	role := &entity.Role{Name: name, Description: description}
+	role.ID = m.nextID
+	for _, name := range permissions {
+		role.Permissions = append(role.Permissions, entity.Permission{Name: name})
+	}
+	m.roles = append(m.roles, role)
+	copied := *role
+	return &copied, nil
+}
+
+func (m *memoryStorage) GetRoleByName(name string) (*entity.Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, role := range m.roles {
+		if role.Name == name {
+			copied := *role
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) ListRoles() ([]entity.Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	roles := make([]entity.Role, 0, len(m.roles))
+	for _, role := range m.roles {
+		roles = append(roles, *role)
+	}
+	slices.SortFunc(roles, func(a, b entity.Role) int { return strings.Compare(a.Name, b.Name) })
+	return roles, nil
+}
+
+func (m *memoryStorage) AssignRole(userID uint, roleID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if !slices.Contains(m.userRoles[userID], roleID) {
+		m.userRoles[userID] = append(m.userRoles[userID], roleID)
+	}
+	return nil
+}
+
+func (m *memoryStorage) UnassignRole(userID uint, roleID uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	i := slices.Index(m.userRoles[userID], roleID)
+	if i < 0 {
+		return gorm.ErrRecordNotFound
+	}
+	m.userRoles[userID] = slices.Delete(m.userRoles[userID], i, i+1)
+	return nil
+}
+
+func (m *memoryStorage) GetUserRoles(userID uint) ([]entity.Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var roles []entity.Role
+	for _, role := range m.roles {
+		if slices.Contains(m.userRoles[userID], role.ID) {
+			roles = append(roles, *role)
+		}
+	}
+	return roles, nil
+}
+
+// grantRole создает роль с правами и назначает ее пользователю.
+func (m *memoryStorage) grantRole(t *testing.T, user *entity.User, name string, permissions ...string) {
+	t.Helper()
+	role, err := m.CreateRole(name, "", permissions)
+	if err != nil {
+		t.Fatalf("CreateRole: %v", err)
+	}
+	if err := m.AssignRole(user.ID, role.ID); err != nil {
+		t.Fatalf("AssignRole: %v", err)
+	}
+}
+
+// addMembership добавляет пользователя в организацию.
+func (m *memoryStorage) addMembership(organizationID, userID uint, role string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	membership := entity.Membership{OrganizationID: organizationID, UserID: userID, Role: role}
+	membership.ID = m.nextID
+	membership.CreatedAt = time.Now()
+	m.memberships = append(m.memberships, membership)
+}
+
+// removeMembership исключает пользователя из организации.
+func (m *memoryStorage) removeMembership(organizationID, userID uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.memberships = slices.DeleteFunc(m.memberships, func(membership entity.Membership) bool {
+		return membership.OrganizationID == organizationID && membership.UserID == userID
+	})
+}
+
+func (m *memoryStorage) GetMembership(organizationID uint, userID uint) (*entity.Membership, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, membership := range m.memberships {
+		if membership.OrganizationID == organizationID && membership.UserID == userID {
+			for _, organization := range m.orgs {
+				if organization.ID == organizationID {
+					membership.Organization = organization
+				}
+			}
+			return &membership, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) ListMemberships(userID uint) ([]entity.Membership, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var memberships []entity.Membership
+	for _, membership := range m.memberships {
+		if membership.UserID == userID {
+			memberships = append(memberships, membership)
+		}
+	}
+	return memberships, nil
+}
+
+func (m *memoryStorage) CreateOrganization(name string, slug string, ownerID uint, ownerRole string) (*entity.Organization, error) {
+	m.mu.Lock()
+	for _, organization := range m.orgs {
+		if organization.Slug == slug {
+			m.mu.Unlock()
+			return nil, postgres.ErrOrganizationExists
+		}
+	}
+	m.nextID++
+	organization := entity.Organization{Name: name, Slug: slug}
+	organization.ID = m.nextID
+	organization.CreatedAt = time.Now()
+	m.orgs = append(m.orgs, organization)
+	m.mu.Unlock()
+
+	m.addMembership(organization.ID, ownerID, ownerRole)
+	return &organization, nil
+}
+
+func (m *memoryStorage) GetOrganization(id uint) (*entity.Organization, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, organization := range m.orgs {
+		if organization.ID == id {
+			return &organization, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) ListMembers(organizationID uint) ([]entity.Membership, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var members []entity.Membership
+	for _, membership := range m.memberships {
+		if membership.OrganizationID == organizationID {
+			membership.User = *m.users[membership.UserID]
+			members = append(members, membership)
+		}
+	}
+	return members, nil
+}
+
+func (m *memoryStorage) SaveInvitation(invitation *entity.Invitation) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	invitation.ID = m.nextID
+	invitation.CreatedAt = time.Now()
+	copied := *invitation
+	m.invitations = append(m.invitations, &copied)
+	return nil
+}
+
+func (m *memoryStorage) GetInvitationByTokenHash(tokenHash string) (*entity.Invitation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, invitation := range m.invitations {
+		if invitation.TokenHash == tokenHash {
+			copied := *invitation
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) ListInvitations(organizationID uint) ([]entity.Invitation, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var invitations []entity.Invitation
+	for i := len(m.invitations) - 1; i >= 0; i-- {
+		if m.invitations[i].OrganizationID == organizationID {
+			invitations = append(invitations, *m.invitations[i])
+		}
+	}
+	return invitations, nil
+}
+
+func (m *memoryStorage) RevokeInvitation(organizationID uint, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, invitation := range m.invitations {
+		if invitation.ID == id && invitation.OrganizationID == organizationID && invitation.AcceptedAt == nil && invitation.RevokedAt == nil {
+			now := time.Now()
+			invitation.RevokedAt = &now
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// pendingInvitation возвращает приглашение, если его еще можно принять.
+// Вызывается под m.mu.
+func (m *memoryStorage) pendingInvitation(id uint) (*entity.Invitation, error) {
+	for _, invitation := range m.invitations {
+		if invitation.ID == id {
+			if invitation.AcceptedAt != nil || invitation.RevokedAt != nil {
+				return nil, postgres.ErrInvitationUsed
+			}
+			return invitation, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+// expireInvitation переносит срок действия приглашения в прошлое.
+func (m *memoryStorage) expireInvitation(id uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, invitation := range m.invitations {
+		if invitation.ID == id {
+			invitation.ExpiresAt = time.Now().Add(-time.Second)
+		}
+	}
+}
+
+func (m *memoryStorage) AcceptInvitation(invitationID uint, userID uint) error {
+	m.mu.Lock()
+	invitation, err := m.pendingInvitation(invitationID)
+	if err == nil {
+		for _, membership := range m.memberships {
+			if membership.OrganizationID == invitation.OrganizationID && membership.UserID == userID {
+				err = postgres.ErrAlreadyMember
+			}
+		}
+	}
+	if err != nil {
+		m.mu.Unlock()
+		return err
+	}
+	now := time.Now()
+	invitation.AcceptedAt, invitation.AcceptedBy = &now, &userID
+	m.mu.Unlock()
+
+	m.addMembership(invitation.OrganizationID, userID, invitation.Role)
+	return nil
+}
+
+func (m *memoryStorage) CreateUserFromInvitation(invitationID uint, userName string, email string, age int32, hashedPassword []byte) (*entity.User, error) {
+	m.mu.Lock()
+	_, err := m.pendingInvitation(invitationID)
+	m.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := m.SaveUser(userName, email, age, hashedPassword); err != nil {
+		return nil, err
+	}
+	user, err := m.GetUserByEmail(identity.Canonical(email))
+	if err != nil {
+		return nil, err
+	}
+	if err := m.SetEmailVerified(user.ID); err != nil {
+		return nil, err
+	}
+	if err := m.AcceptInvitation(invitationID, user.ID); err != nil {
+		return nil, err
+	}
+	user.EmailVerified = true
+	return user, nil
+}
+
+func (m *memoryStorage) SaveAPIKey(key *entity.APIKey) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	key.ID = m.nextID
+	key.CreatedAt = time.Now()
+	copied := *key
+	m.apiKeys = append(m.apiKeys, &copied)
+	return nil
+}
+
+func (m *memoryStorage) GetAPIKeyByHash(keyHash string) (*entity.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.apiKeys {
+		if key.KeyHash == keyHash {
+			copied := *key
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) ListAPIKeys(userID uint, organizationID uint) ([]entity.APIKey, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var keys []entity.APIKey
+	for _, key := range m.apiKeys {
+		if key.UserID == userID && key.OrganizationID == organizationID {
+			keys = append(keys, *key)
+		}
+	}
+	return keys, nil
+}
+
+func (m *memoryStorage) RevokeAPIKey(userID uint, organizationID uint, id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.apiKeys {
+		if key.ID == id && key.UserID == userID && key.OrganizationID == organizationID && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			return nil
+		}
+	}
+	return gorm.ErrRecordNotFound
+}
+
+// expireAPIKey переносит срок действия ключа в прошлое.
+func (m *memoryStorage) expireAPIKey(id uint) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.apiKeys {
+		if key.ID == id {
+			expired := time.Now().Add(-time.Second)
+			key.ExpiresAt = &expired
+		}
+	}
+}
+
+func (m *memoryStorage) TouchAPIKey(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, key := range m.apiKeys {
+		if key.ID == id {
+			now := time.Now()
+			key.LastUsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memoryStorage) SaveRefreshToken(userID uint, familyID string, clientID string, organizationID uint, scope string, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	stored := &entity.RefreshToken{
+		UserID:         userID,
+		FamilyID:       familyID,
+		ClientID:       clientID,
+		OrganizationID: organizationID,
+		Scope:          scope,
+		TokenHash:      tokenHash,
+		ExpiresAt:      expiresAt,
+	}
+	stored.ID = m.nextID
+	m.refresh[tokenHash] = stored
+	return nil
+}
+
+func (m *memoryStorage) GetRefreshToken(tokenHash string) (*entity.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.refresh[tokenHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+func (m *memoryStorage) RevokeRefreshTokenFamily(familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, stored := range m.refresh {
+		if stored.FamilyID == familyID && stored.RevokedAt == nil {
+			stored.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memoryStorage) SaveOneTimeToken(userID uint, purpose string, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	stored := &entity.OneTimeToken{UserID: userID, Purpose: purpose, TokenHash: tokenHash, ExpiresAt: expiresAt}
+	stored.ID = m.nextID
+	stored.CreatedAt = time.Now()
+	m.oneTime[tokenHash] = stored
+	return nil
+}
+
+func (m *memoryStorage) GetOneTimeToken(purpose string, tokenHash string) (*entity.OneTimeToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.oneTime[tokenHash]
+	if !ok || stored.Purpose != purpose {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+func (m *memoryStorage) MarkOneTimeTokenUsed(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stored := range m.oneTime {
+		if stored.ID == id && stored.UsedAt == nil {
+			now := time.Now()
+			stored.UsedAt = &now
+			return nil
+		}
+	}
+	return postgres.ErrOneTimeTokenAlreadyUsed
+}
+
+func (m *memoryStorage) InvalidateOneTimeTokens(userID uint, purpose string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, stored := range m.oneTime {
+		if stored.UserID == userID && stored.Purpose == purpose && stored.UsedAt == nil {
+			stored.UsedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memoryStorage) CountOneTimeTokens(userID uint, purpose string, since time.Time) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var count int64
+	for _, stored := range m.oneTime {
+		if stored.UserID == userID && stored.Purpose == purpose && !stored.CreatedAt.Before(since) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+func (m *memoryStorage) SaveLoginEvent(event *entity.LoginEvent) error {
+	// Как и Postgres, невалидный UTF-8 не сохраняется
+	if !utf8.ValidString(event.Login) || !utf8.ValidString(event.UserAgent) {
+		return errors.New("invalid byte sequence for encoding UTF8")
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	event.ID = uint(len(m.logins) + 1)
+	event.CreatedAt = time.Now()
+	m.logins = append(m.logins, *event)
+	return nil
+}
+
+func (m *memoryStorage) HasSuccessfulLogin(userID uint, fingerprint string) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, event := range m.logins {
+		if event.UserID == nil || *event.UserID != userID || event.Result != entity.LoginResultSuccess {
+			continue
+		}
+		if fingerprint == "" || event.Fingerprint == fingerprint {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func (m *memoryStorage) ListLoginEvents(userID uint, beforeID uint, limit int) ([]entity.LoginEvent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var events []entity.LoginEvent
+	for i := len(m.logins) - 1; i >= 0 && len(events) < limit; i-- {
+		event := m.logins[i]
+		if event.UserID == nil || *event.UserID != userID || (beforeID != 0 && event.ID >= beforeID) {
+			continue
+		}
+		events = append(events, event)
+	}
+	return events, nil
+}
+
+func (m *memoryStorage) AppendAuditEntry(entry *entity.AuditEntry, seal func(entry *entity.AuditEntry) string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.ID = uint64(len(m.auditLog) + 1)
+	if len(m.auditLog) > 0 {
+		entry.PrevHash = m.auditLog[len(m.auditLog)-1].Hash
+	}
+	entry.Hash = seal(entry)
+	m.auditLog = append(m.auditLog, *entry)
+	return nil
+}
+
+func (m *memoryStorage) ListAuditEntries(filter entity.AuditFilter, beforeID uint64, limit int) ([]entity.AuditEntry, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var entries []entity.AuditEntry
+	for i := len(m.auditLog) - 1; i >= 0 && len(entries) < limit; i-- {
+		entry := m.auditLog[i]
+		switch {
+		case beforeID != 0 && entry.ID >= beforeID,
+			filter.Action != "" && entry.Action != filter.Action,
+			filter.ActorID != 0 && (entry.ActorID == nil || *entry.ActorID != filter.ActorID),
+			filter.SubjectID != 0 && (entry.SubjectID == nil || *entry.SubjectID != filter.SubjectID),
+			!filter.Since.IsZero() && entry.CreatedAt.Before(filter.Since),
+			!filter.Until.IsZero() && !entry.CreatedAt.Before(filter.Until):
+			continue
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// auditActions возвращает действия журнала аудита по порядку записи.
+func (m *memoryStorage) auditActions() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	actions := make([]string, 0, len(m.auditLog))
+	for _, entry := range m.auditLog {
+		actions = append(actions, entry.Action)
+	}
+	return actions
+}
+
+// recordingWriter запоминает события, отправленные в кафку.
+type recordingWriter struct {
+	mu     sync.Mutex
+	events []map[string]string
+	// err, если задана, возвращается вместо записи событий
+	err error
+}
+
+func (w *recordingWriter) WriteMessages(ctx context.Context, msgs ...kafka.Message) error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.err != nil {
+		return w.err
+	}
+	for _, msg := range msgs {
+		var event map[string]string
+		if err := json.Unmarshal(msg.Value, &event); err != nil {
+			return err
+		}
+		w.events = append(w.events, event)
+	}
+	return nil
+}
+
+func (w *recordingWriter) Close() error {
+	return nil
+}
+
+// last возвращает последнее событие с заданным type.
+func (w *recordingWriter) last(t *testing.T, eventType string) map[string]string {
+	t.Helper()
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for i := len(w.events) - 1; i >= 0; i-- {
+		if w.events[i]["type"] == eventType {
+			return w.events[i]
+		}
+	}
+	t.Fatalf("no %q event was sent", eventType)
+	return nil
+}
+
+func (w *recordingWriter) count(eventType string) int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	count := 0
+	for _, event := range w.events {
+		if event["type"] == eventType {
+			count++
+		}
+	}
+	return count
+}
+
+const (
+	testPassword = "violet-harbor-lantern-58"
+	testRPID     = "auth.test"
+	testOrigin   = "https://auth.test"
+)
+
+type testService struct {
+	*AuthService
+	storage *memoryStorage
+	writer  *recordingWriter
+	cache   redis.Redis
+}
+
+func newTestService(t *testing.T) *testService {
+	t.Helper()
+	return newTestServiceWithConfig(t, func(*config.Config) {})
+}
+
+func newTestServiceWithConfig(t *testing.T, configure func(*config.Config)) *testService {
+	t.Helper()
+	return newTestServiceWith(t, configure, redis.NewInMemory())
+}
+
+// newTestServiceWith собирает сервис поверх переданного кэша.
+func newTestServiceWith(t *testing.T, configure func(*config.Config), cache redis.Redis) *testService {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	cfg := &config.Config{}
+	cfg.JWTConfig.Algorithm = keyring.AlgorithmES256
+	cfg.JWTConfig.Issuer = "https://auth.test"
+	cfg.JWTConfig.Audience = "auth"
+	cfg.JWTConfig.Leeway = time.Second
+	configure(cfg)
+
+	keys, err := keyring.New(cfg.JWTConfig.Algorithm, "", time.Hour, logger)
+	if err != nil {
+		t.Fatalf("keyring.New: %v", err)
+	}
+	passwords, err := passwordpolicy.New(cfg.PasswordPolicyConfig)
+	if err != nil {
+		t.Fatalf("passwordpolicy.New: %v", err)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	cipher, err := encryption.NewCipher(base64.StdEncoding.EncodeToString(key))
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+
+	passkeys, err := webauthn.New(webauthn.Config{RPID: testRPID, RPName: "Auth", Origins: []string{testOrigin}})
+	if err != nil {
+		t.Fatalf("webauthn.New: %v", err)
+	}
+
+	storage := newMemoryStorage()
+	writer := &recordingWriter{}
+	tokens := token.NewManager(cfg, storage, keys, cache, logger)
+
+	service := NewGRPCServer(cfg, storage, tokens, keys, writer, cipher, cache, passkeys, passwords, "", logger)
+	return &testService{AuthService: service, storage: storage, writer: writer, cache: cache}
+}
+
+// addUser сохраняет пользователя с паролем testPassword.
+func (s *testService) addUser(t *testing.T, username string, verified bool) *entity.User {
+	t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte(testPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	if err := s.storage.SaveUser(username, username+"@example.com", 30, hashed); err != nil {
+		t.Fatalf("SaveUser: %v", err)
+	}
+	user, err := s.storage.GetUserByUserName(username)
+	if err != nil {
+		t.Fatalf("GetUserByUserName: %v", err)
+	}
+	if verified {
+		if err := s.storage.SetEmailVerified(user.ID); err != nil {
+			t.Fatalf("SetEmailVerified: %v", err)
+		}
+		user.EmailVerified = true
+	}
+	return user
+}
+
+// authorized возвращает контекст с access-токеном пользователя.
+func (s *testService) authorized(t *testing.T, user *entity.User) context.Context {
+	t.Helper()
+	pair, err := s.tokens.Issue(user)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+pair.AccessToken))
+}
+
+// authorizedIn возвращает контекст с access-токеном, в котором активна
+// организация organizationID; 0 - без организации.
+func (s *testService) authorizedIn(t *testing.T, user *entity.User, organizationID uint) context.Context {
+	t.Helper()
+	pair, err := s.tokens.IssueGrant(user, token.Grant{OrganizationID: organizationID})
+	if err != nil {
+		t.Fatalf("IssueGrant: %v", err)
+	}
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+pair.AccessToken))
+}
+
+func requireCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Fatalf("code = %v, want %v (err: %v)", got, want, err)
+	}
+}
@@ -0,0 +1,118 @@
+package authservice
+
+import (
+	"auth/internal/entity"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"errors"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	verificationExpiration   = 24 * time.Hour
+	verificationResendLimit  = 3
+	verificationResendWindow = time.Hour
+)
+
+func (s *AuthService) VerifyEmail(ctx context.Context, req *pb.VerifyEmailRequest) (*pb.VerifyEmailResponse, error) {
+	stored, err := s.storage.GetOneTimeToken(entity.PurposeEmailVerification, token.Hash(req.GetToken()))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Warn("unknown verification token")
+			return nil, status.Errorf(codes.InvalidArgument, "invalid or expired verification token")
+		}
+		s.logger.Error("failed to get verification token", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to verify email")
+	}
+
+	if stored.UsedAt != nil || time.Now().After(stored.ExpiresAt) {
+		s.logger.Warn("verification token is used or expired", "user_id", stored.UserID)
+		return nil, status.Errorf(codes.InvalidArgument, "invalid or expired verification token")
+	}
+
+	if err := s.storage.MarkOneTimeTokenUsed(stored.ID); err != nil {
+		if errors.Is(err, postgres.ErrOneTimeTokenAlreadyUsed) {
+			return nil, status.Errorf(codes.InvalidArgument, "invalid or expired verification token")
+		}
+		s.logger.Error("failed to mark verification token as used", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to verify email")
+	}
+
+	if err := s.storage.SetEmailVerified(stored.UserID); err != nil {
+		s.logger.Error("failed to set email verified", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to verify email")
+	}
+
+	if err := s.storage.InvalidateOneTimeTokens(stored.UserID, entity.PurposeEmailVerification); err != nil {
+		s.logger.Warn("failed to invalidate verification tokens", "error", err)
+	}
+
+	s.logger.Info("email verified successfully", "user_id", stored.UserID)
+	return &pb.VerifyEmailResponse{Message: "email successfully verified"}, nil
+}
+
+// ResendVerification отвечает одинаково для любых адресов, чтобы по
+// ответу нельзя было узнать, зарегистрирован ли email.
+func (s *AuthService) ResendVerification(ctx context.Context, req *pb.ResendVerificationRequest) (*pb.ResendVerificationResponse, error) {
+	resp := &pb.ResendVerificationResponse{Message: "if the account exists and is not verified, a new verification email has been sent"}
+
+	user, err := s.storage.GetUserByEmail(req.GetEmail())
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return resp, nil
+		}
+		s.logger.Error("failed to get user", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to resend verification")
+	}
+
+	if user.EmailVerified {
+		return resp, nil
+	}
+
+	sent, err := s.storage.CountOneTimeTokens(user.ID, entity.PurposeEmailVerification, time.Now().Add(-verificationResendWindow))
+	if err != nil {
+		s.logger.Error("failed to count verification tokens", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to resend verification")
+	}
+	if sent >= verificationResendLimit {
+		s.logger.Warn("verification resend limit reached", "user_id", user.ID)
+		return resp, nil
+	}
+
+	if err := s.storage.InvalidateOneTimeTokens(user.ID, entity.PurposeEmailVerification); err != nil {
+		s.logger.Error("failed to invalidate verification tokens", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to resend verification")
+	}
+
+	if err := s.sendVerification(user); err != nil {
+		s.logger.Error("failed to send verification", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to resend verification")
+	}
+
+	return resp, nil
+}
+
+// sendVerification выпускает новый токен подтверждения и отправляет его
+// пользователю через кафку.
+func (s *AuthService) sendVerification(user *entity.User) error {
+	verificationToken, err := token.RandomString(32)
+	if err != nil {
+		return err
+	}
+
+	expiresAt := time.Now().Add(verificationExpiration)
+	if err := s.storage.SaveOneTimeToken(user.ID, entity.PurposeEmailVerification, token.Hash(verificationToken), expiresAt); err != nil {
+		return err
+	}
+
+	return s.sendNotificationEvent(user.Email, "confirm your email address", map[string]string{
+		"type":  entity.PurposeEmailVerification,
+		"token": verificationToken,
+	})
+}
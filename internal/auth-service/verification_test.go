@@ -0,0 +1,182 @@
+package authservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/entity"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"slices"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+)
+
+func TestRegisterSendsVerification(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.Register(ctx, &pb.RegisterRequest{Username: "Alice", Email: "Alice@Example.com", Age: 30, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	user, err := s.storage.GetUserByUserName("alice")
+	if err != nil {
+		t.Fatalf("GetUserByUserName: %v", err)
+	}
+	if user.EmailVerified {
+		t.Fatal("new user has a verified email")
+	}
+
+	event := s.writer.last(t, entity.PurposeEmailVerification)
+	if event["email"] != user.Email || event["token"] == "" {
+		t.Fatalf("verification event = %v", event)
+	}
+	if !slices.Contains(s.storage.auditActions(), audit.ActionRegister) {
+		t.Fatalf("audit actions = %v, want %s", s.storage.auditActions(), audit.ActionRegister)
+	}
+
+	_, err = s.Register(ctx, &pb.RegisterRequest{Username: "alice", Email: "other@example.com", Age: 30, Password: testPassword})
+	requireCode(t, err, codes.AlreadyExists)
+}
+
+func TestLoginRequiresVerifiedEmail(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+
+	_, err := s.Register(ctx, &pb.RegisterRequest{Username: "alice", Email: "alice@example.com", Age: 30, Password: testPassword})
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+
+	_, err = s.Login(ctx, &pb.LoginRequest{Login: "alice", Password: testPassword})
+	requireCode(t, err, codes.FailedPrecondition)
+
+	verificationToken := s.writer.last(t, entity.PurposeEmailVerification)["token"]
+	if _, err := s.VerifyEmail(ctx, &pb.VerifyEmailRequest{Token: verificationToken}); err != nil {
+		t.Fatalf("VerifyEmail: %v", err)
+	}
+
+	// Тот же токен второй раз не принимается
+	_, err = s.VerifyEmail(ctx, &pb.VerifyEmailRequest{Token: verificationToken})
+	requireCode(t, err, codes.InvalidArgument)
+
+	response, err := s.Login(ctx, &pb.LoginRequest{Login: "alice@example.com", Password: testPassword})
+	if err != nil {
+		t.Fatalf("Login after verification: %v", err)
+	}
+	if response.GetToken() == "" || response.GetRefreshToken() == "" {
+		t.Fatalf("Login response = %v, want a token pair", response)
+	}
+}
+
+func TestVerifyEmailRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		token func(t *testing.T, s *testService, user *entity.User) string
+	}{
+		{
+			name: "unknown token",
+			token: func(t *testing.T, s *testService, user *entity.User) string {
+				return "unknown"
+			},
+		},
+		{
+			name: "expired token",
+			token: func(t *testing.T, s *testService, user *entity.User) string {
+				return saveOneTimeToken(t, s, user, entity.PurposeEmailVerification, -time.Minute)
+			},
+		},
+		{
+			name: "password reset token",
+			token: func(t *testing.T, s *testService, user *entity.User) string {
+				return saveOneTimeToken(t, s, user, entity.PurposePasswordReset, time.Hour)
+			},
+		},
+		{
+			name: "superseded by resend",
+			token: func(t *testing.T, s *testService, user *entity.User) string {
+				old := saveOneTimeToken(t, s, user, entity.PurposeEmailVerification, time.Hour)
+				if _, err := s.ResendVerification(context.Background(), &pb.ResendVerificationRequest{Email: user.Email}); err != nil {
+					t.Fatalf("ResendVerification: %v", err)
+				}
+				return old
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			user := s.addUser(t, "alice", false)
+
+			_, err := s.VerifyEmail(context.Background(), &pb.VerifyEmailRequest{Token: tt.token(t, s, user)})
+			requireCode(t, err, codes.InvalidArgument)
+
+			stored, err := s.storage.GetUserByID(user.ID)
+			if err != nil {
+				t.Fatalf("GetUserByID: %v", err)
+			}
+			if stored.EmailVerified {
+				t.Fatal("email verified by a rejected token")
+			}
+		})
+	}
+}
+
+func TestResendVerification(t *testing.T) {
+	s := newTestService(t)
+	ctx := context.Background()
+	unverified := s.addUser(t, "alice", false)
+	verified := s.addUser(t, "bob", true)
+
+	// Ответ не выдает, есть ли учетная запись
+	unknown, err := s.ResendVerification(ctx, &pb.ResendVerificationRequest{Email: "nobody@example.com"})
+	if err != nil {
+		t.Fatalf("ResendVerification for unknown email: %v", err)
+	}
+	known, err := s.ResendVerification(ctx, &pb.ResendVerificationRequest{Email: verified.Email})
+	if err != nil {
+		t.Fatalf("ResendVerification for verified user: %v", err)
+	}
+	if unknown.GetMessage() != known.GetMessage() {
+		t.Fatalf("messages differ: %q and %q", unknown.GetMessage(), known.GetMessage())
+	}
+	if got := s.writer.count(entity.PurposeEmailVerification); got != 0 {
+		t.Fatalf("sent %d verification events, want 0", got)
+	}
+
+	for i := range verificationResendLimit {
+		if _, err := s.ResendVerification(ctx, &pb.ResendVerificationRequest{Email: unverified.Email}); err != nil {
+			t.Fatalf("ResendVerification #%d: %v", i+1, err)
+		}
+	}
+	// Сверх лимита письмо не отправляется, но ответ тот же, что и для
+	// незнакомого адреса
+	limited, err := s.ResendVerification(ctx, &pb.ResendVerificationRequest{Email: unverified.Email})
+	if err != nil {
+		t.Fatalf("ResendVerification over the limit: %v", err)
+	}
+	if limited.GetMessage() != unknown.GetMessage() {
+		t.Fatalf("messages differ: %q and %q", limited.GetMessage(), unknown.GetMessage())
+	}
+
+	if got := s.writer.count(entity.PurposeEmailVerification); got != verificationResendLimit {
+		t.Fatalf("sent %d verification events, want %d", got, verificationResendLimit)
+	}
+}
+
+// saveOneTimeToken сохраняет токен с заданной целью, истекающий через ttl.
+func saveOneTimeToken(t *testing.T, s *testService, user *entity.User, purpose string, ttl time.Duration) string {
+	t.Helper()
+	raw, err := token.RandomString(32)
+	if err != nil {
+		t.Fatalf("RandomString: %v", err)
+	}
+	if err := s.storage.SaveOneTimeToken(user.ID, purpose, token.Hash(raw), time.Now().Add(ttl)); err != nil {
+		t.Fatalf("SaveOneTimeToken: %v", err)
+	}
+	return raw
+}
@@ -0,0 +1,409 @@
+package authzservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/authz"
+	"auth/internal/entity"
+	"auth/internal/rbac"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	pb "auth/proto/authz"
+	"context"
+	"errors"
+	"log/slog"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// maxTuplesPerWrite ограничивает размер одной атомарной записи.
+const maxTuplesPerWrite = 100
+
+// userNamespace - пространство имен пользователей: в кортежах пользователь
+// с ID 42 - субъект user:42.
+const userNamespace = "user"
+
+var objectIDPattern = regexp.MustCompile(`^[A-Za-z0-9/_|.@+=-]{1,128}$`)
+
+// AuthzService - проверка прав на уровне объектов по кортежам отношений
+// (модель Zanzibar). Схема задается в секции authz конфигурации.
+type AuthzService struct {
+	pb.UnimplementedAuthzServiceServer
+	schema  *authz.Schema
+	storage postgres.Storage
+	tokens  *token.Manager
+	audit   *audit.Log
+	logger  *slog.Logger
+}
+
+func NewAuthzService(schema *authz.Schema, storage postgres.Storage, tokens *token.Manager, logger *slog.Logger) *AuthzService {
+	return &AuthzService{
+		schema:  schema,
+		storage: storage,
+		tokens:  tokens,
+		audit:   audit.NewLog(storage, logger),
+		logger:  logger,
+	}
+}
+
+func (s *AuthzService) WriteTuples(ctx context.Context, req *pb.WriteTuplesRequest) (*pb.WriteTuplesResponse, error) {
+	userID, err := s.requirePermission(ctx, rbac.PermissionWriteRelations)
+	if err != nil {
+		return nil, err
+	}
+
+	tuples, err := s.tuplesFromProto(req.GetTuples(), true)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, err := s.storage.WriteRelationTuples(tuples, nil)
+	if err != nil {
+		s.logger.Error("failed to write tuples", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to write tuples")
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:  audit.ActionRelationsWrite,
+		ActorID: userID,
+		Details: tuplesDetails(tuples, revision),
+	})
+	s.logger.Info("relation tuples written", "count", len(tuples), "revision", revision, "user_id", userID)
+	return &pb.WriteTuplesResponse{Zookie: authz.EncodeZookie(revision)}, nil
+}
+
+func (s *AuthzService) DeleteTuples(ctx context.Context, req *pb.DeleteTuplesRequest) (*pb.DeleteTuplesResponse, error) {
+	userID, err := s.requirePermission(ctx, rbac.PermissionWriteRelations)
+	if err != nil {
+		return nil, err
+	}
+
+	tuples, err := s.tuplesFromProto(req.GetTuples(), false)
+	if err != nil {
+		return nil, err
+	}
+
+	revision, err := s.storage.WriteRelationTuples(nil, tuples)
+	if err != nil {
+		s.logger.Error("failed to delete tuples", "error", err)
+		return nil, status.Errorf(codes.Internal, "failed to delete tuples")
+	}
+
+	s.audit.Record(ctx, audit.Event{
+		Action:  audit.ActionRelationsDelete,
+		ActorID: userID,
+		Details: tuplesDetails(tuples, revision),
+	})
+	s.logger.Info("relation tuples deleted", "count", len(tuples), "revision", revision, "user_id", userID)
+	return &pb.DeleteTuplesResponse{Zookie: authz.EncodeZookie(revision)}, nil
+}
+
+// Check проверяет отношение. Без права relations:read пользователь может
+// проверять только себя.
+func (s *AuthzService) Check(ctx context.Context, req *pb.CheckRequest) (*pb.CheckResponse, error) {
+	object, err := s.object(req.GetObject(), req.GetRelation())
+	if err != nil {
+		return nil, err
+	}
+	subject, err := s.subject(req.GetSubject())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireSubjectAccess(ctx, subject); err != nil {
+		return nil, err
+	}
+
+	revision, err := s.revision(req.GetConsistency())
+	if err != nil {
+		return nil, err
+	}
+
+	allowed, err := authz.NewChecker(s.schema, s.storage, revision).Check(object, req.GetRelation(), subject)
+	if err != nil {
+		return nil, s.evaluationError("check", err)
+	}
+
+	return &pb.CheckResponse{Allowed: allowed, Zookie: authz.EncodeZookie(revision)}, nil
+}
+
+// Expand раскрывает всех субъектов отношения, поэтому требует права
+// relations:read.
+func (s *AuthzService) Expand(ctx context.Context, req *pb.ExpandRequest) (*pb.ExpandResponse, error) {
+	if _, err := s.requirePermission(ctx, rbac.PermissionReadRelations); err != nil {
+		return nil, err
+	}
+
+	object, err := s.object(req.GetObject(), req.GetRelation())
+	if err != nil {
+		return nil, err
+	}
+
+	revision, err := s.revision(req.GetConsistency())
+	if err != nil {
+		return nil, err
+	}
+
+	tree, err := authz.NewChecker(s.schema, s.storage, revision).Expand(object, req.GetRelation())
+	if err != nil {
+		return nil, s.evaluationError("expand", err)
+	}
+
+	return &pb.ExpandResponse{Tree: treeToProto(tree), Zookie: authz.EncodeZookie(revision)}, nil
+}
+
+// ListObjects возвращает объекты, к которым у субъекта есть отношение. Как и
+// в Check, чужие субъекты доступны только с правом relations:read.
+func (s *AuthzService) ListObjects(ctx context.Context, req *pb.ListObjectsRequest) (*pb.ListObjectsResponse, error) {
+	if _, ok := s.schema.Relation(req.GetNamespace(), req.GetRelation()); !ok {
+		return nil, status.Errorf(codes.InvalidArgument, "unknown relation %s#%s", req.GetNamespace(), req.GetRelation())
+	}
+	subject, err := s.subject(req.GetSubject())
+	if err != nil {
+		return nil, err
+	}
+	if err := s.requireSubjectAccess(ctx, subject); err != nil {
+		return nil, err
+	}
+
+	revision, err := s.revision(req.GetConsistency())
+	if err != nil {
+		return nil, err
+	}
+
+	objects, err := authz.NewChecker(s.schema, s.storage, revision).ListObjects(req.GetNamespace(), req.GetRelation(), subject)
+	if err != nil {
+		return nil, s.evaluationError("list objects", err)
+	}
+
+	return &pb.ListObjectsResponse{ObjectIds: objects, Zookie: authz.EncodeZookie(revision)}, nil
+}
+
+// revision выбирает ревизию для чтения. Реплик и кеша проверок нет, поэтому
+// at_least_as_fresh всегда выполняется на последней ревизии.
+func (s *AuthzService) revision(consistency *pb.Consistency) (uint64, error) {
+	latest, err := s.storage.LatestRelationRevision()
+	if err != nil {
+		s.logger.Error("failed to get relation revision", "error", err)
+		return 0, status.Errorf(codes.Internal, "failed to get revision")
+	}
+
+	var zookie string
+	switch requirement := consistency.GetRequirement().(type) {
+	case *pb.Consistency_AtLeastAsFresh:
+		zookie = requirement.AtLeastAsFresh
+	case *pb.Consistency_AtExactSnapshot:
+		zookie = requirement.AtExactSnapshot
+	default:
+		return latest, nil
+	}
+
+	revision, err := authz.DecodeZookie(zookie)
+	if err != nil {
+		return 0, status.Errorf(codes.InvalidArgument, "invalid zookie")
+	}
+	if revision > latest {
+		return 0, status.Errorf(codes.InvalidArgument, "zookie refers to an unknown revision")
+	}
+
+	if consistency.GetAtExactSnapshot() != "" {
+		return revision, nil
+	}
+	return latest, nil
+}
+
+func (s *AuthzService) evaluationError(operation string, err error) error {
+	if errors.Is(err, authz.ErrMaxDepth) {
+		return status.Errorf(codes.FailedPrecondition, "%v", err)
+	}
+	s.logger.Error("failed to evaluate relations", "operation", operation, "error", err)
+	return status.Errorf(codes.Internal, "failed to %s", operation)
+}
+
+func (s *AuthzService) tuplesFromProto(tuples []*pb.RelationTuple, write bool) ([]entity.RelationTuple, error) {
+	if len(tuples) == 0 {
+		return nil, status.Errorf(codes.InvalidArgument, "no tuples")
+	}
+	if len(tuples) > maxTuplesPerWrite {
+		return nil, status.Errorf(codes.InvalidArgument, "at most %d tuples per request", maxTuplesPerWrite)
+	}
+
+	result := make([]entity.RelationTuple, 0, len(tuples))
+	for _, tuple := range tuples {
+		object, err := s.object(tuple.GetObject(), tuple.GetRelation())
+		if err != nil {
+			return nil, err
+		}
+		subject, err := s.subject(tuple.GetSubject())
+		if err != nil {
+			return nil, err
+		}
+
+		// Вычисляемые отношения определяются схемой, кортежи для них
+		// записывать нельзя
+		relation, _ := s.schema.Relation(object.Namespace, tuple.GetRelation())
+		if write && !relation.AllowsDirect() {
+			return nil, status.Errorf(codes.InvalidArgument, "relation %s#%s does not accept tuples", object.Namespace, relation.Name)
+		}
+
+		result = append(result, entity.RelationTuple{
+			Namespace:        object.Namespace,
+			ObjectID:         object.ID,
+			Relation:         tuple.GetRelation(),
+			SubjectNamespace: subject.Namespace,
+			SubjectID:        subject.ID,
+			SubjectRelation:  subject.Relation,
+		})
+	}
+
+	return result, nil
+}
+
+func (s *AuthzService) object(ref *pb.ObjectRef, relation string) (authz.Object, error) {
+	if _, ok := s.schema.Relation(ref.GetNamespace(), relation); !ok {
+		return authz.Object{}, status.Errorf(codes.InvalidArgument, "unknown relation %s#%s", ref.GetNamespace(), relation)
+	}
+	if !objectIDPattern.MatchString(ref.GetObjectId()) {
+		return authz.Object{}, status.Errorf(codes.InvalidArgument, "invalid object id %q", ref.GetObjectId())
+	}
+
+	return authz.Object{Namespace: ref.GetNamespace(), ID: ref.GetObjectId()}, nil
+}
+
+func (s *AuthzService) subject(ref *pb.SubjectRef) (authz.Subject, error) {
+	object := ref.GetObject()
+	if _, ok := s.schema.Namespace(object.GetNamespace()); !ok {
+		return authz.Subject{}, status.Errorf(codes.InvalidArgument, "unknown subject namespace %q", object.GetNamespace())
+	}
+	if !objectIDPattern.MatchString(object.GetObjectId()) {
+		return authz.Subject{}, status.Errorf(codes.InvalidArgument, "invalid subject id %q", object.GetObjectId())
+	}
+	if ref.GetRelation() != "" {
+		if _, ok := s.schema.Relation(object.GetNamespace(), ref.GetRelation()); !ok {
+			return authz.Subject{}, status.Errorf(codes.InvalidArgument, "unknown subject relation %s#%s", object.GetNamespace(), ref.GetRelation())
+		}
+	}
+
+	return authz.Subject{Namespace: object.GetNamespace(), ID: object.GetObjectId(), Relation: ref.GetRelation()}, nil
+}
+
+// requireSubjectAccess пропускает вопросы пользователя о самом себе, а о
+// других субъектах - только при праве relations:read.
+func (s *AuthzService) requireSubjectAccess(ctx context.Context, subject authz.Subject) error {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return err
+	}
+
+	self := authz.Subject{Namespace: userNamespace, ID: strconv.FormatUint(uint64(userID), 10)}
+	if subject == self {
+		return nil
+	}
+
+	_, err = s.requirePermission(ctx, rbac.PermissionReadRelations)
+	return err
+}
+
+// requirePermission проверяет access-токен из метаданных и право
+// пользователя по его текущим ролям.
+func (s *AuthzService) requirePermission(ctx context.Context, permission string) (uint, error) {
+	userID, err := s.authenticate(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	roles, err := s.storage.GetUserRoles(userID)
+	if err != nil {
+		s.logger.Error("failed to get user roles", "error", err)
+		return 0, status.Errorf(codes.Internal, "failed to check permission")
+	}
+	if !rbac.HasPermission(roles, permission) {
+		s.logger.Warn("permission denied", "user_id", userID, "permission", permission)
+		s.audit.Record(ctx, audit.Event{
+			Action:  audit.ActionPermissionDenied,
+			ActorID: userID,
+			Result:  audit.ResultFailure,
+			Details: map[string]string{"permission": permission},
+		})
+		return 0, status.Errorf(codes.PermissionDenied, "permission denied")
+	}
+
+	return userID, nil
+}
+
+// authenticate проверяет access-токен из метаданных и возвращает ID
+// пользователя.
+func (s *AuthzService) authenticate(ctx context.Context) (uint, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 {
+		return 0, status.Errorf(codes.Unauthenticated, "missing authorization metadata")
+	}
+
+	tokenString, found := strings.CutPrefix(values[0], "Bearer ")
+	if !found {
+		return 0, status.Errorf(codes.Unauthenticated, "invalid authorization metadata")
+	}
+
+	claims, err := s.tokens.Parse(tokenString)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrTokenRevoked) {
+			s.logger.Warn("invalid token", "error", err)
+			return 0, status.Errorf(codes.Unauthenticated, "invalid token")
+		}
+		s.logger.Error("failed to validate token", "error", err)
+		return 0, status.Errorf(codes.Internal, "failed to validate token")
+	}
+
+	// Токены OAuth-клиентов не дают доступа к отношениям: клиент мог бы
+	// узнать, какие объекты видит пользователь
+	if claims.ClientID != "" {
+		return 0, status.Errorf(codes.PermissionDenied, "oauth client tokens are not accepted")
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return 0, status.Errorf(codes.Unauthenticated, "invalid token")
+	}
+
+	return userID, nil
+}
+
+// tuplesDetails описывает кортежи для журнала аудита в виде
+// namespace:object#relation@subject.
+func tuplesDetails(tuples []entity.RelationTuple, revision uint64) map[string]string {
+	formatted := make([]string, 0, len(tuples))
+	for _, tuple := range tuples {
+		subject := tuple.SubjectNamespace + ":" + tuple.SubjectID
+		if tuple.SubjectRelation != "" {
+			subject += "#" + tuple.SubjectRelation
+		}
+		formatted = append(formatted, tuple.Namespace+":"+tuple.ObjectID+"#"+tuple.Relation+"@"+subject)
+	}
+
+	return map[string]string{
+		"tuples":   strings.Join(formatted, " "),
+		"revision": strconv.FormatUint(revision, 10),
+	}
+}
+
+func treeToProto(tree *authz.Tree) *pb.UsersetTree {
+	node := &pb.UsersetTree{
+		Operation: tree.Operation,
+		Object:    &pb.ObjectRef{Namespace: tree.Object.Namespace, ObjectId: tree.Object.ID},
+		Relation:  tree.Relation,
+	}
+	for _, subject := range tree.Subjects {
+		node.Subjects = append(node.Subjects, &pb.SubjectRef{
+			Object:   &pb.ObjectRef{Namespace: subject.Namespace, ObjectId: subject.ID},
+			Relation: subject.Relation,
+		})
+	}
+	for _, child := range tree.Children {
+		node.Children = append(node.Children, treeToProto(child))
+	}
+	return node
+}
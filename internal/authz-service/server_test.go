@@ -0,0 +1,447 @@
+package authzservice
+
+import (
+	"auth/internal/audit"
+	"auth/internal/authz"
+	"auth/internal/config"
+	"auth/internal/entity"
+	"auth/internal/keyring"
+	"auth/internal/rbac"
+	"auth/internal/redis"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	pb "auth/proto/authz"
+	"context"
+	"io"
+	"log/slog"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+// memoryStorage хранит кортежи с ревизиями, права пользователей и журнал
+// аудита. Остальные методы Storage не реализованы и паникуют при вызове.
+type memoryStorage struct {
+	postgres.Storage
+
+	mu          sync.Mutex
+	tuples      []entity.RelationTuple
+	revision    uint64
+	permissions map[uint][]string
+	auditLog    []entity.AuditEntry
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{permissions: make(map[uint][]string)}
+}
+
+func sameTuple(a, b entity.RelationTuple) bool {
+	return a.Namespace == b.Namespace && a.ObjectID == b.ObjectID && a.Relation == b.Relation &&
+		a.SubjectNamespace == b.SubjectNamespace && a.SubjectID == b.SubjectID && a.SubjectRelation == b.SubjectRelation
+}
+
+func (m *memoryStorage) WriteRelationTuples(writes []entity.RelationTuple, deletes []entity.RelationTuple) (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.revision++
+	revision := m.revision
+
+	for _, tuple := range deletes {
+		for i := range m.tuples {
+			if sameTuple(m.tuples[i], tuple) && m.tuples[i].DeletedRevision == nil {
+				m.tuples[i].DeletedRevision = &revision
+			}
+		}
+	}
+	for _, tuple := range writes {
+		live := slices.ContainsFunc(m.tuples, func(existing entity.RelationTuple) bool {
+			return sameTuple(existing, tuple) && existing.DeletedRevision == nil
+		})
+		if live {
+			continue
+		}
+		tuple.ID = uint(len(m.tuples) + 1)
+		tuple.CreatedRevision = revision
+		m.tuples = append(m.tuples, tuple)
+	}
+
+	return revision, nil
+}
+
+func (m *memoryStorage) ReadRelationTuples(filter entity.RelationTupleFilter, revision uint64) ([]entity.RelationTuple, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var tuples []entity.RelationTuple
+	for _, tuple := range m.tuples {
+		switch {
+		case tuple.CreatedRevision > revision,
+			tuple.DeletedRevision != nil && *tuple.DeletedRevision <= revision,
+			filter.Namespace != "" && tuple.Namespace != filter.Namespace,
+			filter.ObjectID != "" && tuple.ObjectID != filter.ObjectID,
+			filter.Relation != "" && tuple.Relation != filter.Relation:
+			continue
+		}
+		tuples = append(tuples, tuple)
+	}
+	return tuples, nil
+}
+
+func (m *memoryStorage) LatestRelationRevision() (uint64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.revision, nil
+}
+
+func (m *memoryStorage) GetUserRoles(userID uint) ([]entity.Role, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if len(m.permissions[userID]) == 0 {
+		return nil, nil
+	}
+	role := entity.Role{Name: "test"}
+	for _, permission := range m.permissions[userID] {
+		role.Permissions = append(role.Permissions, entity.Permission{Name: permission})
+	}
+	return []entity.Role{role}, nil
+}
+
+func (m *memoryStorage) ListMemberships(userID uint) ([]entity.Membership, error) {
+	return nil, nil
+}
+
+func (m *memoryStorage) SaveRefreshToken(userID uint, familyID string, clientID string, organizationID uint, scope string, tokenHash string, expiresAt time.Time) error {
+	return nil
+}
+
+func (m *memoryStorage) AppendAuditEntry(entry *entity.AuditEntry, seal func(entry *entity.AuditEntry) string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.ID = uint64(len(m.auditLog) + 1)
+	if len(m.auditLog) > 0 {
+		entry.PrevHash = m.auditLog[len(m.auditLog)-1].Hash
+	}
+	entry.Hash = seal(entry)
+	m.auditLog = append(m.auditLog, *entry)
+	return nil
+}
+
+func (m *memoryStorage) auditActions() []string {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	actions := make([]string, 0, len(m.auditLog))
+	for _, entry := range m.auditLog {
+		actions = append(actions, entry.Action)
+	}
+	return actions
+}
+
+type testService struct {
+	*AuthzService
+	storage *memoryStorage
+}
+
+// testSchema - сокращенная схема из config.yaml; viewer документа только
+// вычисляется и кортежей не принимает.
+func testSchema(t *testing.T) *authz.Schema {
+	t.Helper()
+	this := config.RewriteConfig{This: true}
+	schema, err := authz.NewSchema(config.AuthzConfig{Namespaces: []config.NamespaceConfig{
+		{Name: "user"},
+		{Name: "team", Relations: []config.RelationConfig{{Name: "member"}}},
+		{Name: "document", Relations: []config.RelationConfig{
+			{Name: "owner"},
+			{Name: "editor", Union: []config.RewriteConfig{this, {ComputedUserset: "owner"}}},
+			{Name: "viewer", Union: []config.RewriteConfig{{ComputedUserset: "editor"}}},
+		}},
+	}})
+	if err != nil {
+		t.Fatalf("NewSchema: %v", err)
+	}
+	return schema
+}
+
+func newTestService(t *testing.T) *testService {
+	t.Helper()
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+
+	cfg := &config.Config{}
+	cfg.JWTConfig.Algorithm = keyring.AlgorithmES256
+	cfg.JWTConfig.Issuer = "https://auth.test"
+	cfg.JWTConfig.Audience = "auth"
+	cfg.JWTConfig.Leeway = time.Second
+
+	keys, err := keyring.New(cfg.JWTConfig.Algorithm, "", time.Hour, logger)
+	if err != nil {
+		t.Fatalf("keyring.New: %v", err)
+	}
+
+	storage := newMemoryStorage()
+	tokens := token.NewManager(cfg, storage, keys, redis.NewInMemory(), logger)
+	return &testService{AuthzService: NewAuthzService(testSchema(t), storage, tokens, logger), storage: storage}
+}
+
+// authorized возвращает контекст с access-токеном пользователя userID,
+// которому выданы права permissions.
+func (s *testService) authorized(t *testing.T, userID uint, permissions ...string) context.Context {
+	t.Helper()
+	s.storage.mu.Lock()
+	s.storage.permissions[userID] = permissions
+	s.storage.mu.Unlock()
+
+	pair, err := s.tokens.Issue(&entity.User{Model: gorm.Model{ID: userID}, UserName: "user" + strconv.Itoa(int(userID))})
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	return bearer(pair.AccessToken)
+}
+
+func bearer(accessToken string) context.Context {
+	return metadata.NewIncomingContext(context.Background(), metadata.Pairs("authorization", "Bearer "+accessToken))
+}
+
+// tupleRef разбирает кортеж вида document:readme#owner@user:1.
+func tupleRef(t *testing.T, tuple string) *pb.RelationTuple {
+	t.Helper()
+	object, subject, ok := strings.Cut(tuple, "@")
+	if !ok {
+		t.Fatalf("invalid tuple %q", tuple)
+	}
+	object, relation, _ := strings.Cut(object, "#")
+	return &pb.RelationTuple{Object: objectRef(object), Relation: relation, Subject: subjectRef(subject)}
+}
+
+func objectRef(object string) *pb.ObjectRef {
+	namespace, id, _ := strings.Cut(object, ":")
+	return &pb.ObjectRef{Namespace: namespace, ObjectId: id}
+}
+
+func subjectRef(subject string) *pb.SubjectRef {
+	object, relation, _ := strings.Cut(subject, "#")
+	return &pb.SubjectRef{Object: objectRef(object), Relation: relation}
+}
+
+// write записывает кортежи от имени администратора и возвращает zookie.
+func (s *testService) write(t *testing.T, tuples ...string) string {
+	t.Helper()
+	req := &pb.WriteTuplesRequest{}
+	for _, tuple := range tuples {
+		req.Tuples = append(req.Tuples, tupleRef(t, tuple))
+	}
+	response, err := s.WriteTuples(s.authorized(t, 100, rbac.PermissionWriteRelations), req)
+	if err != nil {
+		t.Fatalf("WriteTuples: %v", err)
+	}
+	return response.GetZookie()
+}
+
+func requireCode(t *testing.T, err error, want codes.Code) {
+	t.Helper()
+	if got := status.Code(err); got != want {
+		t.Fatalf("code = %v, want %v (err: %v)", got, want, err)
+	}
+}
+
+func TestWriteTuplesRequiresPermission(t *testing.T) {
+	s := newTestService(t)
+	req := &pb.WriteTuplesRequest{Tuples: []*pb.RelationTuple{tupleRef(t, "document:readme#owner@user:1")}}
+
+	_, err := s.WriteTuples(context.Background(), req)
+	requireCode(t, err, codes.Unauthenticated)
+
+	_, err = s.WriteTuples(s.authorized(t, 1, rbac.PermissionReadRelations), req)
+	requireCode(t, err, codes.PermissionDenied)
+	if !slices.Contains(s.storage.auditActions(), audit.ActionPermissionDenied) {
+		t.Fatalf("audit actions = %v, want %s", s.storage.auditActions(), audit.ActionPermissionDenied)
+	}
+
+	_, err = s.DeleteTuples(s.authorized(t, 1), &pb.DeleteTuplesRequest{Tuples: req.Tuples})
+	requireCode(t, err, codes.PermissionDenied)
+
+	response, err := s.WriteTuples(s.authorized(t, 2, rbac.PermissionWriteRelations), req)
+	if err != nil {
+		t.Fatalf("WriteTuples: %v", err)
+	}
+	if response.GetZookie() != authz.EncodeZookie(1) {
+		t.Fatalf("zookie = %q, want revision 1", response.GetZookie())
+	}
+	if !slices.Contains(s.storage.auditActions(), audit.ActionRelationsWrite) {
+		t.Fatalf("audit actions = %v, want %s", s.storage.auditActions(), audit.ActionRelationsWrite)
+	}
+}
+
+func TestWriteTuplesRejects(t *testing.T) {
+	tests := []struct {
+		name  string
+		tuple string
+	}{
+		{"computed relation", "document:readme#viewer@user:1"},
+		{"unknown relation", "document:readme#reader@user:1"},
+		{"unknown namespace", "project:apollo#owner@user:1"},
+		{"unknown subject namespace", "document:readme#owner@robot:1"},
+		{"unknown subject relation", "document:readme#editor@team:core#lead"},
+		{"invalid object id", "document:read me#owner@user:1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := newTestService(t)
+			ctx := s.authorized(t, 100, rbac.PermissionWriteRelations)
+
+			_, err := s.WriteTuples(ctx, &pb.WriteTuplesRequest{Tuples: []*pb.RelationTuple{tupleRef(t, tt.tuple)}})
+			requireCode(t, err, codes.InvalidArgument)
+			if revision, _ := s.storage.LatestRelationRevision(); revision != 0 {
+				t.Fatalf("revision = %d after a rejected write", revision)
+			}
+		})
+	}
+
+	s := newTestService(t)
+	_, err := s.WriteTuples(s.authorized(t, 100, rbac.PermissionWriteRelations), &pb.WriteTuplesRequest{})
+	requireCode(t, err, codes.InvalidArgument)
+}
+
+func TestReadsRequireAccess(t *testing.T) {
+	s := newTestService(t)
+	s.write(t, "document:readme#owner@user:1", "document:readme#editor@team:core#member", "team:core#member@user:2")
+
+	check := func(ctx context.Context, subject string) error {
+		_, err := s.Check(ctx, &pb.CheckRequest{Object: objectRef("document:readme"), Relation: "viewer", Subject: subjectRef(subject)})
+		return err
+	}
+	listObjects := func(ctx context.Context, subject string) error {
+		_, err := s.ListObjects(ctx, &pb.ListObjectsRequest{Namespace: "document", Relation: "viewer", Subject: subjectRef(subject)})
+		return err
+	}
+	expand := func(ctx context.Context, subject string) error {
+		_, err := s.Expand(ctx, &pb.ExpandRequest{Object: objectRef("document:readme"), Relation: "viewer"})
+		return err
+	}
+
+	oauthClient, err := s.tokens.IssueGrant(&entity.User{Model: gorm.Model{ID: 1}}, token.Grant{ClientID: "app", Scope: "openid"})
+	if err != nil {
+		t.Fatalf("IssueGrant: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		call    func(context.Context, string) error
+		ctx     context.Context
+		subject string
+		want    codes.Code
+	}{
+		{"check without token", check, context.Background(), "user:1", codes.Unauthenticated},
+		{"check with invalid token", check, bearer("invalid"), "user:1", codes.Unauthenticated},
+		{"check with oauth client token", check, bearer(oauthClient.AccessToken), "user:1", codes.PermissionDenied},
+		{"check self", check, s.authorized(t, 1), "user:1", codes.OK},
+		{"check another user", check, s.authorized(t, 2), "user:1", codes.PermissionDenied},
+		{"check userset", check, s.authorized(t, 2), "team:core#member", codes.PermissionDenied},
+		{"check another user with relations:read", check, s.authorized(t, 3, rbac.PermissionReadRelations), "user:1", codes.OK},
+		{"check with relations:write only", check, s.authorized(t, 4, rbac.PermissionWriteRelations), "user:1", codes.PermissionDenied},
+		{"list objects without token", listObjects, context.Background(), "user:1", codes.Unauthenticated},
+		{"list objects of self", listObjects, s.authorized(t, 1), "user:1", codes.OK},
+		{"list objects of another user", listObjects, s.authorized(t, 2), "user:1", codes.PermissionDenied},
+		{"list objects with relations:read", listObjects, s.authorized(t, 3, rbac.PermissionReadRelations), "user:1", codes.OK},
+		{"expand without token", expand, context.Background(), "", codes.Unauthenticated},
+		{"expand without relations:read", expand, s.authorized(t, 1), "", codes.PermissionDenied},
+		{"expand with relations:read", expand, s.authorized(t, 3, rbac.PermissionReadRelations), "", codes.OK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			requireCode(t, tt.call(tt.ctx, tt.subject), tt.want)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	s := newTestService(t)
+	s.write(t, "document:readme#owner@user:1", "document:readme#editor@team:core#member", "team:core#member@user:2")
+	ctx := s.authorized(t, 100, rbac.PermissionReadRelations)
+
+	tests := []struct {
+		subject  string
+		relation string
+		want     bool
+	}{
+		{"user:1", "owner", true},
+		{"user:1", "viewer", true},
+		{"user:2", "editor", true},
+		{"user:2", "owner", false},
+		{"user:3", "viewer", false},
+	}
+	for _, tt := range tests {
+		response, err := s.Check(ctx, &pb.CheckRequest{Object: objectRef("document:readme"), Relation: tt.relation, Subject: subjectRef(tt.subject)})
+		if err != nil {
+			t.Fatalf("Check %s#%s: %v", tt.subject, tt.relation, err)
+		}
+		if response.GetAllowed() != tt.want {
+			t.Fatalf("Check %s#%s = %v, want %v", tt.subject, tt.relation, response.GetAllowed(), tt.want)
+		}
+	}
+
+	objects, err := s.ListObjects(s.authorized(t, 2), &pb.ListObjectsRequest{Namespace: "document", Relation: "viewer", Subject: subjectRef("user:2")})
+	if err != nil {
+		t.Fatalf("ListObjects: %v", err)
+	}
+	if !slices.Equal(objects.GetObjectIds(), []string{"readme"}) {
+		t.Fatalf("ListObjects = %v, want [readme]", objects.GetObjectIds())
+	}
+}
+
+func TestConsistency(t *testing.T) {
+	s := newTestService(t)
+	granted := s.write(t, "document:readme#owner@user:1")
+
+	admin := s.authorized(t, 100, rbac.PermissionWriteRelations)
+	deleted, err := s.DeleteTuples(admin, &pb.DeleteTuplesRequest{Tuples: []*pb.RelationTuple{tupleRef(t, "document:readme#owner@user:1")}})
+	if err != nil {
+		t.Fatalf("DeleteTuples: %v", err)
+	}
+
+	ctx := s.authorized(t, 1)
+	check := func(consistency *pb.Consistency) (*pb.CheckResponse, error) {
+		return s.Check(ctx, &pb.CheckRequest{
+			Object:      objectRef("document:readme"),
+			Relation:    "owner",
+			Subject:     subjectRef("user:1"),
+			Consistency: consistency,
+		})
+	}
+
+	tests := []struct {
+		name        string
+		consistency *pb.Consistency
+		allowed     bool
+		zookie      string
+	}{
+		{"latest", nil, false, deleted.GetZookie()},
+		{"exact snapshot before delete", &pb.Consistency{Requirement: &pb.Consistency_AtExactSnapshot{AtExactSnapshot: granted}}, true, granted},
+		{"exact snapshot after delete", &pb.Consistency{Requirement: &pb.Consistency_AtExactSnapshot{AtExactSnapshot: deleted.GetZookie()}}, false, deleted.GetZookie()},
+		// Реплик нет, поэтому at_least_as_fresh читает последнюю ревизию
+		{"at least as fresh", &pb.Consistency{Requirement: &pb.Consistency_AtLeastAsFresh{AtLeastAsFresh: granted}}, false, deleted.GetZookie()},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response, err := check(tt.consistency)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if response.GetAllowed() != tt.allowed || response.GetZookie() != tt.zookie {
+				t.Fatalf("Check = %v/%q, want %v/%q", response.GetAllowed(), response.GetZookie(), tt.allowed, tt.zookie)
+			}
+		})
+	}
+
+	for _, zookie := range []string{"not-a-zookie", authz.EncodeZookie(3)} {
+		_, err := check(&pb.Consistency{Requirement: &pb.Consistency_AtExactSnapshot{AtExactSnapshot: zookie}})
+		requireCode(t, err, codes.InvalidArgument)
+	}
+}
@@ -0,0 +1,292 @@
+package authz
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"sort"
+)
+
+// MaxDepth ограничивает глубину обхода отношений, чтобы длинная или
+// ошибочная цепочка кортежей не обходилась бесконечно.
+const MaxDepth = 32
+
+var ErrMaxDepth = errors.New("relation graph is too deep")
+
+// Operation узла дерева Expand.
+const OperationUnion = "union"
+
+// TupleReader читает кортежи на заданной ревизии.
+type TupleReader interface {
+	ReadRelationTuples(filter entity.RelationTupleFilter, revision uint64) ([]entity.RelationTuple, error)
+}
+
+// Object - объект namespace:id.
+type Object struct {
+	Namespace string
+	ID        string
+}
+
+// Subject - конкретный объект или, если задан Relation, множество
+// субъектов namespace:id#relation.
+type Subject struct {
+	Namespace string
+	ID        string
+	Relation  string
+}
+
+// Tree - результат Expand. Узел union содержит по узлу на каждое слагаемое
+// схемы; у узлов this и tuple_to_userset в Subjects найденные кортежи, а в
+// Children - раскрытые множества, на которые они указывают.
+type Tree struct {
+	Operation string
+	Object    Object
+	Relation  string
+	Subjects  []Subject
+	Children  []*Tree
+}
+
+type checkKey struct {
+	object   Object
+	relation string
+	subject  Subject
+}
+
+// Checker выполняет проверки на одной ревизии. Кортежи и результаты
+// кешируются на время жизни Checker, поэтому он создается на запрос.
+type Checker struct {
+	schema   *Schema
+	reader   TupleReader
+	revision uint64
+
+	tuples  map[entity.RelationTupleFilter][]entity.RelationTuple
+	results map[checkKey]bool
+	pending map[checkKey]struct{}
+	// cycles растет при каждом обнаруженном цикле; отрицательный результат,
+	// полученный через цикл, не кешируется, так как мог быть неполным
+	cycles int
+}
+
+func NewChecker(schema *Schema, reader TupleReader, revision uint64) *Checker {
+	return &Checker{
+		schema:   schema,
+		reader:   reader,
+		revision: revision,
+		tuples:   make(map[entity.RelationTupleFilter][]entity.RelationTuple),
+		results:  make(map[checkKey]bool),
+		pending:  make(map[checkKey]struct{}),
+	}
+}
+
+// Check сообщает, входит ли subject в множество object#relation.
+func (c *Checker) Check(object Object, relation string, subject Subject) (bool, error) {
+	return c.check(object, relation, subject, 0)
+}
+
+func (c *Checker) check(object Object, relation string, subject Subject, depth int) (bool, error) {
+	if depth > MaxDepth {
+		return false, ErrMaxDepth
+	}
+
+	// Множество субъектов входит само в себя
+	if subject.Relation == relation && subject.Namespace == object.Namespace && subject.ID == object.ID {
+		return true, nil
+	}
+
+	key := checkKey{object: object, relation: relation, subject: subject}
+	if result, ok := c.results[key]; ok {
+		return result, nil
+	}
+	if _, ok := c.pending[key]; ok {
+		c.cycles++
+		return false, nil
+	}
+
+	rel, ok := c.schema.Relation(object.Namespace, relation)
+	if !ok {
+		return false, nil
+	}
+
+	c.pending[key] = struct{}{}
+	cycles := c.cycles
+	result, err := c.checkRewrites(object, rel, subject, depth)
+	delete(c.pending, key)
+	if err != nil {
+		return false, err
+	}
+
+	if result || c.cycles == cycles {
+		c.results[key] = result
+	}
+
+	return result, nil
+}
+
+func (c *Checker) checkRewrites(object Object, relation *Relation, subject Subject, depth int) (bool, error) {
+	for _, rewrite := range relation.Union {
+		switch rewrite.Kind {
+		case RewriteThis:
+			tuples, err := c.read(object, relation.Name)
+			if err != nil {
+				return false, err
+			}
+			for _, tuple := range tuples {
+				if tuple.SubjectNamespace == subject.Namespace && tuple.SubjectID == subject.ID && tuple.SubjectRelation == subject.Relation {
+					return true, nil
+				}
+				if tuple.SubjectRelation == "" {
+					continue
+				}
+				ok, err := c.check(Object{Namespace: tuple.SubjectNamespace, ID: tuple.SubjectID}, tuple.SubjectRelation, subject, depth+1)
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+
+		case RewriteComputed:
+			ok, err := c.check(object, rewrite.Relation, subject, depth+1)
+			if err != nil || ok {
+				return ok, err
+			}
+
+		case RewriteTupleToUserset:
+			tuples, err := c.read(object, rewrite.Tupleset)
+			if err != nil {
+				return false, err
+			}
+			for _, tuple := range tuples {
+				ok, err := c.check(Object{Namespace: tuple.SubjectNamespace, ID: tuple.SubjectID}, rewrite.Relation, subject, depth+1)
+				if err != nil || ok {
+					return ok, err
+				}
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// Expand раскрывает множество object#relation рекурсивно. Повторно
+// встреченные на пути множества не раскрываются.
+func (c *Checker) Expand(object Object, relation string) (*Tree, error) {
+	return c.expand(object, relation, 0, make(map[checkKey]struct{}))
+}
+
+func (c *Checker) expand(object Object, relation string, depth int, path map[checkKey]struct{}) (*Tree, error) {
+	if depth > MaxDepth {
+		return nil, ErrMaxDepth
+	}
+
+	node := &Tree{Operation: OperationUnion, Object: object, Relation: relation}
+
+	key := checkKey{object: object, relation: relation}
+	rel, ok := c.schema.Relation(object.Namespace, relation)
+	if _, seen := path[key]; seen || !ok {
+		return node, nil
+	}
+	path[key] = struct{}{}
+	defer delete(path, key)
+
+	for _, rewrite := range rel.Union {
+		child := &Tree{Operation: rewrite.Kind, Object: object, Relation: relation}
+
+		switch rewrite.Kind {
+		case RewriteThis:
+			tuples, err := c.read(object, relation)
+			if err != nil {
+				return nil, err
+			}
+			for _, tuple := range tuples {
+				child.Subjects = append(child.Subjects, tupleSubject(tuple))
+				if tuple.SubjectRelation == "" {
+					continue
+				}
+				nested, err := c.expand(Object{Namespace: tuple.SubjectNamespace, ID: tuple.SubjectID}, tuple.SubjectRelation, depth+1, path)
+				if err != nil {
+					return nil, err
+				}
+				child.Children = append(child.Children, nested)
+			}
+
+		case RewriteComputed:
+			child.Relation = rewrite.Relation
+			nested, err := c.expand(object, rewrite.Relation, depth+1, path)
+			if err != nil {
+				return nil, err
+			}
+			child.Children = append(child.Children, nested)
+
+		case RewriteTupleToUserset:
+			child.Relation = rewrite.Tupleset
+			tuples, err := c.read(object, rewrite.Tupleset)
+			if err != nil {
+				return nil, err
+			}
+			for _, tuple := range tuples {
+				child.Subjects = append(child.Subjects, tupleSubject(tuple))
+				nested, err := c.expand(Object{Namespace: tuple.SubjectNamespace, ID: tuple.SubjectID}, rewrite.Relation, depth+1, path)
+				if err != nil {
+					return nil, err
+				}
+				child.Children = append(child.Children, nested)
+			}
+		}
+
+		node.Children = append(node.Children, child)
+	}
+
+	return node, nil
+}
+
+// ListObjects возвращает отсортированные идентификаторы объектов namespace,
+// для которых subject входит в relation. Объект без единого кортежа не
+// может дать доступ, поэтому кандидатами служат объекты, у которых есть
+// кортежи; каждый проверяется через Check с общим кешем.
+func (c *Checker) ListObjects(namespace, relation string, subject Subject) ([]string, error) {
+	tuples, err := c.reader.ReadRelationTuples(entity.RelationTupleFilter{Namespace: namespace}, c.revision)
+	if err != nil {
+		return nil, err
+	}
+
+	candidates := make(map[string]struct{})
+	for _, tuple := range tuples {
+		candidates[tuple.ObjectID] = struct{}{}
+	}
+
+	ids := make([]string, 0, len(candidates))
+	for id := range candidates {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	objects := make([]string, 0)
+	for _, id := range ids {
+		ok, err := c.Check(Object{Namespace: namespace, ID: id}, relation, subject)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			objects = append(objects, id)
+		}
+	}
+
+	return objects, nil
+}
+
+func (c *Checker) read(object Object, relation string) ([]entity.RelationTuple, error) {
+	filter := entity.RelationTupleFilter{Namespace: object.Namespace, ObjectID: object.ID, Relation: relation}
+	if tuples, ok := c.tuples[filter]; ok {
+		return tuples, nil
+	}
+
+	tuples, err := c.reader.ReadRelationTuples(filter, c.revision)
+	if err != nil {
+		return nil, err
+	}
+	c.tuples[filter] = tuples
+
+	return tuples, nil
+}
+
+func tupleSubject(tuple entity.RelationTuple) Subject {
+	return Subject{Namespace: tuple.SubjectNamespace, ID: tuple.SubjectID, Relation: tuple.SubjectRelation}
+}
@@ -0,0 +1,339 @@
+package authz
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// memoryReader хранит кортежи с ревизиями создания и удаления.
+type memoryReader struct {
+	tuples []entity.RelationTuple
+	reads  int
+}
+
+// add записывает кортеж вида document:readme#owner@user:carol.
+func (r *memoryReader) add(t *testing.T, tuple string, created uint64) *entity.RelationTuple {
+	t.Helper()
+	object, subject, ok := strings.Cut(tuple, "@")
+	if !ok {
+		t.Fatalf("invalid tuple %q", tuple)
+	}
+	object, relation, _ := strings.Cut(object, "#")
+	namespace, objectID, _ := strings.Cut(object, ":")
+	subject, subjectRelation, _ := strings.Cut(subject, "#")
+	subjectNamespace, subjectID, _ := strings.Cut(subject, ":")
+
+	r.tuples = append(r.tuples, entity.RelationTuple{
+		ID:               uint(len(r.tuples) + 1),
+		Namespace:        namespace,
+		ObjectID:         objectID,
+		Relation:         relation,
+		SubjectNamespace: subjectNamespace,
+		SubjectID:        subjectID,
+		SubjectRelation:  subjectRelation,
+		CreatedRevision:  created,
+	})
+	return &r.tuples[len(r.tuples)-1]
+}
+
+func (r *memoryReader) ReadRelationTuples(filter entity.RelationTupleFilter, revision uint64) ([]entity.RelationTuple, error) {
+	r.reads++
+	var tuples []entity.RelationTuple
+	for _, tuple := range r.tuples {
+		if tuple.CreatedRevision > revision || (tuple.DeletedRevision != nil && *tuple.DeletedRevision <= revision) {
+			continue
+		}
+		if (filter.Namespace != "" && tuple.Namespace != filter.Namespace) ||
+			(filter.ObjectID != "" && tuple.ObjectID != filter.ObjectID) ||
+			(filter.Relation != "" && tuple.Relation != filter.Relation) {
+			continue
+		}
+		tuples = append(tuples, tuple)
+	}
+	return tuples, nil
+}
+
+type failingReader struct{}
+
+var errRead = errors.New("read failed")
+
+func (failingReader) ReadRelationTuples(entity.RelationTupleFilter, uint64) ([]entity.RelationTuple, error) {
+	return nil, errRead
+}
+
+func newTestSchema(t *testing.T) *Schema {
+	t.Helper()
+	schema, err := NewSchema(testSchemaConfig())
+	if err != nil {
+		t.Fatalf("NewSchema: %v", err)
+	}
+	return schema
+}
+
+// newTestReader заполняет хранилище: readme лежит в docs, docs в root,
+// редакторы readme - команда core. План удален на ревизии 3.
+func newTestReader(t *testing.T) *memoryReader {
+	reader := &memoryReader{}
+	reader.add(t, "team:core#member@user:alice", 1)
+	reader.add(t, "team:core#member@user:bob", 1)
+	reader.add(t, "document:readme#owner@user:carol", 1)
+	reader.add(t, "document:readme#editor@team:core#member", 1)
+	reader.add(t, "document:readme#parent@folder:docs", 1)
+	reader.add(t, "folder:docs#viewer@user:dave", 1)
+	reader.add(t, "folder:docs#parent@folder:root", 1)
+	reader.add(t, "folder:root#viewer@user:erin", 1)
+	plan := reader.add(t, "document:plan#viewer@user:frank", 1)
+	deleted := uint64(3)
+	plan.DeletedRevision = &deleted
+	reader.add(t, "document:plan#viewer@user:grace", 2)
+	return reader
+}
+
+func user(id string) Subject {
+	return Subject{Namespace: "user", ID: id}
+}
+
+func TestCheck(t *testing.T) {
+	schema := newTestSchema(t)
+	reader := newTestReader(t)
+	readme := Object{Namespace: "document", ID: "readme"}
+	plan := Object{Namespace: "document", ID: "plan"}
+
+	tests := []struct {
+		name     string
+		object   Object
+		relation string
+		subject  Subject
+		revision uint64
+		want     bool
+	}{
+		{name: "direct owner", object: readme, relation: "owner", subject: user("carol"), revision: 3, want: true},
+		{name: "owner is editor", object: readme, relation: "editor", subject: user("carol"), revision: 3, want: true},
+		{name: "owner is viewer", object: readme, relation: "viewer", subject: user("carol"), revision: 3, want: true},
+		{name: "editor through team", object: readme, relation: "editor", subject: user("alice"), revision: 3, want: true},
+		{name: "editor is not owner", object: readme, relation: "owner", subject: user("alice"), revision: 3},
+		{name: "viewer through folder", object: readme, relation: "viewer", subject: user("dave"), revision: 3, want: true},
+		{name: "viewer through nested folder", object: readme, relation: "viewer", subject: user("erin"), revision: 3, want: true},
+		{name: "folder viewer is not editor", object: readme, relation: "editor", subject: user("dave"), revision: 3},
+		{name: "team as a subject set", object: readme, relation: "editor", subject: Subject{Namespace: "team", ID: "core", Relation: "member"}, revision: 3, want: true},
+		{name: "stranger", object: readme, relation: "viewer", subject: user("mallory"), revision: 3},
+		{name: "subject from another namespace", object: readme, relation: "owner", subject: Subject{Namespace: "service", ID: "carol"}, revision: 3},
+		{name: "unknown relation", object: readme, relation: "commenter", subject: user("carol"), revision: 3},
+		{name: "unknown namespace", object: Object{Namespace: "project", ID: "readme"}, relation: "viewer", subject: user("carol"), revision: 3},
+		{name: "before creation", object: plan, relation: "viewer", subject: user("grace"), revision: 1},
+		{name: "after creation", object: plan, relation: "viewer", subject: user("grace"), revision: 2, want: true},
+		{name: "before deletion", object: plan, relation: "viewer", subject: user("frank"), revision: 2, want: true},
+		{name: "after deletion", object: plan, relation: "viewer", subject: user("frank"), revision: 3},
+		{name: "revision zero", object: readme, relation: "owner", subject: user("carol"), revision: 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewChecker(schema, reader, tt.revision).Check(tt.object, tt.relation, tt.subject)
+			if err != nil {
+				t.Fatalf("Check: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Check = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCheckCachesTuples(t *testing.T) {
+	reader := newTestReader(t)
+	checker := NewChecker(newTestSchema(t), reader, 3)
+	readme := Object{Namespace: "document", ID: "readme"}
+
+	// Отрицательная проверка обходит весь граф
+	if ok, err := checker.Check(readme, "viewer", user("mallory")); err != nil || ok {
+		t.Fatalf("Check = %v, %v", ok, err)
+	}
+	reads := reader.reads
+
+	// Повторные проверки на той же ревизии не читают кортежи заново
+	for _, id := range []string{"erin", "dave", "mallory"} {
+		if _, err := checker.Check(readme, "viewer", user(id)); err != nil {
+			t.Fatalf("Check: %v", err)
+		}
+	}
+	if reader.reads != reads {
+		t.Fatalf("reads = %d, want %d", reader.reads, reads)
+	}
+}
+
+func TestCheckCycle(t *testing.T) {
+	reader := &memoryReader{}
+	reader.add(t, "team:a#member@team:b#member", 1)
+	reader.add(t, "team:b#member@team:a#member", 1)
+	reader.add(t, "team:a#member@user:alice", 1)
+	checker := NewChecker(newTestSchema(t), reader, 1)
+
+	tests := []struct {
+		team    string
+		subject Subject
+		want    bool
+	}{
+		// Проверка a заходит в b раньше, чем находит alice; b через цикл
+		// получает отрицательный ответ, который не должен кешироваться
+		{team: "a", subject: user("alice"), want: true},
+		{team: "b", subject: user("alice"), want: true},
+		{team: "a", subject: user("bob")},
+		{team: "b", subject: user("bob")},
+	}
+
+	for _, tt := range tests {
+		got, err := checker.Check(Object{Namespace: "team", ID: tt.team}, "member", tt.subject)
+		if err != nil {
+			t.Fatalf("Check(team:%s): %v", tt.team, err)
+		}
+		if got != tt.want {
+			t.Fatalf("Check(team:%s, %s) = %v, want %v", tt.team, tt.subject.ID, got, tt.want)
+		}
+	}
+}
+
+func TestCheckMaxDepth(t *testing.T) {
+	tests := []struct {
+		name    string
+		chain   int
+		wantErr error
+	}{
+		{name: "within limit", chain: MaxDepth},
+		{name: "too deep", chain: MaxDepth + 1, wantErr: ErrMaxDepth},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// team:t0 <- team:t1 <- ... <- team:tN <- user:alice
+			reader := &memoryReader{}
+			for i := range tt.chain {
+				reader.add(t, fmt.Sprintf("team:t%d#member@team:t%d#member", i, i+1), 1)
+			}
+			reader.add(t, fmt.Sprintf("team:t%d#member@user:alice", tt.chain), 1)
+
+			ok, err := NewChecker(newTestSchema(t), reader, 1).Check(Object{Namespace: "team", ID: "t0"}, "member", user("alice"))
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Check error = %v, want %v", err, tt.wantErr)
+			}
+			if ok != (tt.wantErr == nil) {
+				t.Fatalf("Check = %v", ok)
+			}
+		})
+	}
+}
+
+func TestCheckReadError(t *testing.T) {
+	checker := NewChecker(newTestSchema(t), failingReader{}, 1)
+	if _, err := checker.Check(Object{Namespace: "document", ID: "readme"}, "viewer", user("alice")); !errors.Is(err, errRead) {
+		t.Fatalf("Check error = %v, want %v", err, errRead)
+	}
+	if _, err := checker.ListObjects("document", "viewer", user("alice")); !errors.Is(err, errRead) {
+		t.Fatalf("ListObjects error = %v, want %v", err, errRead)
+	}
+}
+
+func TestListObjects(t *testing.T) {
+	schema := newTestSchema(t)
+	reader := newTestReader(t)
+	reader.add(t, "document:changelog#owner@user:alice", 1)
+
+	tests := []struct {
+		name     string
+		relation string
+		subject  Subject
+		revision uint64
+		want     []string
+	}{
+		{name: "owner and team editor", relation: "viewer", subject: user("alice"), revision: 3, want: []string{"changelog", "readme"}},
+		{name: "only owned", relation: "owner", subject: user("alice"), revision: 3, want: []string{"changelog"}},
+		{name: "through folders", relation: "viewer", subject: user("erin"), revision: 3, want: []string{"readme"}},
+		{name: "before deletion", relation: "viewer", subject: user("frank"), revision: 2, want: []string{"plan"}},
+		{name: "after deletion", relation: "viewer", subject: user("frank"), revision: 3, want: []string{}},
+		{name: "stranger", relation: "viewer", subject: user("mallory"), revision: 3, want: []string{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NewChecker(schema, reader, tt.revision).ListObjects("document", tt.relation, tt.subject)
+			if err != nil {
+				t.Fatalf("ListObjects: %v", err)
+			}
+			if got == nil || !slices.Equal(got, tt.want) {
+				t.Fatalf("ListObjects = %#v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExpand(t *testing.T) {
+	checker := NewChecker(newTestSchema(t), newTestReader(t), 3)
+
+	tree, err := checker.Expand(Object{Namespace: "document", ID: "readme"}, "editor")
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+	if tree.Operation != OperationUnion || len(tree.Children) != 2 {
+		t.Fatalf("root = %+v, want union of this and computed_userset", tree)
+	}
+
+	this, owner := tree.Children[0], tree.Children[1]
+	if this.Operation != RewriteThis || !slices.Equal(this.Subjects, []Subject{{Namespace: "team", ID: "core", Relation: "member"}}) {
+		t.Fatalf("this = %+v", this)
+	}
+	// Множество команды раскрыто до пользователей
+	team := this.Children[0].Children[0]
+	if !slices.Equal(team.Subjects, []Subject{user("alice"), user("bob")}) {
+		t.Fatalf("team members = %+v", team.Subjects)
+	}
+
+	if owner.Operation != RewriteComputed || owner.Relation != "owner" {
+		t.Fatalf("computed = %+v", owner)
+	}
+	if subjects := owner.Children[0].Children[0].Subjects; !slices.Equal(subjects, []Subject{user("carol")}) {
+		t.Fatalf("owners = %+v", subjects)
+	}
+}
+
+func TestExpandTupleToUserset(t *testing.T) {
+	checker := NewChecker(newTestSchema(t), newTestReader(t), 3)
+
+	tree, err := checker.Expand(Object{Namespace: "folder", ID: "docs"}, "viewer")
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	parent := tree.Children[1]
+	if parent.Operation != RewriteTupleToUserset || parent.Relation != "parent" {
+		t.Fatalf("tuple_to_userset = %+v", parent)
+	}
+	if !slices.Equal(parent.Subjects, []Subject{{Namespace: "folder", ID: "root"}}) {
+		t.Fatalf("parents = %+v", parent.Subjects)
+	}
+	root := parent.Children[0]
+	if root.Object.ID != "root" || !slices.Equal(root.Children[0].Subjects, []Subject{user("erin")}) {
+		t.Fatalf("root folder = %+v", root)
+	}
+}
+
+func TestExpandCycle(t *testing.T) {
+	reader := &memoryReader{}
+	reader.add(t, "team:a#member@team:b#member", 1)
+	reader.add(t, "team:b#member@team:a#member", 1)
+
+	tree, err := NewChecker(newTestSchema(t), reader, 1).Expand(Object{Namespace: "team", ID: "a"}, "member")
+	if err != nil {
+		t.Fatalf("Expand: %v", err)
+	}
+
+	// a -> b -> a: повторно встреченное множество не раскрывается
+	b := tree.Children[0].Children[0]
+	a := b.Children[0].Children[0]
+	if a.Object.ID != "a" || len(a.Children) != 0 {
+		t.Fatalf("repeated set expanded: %+v", a)
+	}
+}
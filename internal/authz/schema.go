@@ -0,0 +1,153 @@
+package authz
+
+import (
+	"auth/internal/config"
+	"fmt"
+	"regexp"
+)
+
+// Виды слагаемых union в схеме.
+const (
+	RewriteThis           = "this"
+	RewriteComputed       = "computed_userset"
+	RewriteTupleToUserset = "tuple_to_userset"
+)
+
+var namePattern = regexp.MustCompile(`^[a-z][a-z0-9_]{0,63}$`)
+
+// Rewrite - слагаемое union: откуда берутся субъекты отношения.
+type Rewrite struct {
+	Kind string
+	// Relation - отношение того же объекта для computed_userset и
+	// отношение найденных объектов для tuple_to_userset
+	Relation string
+	// Tupleset - отношение, кортежи которого указывают на другие объекты
+	Tupleset string
+}
+
+type Relation struct {
+	Name  string
+	Union []Rewrite
+}
+
+// AllowsDirect сообщает, можно ли записывать кортежи этого отношения.
+func (r *Relation) AllowsDirect() bool {
+	for _, rewrite := range r.Union {
+		if rewrite.Kind == RewriteThis {
+			return true
+		}
+	}
+	return false
+}
+
+type Namespace struct {
+	Name      string
+	Relations map[string]*Relation
+}
+
+// Schema - проверенная схема пространств имен и отношений.
+type Schema struct {
+	namespaces map[string]*Namespace
+}
+
+// NewSchema строит схему из конфигурации и проверяет, что все ссылки на
+// отношения разрешаются.
+func NewSchema(cfg config.AuthzConfig) (*Schema, error) {
+	schema := &Schema{namespaces: make(map[string]*Namespace, len(cfg.Namespaces))}
+
+	for _, nsCfg := range cfg.Namespaces {
+		if !namePattern.MatchString(nsCfg.Name) {
+			return nil, fmt.Errorf("invalid namespace name %q", nsCfg.Name)
+		}
+		if _, ok := schema.namespaces[nsCfg.Name]; ok {
+			return nil, fmt.Errorf("duplicate namespace %q", nsCfg.Name)
+		}
+
+		ns := &Namespace{Name: nsCfg.Name, Relations: make(map[string]*Relation, len(nsCfg.Relations))}
+		for _, relCfg := range nsCfg.Relations {
+			if !namePattern.MatchString(relCfg.Name) {
+				return nil, fmt.Errorf("%s: invalid relation name %q", ns.Name, relCfg.Name)
+			}
+			if _, ok := ns.Relations[relCfg.Name]; ok {
+				return nil, fmt.Errorf("%s: duplicate relation %q", ns.Name, relCfg.Name)
+			}
+
+			relation := &Relation{Name: relCfg.Name}
+			if len(relCfg.Union) == 0 {
+				relation.Union = []Rewrite{{Kind: RewriteThis}}
+			}
+			for _, rewriteCfg := range relCfg.Union {
+				rewrite, err := newRewrite(rewriteCfg)
+				if err != nil {
+					return nil, fmt.Errorf("%s#%s: %w", ns.Name, relation.Name, err)
+				}
+				relation.Union = append(relation.Union, rewrite)
+			}
+			ns.Relations[relation.Name] = relation
+		}
+
+		schema.namespaces[ns.Name] = ns
+	}
+
+	// Ссылки проверяем после загрузки всех отношений: порядок в
+	// конфигурации произвольный
+	for _, ns := range schema.namespaces {
+		for _, relation := range ns.Relations {
+			for _, rewrite := range relation.Union {
+				switch rewrite.Kind {
+				case RewriteComputed:
+					if _, ok := ns.Relations[rewrite.Relation]; !ok {
+						return nil, fmt.Errorf("%s#%s: unknown relation %q", ns.Name, relation.Name, rewrite.Relation)
+					}
+				case RewriteTupleToUserset:
+					if _, ok := ns.Relations[rewrite.Tupleset]; !ok {
+						return nil, fmt.Errorf("%s#%s: unknown tupleset %q", ns.Name, relation.Name, rewrite.Tupleset)
+					}
+				}
+			}
+		}
+	}
+
+	return schema, nil
+}
+
+func newRewrite(cfg config.RewriteConfig) (Rewrite, error) {
+	set := 0
+	var rewrite Rewrite
+	if cfg.This {
+		set++
+		rewrite = Rewrite{Kind: RewriteThis}
+	}
+	if cfg.ComputedUserset != "" {
+		set++
+		rewrite = Rewrite{Kind: RewriteComputed, Relation: cfg.ComputedUserset}
+	}
+	if cfg.TupleToUserset != nil {
+		set++
+		if cfg.TupleToUserset.Tupleset == "" || cfg.TupleToUserset.ComputedUserset == "" {
+			return Rewrite{}, fmt.Errorf("tuple_to_userset needs tupleset and computed_userset")
+		}
+		rewrite = Rewrite{Kind: RewriteTupleToUserset, Tupleset: cfg.TupleToUserset.Tupleset, Relation: cfg.TupleToUserset.ComputedUserset}
+	}
+	if set != 1 {
+		return Rewrite{}, fmt.Errorf("each union entry must set exactly one of this, computed_userset, tuple_to_userset")
+	}
+
+	return rewrite, nil
+}
+
+// Namespace возвращает пространство имен по имени.
+func (s *Schema) Namespace(name string) (*Namespace, bool) {
+	ns, ok := s.namespaces[name]
+	return ns, ok
+}
+
+// Relation возвращает отношение namespace#relation.
+func (s *Schema) Relation(namespace, relation string) (*Relation, bool) {
+	ns, ok := s.namespaces[namespace]
+	if !ok {
+		return nil, false
+	}
+	rel, ok := ns.Relations[relation]
+	return rel, ok
+}
@@ -0,0 +1,171 @@
+package authz
+
+import (
+	"auth/internal/config"
+	"strings"
+	"testing"
+)
+
+func this() config.RewriteConfig {
+	return config.RewriteConfig{This: true}
+}
+
+func computed(relation string) config.RewriteConfig {
+	return config.RewriteConfig{ComputedUserset: relation}
+}
+
+func tupleToUserset(tupleset, relation string) config.RewriteConfig {
+	return config.RewriteConfig{TupleToUserset: &config.TupleToUsersetConfig{Tupleset: tupleset, ComputedUserset: relation}}
+}
+
+// testSchemaConfig - документы в папках, доступ через команды.
+func testSchemaConfig() config.AuthzConfig {
+	return config.AuthzConfig{Namespaces: []config.NamespaceConfig{
+		{Name: "document", Relations: []config.RelationConfig{
+			{Name: "viewer", Union: []config.RewriteConfig{this(), computed("editor"), tupleToUserset("parent", "viewer")}},
+			{Name: "editor", Union: []config.RewriteConfig{this(), computed("owner")}},
+			{Name: "owner"},
+			{Name: "parent"},
+		}},
+		{Name: "folder", Relations: []config.RelationConfig{
+			{Name: "viewer", Union: []config.RewriteConfig{this(), tupleToUserset("parent", "viewer")}},
+			{Name: "parent"},
+		}},
+		{Name: "team", Relations: []config.RelationConfig{
+			{Name: "member"},
+		}},
+	}}
+}
+
+func TestNewSchema(t *testing.T) {
+	schema, err := NewSchema(testSchemaConfig())
+	if err != nil {
+		t.Fatalf("NewSchema: %v", err)
+	}
+
+	tests := []struct {
+		namespace  string
+		relation   string
+		wantOK     bool
+		wantDirect bool
+	}{
+		{namespace: "document", relation: "viewer", wantOK: true, wantDirect: true},
+		{namespace: "document", relation: "owner", wantOK: true, wantDirect: true},
+		{namespace: "team", relation: "member", wantOK: true, wantDirect: true},
+		{namespace: "document", relation: "member"},
+		{namespace: "project", relation: "viewer"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.namespace+"#"+tt.relation, func(t *testing.T) {
+			relation, ok := schema.Relation(tt.namespace, tt.relation)
+			if ok != tt.wantOK {
+				t.Fatalf("Relation ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && relation.AllowsDirect() != tt.wantDirect {
+				t.Fatalf("AllowsDirect = %v, want %v", relation.AllowsDirect(), tt.wantDirect)
+			}
+		})
+	}
+
+	if _, ok := schema.Namespace("folder"); !ok {
+		t.Fatal("namespace folder not found")
+	}
+}
+
+func TestRelationAllowsDirect(t *testing.T) {
+	cfg := config.AuthzConfig{Namespaces: []config.NamespaceConfig{
+		{Name: "document", Relations: []config.RelationConfig{
+			{Name: "owner"},
+			{Name: "editor", Union: []config.RewriteConfig{computed("owner")}},
+		}},
+	}}
+	schema, err := NewSchema(cfg)
+	if err != nil {
+		t.Fatalf("NewSchema: %v", err)
+	}
+
+	// editor вычисляется из owner, писать его кортежи нельзя
+	editor, _ := schema.Relation("document", "editor")
+	if editor.AllowsDirect() {
+		t.Fatal("computed-only relation allows direct tuples")
+	}
+}
+
+func TestNewSchemaRejects(t *testing.T) {
+	namespace := func(name string, relations ...config.RelationConfig) config.NamespaceConfig {
+		return config.NamespaceConfig{Name: name, Relations: relations}
+	}
+	relation := func(name string, union ...config.RewriteConfig) config.RelationConfig {
+		return config.RelationConfig{Name: name, Union: union}
+	}
+
+	tests := []struct {
+		name       string
+		namespaces []config.NamespaceConfig
+		wantErr    string
+	}{
+		{
+			name:       "invalid namespace name",
+			namespaces: []config.NamespaceConfig{namespace("Document")},
+			wantErr:    "invalid namespace name",
+		},
+		{
+			name:       "namespace name too long",
+			namespaces: []config.NamespaceConfig{namespace(strings.Repeat("n", 65))},
+			wantErr:    "invalid namespace name",
+		},
+		{
+			name:       "duplicate namespace",
+			namespaces: []config.NamespaceConfig{namespace("document"), namespace("document")},
+			wantErr:    "duplicate namespace",
+		},
+		{
+			name:       "invalid relation name",
+			namespaces: []config.NamespaceConfig{namespace("document", relation("can-view"))},
+			wantErr:    "invalid relation name",
+		},
+		{
+			name:       "duplicate relation",
+			namespaces: []config.NamespaceConfig{namespace("document", relation("viewer"), relation("viewer"))},
+			wantErr:    "duplicate relation",
+		},
+		{
+			name:       "empty rewrite",
+			namespaces: []config.NamespaceConfig{namespace("document", relation("viewer", config.RewriteConfig{}))},
+			wantErr:    "exactly one",
+		},
+		{
+			name: "two kinds in one rewrite",
+			namespaces: []config.NamespaceConfig{namespace("document",
+				relation("owner"),
+				relation("viewer", config.RewriteConfig{This: true, ComputedUserset: "owner"}),
+			)},
+			wantErr: "exactly one",
+		},
+		{
+			name:       "tuple to userset without computed userset",
+			namespaces: []config.NamespaceConfig{namespace("document", relation("parent"), relation("viewer", tupleToUserset("parent", "")))},
+			wantErr:    "needs tupleset and computed_userset",
+		},
+		{
+			name:       "unknown computed relation",
+			namespaces: []config.NamespaceConfig{namespace("document", relation("viewer", computed("owner")))},
+			wantErr:    `unknown relation "owner"`,
+		},
+		{
+			name:       "unknown tupleset",
+			namespaces: []config.NamespaceConfig{namespace("document", relation("viewer", tupleToUserset("parent", "viewer")))},
+			wantErr:    `unknown tupleset "parent"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := NewSchema(config.AuthzConfig{Namespaces: tt.namespaces})
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("NewSchema error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,36 @@
+package authz
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+)
+
+const zookieVersion = "v1."
+
+var ErrInvalidZookie = errors.New("invalid zookie")
+
+// EncodeZookie упаковывает ревизию в непрозрачный для клиента токен.
+func EncodeZookie(revision uint64) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(zookieVersion + strconv.FormatUint(revision, 10)))
+}
+
+func DecodeZookie(zookie string) (uint64, error) {
+	data, err := base64.RawURLEncoding.DecodeString(zookie)
+	if err != nil {
+		return 0, ErrInvalidZookie
+	}
+
+	raw, found := strings.CutPrefix(string(data), zookieVersion)
+	if !found {
+		return 0, ErrInvalidZookie
+	}
+
+	revision, err := strconv.ParseUint(raw, 10, 64)
+	if err != nil {
+		return 0, ErrInvalidZookie
+	}
+
+	return revision, nil
+}
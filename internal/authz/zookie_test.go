@@ -0,0 +1,50 @@
+package authz
+
+import (
+	"encoding/base64"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestZookieRoundTrip(t *testing.T) {
+	for _, revision := range []uint64{0, 1, 42, math.MaxUint64} {
+		zookie := EncodeZookie(revision)
+		got, err := DecodeZookie(zookie)
+		if err != nil {
+			t.Fatalf("DecodeZookie(%q): %v", zookie, err)
+		}
+		if got != revision {
+			t.Fatalf("DecodeZookie(EncodeZookie(%d)) = %d", revision, got)
+		}
+	}
+}
+
+func TestDecodeZookieRejects(t *testing.T) {
+	encode := func(raw string) string {
+		return base64.RawURLEncoding.EncodeToString([]byte(raw))
+	}
+
+	tests := []struct {
+		name   string
+		zookie string
+	}{
+		{name: "empty", zookie: ""},
+		{name: "not base64", zookie: "v1.42!"},
+		{name: "padded base64", zookie: base64.URLEncoding.EncodeToString([]byte("v1.4"))},
+		{name: "plain revision", zookie: encode("42")},
+		{name: "unknown version", zookie: encode("v2.42")},
+		{name: "no revision", zookie: encode("v1.")},
+		{name: "negative revision", zookie: encode("v1.-1")},
+		{name: "not a number", zookie: encode("v1.abc")},
+		{name: "overflow", zookie: encode("v1.18446744073709551616")},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := DecodeZookie(tt.zookie); !errors.Is(err, ErrInvalidZookie) {
+				t.Fatalf("DecodeZookie(%q) error = %v, want %v", tt.zookie, err, ErrInvalidZookie)
+			}
+		})
+	}
+}
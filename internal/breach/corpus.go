@@ -0,0 +1,96 @@
+package breach
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"strconv"
+)
+
+// Длина SHA-1 в hex и префикса, по которому HIBP делит базу на диапазоны
+const (
+	HashLength   = 40
+	PrefixLength = 5
+)
+
+// Corpus - отсортированный по хешу файл утекших паролей в формате
+// HIBP Pwned Passwords: строки "SHA1:COUNT" в верхнем регистре. Файл
+// отображается в память, поиск - двоичный по смещениям строк.
+type Corpus struct {
+	data  []byte
+	unmap func() error
+}
+
+func Open(path string) (*Corpus, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open breached passwords file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return nil, fmt.Errorf("failed to stat breached passwords file: %w", err)
+	}
+
+	corpus := &Corpus{unmap: func() error { return nil }}
+	if info.Size() == 0 {
+		return corpus, nil
+	}
+
+	if corpus.data, corpus.unmap, err = mapFile(file, info.Size()); err != nil {
+		return nil, fmt.Errorf("failed to map breached passwords file: %w", err)
+	}
+
+	return corpus, nil
+}
+
+func (c *Corpus) Close() error {
+	c.data = nil
+	return c.unmap()
+}
+
+// Count возвращает, сколько раз пароль встречался в утечках, 0 - ни разу.
+func (c *Corpus) Count(password string) int {
+	sum := sha1.Sum([]byte(password))
+	key := bytes.ToUpper([]byte(hex.EncodeToString(sum[:])))
+
+	return c.lookup(key)
+}
+
+// lookup ищет строку с хешем key. lo и hi всегда указывают на начало строки.
+func (c *Corpus) lookup(key []byte) int {
+	lo, hi := 0, len(c.data)
+	for lo < hi {
+		mid := lo + (hi-lo)/2
+		start := lo + bytes.LastIndexByte(c.data[lo:mid], '\n') + 1
+		end := len(c.data)
+		if i := bytes.IndexByte(c.data[start:], '\n'); i >= 0 {
+			end = start + i + 1
+		}
+
+		line := c.data[start:end]
+		switch bytes.Compare(key, line[:min(len(line), HashLength)]) {
+		case 0:
+			return parseCount(line[HashLength:])
+		case -1:
+			hi = start
+		default:
+			lo = end
+		}
+	}
+
+	return 0
+}
+
+// parseCount разбирает ":COUNT\r\n"; строка без счетчика считается одной утечкой.
+func parseCount(rest []byte) int {
+	rest = bytes.TrimRight(rest, "\r\n")
+	count, err := strconv.Atoi(string(bytes.TrimPrefix(rest, []byte(":"))))
+	if err != nil || count < 1 {
+		return 1
+	}
+	return count
+}
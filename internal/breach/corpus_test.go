@@ -0,0 +1,117 @@
+package breach
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+)
+
+// hashOf возвращает SHA-1 пароля в верхнем регистре, как в выгрузке HIBP.
+func hashOf(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+// writeCorpus сохраняет строки в файл и открывает его как Corpus.
+func writeCorpus(t *testing.T, content string) *Corpus {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, []byte(content), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	corpus, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { corpus.Close() })
+	return corpus
+}
+
+func TestCount(t *testing.T) {
+	counts := map[string]int{"password": 9545824, "qwerty": 3912816, "letmein": 1}
+	hashes := make(map[string]int)
+	for password, count := range counts {
+		hashes[hashOf(password)] = count
+	}
+	// Соседние строки, чтобы двоичный поиск прошел несколько шагов
+	for i := range 1000 {
+		hashes[hashOf(fmt.Sprintf("filler-%d", i))] = 2
+	}
+
+	keys := make([]string, 0, len(hashes))
+	for hash := range hashes {
+		keys = append(keys, hash)
+	}
+	slices.Sort(keys)
+
+	var buf bytes.Buffer
+	writer := NewWriter(&buf)
+	for _, hash := range keys {
+		if err := writer.Add(hash, hashes[hash]); err != nil {
+			t.Fatalf("Add: %v", err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+	corpus := writeCorpus(t, buf.String())
+
+	for password, want := range counts {
+		if got := corpus.Count(password); got != want {
+			t.Errorf("Count(%q) = %d, want %d", password, got, want)
+		}
+	}
+	for _, password := range []string{"violet-harbor-lantern-58", ""} {
+		if got := corpus.Count(password); got != 0 {
+			t.Errorf("Count(%q) = %d, want 0", password, got)
+		}
+	}
+}
+
+func TestCountLineFormats(t *testing.T) {
+	hashes := []string{hashOf("123456"), hashOf("password"), hashOf("qwerty")}
+	slices.Sort(hashes)
+
+	tests := []struct {
+		name    string
+		content string
+		want    []int
+	}{
+		{name: "lf", content: hashes[0] + ":3\n" + hashes[1] + ":5\n" + hashes[2] + ":7\n", want: []int{3, 5, 7}},
+		{name: "crlf", content: hashes[0] + ":3\r\n" + hashes[1] + ":5\r\n" + hashes[2] + ":7\r\n", want: []int{3, 5, 7}},
+		{name: "no trailing newline", content: hashes[0] + ":3\n" + hashes[1] + ":5\n" + hashes[2] + ":7", want: []int{3, 5, 7}},
+		// Строка без счетчика или с мусором вместо него - одна утечка
+		{name: "missing counts", content: hashes[0] + "\n" + hashes[1] + ":x\n" + hashes[2] + ":0\n", want: []int{1, 1, 1}},
+		{name: "single line", content: hashes[1] + ":5\n", want: []int{0, 5, 0}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			corpus := writeCorpus(t, tt.content)
+			for i, hash := range hashes {
+				if got := corpus.lookup([]byte(hash)); got != tt.want[i] {
+					t.Errorf("lookup(%s) = %d, want %d", hash, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestOpenEmpty(t *testing.T) {
+	corpus := writeCorpus(t, "")
+	if got := corpus.Count("password"); got != 0 {
+		t.Fatalf("Count = %d, want 0", got)
+	}
+}
+
+func TestOpenMissing(t *testing.T) {
+	if _, err := Open(filepath.Join(t.TempDir(), "missing.txt")); err == nil {
+		t.Fatal("Open accepted a missing file")
+	}
+}
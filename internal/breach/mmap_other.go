@@ -0,0 +1,18 @@
+//go:build !unix
+
+package breach
+
+import (
+	"io"
+	"os"
+)
+
+// Без mmap файл читается в память целиком
+func mapFile(file *os.File, size int64) ([]byte, func() error, error) {
+	data := make([]byte, size)
+	if _, err := io.ReadFull(file, data); err != nil {
+		return nil, nil, err
+	}
+
+	return data, func() error { return nil }, nil
+}
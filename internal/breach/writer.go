@@ -0,0 +1,66 @@
+package breach
+
+import (
+	"bufio"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// Writer пишет файл для Corpus и следит, чтобы хеши шли строго по
+// возрастанию: иначе двоичный поиск будет молча пропускать пароли.
+type Writer struct {
+	w       *bufio.Writer
+	last    string
+	written int
+}
+
+func NewWriter(w io.Writer) *Writer {
+	return &Writer{w: bufio.NewWriter(w)}
+}
+
+func (w *Writer) Add(hash string, count int) error {
+	hash = strings.ToUpper(hash)
+	if len(hash) != HashLength {
+		return fmt.Errorf("invalid hash %q: expected %d hex characters", hash, HashLength)
+	}
+	if _, err := hex.DecodeString(hash); err != nil {
+		return fmt.Errorf("invalid hash %q: %w", hash, err)
+	}
+	if hash <= w.last {
+		return fmt.Errorf("hash %s is out of order after %s", hash, w.last)
+	}
+
+	if _, err := fmt.Fprintf(w.w, "%s:%d\n", hash, count); err != nil {
+		return err
+	}
+	w.last = hash
+	w.written++
+	return nil
+}
+
+func (w *Writer) Flush() error {
+	return w.w.Flush()
+}
+
+func (w *Writer) Written() int {
+	return w.written
+}
+
+// ParseLine разбирает строку вида "HASH:COUNT" из выгрузки HIBP. В файлах
+// диапазонов вместо полного хеша стоит суффикс без 5 символов префикса.
+func ParseLine(line string) (string, int, error) {
+	hash, rawCount, found := strings.Cut(strings.TrimSpace(line), ":")
+	if !found {
+		return "", 0, fmt.Errorf("invalid line %q: expected HASH:COUNT", line)
+	}
+
+	count, err := strconv.Atoi(rawCount)
+	if err != nil || count < 1 {
+		return "", 0, fmt.Errorf("invalid count in line %q", line)
+	}
+
+	return hash, count, nil
+}
@@ -0,0 +1,87 @@
+package breach
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+)
+
+func TestWriter(t *testing.T) {
+	var buf bytes.Buffer
+	writer := NewWriter(&buf)
+
+	// Регистр хеша приводится к верхнему
+	if err := writer.Add(strings.Repeat("0", 39)+"a", 3); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := writer.Add(strings.Repeat("F", HashLength), 1); err != nil {
+		t.Fatalf("Add: %v", err)
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatalf("Flush: %v", err)
+	}
+
+	want := strings.Repeat("0", 39) + "A:3\n" + strings.Repeat("F", HashLength) + ":1\n"
+	if buf.String() != want {
+		t.Fatalf("output = %q, want %q", buf.String(), want)
+	}
+	if writer.Written() != 2 {
+		t.Fatalf("Written = %d, want 2", writer.Written())
+	}
+}
+
+func TestWriterRejects(t *testing.T) {
+	first := strings.Repeat("5", HashLength)
+
+	tests := []struct {
+		name string
+		hash string
+	}{
+		{name: "short", hash: "5BAA6"},
+		{name: "not hex", hash: strings.Repeat("Z", HashLength)},
+		{name: "duplicate", hash: first},
+		{name: "out of order", hash: strings.Repeat("4", HashLength)},
+		{name: "out of order in lower case", hash: strings.Repeat("4", 39) + "f"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			writer := NewWriter(&buf)
+			if err := writer.Add(first, 1); err != nil {
+				t.Fatalf("Add: %v", err)
+			}
+			if err := writer.Add(tt.hash, 1); err == nil {
+				t.Fatalf("Add(%q) succeeded", tt.hash)
+			}
+			if writer.Written() != 1 {
+				t.Fatalf("Written = %d, want 1", writer.Written())
+			}
+		})
+	}
+}
+
+func TestParseLine(t *testing.T) {
+	tests := []struct {
+		line      string
+		wantHash  string
+		wantCount int
+		wantErr   bool
+	}{
+		{line: "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:9545824", wantHash: "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", wantCount: 9545824},
+		{line: "1E4C9B93F3F0682250B6CF8331B7EE68FD8:3\r\n", wantHash: "1E4C9B93F3F0682250B6CF8331B7EE68FD8", wantCount: 3},
+		{line: "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8", wantErr: true},
+		{line: "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:many", wantErr: true},
+		{line: "5BAA61E4C9B93F3F0682250B6CF8331B7EE68FD8:0", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		hash, count, err := ParseLine(tt.line)
+		if (err != nil) != tt.wantErr {
+			t.Fatalf("ParseLine(%q) error = %v, wantErr %v", tt.line, err, tt.wantErr)
+		}
+		if hash != tt.wantHash || count != tt.wantCount {
+			t.Fatalf("ParseLine(%q) = %q, %d, want %q, %d", tt.line, hash, count, tt.wantHash, tt.wantCount)
+		}
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"io/ioutil"
 	"os"
+	"time"
 
 	"gopkg.in/yaml.v2"
 )
@@ -22,6 +23,157 @@ type DataBaseConfig struct {
 	DatabaseName     string `json:"database_name" yaml:"database_name" validate:"required"`
 }
 
+type HTTPServerConfig struct {
+	HTTPServerAddress string `json:"http_server_address" yaml:"http_server_address"`
+	HTTPServerPort    int    `json:"http_server_port" yaml:"http_server_port" validate:"required,min=1,max=65535"`
+}
+
+// JWTConfig - private_key_path обязателен: ключ из файла общий для всех
+// экземпляров сервиса. ephemeral_keys разрешает без него генерировать ключ
+// в памяти процесса, только для разработки с одним экземпляром. Ротация
+// по rotation_interval тоже происходит в каждом процессе отдельно, новые
+// ключи не попадают к другим экземплярам, поэтому она разрешена только
+// вместе с ephemeral_keys. В остальных случаях rotation_interval равен 0,
+// а ключ меняется через файл.
+type JWTConfig struct {
+	Algorithm        string        `json:"algorithm" yaml:"algorithm" validate:"required,oneof=RS256 ES256 EdDSA"`
+	PrivateKeyPath   string        `json:"private_key_path" yaml:"private_key_path"`
+	EphemeralKeys    bool          `json:"ephemeral_keys" yaml:"ephemeral_keys"`
+	RotationInterval time.Duration `json:"rotation_interval" yaml:"rotation_interval"`
+	KeyRetention     time.Duration `json:"key_retention" yaml:"key_retention"`
+	Issuer           string        `json:"issuer" yaml:"issuer"`
+	Audience         string        `json:"audience" yaml:"audience"`
+	Leeway           time.Duration `json:"leeway" yaml:"leeway"`
+}
+
+// MFAConfig - encryption_key: 32 байта в base64, которыми шифруются
+// секреты TOTP в базе. В файле конфигурации не хранится, задается
+// переменной окружения MFA_ENCRYPTION_KEY.
+type MFAConfig struct {
+	TOTPIssuer    string `json:"totp_issuer" yaml:"totp_issuer"`
+	EncryptionKey string `json:"encryption_key" yaml:"encryption_key"`
+}
+
+// WebAuthnConfig - rp_id должен совпадать с доменом origins.
+type WebAuthnConfig struct {
+	RPID             string   `json:"rp_id" yaml:"rp_id"`
+	RPName           string   `json:"rp_name" yaml:"rp_name"`
+	Origins          []string `json:"origins" yaml:"origins"`
+	UserVerification string   `json:"user_verification" yaml:"user_verification" validate:"oneof=required preferred discouraged"`
+}
+
+// OAuthConfig - login_url: страница входа, куда /authorize отправляет
+// неаутентифицированного пользователя с параметром return_to. Сессией
+// считается access-токен в cookie session_cookie.
+type OAuthConfig struct {
+	LoginURL      string `json:"login_url" yaml:"login_url"`
+	SessionCookie string `json:"session_cookie" yaml:"session_cookie"`
+}
+
+// ProviderConfig - внешний OIDC провайдер для входа. redirect_url должен
+// указывать на /federation/<name>/callback этого сервиса.
+type ProviderConfig struct {
+	Name         string   `json:"name" yaml:"name" validate:"required"`
+	Issuer       string   `json:"issuer" yaml:"issuer" validate:"required"`
+	ClientID     string   `json:"client_id" yaml:"client_id" validate:"required"`
+	ClientSecret string   `json:"client_secret" yaml:"client_secret"`
+	RedirectURL  string   `json:"redirect_url" yaml:"redirect_url" validate:"required"`
+	Scopes       []string `json:"scopes" yaml:"scopes"`
+}
+
+type FederationConfig struct {
+	Providers []ProviderConfig `json:"providers" yaml:"providers"`
+}
+
+// AuthzConfig - схема отношений для AuthzService. Отношение без union
+// состоит только из явно записанных кортежей (this).
+type AuthzConfig struct {
+	Namespaces []NamespaceConfig `json:"namespaces" yaml:"namespaces"`
+}
+
+type NamespaceConfig struct {
+	Name      string           `json:"name" yaml:"name" validate:"required"`
+	Relations []RelationConfig `json:"relations" yaml:"relations"`
+}
+
+type RelationConfig struct {
+	Name  string          `json:"name" yaml:"name" validate:"required"`
+	Union []RewriteConfig `json:"union" yaml:"union"`
+}
+
+// RewriteConfig - одно из слагаемых union: this (кортежи самого
+// отношения), computed_userset (другое отношение того же объекта) или
+// tuple_to_userset (отношение объектов, на которые указывает tupleset).
+type RewriteConfig struct {
+	This            bool                  `json:"this" yaml:"this"`
+	ComputedUserset string                `json:"computed_userset" yaml:"computed_userset"`
+	TupleToUserset  *TupleToUsersetConfig `json:"tuple_to_userset" yaml:"tuple_to_userset"`
+}
+
+type TupleToUsersetConfig struct {
+	Tupleset        string `json:"tupleset" yaml:"tupleset"`
+	ComputedUserset string `json:"computed_userset" yaml:"computed_userset"`
+}
+
+// LockoutConfig - после threshold неудачных попыток входа подряд учетная
+// запись блокируется на base_duration, каждая следующая неудача удваивает
+// блокировку до max_duration. Счетчик сбрасывается через window после
+// последней неудачи. Нулевой threshold отключает блокировку.
+type LockoutConfig struct {
+	Threshold    int           `json:"threshold" yaml:"threshold" validate:"min=0"`
+	BaseDuration time.Duration `json:"base_duration" yaml:"base_duration"`
+	MaxDuration  time.Duration `json:"max_duration" yaml:"max_duration"`
+	Window       time.Duration `json:"window" yaml:"window"`
+}
+
+// RateLimitRule ограничивает method (полное имя, например
+// /auth.AuthService/Login) до limit вызовов за скользящее окно window.
+// key - чем различаются клиенты: ip, username (login, username или email
+// из запроса) или api_key; без имени или ключа в запросе считается по ip.
+type RateLimitRule struct {
+	Method string        `json:"method" yaml:"method" validate:"required"`
+	Key    string        `json:"key" yaml:"key" validate:"oneof=ip username api_key"`
+	Limit  int           `json:"limit" yaml:"limit" validate:"min=1"`
+	Window time.Duration `json:"window" yaml:"window" validate:"required"`
+}
+
+// RateLimitConfig - на один метод можно задать несколько правил, вызов
+// проходит, только если его пропускают все.
+type RateLimitConfig struct {
+	Enabled bool            `json:"enabled" yaml:"enabled"`
+	Rules   []RateLimitRule `json:"rules" yaml:"rules"`
+}
+
+// PasswordPolicyConfig - правила для новых паролей. max_length считается в
+// байтах и не может превышать 72: дальше bcrypt пароль не различает.
+// min_score - минимальная оценка стойкости от 0 до 4. blocklist_path -
+// файл с дополнительными запрещенными паролями, по одному на строку.
+type PasswordPolicyConfig struct {
+	MinLength      int    `json:"min_length" yaml:"min_length" validate:"min=0"`
+	MaxLength      int    `json:"max_length" yaml:"max_length" validate:"min=0,max=72"`
+	RequireLower   bool   `json:"require_lower" yaml:"require_lower"`
+	RequireUpper   bool   `json:"require_upper" yaml:"require_upper"`
+	RequireDigit   bool   `json:"require_digit" yaml:"require_digit"`
+	RequireSymbol  bool   `json:"require_symbol" yaml:"require_symbol"`
+	MinScore       int    `json:"min_score" yaml:"min_score" validate:"min=0,max=4"`
+	BlocklistPath  string `json:"blocklist_path" yaml:"blocklist_path"`
+	ForbidUserInfo bool   `json:"forbid_user_info" yaml:"forbid_user_info"`
+	// Файл утекших паролей, собирается cmd/load-breached-passwords.
+	// Пустой путь отключает проверку
+	BreachedPasswordsPath string `json:"breached_passwords_path" yaml:"breached_passwords_path"`
+	BreachedMinCount      int    `json:"breached_min_count" yaml:"breached_min_count" validate:"min=0"`
+	// Сколько последних паролей, включая текущий, нельзя использовать снова.
+	// 0 отключает проверку
+	HistorySize int `json:"history_size" yaml:"history_size" validate:"min=0"`
+}
+
+// RedisConfig - если адрес пустой, используется хранилище в памяти.
+type RedisConfig struct {
+	RedisAddress  string `json:"redis_address" yaml:"redis_address"`
+	RedisPassword string `json:"redis_password" yaml:"redis_password"`
+	RedisDB       int    `json:"redis_db" yaml:"redis_db"`
+}
+
 type SMTPConfig struct {
 	Email string 		`yaml:"email"`
 	Password string 	`yaml:"password"`
@@ -34,10 +186,23 @@ type KafkaConfig struct {
 type Config struct {
 	GRPCServerConfig `json:"grpc_server_config" yaml:"grpc_server_config"`
 	DataBaseConfig	 `json:"database_config" yaml:"database_config"`
+	HTTPServerConfig `json:"http_server_config" yaml:"http_server_config"`
+	JWTConfig        `json:"jwt" yaml:"jwt"`
+	RedisConfig      `json:"redis" yaml:"redis"`
+	MFAConfig        `json:"mfa" yaml:"mfa"`
+	WebAuthnConfig   `json:"webauthn" yaml:"webauthn"`
+	OAuthConfig      `json:"oauth" yaml:"oauth"`
+	FederationConfig `json:"federation" yaml:"federation"`
+	AuthzConfig      `json:"authz" yaml:"authz"`
+	LockoutConfig    `json:"lockout" yaml:"lockout"`
+	RateLimitConfig  `json:"rate_limit" yaml:"rate_limit"`
+	PasswordPolicyConfig `json:"password_policy" yaml:"password_policy"`
 	SMTPConfig		 `yaml:"smtp"`
 }
 
 
+const mfaEncryptionKeyEnv = "MFA_ENCRYPTION_KEY"
+
 func LoadConfig(path string) (*Config, error) {
 	file, err := os.Open(path)
 	if err != nil {
@@ -56,5 +221,10 @@ func LoadConfig(path string) (*Config, error) {
 		return nil, fmt.Errorf("failed to unmarshal YAML: %w", err)
 	}
 
+	// Секреты из окружения имеют приоритет над файлом
+	if key := os.Getenv(mfaEncryptionKeyEnv); key != "" {
+		config.MFAConfig.EncryptionKey = key
+	}
+
 	return &config, nil
 }
\ No newline at end of file
@@ -0,0 +1,120 @@
+package encryption
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"testing"
+)
+
+func newKey(t *testing.T) string {
+	t.Helper()
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		t.Fatalf("rand.Read: %v", err)
+	}
+	return base64.StdEncoding.EncodeToString(key)
+}
+
+func newTestCipher(t *testing.T) *Cipher {
+	t.Helper()
+	c, err := NewCipher(newKey(t))
+	if err != nil {
+		t.Fatalf("NewCipher: %v", err)
+	}
+	return c
+}
+
+func TestNewCipherRejectsKeys(t *testing.T) {
+	tests := []struct {
+		name string
+		key  string
+	}{
+		{name: "not base64", key: "not base64!"},
+		{name: "empty", key: ""},
+		{name: "aes-128 key", key: base64.StdEncoding.EncodeToString(make([]byte, 16))},
+		{name: "too long", key: base64.StdEncoding.EncodeToString(make([]byte, 33))},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := NewCipher(tt.key); err == nil {
+				t.Fatal("NewCipher accepted the key")
+			}
+		})
+	}
+}
+
+func TestEncryptRoundTrip(t *testing.T) {
+	c := newTestCipher(t)
+	plaintext := []byte("JBSWY3DPEHPK3PXP")
+	aad := []byte("totp:1")
+
+	first, err := c.Encrypt(plaintext, aad)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	second, err := c.Encrypt(plaintext, aad)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+	// Каждый вызов берет новый nonce
+	if bytes.Equal(first, second) {
+		t.Fatal("two encryptions produced the same ciphertext")
+	}
+	if bytes.Contains(first, plaintext) {
+		t.Fatal("ciphertext contains the plaintext")
+	}
+
+	for _, ciphertext := range [][]byte{first, second} {
+		got, err := c.Decrypt(ciphertext, aad)
+		if err != nil {
+			t.Fatalf("Decrypt: %v", err)
+		}
+		if !bytes.Equal(got, plaintext) {
+			t.Fatalf("Decrypt = %q, want %q", got, plaintext)
+		}
+	}
+}
+
+func TestDecryptRejects(t *testing.T) {
+	c := newTestCipher(t)
+	aad := []byte("totp:1")
+	ciphertext, err := c.Encrypt([]byte("secret"), aad)
+	if err != nil {
+		t.Fatalf("Encrypt: %v", err)
+	}
+
+	flipped := func(i int) []byte {
+		modified := bytes.Clone(ciphertext)
+		modified[i] ^= 0x01
+		return modified
+	}
+
+	tests := []struct {
+		name       string
+		cipher     *Cipher
+		ciphertext []byte
+		aad        []byte
+	}{
+		{name: "another owner", cipher: c, ciphertext: ciphertext, aad: []byte("totp:2")},
+		{name: "no associated data", cipher: c, ciphertext: ciphertext},
+		{name: "modified nonce", cipher: c, ciphertext: flipped(0), aad: aad},
+		{name: "modified body", cipher: c, ciphertext: flipped(len(ciphertext) / 2), aad: aad},
+		{name: "modified tag", cipher: c, ciphertext: flipped(len(ciphertext) - 1), aad: aad},
+		{name: "truncated", cipher: c, ciphertext: ciphertext[:len(ciphertext)-1], aad: aad},
+		{name: "shorter than nonce", cipher: c, ciphertext: ciphertext[:4], aad: aad},
+		{name: "empty", cipher: c, ciphertext: nil, aad: aad},
+		{name: "another key", cipher: newTestCipher(t), ciphertext: ciphertext, aad: aad},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := tt.cipher.Decrypt(tt.ciphertext, tt.aad)
+			if !errors.Is(err, ErrInvalidCiphertext) {
+				t.Fatalf("Decrypt error = %v, want %v", err, ErrInvalidCiphertext)
+			}
+		})
+	}
+}
@@ -1,13 +1,293 @@
 package entity
 
 import (
+	"time"
+
 	"gorm.io/gorm"
 )
 
 type User struct {
 	gorm.Model
-	UserName 		string  `gorm:"name"`
+	// UserName и Email хранятся в каноническом виде, см. internal/identity
+	UserName 		string  `gorm:"uniqueIndex"`
 	Age  			int32   `gorm:"age"`
 	HashedPassword 	[]byte	`gorm:"hashed_password"`
-	Email 			string	`gorm:"email"`
+	Email 			string	`gorm:"uniqueIndex"`
+	EmailVerified   bool    `gorm:"default:false"`
+	// Секрет TOTP хранится зашифрованным, см. internal/encryption
+	TOTPSecret      []byte
+	TOTPEnabled     bool    `gorm:"default:false"`
+	TOTPLastCounter int64   `gorm:"default:0"`
+}
+
+// RefreshToken хранит хеш refresh-токена. Все токены, полученные
+// ротацией из одного логина, объединены общим FamilyID.
+// ClientID пустой для собственного входа и заполнен для токенов,
+// выданных OAuth-клиенту. OrganizationID - активная организация, она
+// сохраняется при ротации.
+type RefreshToken struct {
+	gorm.Model
+	UserID         uint   `gorm:"index"`
+	FamilyID       string `gorm:"index"`
+	ClientID       string `gorm:"index"`
+	OrganizationID uint
+	Scope          string
+	TokenHash      string `gorm:"uniqueIndex"`
+	ExpiresAt      time.Time
+	UsedAt         *time.Time
+	RevokedAt      *time.Time
+}
+
+const (
+	PurposeEmailVerification = "email_verification"
+	PurposePasswordReset     = "password_reset"
+)
+
+// OneTimeToken - одноразовый секрет, выданный пользователю для
+// конкретной цели (подтверждение почты, сброс пароля). Хранится хеш.
+type OneTimeToken struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	Purpose   string `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// RecoveryCode - одноразовый резервный код входа при потере устройства
+// второго фактора. Хранится только хеш.
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"uniqueIndex"`
+	UsedAt   *time.Time
+}
+
+// WebAuthnCredential - passkey пользователя. PublicKey хранится в
+// формате COSE_Key, как его вернул аутентификатор.
+type WebAuthnCredential struct {
+	gorm.Model
+	UserID       uint   `gorm:"index"`
+	CredentialID []byte `gorm:"uniqueIndex"`
+	PublicKey    []byte
+	SignCount    uint32
+	Transports   string
+	LastUsedAt   *time.Time
+}
+
+// OAuthClient - зарегистрированный OAuth-клиент. Списки хранятся через
+// пробел, как scope в протоколе. У публичного клиента нет секрета.
+type OAuthClient struct {
+	gorm.Model
+	ClientID     string `gorm:"uniqueIndex"`
+	SecretHash   string
+	Name         string
+	RedirectURIs string
+	GrantTypes   string
+	Scopes       string
+	Public       bool `gorm:"default:false"`
+}
+
+// AuthorizationCode - код авторизации OAuth. Хранится хеш. FamilyID
+// заранее задает семью refresh-токенов, чтобы при повторном предъявлении
+// кода отозвать выданные по нему токены. RedirectURIProvided - был ли
+// redirect_uri явно указан в запросе авторизации.
+type AuthorizationCode struct {
+	gorm.Model
+	CodeHash            string `gorm:"uniqueIndex"`
+	ClientID            string `gorm:"index"`
+	UserID              uint   `gorm:"index"`
+	RedirectURI         string
+	RedirectURIProvided bool
+	Scope               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+	Nonce               string
+	FamilyID            string
+	ExpiresAt           time.Time
+	UsedAt              *time.Time
+}
+
+// OAuthConsent - scope, на которые пользователь уже дал согласие клиенту.
+type OAuthConsent struct {
+	gorm.Model
+	UserID   uint   `gorm:"uniqueIndex:idx_oauth_consent_user_client"`
+	ClientID string `gorm:"uniqueIndex:idx_oauth_consent_user_client"`
+	Scope    string
+}
+
+// FederatedIdentity связывает пользователя с учетной записью у внешнего
+// OIDC провайдера. Пара (Issuer, Subject) однозначно задает эту запись.
+type FederatedIdentity struct {
+	gorm.Model
+	UserID  uint   `gorm:"index"`
+	Issuer  string `gorm:"uniqueIndex:idx_federated_issuer_subject"`
+	Subject string `gorm:"uniqueIndex:idx_federated_issuer_subject"`
+	Email   string
+}
+
+// APIKey - ключ для программного доступа от имени пользователя. Prefix
+// показывается пользователю, сам ключ хранится только в виде хеша.
+type APIKey struct {
+	gorm.Model
+	UserID uint `gorm:"index"`
+	// OrganizationID - организация, в которой ключ создан; 0 - без организации
+	OrganizationID uint
+	Name           string
+	Prefix         string `gorm:"uniqueIndex"`
+	KeyHash        string `gorm:"uniqueIndex"`
+	Scopes         string
+	ExpiresAt      *time.Time
+	LastUsedAt     *time.Time
+	RevokedAt      *time.Time
+}
+
+// Permission - право вида resource:action, например users:read.
+type Permission struct {
+	gorm.Model
+	Name        string `gorm:"uniqueIndex"`
+	Description string
+}
+
+// Role - именованный набор прав. Роли пользователя попадают в claim roles
+// access-токена.
+type Role struct {
+	gorm.Model
+	Name        string `gorm:"uniqueIndex"`
+	Description string
+	Permissions []Permission `gorm:"many2many:role_permissions"`
+}
+
+// UserRole назначает роль пользователю.
+type UserRole struct {
+	gorm.Model
+	UserID uint `gorm:"uniqueIndex:idx_user_role"`
+	RoleID uint `gorm:"uniqueIndex:idx_user_role"`
+}
+
+// RelationTuple - кортеж отношения object#relation@subject. Кортежи не
+// удаляются: DeletedRevision отмечает ревизию удаления, чтобы проверки
+// можно было выполнять на снимке по zookie.
+type RelationTuple struct {
+	ID               uint   `gorm:"primaryKey"`
+	Namespace        string `gorm:"uniqueIndex:idx_relation_tuple_live,where:deleted_revision IS NULL;index:idx_relation_tuple_object"`
+	ObjectID         string `gorm:"uniqueIndex:idx_relation_tuple_live;index:idx_relation_tuple_object"`
+	Relation         string `gorm:"uniqueIndex:idx_relation_tuple_live;index:idx_relation_tuple_object"`
+	SubjectNamespace string `gorm:"uniqueIndex:idx_relation_tuple_live;index:idx_relation_tuple_subject"`
+	SubjectID        string `gorm:"uniqueIndex:idx_relation_tuple_live;index:idx_relation_tuple_subject"`
+	// SubjectRelation пустой для конкретного субъекта и задан для
+	// множества субъектов вида team:core#member
+	SubjectRelation string `gorm:"uniqueIndex:idx_relation_tuple_live;index:idx_relation_tuple_subject"`
+	CreatedRevision uint64 `gorm:"index"`
+	DeletedRevision *uint64
+	CreatedAt       time.Time
+}
+
+// RelationRevision - ревизия хранилища кортежей. Каждая запись создает
+// новую ревизию, ее номер кодируется в zookie.
+type RelationRevision struct {
+	ID        uint64 `gorm:"primaryKey"`
+	CreatedAt time.Time
+}
+
+// RelationTupleFilter - условия выборки кортежей; пустые поля не
+// учитываются.
+type RelationTupleFilter struct {
+	Namespace string
+	ObjectID  string
+	Relation  string
+}
+
+// Organization - организация-арендатор. Пользователи глобальны и состоят
+// в организациях через Membership.
+type Organization struct {
+	gorm.Model
+	Name string
+	Slug string `gorm:"uniqueIndex"`
+}
+
+// Membership - членство пользователя в организации с ролью внутри нее.
+type Membership struct {
+	gorm.Model
+	OrganizationID uint `gorm:"uniqueIndex:idx_membership_org_user"`
+	UserID         uint `gorm:"uniqueIndex:idx_membership_org_user;index"`
+	Role           string
+	Organization   Organization
+	User           User
+}
+
+// Invitation - приглашение в организацию. Токен из письма непрозрачный,
+// в базе лежит только его хеш: приглашение принимается один раз, истекает
+// по ExpiresAt и отзывается через RevokedAt.
+type Invitation struct {
+	gorm.Model
+	OrganizationID uint   `gorm:"index"`
+	Email          string `gorm:"index"`
+	Role           string
+	InvitedBy      uint
+	// TokenHash - sha256 непрозрачного токена из письма, см. token.Hash
+	TokenHash      string `gorm:"uniqueIndex"`
+	ExpiresAt      time.Time
+	AcceptedAt     *time.Time
+	AcceptedBy     *uint
+	RevokedAt      *time.Time
+}
+
+// Результаты попытки входа.
+const (
+	LoginResultSuccess     = "success"
+	LoginResultMFARequired = "mfa_required"
+	LoginResultFailure     = "failure"
+)
+
+// LoginEvent - попытка входа. UserID пуст, если пользователь не найден.
+// Fingerprint - хеш адреса и user agent, по нему определяется вход с
+// нового устройства.
+type LoginEvent struct {
+	ID          uint `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UserID      *uint `gorm:"index:idx_login_event_user_fingerprint"`
+	Login       string
+	Method      string
+	Result      string
+	Reason      string
+	IP          string
+	UserAgent   string
+	Fingerprint string `gorm:"index:idx_login_event_user_fingerprint"`
+	NewDevice   bool
+}
+
+// PasswordHistory - прежний хеш пароля пользователя. Хранится несколько
+// последних, чтобы не давать вернуться к недавно использованному паролю.
+type PasswordHistory struct {
+	ID             uint `gorm:"primaryKey"`
+	CreatedAt      time.Time
+	UserID         uint `gorm:"index"`
+	HashedPassword []byte
+}
+
+// AuditEntry - запись журнала аудита. Hash покрывает поля записи и
+// PrevHash, так что изменение или удаление любой записи разрывает цепочку.
+// Details - JSON, хранится текстом, чтобы хеш считался по тем же байтам.
+// Записи только добавляются, поэтому без gorm.Model и мягкого удаления.
+type AuditEntry struct {
+	ID        uint64    `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	Action    string    `gorm:"index"`
+	ActorID   *uint     `gorm:"index"`
+	SubjectID *uint     `gorm:"index"`
+	Result    string
+	IP        string
+	Details   string `gorm:"type:text"`
+	PrevHash  string
+	Hash      string `gorm:"uniqueIndex"`
+}
+
+// AuditFilter - условия выборки журнала; пустые поля не ограничивают.
+type AuditFilter struct {
+	Action    string
+	ActorID   uint
+	SubjectID uint
+	Since     time.Time
+	Until     time.Time
 }
@@ -0,0 +1,388 @@
+package federation
+
+import (
+	"auth/internal/config"
+	"auth/internal/entity"
+	"auth/internal/identity"
+	"auth/internal/redis"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	pb "auth/proto/auth"
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+	"unicode"
+
+	"google.golang.org/grpc/codes"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/encoding/protojson"
+	"gorm.io/gorm"
+)
+
+const (
+	stateExpiration = 10 * time.Minute
+	statePrefix     = "federation:state:"
+
+	usernameAttempts = 5
+)
+
+var (
+	errEmailRequired = errors.New("provider did not return an email address")
+	errAccountExists = errors.New("an account with this email already exists, sign in and link the provider")
+)
+
+// LoginCompleter завершает вход так же, как AuthService.Login: проверяет
+// почту, блокировку, второй фактор и выдает токены. Успешные и неудачные
+// входы попадают в историю входов и журнал аудита.
+type LoginCompleter interface {
+	CompleteFederatedLogin(ctx context.Context, user *entity.User, login string) (*pb.LoginResponse, error)
+	RecordFederatedFailure(ctx context.Context, user *entity.User, login, reason string)
+}
+
+// Handler обслуживает вход через внешних OIDC провайдеров:
+// /federation/<provider>/login и /federation/<provider>/callback.
+type Handler struct {
+	cfg       *config.Config
+	providers map[string]*Provider
+	storage   postgres.Storage
+	cache     redis.Redis
+	logins    LoginCompleter
+	logger    *slog.Logger
+	mux       *http.ServeMux
+}
+
+// loginState хранится между редиректом к провайдеру и callback.
+type loginState struct {
+	Provider     string `json:"provider"`
+	Nonce        string `json:"nonce"`
+	CodeVerifier string `json:"code_verifier"`
+	ReturnTo     string `json:"return_to,omitempty"`
+}
+
+// NewHandler создает обработчик для провайдеров из конфигурации. client
+// используется для запросов к провайдерам.
+func NewHandler(cfg *config.Config, client *http.Client, storage postgres.Storage, cache redis.Redis, logins LoginCompleter, logger *slog.Logger) *Handler {
+	h := &Handler{
+		cfg:       cfg,
+		providers: make(map[string]*Provider),
+		storage:   storage,
+		cache:     cache,
+		logins:    logins,
+		logger:    logger,
+		mux:       http.NewServeMux(),
+	}
+
+	for _, providerCfg := range cfg.FederationConfig.Providers {
+		h.providers[providerCfg.Name] = NewProvider(providerCfg, client)
+	}
+
+	h.mux.HandleFunc("GET /federation/{provider}/login", h.handleLogin)
+	h.mux.HandleFunc("GET /federation/{provider}/callback", h.handleCallback)
+
+	return h
+}
+
+func (h *Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	h.mux.ServeHTTP(w, r)
+}
+
+// RegisterRoutes регистрирует эндпоинты на общем mux.
+func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("/federation/", h)
+}
+
+func (h *Handler) handleLogin(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.providers[r.PathValue("provider")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	returnTo := r.URL.Query().Get("return_to")
+	if returnTo != "" && !isLocalPath(returnTo) {
+		writeError(w, http.StatusBadRequest, "return_to must be a local path")
+		return
+	}
+
+	state, err := token.RandomString(32)
+	if err != nil {
+		h.internalError(w, "failed to generate state", err)
+		return
+	}
+	nonce, err := token.RandomString(32)
+	if err != nil {
+		h.internalError(w, "failed to generate nonce", err)
+		return
+	}
+	verifier, err := token.RandomString(32)
+	if err != nil {
+		h.internalError(w, "failed to generate code verifier", err)
+		return
+	}
+
+	data, err := json.Marshal(&loginState{
+		Provider:     provider.Name(),
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+		ReturnTo:     returnTo,
+	})
+	if err != nil {
+		h.internalError(w, "failed to marshal state", err)
+		return
+	}
+	if err := h.cache.Put(statePrefix+state, string(data), stateExpiration); err != nil {
+		h.internalError(w, "failed to save state", err)
+		return
+	}
+
+	target, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		h.logger.Error("failed to build provider url", "provider", provider.Name(), "error", err)
+		writeError(w, http.StatusBadGateway, "identity provider is unavailable")
+		return
+	}
+
+	http.Redirect(w, r, target, http.StatusFound)
+}
+
+// loginContext переносит адрес клиента и user agent запроса туда, где их
+// ищет gRPC-часть, чтобы вход попал в историю так же, как через Login.
+func loginContext(r *http.Request) context.Context {
+	ctx := grpcmetadata.NewIncomingContext(r.Context(), grpcmetadata.Pairs("user-agent", r.UserAgent()))
+	if addr, err := net.ResolveTCPAddr("tcp", r.RemoteAddr); err == nil {
+		ctx = peer.NewContext(ctx, &peer.Peer{Addr: addr})
+	}
+	return ctx
+}
+
+func (h *Handler) handleCallback(w http.ResponseWriter, r *http.Request) {
+	provider, ok := h.providers[r.PathValue("provider")]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	query := r.URL.Query()
+
+	// state одноразовый и привязан к провайдеру, через который начат вход
+	state, err := h.takeState(query.Get("state"))
+	if err != nil {
+		if !errors.Is(err, redis.ErrNotFound) {
+			h.logger.Error("failed to load state", "error", err)
+		}
+		writeError(w, http.StatusBadRequest, "login request has expired or is invalid, start over")
+		return
+	}
+	if state.Provider != provider.Name() {
+		writeError(w, http.StatusBadRequest, "login request has expired or is invalid, start over")
+		return
+	}
+
+	ctx := loginContext(r)
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		h.logger.Warn("provider returned an error", "provider", provider.Name(), "error", providerErr, "description", query.Get("error_description"))
+		h.logins.RecordFederatedFailure(ctx, nil, "", provider.Name()+" denied the login: "+providerErr)
+		writeError(w, http.StatusUnauthorized, "identity provider denied the login: "+providerErr)
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), query.Get("code"), state.CodeVerifier, state.Nonce)
+	if err != nil {
+		if errors.Is(err, ErrInvalidIDToken) || errors.Is(err, ErrNonceMismatch) {
+			h.logger.Warn("rejected id token", "provider", provider.Name(), "error", err)
+			h.logins.RecordFederatedFailure(ctx, nil, "", provider.Name()+" id token rejected")
+			writeError(w, http.StatusUnauthorized, "identity provider login failed")
+			return
+		}
+		h.logger.Error("failed to exchange code", "provider", provider.Name(), "error", err)
+		writeError(w, http.StatusBadGateway, "identity provider is unavailable")
+		return
+	}
+
+	user, err := h.resolveUser(provider, claims)
+	if err != nil {
+		switch {
+		case errors.Is(err, errEmailRequired):
+			h.logins.RecordFederatedFailure(ctx, nil, claims.Email, err.Error())
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, errAccountExists):
+			h.logins.RecordFederatedFailure(ctx, nil, claims.Email, err.Error())
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			h.internalError(w, "failed to resolve federated user", err)
+		}
+		return
+	}
+
+	response, err := h.logins.CompleteFederatedLogin(ctx, user, claims.Email)
+	if err != nil {
+		switch status.Code(err) {
+		case codes.FailedPrecondition:
+			writeError(w, http.StatusForbidden, status.Convert(err).Message())
+			return
+		case codes.ResourceExhausted:
+			writeError(w, http.StatusTooManyRequests, status.Convert(err).Message())
+			return
+		}
+		h.internalError(w, "failed to complete login", err)
+		return
+	}
+
+	h.logger.Info("federated login", "provider", provider.Name(), "user_id", user.ID)
+
+	// Браузерный вход: access-токен становится сессией для /authorize
+	if state.ReturnTo != "" && !response.GetMfaRequired() && h.cfg.OAuthConfig.SessionCookie != "" {
+		http.SetCookie(w, &http.Cookie{
+			Name:     h.cfg.OAuthConfig.SessionCookie,
+			Value:    response.GetToken(),
+			Path:     "/",
+			MaxAge:   int(response.GetExpiresIn()),
+			HttpOnly: true,
+			Secure:   r.TLS != nil,
+			SameSite: http.SameSiteLaxMode,
+		})
+		http.Redirect(w, r, state.ReturnTo, http.StatusFound)
+		return
+	}
+
+	body, err := protojson.MarshalOptions{UseProtoNames: true}.Marshal(response)
+	if err != nil {
+		h.internalError(w, "failed to marshal login response", err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(body)
+}
+
+// resolveUser находит пользователя по (issuer, subject). Если привязки нет,
+// связывает с существующим пользователем по подтвержденной почте или
+// создает нового.
+func (h *Handler) resolveUser(provider *Provider, claims *Claims) (*entity.User, error) {
+	federated, err := h.storage.GetFederatedIdentity(provider.Issuer(), claims.Subject)
+	if err == nil {
+		return h.storage.GetUserByID(federated.UserID)
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	email, err := identity.NormalizeEmail(claims.Email)
+	if err != nil {
+		return nil, errEmailRequired
+	}
+
+	existing, err := h.storage.GetUserByEmail(email)
+	if err == nil {
+		// Связываем, только если почту подтвердили обе стороны: иначе
+		// чужой провайдер или незавершенная регистрация дали бы доступ
+		// к учетной записи
+		if !claims.EmailVerified || !existing.EmailVerified {
+			return nil, errAccountExists
+		}
+
+		if err := h.storage.SaveFederatedIdentity(existing.ID, provider.Issuer(), claims.Subject, email); err != nil {
+			return nil, err
+		}
+
+		h.logger.Info("federated identity linked", "provider", provider.Name(), "user_id", existing.ID)
+		return existing, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	base := usernameBase(claims.PreferredUsername, email)
+	for attempt := 0; attempt < usernameAttempts; attempt++ {
+		username := base
+		if attempt > 0 {
+			suffix, err := rand.Int(rand.Reader, big.NewInt(1000000))
+			if err != nil {
+				return nil, err
+			}
+			username = fmt.Sprintf("%s-%06d", base, suffix.Int64())
+		}
+
+		user, err := h.storage.CreateFederatedUser(username, email, claims.EmailVerified, provider.Issuer(), claims.Subject)
+		if err == nil {
+			h.logger.Info("federated user created", "provider", provider.Name(), "user_id", user.ID)
+			return user, nil
+		}
+		if !errors.Is(err, postgres.ErrUserAlreadyExists) {
+			return nil, err
+		}
+	}
+
+	return nil, errors.New("failed to allocate a unique username")
+}
+
+// usernameBase подбирает имя пользователя из preferred_username или
+// локальной части почты, выбрасывая недопустимые символы.
+func usernameBase(preferred, email string) string {
+	for _, candidate := range []string{preferred, strings.SplitN(email, "@", 2)[0]} {
+		var b strings.Builder
+		for _, r := range identity.Canonical(candidate) {
+			if unicode.IsLetter(r) || unicode.IsDigit(r) || r == '.' || r == '_' || r == '-' {
+				b.WriteRune(r)
+			}
+		}
+
+		name := []rune(b.String())
+		// Оставляем место под суффикс при совпадении имен
+		if len(name) > identity.UsernameMaxLength-8 {
+			name = name[:identity.UsernameMaxLength-8]
+		}
+		if username, err := identity.NormalizeUsername(string(name)); err == nil {
+			return username
+		}
+	}
+
+	return "user"
+}
+
+func (h *Handler) takeState(state string) (*loginState, error) {
+	if state == "" {
+		return nil, redis.ErrNotFound
+	}
+
+	data, err := h.cache.Take(statePrefix + state)
+	if err != nil {
+		return nil, err
+	}
+
+	var s loginState
+	if err := json.Unmarshal([]byte(data), &s); err != nil {
+		return nil, err
+	}
+
+	return &s, nil
+}
+
+func (h *Handler) internalError(w http.ResponseWriter, message string, err error) {
+	h.logger.Error(message, "error", err)
+	writeError(w, http.StatusInternalServerError, "internal server error")
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(map[string]string{"error": message})
+}
+
+// isLocalPath не дает использовать return_to для перехода на чужой сайт.
+func isLocalPath(path string) bool {
+	return strings.HasPrefix(path, "/") && !strings.HasPrefix(path, "//") && !strings.HasPrefix(path, "/\\")
+}
@@ -0,0 +1,668 @@
+package federation
+
+import (
+	"auth/internal/config"
+	"auth/internal/entity"
+	"auth/internal/keyring"
+	"auth/internal/redis"
+	"auth/internal/storage/postgres"
+	pb "auth/proto/auth"
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc/codes"
+	grpcmetadata "google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	testClientID     = "auth-service"
+	testClientSecret = "idp-secret"
+	testRedirectURL  = "https://auth.test/federation/stub/callback"
+	testCode         = "idp-code"
+)
+
+// stubIdP - OIDC провайдер на httptest: discovery, JWKS и /token,
+// который выдает ID Token с nonce из последнего запроса авторизации.
+type stubIdP struct {
+	*httptest.Server
+	keys *keyring.KeyRing
+
+	mu        sync.Mutex
+	nonce     string
+	challenge string
+	// modify меняет claims перед подписью
+	modify func(*Claims)
+}
+
+func newStubIdP(t *testing.T) *stubIdP {
+	t.Helper()
+
+	keys, err := keyring.New(keyring.AlgorithmES256, "", time.Hour, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("keyring.New: %v", err)
+	}
+
+	idp := &stubIdP{keys: keys}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		_ = json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 idp.URL,
+			"authorization_endpoint": idp.URL + "/authorize",
+			"token_endpoint":         idp.URL + "/token",
+			"jwks_uri":               idp.URL + "/jwks",
+		})
+	})
+	mux.Handle("/jwks", keys)
+	mux.HandleFunc("/token", idp.handleToken)
+
+	idp.Server = httptest.NewServer(mux)
+	t.Cleanup(idp.Close)
+	return idp
+}
+
+func (idp *stubIdP) handleToken(w http.ResponseWriter, r *http.Request) {
+	idp.mu.Lock()
+	defer idp.mu.Unlock()
+
+	clientID, secret, _ := r.BasicAuth()
+	verifier := sha256.Sum256([]byte(r.FormValue("code_verifier")))
+	switch {
+	case clientID != testClientID || secret != testClientSecret:
+		w.WriteHeader(http.StatusUnauthorized)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	case r.FormValue("code") != testCode,
+		r.FormValue("redirect_uri") != testRedirectURL,
+		base64.RawURLEncoding.EncodeToString(verifier[:]) != idp.challenge:
+		w.WriteHeader(http.StatusBadRequest)
+		_ = json.NewEncoder(w).Encode(map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	now := time.Now()
+	claims := &Claims{
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    idp.URL,
+			Subject:   "idp-user-1",
+			Audience:  jwt.ClaimStrings{testClientID},
+			ExpiresAt: jwt.NewNumericDate(now.Add(5 * time.Minute)),
+			IssuedAt:  jwt.NewNumericDate(now),
+		},
+		Nonce:             idp.nonce,
+		Email:             "bob@example.com",
+		EmailVerified:     true,
+		PreferredUsername: "Bob",
+	}
+	if idp.modify != nil {
+		idp.modify(claims)
+	}
+
+	idToken, err := idp.keys.Sign(claims)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(map[string]string{"access_token": "at", "token_type": "Bearer", "id_token": idToken})
+}
+
+// memoryStorage хранит пользователей и привязки к провайдерам в памяти.
+type memoryStorage struct {
+	postgres.Storage
+
+	mu         sync.Mutex
+	nextID     uint
+	users      map[uint]*entity.User
+	identities map[string]*entity.FederatedIdentity
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		users:      make(map[uint]*entity.User),
+		identities: make(map[string]*entity.FederatedIdentity),
+	}
+}
+
+func (m *memoryStorage) addUser(username, email string, verified bool) *entity.User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	user := &entity.User{UserName: username, Email: email, EmailVerified: verified}
+	user.ID = m.nextID
+	m.users[user.ID] = user
+	return user
+}
+
+func (m *memoryStorage) GetUserByID(id uint) (*entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (m *memoryStorage) GetUserByEmail(email string) (*entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, user := range m.users {
+		if user.Email == email {
+			copied := *user
+			return &copied, nil
+		}
+	}
+	return nil, gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) GetFederatedIdentity(issuer string, subject string) (*entity.FederatedIdentity, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	federated, ok := m.identities[issuer+" "+subject]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return federated, nil
+}
+
+func (m *memoryStorage) SaveFederatedIdentity(userID uint, issuer string, subject string, email string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.identities[issuer+" "+subject] = &entity.FederatedIdentity{UserID: userID, Issuer: issuer, Subject: subject, Email: email}
+	return nil
+}
+
+func (m *memoryStorage) CreateFederatedUser(userName string, email string, emailVerified bool, issuer string, subject string) (*entity.User, error) {
+	m.mu.Lock()
+	for _, user := range m.users {
+		if user.UserName == userName {
+			m.mu.Unlock()
+			return nil, postgres.ErrUserAlreadyExists
+		}
+	}
+	m.mu.Unlock()
+
+	user := m.addUser(userName, email, emailVerified)
+	if err := m.SaveFederatedIdentity(user.ID, issuer, subject, email); err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// stubCompleter записывает завершенные и неудачные входы.
+type stubCompleter struct {
+	mu        sync.Mutex
+	err       error
+	mfa       bool
+	completed []*entity.User
+	failures  []string
+	userAgent string
+	peer      bool
+}
+
+func (c *stubCompleter) CompleteFederatedLogin(ctx context.Context, user *entity.User, login string) (*pb.LoginResponse, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if md, ok := grpcmetadata.FromIncomingContext(ctx); ok && len(md.Get("user-agent")) > 0 {
+		c.userAgent = md.Get("user-agent")[0]
+	}
+	_, c.peer = peer.FromContext(ctx)
+
+	if c.err != nil {
+		return nil, c.err
+	}
+	c.completed = append(c.completed, user)
+	if c.mfa {
+		return &pb.LoginResponse{MfaRequired: true, MfaToken: "mfa"}, nil
+	}
+	return &pb.LoginResponse{Token: fmt.Sprintf("session-%d", user.ID), RefreshToken: "refresh", ExpiresIn: 900}, nil
+}
+
+func (c *stubCompleter) RecordFederatedFailure(ctx context.Context, user *entity.User, login, reason string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.failures = append(c.failures, reason)
+}
+
+type harness struct {
+	idp     *stubIdP
+	handler *Handler
+	storage *memoryStorage
+	logins  *stubCompleter
+}
+
+func newHarness(t *testing.T) *harness {
+	t.Helper()
+
+	idp := newStubIdP(t)
+	cfg := &config.Config{}
+	cfg.OAuthConfig.SessionCookie = "session"
+	cfg.FederationConfig.Providers = []config.ProviderConfig{
+		{
+			Name:         "stub",
+			Issuer:       idp.URL,
+			ClientID:     testClientID,
+			ClientSecret: testClientSecret,
+			RedirectURL:  testRedirectURL,
+		},
+		{
+			Name:        "other",
+			Issuer:      idp.URL,
+			ClientID:    testClientID,
+			RedirectURL: "https://auth.test/federation/other/callback",
+		},
+	}
+
+	storage := newMemoryStorage()
+	logins := &stubCompleter{}
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	handler := NewHandler(cfg, idp.Client(), storage, redis.NewInMemory(), logins, logger)
+
+	return &harness{idp: idp, handler: handler, storage: storage, logins: logins}
+}
+
+func (h *harness) get(target string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(http.MethodGet, target, nil)
+	req.Header.Set("User-Agent", "test-browser")
+	rec := httptest.NewRecorder()
+	h.handler.ServeHTTP(rec, req)
+	return rec
+}
+
+// begin начинает вход через провайдера и возвращает state. nonce и
+// code_challenge из адреса авторизации запоминает провайдер.
+func (h *harness) begin(t *testing.T, provider, returnTo string) string {
+	t.Helper()
+
+	target := "/federation/" + provider + "/login"
+	if returnTo != "" {
+		target += "?return_to=" + url.QueryEscape(returnTo)
+	}
+	rec := h.get(target)
+	if rec.Code != http.StatusFound {
+		t.Fatalf("login status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	location, err := url.Parse(rec.Header().Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(location.String(), h.idp.URL+"/authorize?") {
+		t.Fatalf("redirected to %s", location)
+	}
+	query := location.Query()
+	if query.Get("client_id") != testClientID || query.Get("code_challenge_method") != "S256" || query.Get("response_type") != "code" {
+		t.Fatalf("unexpected authorization request %s", location.RawQuery)
+	}
+
+	h.idp.mu.Lock()
+	h.idp.nonce = query.Get("nonce")
+	h.idp.challenge = query.Get("code_challenge")
+	h.idp.mu.Unlock()
+
+	return query.Get("state")
+}
+
+func (h *harness) callback(provider, state string) *httptest.ResponseRecorder {
+	return h.get("/federation/" + provider + "/callback?" + url.Values{"state": {state}, "code": {testCode}}.Encode())
+}
+
+func (h *harness) modifyClaims(modify func(*Claims)) {
+	h.idp.mu.Lock()
+	h.idp.modify = modify
+	h.idp.mu.Unlock()
+}
+
+func TestCallbackCreatesUser(t *testing.T) {
+	h := newHarness(t)
+
+	rec := h.callback("stub", h.begin(t, "stub", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	var response struct {
+		Token string `json:"token"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &response); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(h.logins.completed) != 1 {
+		t.Fatalf("completed logins = %d, want 1", len(h.logins.completed))
+	}
+	user := h.logins.completed[0]
+	if user.UserName != "bob" || user.Email != "bob@example.com" || !user.EmailVerified {
+		t.Errorf("created user = %+v", user)
+	}
+	if response.Token != fmt.Sprintf("session-%d", user.ID) {
+		t.Errorf("token = %q", response.Token)
+	}
+
+	federated, err := h.storage.GetFederatedIdentity(h.idp.URL, "idp-user-1")
+	if err != nil || federated.UserID != user.ID {
+		t.Fatalf("identity = %+v, %v", federated, err)
+	}
+
+	// Адрес и user agent доходят до истории входов
+	if h.logins.userAgent != "test-browser" || !h.logins.peer {
+		t.Errorf("login context: user agent = %q, peer = %v", h.logins.userAgent, h.logins.peer)
+	}
+}
+
+func TestCallbackCreatesUserWithFreeUsername(t *testing.T) {
+	h := newHarness(t)
+	h.storage.addUser("bob", "bob@other.example", true)
+
+	rec := h.callback("stub", h.begin(t, "stub", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+
+	user := h.logins.completed[0]
+	if !strings.HasPrefix(user.UserName, "bob-") || len(user.UserName) != len("bob-000000") {
+		t.Errorf("username = %q, want bob-NNNNNN", user.UserName)
+	}
+}
+
+func TestCallbackLinksBySubject(t *testing.T) {
+	h := newHarness(t)
+	existing := h.storage.addUser("robert", "robert@example.com", true)
+	if err := h.storage.SaveFederatedIdentity(existing.ID, h.idp.URL, "idp-user-1", "robert@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	// Почта у провайдера сменилась и не подтверждена: привязка по
+	// (issuer, subject) от нее не зависит
+	h.modifyClaims(func(c *Claims) {
+		c.Email = "new@example.com"
+		c.EmailVerified = false
+	})
+
+	rec := h.callback("stub", h.begin(t, "stub", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if len(h.logins.completed) != 1 || h.logins.completed[0].ID != existing.ID {
+		t.Fatalf("logged in as %+v, want user %d", h.logins.completed, existing.ID)
+	}
+	if len(h.storage.users) != 1 {
+		t.Errorf("users = %d, no new user expected", len(h.storage.users))
+	}
+}
+
+func TestCallbackSameSubjectOtherIssuer(t *testing.T) {
+	h := newHarness(t)
+	existing := h.storage.addUser("robert", "robert@example.com", true)
+	if err := h.storage.SaveFederatedIdentity(existing.ID, "https://other-idp.test", "idp-user-1", "robert@example.com"); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := h.callback("stub", h.begin(t, "stub", ""))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if h.logins.completed[0].ID == existing.ID {
+		t.Fatal("subject of another issuer resolved to the linked user")
+	}
+}
+
+func TestCallbackLinksByEmail(t *testing.T) {
+	tests := []struct {
+		name          string
+		userVerified  bool
+		claimVerified bool
+		wantStatus    int
+	}{
+		{"both verified", true, true, http.StatusOK},
+		{"provider email unverified", true, false, http.StatusConflict},
+		{"local email unverified", false, true, http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t)
+			existing := h.storage.addUser("bobby", "bob@example.com", tt.userVerified)
+			h.modifyClaims(func(c *Claims) {
+				c.Email = "Bob@Example.com"
+				c.EmailVerified = tt.claimVerified
+			})
+
+			rec := h.callback("stub", h.begin(t, "stub", ""))
+			if rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+			}
+
+			_, err := h.storage.GetFederatedIdentity(h.idp.URL, "idp-user-1")
+			if tt.wantStatus != http.StatusOK {
+				if err == nil {
+					t.Error("identity linked without verified email")
+				}
+				if len(h.logins.completed) != 0 || len(h.logins.failures) != 1 {
+					t.Errorf("completed = %d, failures = %v", len(h.logins.completed), h.logins.failures)
+				}
+				return
+			}
+			if err != nil || h.logins.completed[0].ID != existing.ID {
+				t.Fatalf("identity err = %v, logged in as %+v", err, h.logins.completed)
+			}
+		})
+	}
+}
+
+func TestCallbackBadState(t *testing.T) {
+	tests := []struct {
+		name  string
+		state func(t *testing.T, h *harness) (provider, state string)
+	}{
+		{"missing", func(t *testing.T, h *harness) (string, string) {
+			h.begin(t, "stub", "")
+			return "stub", ""
+		}},
+		{"unknown", func(t *testing.T, h *harness) (string, string) {
+			h.begin(t, "stub", "")
+			return "stub", "forged-state"
+		}},
+		{"reused", func(t *testing.T, h *harness) (string, string) {
+			state := h.begin(t, "stub", "")
+			if rec := h.callback("stub", state); rec.Code != http.StatusOK {
+				t.Fatalf("first callback status = %d, body = %s", rec.Code, rec.Body)
+			}
+			h.logins.completed = nil
+			return "stub", state
+		}},
+		{"other provider", func(t *testing.T, h *harness) (string, string) {
+			return "other", h.begin(t, "stub", "")
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t)
+			provider, state := tt.state(t, h)
+
+			rec := h.callback(provider, state)
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+			if len(h.logins.completed) != 0 {
+				t.Error("login completed with a bad state")
+			}
+		})
+	}
+}
+
+func TestCallbackRejectsIDToken(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(*Claims)
+	}{
+		{"nonce mismatch", func(c *Claims) { c.Nonce = "replayed-nonce" }},
+		{"missing nonce", func(c *Claims) { c.Nonce = "" }},
+		{"wrong issuer", func(c *Claims) { c.Issuer = "https://evil.test" }},
+		{"wrong audience", func(c *Claims) { c.Audience = jwt.ClaimStrings{"another-client"} }},
+		{"expired", func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-2 * clockSkew)) }},
+		{"missing subject", func(c *Claims) { c.Subject = "" }},
+		{"foreign azp", func(c *Claims) {
+			c.Audience = jwt.ClaimStrings{testClientID, "another-client"}
+			c.AuthorizedParty = "another-client"
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t)
+			h.modifyClaims(tt.modify)
+
+			rec := h.callback("stub", h.begin(t, "stub", ""))
+			if rec.Code != http.StatusUnauthorized {
+				t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+			}
+			if len(h.logins.completed) != 0 || len(h.logins.failures) != 1 {
+				t.Fatalf("completed = %d, failures = %v", len(h.logins.completed), h.logins.failures)
+			}
+			if len(h.storage.users) != 0 {
+				t.Error("user created from a rejected id token")
+			}
+		})
+	}
+}
+
+func TestCallbackProviderError(t *testing.T) {
+	h := newHarness(t)
+	state := h.begin(t, "stub", "")
+
+	rec := h.get("/federation/stub/callback?" + url.Values{"state": {state}, "error": {"access_denied"}}.Encode())
+	if rec.Code != http.StatusUnauthorized {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if len(h.logins.failures) != 1 || !strings.Contains(h.logins.failures[0], "access_denied") {
+		t.Errorf("failures = %v", h.logins.failures)
+	}
+}
+
+func TestCallbackEmailRequired(t *testing.T) {
+	h := newHarness(t)
+	h.modifyClaims(func(c *Claims) { c.Email = "" })
+
+	rec := h.callback("stub", h.begin(t, "stub", ""))
+	if rec.Code != http.StatusBadRequest {
+		t.Fatalf("status = %d, body = %s", rec.Code, rec.Body)
+	}
+	if len(h.logins.failures) != 1 {
+		t.Errorf("failures = %v", h.logins.failures)
+	}
+}
+
+func TestCallbackCompleteLoginError(t *testing.T) {
+	tests := []struct {
+		name       string
+		err        error
+		wantStatus int
+	}{
+		{"email not verified", status.Error(codes.FailedPrecondition, "email is not verified"), http.StatusForbidden},
+		{"locked out", status.Error(codes.ResourceExhausted, "account is temporarily locked"), http.StatusTooManyRequests},
+		{"internal", status.Error(codes.Internal, "boom"), http.StatusInternalServerError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newHarness(t)
+			h.logins.err = tt.err
+
+			if rec := h.callback("stub", h.begin(t, "stub", "")); rec.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+		})
+	}
+}
+
+func TestCallbackSetsSessionCookie(t *testing.T) {
+	h := newHarness(t)
+
+	rec := h.callback("stub", h.begin(t, "stub", "/authorize?client_id=app"))
+	if rec.Code != http.StatusFound || rec.Header().Get("Location") != "/authorize?client_id=app" {
+		t.Fatalf("status = %d, location = %q", rec.Code, rec.Header().Get("Location"))
+	}
+
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "session" || !cookies[0].HttpOnly {
+		t.Fatalf("cookies = %+v", cookies)
+	}
+	if cookies[0].Value != fmt.Sprintf("session-%d", h.logins.completed[0].ID) {
+		t.Errorf("cookie value = %q", cookies[0].Value)
+	}
+}
+
+func TestCallbackMFANoCookie(t *testing.T) {
+	h := newHarness(t)
+	h.logins.mfa = true
+
+	rec := h.callback("stub", h.begin(t, "stub", "/authorize"))
+	if rec.Code != http.StatusOK || len(rec.Result().Cookies()) != 0 {
+		t.Fatalf("status = %d, cookies = %v", rec.Code, rec.Result().Cookies())
+	}
+}
+
+func TestLoginRejectsReturnTo(t *testing.T) {
+	h := newHarness(t)
+
+	for _, returnTo := range []string{"https://evil.test/", "//evil.test/", "/\\evil.test", "relative"} {
+		t.Run(returnTo, func(t *testing.T) {
+			rec := h.get("/federation/stub/login?return_to=" + url.QueryEscape(returnTo))
+			if rec.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestLoginUnknownProvider(t *testing.T) {
+	h := newHarness(t)
+
+	for _, target := range []string{"/federation/missing/login", "/federation/missing/callback"} {
+		if rec := h.get(target); rec.Code != http.StatusNotFound {
+			t.Errorf("%s: status = %d, want %d", target, rec.Code, http.StatusNotFound)
+		}
+	}
+}
+
+func TestUsernameBase(t *testing.T) {
+	tests := []struct {
+		name      string
+		preferred string
+		email     string
+		want      string
+	}{
+		{"preferred", "Alice", "a@example.com", "alice"},
+		{"strips invalid characters", "al ice!", "a@example.com", "alice"},
+		{"falls back to email", "", "carol.smith@example.com", "carol.smith"},
+		{"reserved preferred", "admin", "dave@example.com", "dave"},
+		{"too short", "x", "ab@example.com", "user"},
+		{"truncated", strings.Repeat("a", 40), "", strings.Repeat("a", 24)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := usernameBase(tt.preferred, tt.email); got != tt.want {
+				t.Errorf("usernameBase(%q, %q) = %q, want %q", tt.preferred, tt.email, got, tt.want)
+			}
+		})
+	}
+}
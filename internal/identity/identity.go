@@ -0,0 +1,80 @@
+package identity
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/asaskevich/govalidator"
+	"golang.org/x/text/cases"
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	UsernameMinLength = 3
+	UsernameMaxLength = 32
+)
+
+var (
+	ErrInvalidUsername  = errors.New("username must be 3-32 letters, digits, '.', '_' or '-'")
+	ErrReservedUsername = errors.New("username is reserved")
+	ErrInvalidEmail     = errors.New("email is not valid")
+)
+
+// reserved - имена, которые нельзя занять при регистрации: служебные
+// учетные записи и пути, которые легко спутать с системными.
+var reserved = map[string]struct{}{
+	"abuse": {}, "admin": {}, "administrator": {}, "api": {}, "auth": {},
+	"help": {}, "hostmaster": {}, "info": {}, "login": {}, "logout": {},
+	"me": {}, "moderator": {}, "no-reply": {}, "noreply": {}, "null": {},
+	"oauth": {}, "postmaster": {}, "register": {}, "root": {}, "security": {},
+	"settings": {}, "staff": {}, "support": {}, "system": {}, "undefined": {},
+	"webmaster": {}, "www": {},
+}
+
+// Canonical приводит идентификатор к виду, в котором он хранится и
+// сравнивается: NFKC, case folding и обрезка пробелов. Проверок не делает,
+// поэтому годится для поиска по уже сохраненным значениям.
+func Canonical(s string) string {
+	s = norm.NFKC.String(strings.TrimSpace(s))
+	// Case folding может вернуть строку не в NFKC (например, для ß)
+	return norm.NFKC.String(cases.Fold().String(s))
+}
+
+// NormalizeUsername возвращает каноническое имя пользователя или ошибку,
+// если имя не подходит для регистрации.
+func NormalizeUsername(s string) (string, error) {
+	username := Canonical(s)
+
+	if n := utf8.RuneCountInString(username); n < UsernameMinLength || n > UsernameMaxLength {
+		return "", ErrInvalidUsername
+	}
+	for _, r := range username {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '.' && r != '_' && r != '-' {
+			return "", ErrInvalidUsername
+		}
+	}
+
+	if _, ok := reserved[username]; ok {
+		return "", ErrReservedUsername
+	}
+
+	return username, nil
+}
+
+// NormalizeEmail возвращает канонический адрес почты.
+func NormalizeEmail(s string) (string, error) {
+	email := Canonical(s)
+	if !govalidator.IsEmail(email) {
+		return "", ErrInvalidEmail
+	}
+
+	return email, nil
+}
+
+// IsEmail сообщает, похож ли логин на адрес почты. В именах пользователей
+// '@' запрещен, поэтому поле входа однозначно.
+func IsEmail(login string) bool {
+	return strings.Contains(login, "@")
+}
@@ -0,0 +1,135 @@
+package identity
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestCanonical(t *testing.T) {
+	tests := []struct {
+		name string
+		in   string
+		want string
+	}{
+		{name: "lower case", in: "alice", want: "alice"},
+		{name: "upper case", in: "ALICE", want: "alice"},
+		{name: "surrounding spaces", in: "  alice\t\n", want: "alice"},
+		{name: "fullwidth letters", in: "ａｌｉｃｅ", want: "alice"},
+		{name: "ligature", in: "ﬁona", want: "fiona"},
+		{name: "sharp s", in: "Straße", want: "strasse"},
+		{name: "kelvin sign", in: "\u212Aate", want: "kate"},
+		{name: "decomposed accent", in: "Jose\u0301", want: "josé"},
+		{name: "cyrillic", in: "Иван", want: "иван"},
+		{name: "email", in: " Alice@Example.COM ", want: "alice@example.com"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Canonical(tt.in)
+			if got != tt.want {
+				t.Fatalf("Canonical(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+			// Повторная нормализация ничего не меняет
+			if again := Canonical(got); again != got {
+				t.Fatalf("Canonical is not idempotent: %q -> %q", got, again)
+			}
+		})
+	}
+}
+
+func TestNormalizeUsername(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr error
+	}{
+		{name: "simple", in: "alice", want: "alice"},
+		{name: "canonical form", in: " ＡＬＩＣＥ ", want: "alice"},
+		{name: "allowed punctuation", in: "a.b_c-d", want: "a.b_c-d"},
+		{name: "digits", in: "user42", want: "user42"},
+		{name: "unicode letters", in: "Иван", want: "иван"},
+		{name: "minimum length", in: "abc", want: "abc"},
+		{name: "maximum length", in: strings.Repeat("a", UsernameMaxLength), want: strings.Repeat("a", UsernameMaxLength)},
+		{name: "too short", in: "ab", wantErr: ErrInvalidUsername},
+		{name: "too long", in: strings.Repeat("a", UsernameMaxLength+1), wantErr: ErrInvalidUsername},
+		{name: "length counts runes", in: strings.Repeat("ж", UsernameMaxLength), want: strings.Repeat("ж", UsernameMaxLength)},
+		{name: "empty", in: "", wantErr: ErrInvalidUsername},
+		{name: "inner space", in: "alice smith", wantErr: ErrInvalidUsername},
+		{name: "at sign", in: "alice@example", wantErr: ErrInvalidUsername},
+		{name: "slash", in: "alice/admin", wantErr: ErrInvalidUsername},
+		{name: "zero width space", in: "ali\u200bce", wantErr: ErrInvalidUsername},
+		{name: "reserved", in: "admin", wantErr: ErrReservedUsername},
+		{name: "reserved in another case", in: "Admin", wantErr: ErrReservedUsername},
+		{name: "reserved in fullwidth", in: "ｒｏｏｔ", wantErr: ErrReservedUsername},
+		{name: "reserved with dash", in: "no-reply", wantErr: ErrReservedUsername},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeUsername(tt.in)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("NormalizeUsername(%q) error = %v, want %v", tt.in, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("NormalizeUsername(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNormalizeEmail(t *testing.T) {
+	tests := []struct {
+		name    string
+		in      string
+		want    string
+		wantErr bool
+	}{
+		{name: "simple", in: "alice@example.com", want: "alice@example.com"},
+		{name: "mixed case", in: "Alice@Example.COM", want: "alice@example.com"},
+		{name: "surrounding spaces", in: " alice@example.com ", want: "alice@example.com"},
+		{name: "plus tag", in: "alice+news@example.com", want: "alice+news@example.com"},
+		{name: "fullwidth at sign", in: "alice＠example.com", want: "alice@example.com"},
+		{name: "missing at sign", in: "alice.example.com", wantErr: true},
+		{name: "missing domain", in: "alice@", wantErr: true},
+		{name: "missing local part", in: "@example.com", wantErr: true},
+		{name: "empty", in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := NormalizeEmail(tt.in)
+			if tt.wantErr {
+				if !errors.Is(err, ErrInvalidEmail) {
+					t.Fatalf("NormalizeEmail(%q) error = %v, want %v", tt.in, err, ErrInvalidEmail)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("NormalizeEmail(%q): %v", tt.in, err)
+			}
+			if got != tt.want {
+				t.Fatalf("NormalizeEmail(%q) = %q, want %q", tt.in, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsEmail(t *testing.T) {
+	tests := []struct {
+		login string
+		want  bool
+	}{
+		{login: "alice@example.com", want: true},
+		{login: "alice@", want: true},
+		{login: "alice", want: false},
+		{login: "", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := IsEmail(tt.login); got != tt.want {
+			t.Errorf("IsEmail(%q) = %v, want %v", tt.login, got, tt.want)
+		}
+	}
+}
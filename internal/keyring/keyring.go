@@ -0,0 +1,420 @@
+package keyring
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	AlgorithmRS256 = "RS256"
+	AlgorithmES256 = "ES256"
+	AlgorithmEdDSA = "EdDSA"
+
+	rsaKeySize = 2048
+)
+
+var (
+	ErrUnknownKey           = errors.New("unknown signing key")
+	ErrUnsupportedAlgorithm = errors.New("unsupported signing algorithm")
+)
+
+// Algorithms - список алгоритмов, которыми подписываются токены.
+var Algorithms = []string{AlgorithmRS256, AlgorithmES256, AlgorithmEdDSA}
+
+type Key struct {
+	ID        string
+	Algorithm string
+	Signer    crypto.Signer
+	CreatedAt time.Time
+	RetiredAt time.Time
+}
+
+// KeyRing хранит активный ключ подписи и предыдущие ключи, которые
+// еще нужны для проверки выданных ими токенов. Связка живет в памяти
+// процесса: сгенерированные и ротированные ключи другим экземплярам
+// сервиса не передаются.
+type KeyRing struct {
+	mu        sync.RWMutex
+	algorithm string
+	retention time.Duration
+	active    *Key
+	previous  []*Key
+	logger    *slog.Logger
+}
+
+// New создает связку ключей. Если privateKeyPath задан, первый активный
+// ключ читается из PEM файла (PKCS#8), иначе генерируется.
+func New(algorithm, privateKeyPath string, retention time.Duration, logger *slog.Logger) (*KeyRing, error) {
+	if _, err := signingMethod(algorithm); err != nil {
+		return nil, err
+	}
+
+	r := &KeyRing{
+		algorithm: algorithm,
+		retention: retention,
+		logger:    logger,
+	}
+
+	var (
+		key *Key
+		err error
+	)
+	if privateKeyPath != "" {
+		key, err = loadKey(algorithm, privateKeyPath)
+	} else {
+		key, err = generateKey(algorithm)
+	}
+	if err != nil {
+		return nil, err
+	}
+	r.active = key
+
+	return r, nil
+}
+
+// Rotate делает активным новый ключ. Прежний ключ остается доступным для
+// проверки в течение retention.
+func (r *KeyRing) Rotate() error {
+	key, err := generateKey(r.algorithm)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	r.active.RetiredAt = now
+	previous := []*Key{r.active}
+	for _, k := range r.previous {
+		if r.retained(k, now) {
+			previous = append(previous, k)
+		}
+	}
+	r.active = key
+	r.previous = previous
+
+	r.logger.Info("signing key rotated", "kid", key.ID, "algorithm", key.Algorithm)
+	return nil
+}
+
+// StartRotation ротирует ключи с заданным интервалом до отмены контекста.
+func (r *KeyRing) StartRotation(ctx context.Context, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Rotate(); err != nil {
+				r.logger.Error("failed to rotate signing key", "error", err)
+			}
+		}
+	}
+}
+
+// Sign подписывает claims активным ключом и проставляет kid в заголовок.
+func (r *KeyRing) Sign(claims jwt.Claims) (string, error) {
+	r.mu.RLock()
+	key := r.active
+	r.mu.RUnlock()
+
+	method, err := signingMethod(key.Algorithm)
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(method, claims)
+	token.Header["kid"] = key.ID
+
+	return token.SignedString(key.Signer)
+}
+
+// Keyfunc возвращает публичный ключ по kid из заголовка токена.
+func (r *KeyRing) Keyfunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	key := r.find(kid)
+	if key == nil {
+		return nil, ErrUnknownKey
+	}
+
+	if token.Method.Alg() != key.Algorithm {
+		return nil, errors.New("unexpected signing method")
+	}
+
+	return key.Signer.Public(), nil
+}
+
+// Keys возвращает активный ключ и все ключи, пригодные для проверки.
+func (r *KeyRing) Keys() []*Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	keys := []*Key{r.active}
+	for _, k := range r.previous {
+		if r.retained(k, now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// find ищет ключ по kid. Выведенный ключ перестает находиться сразу по
+// истечении retention, не дожидаясь следующей ротации.
+func (r *KeyRing) find(kid string) *Key {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.active.ID == kid {
+		return r.active
+	}
+	now := time.Now()
+	for _, k := range r.previous {
+		if k.ID == kid && r.retained(k, now) {
+			return k
+		}
+	}
+	return nil
+}
+
+// retained сообщает, можно ли еще проверять токены выведенного ключа.
+func (r *KeyRing) retained(k *Key, now time.Time) bool {
+	return now.Sub(k.RetiredAt) < r.retention
+}
+
+// JWK - публичный ключ в формате RFC 7517.
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+// JWKS возвращает публичные части всех ключей, пригодных для проверки.
+func (r *KeyRing) JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, k := range r.Keys() {
+		jwk := publicJWK(k.Signer.Public())
+		jwk.Kid = k.ID
+		jwk.Use = "sig"
+		jwk.Alg = k.Algorithm
+		set.Keys = append(set.Keys, jwk)
+	}
+	return set
+}
+
+// ServeHTTP отдает JWKS по /.well-known/jwks.json.
+func (r *KeyRing) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	if req.Method != http.MethodGet && req.Method != http.MethodHead {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	if err := json.NewEncoder(w).Encode(r.JWKS()); err != nil {
+		r.logger.Error("failed to encode jwks", "error", err)
+	}
+}
+
+func signingMethod(algorithm string) (jwt.SigningMethod, error) {
+	switch algorithm {
+	case AlgorithmRS256:
+		return jwt.SigningMethodRS256, nil
+	case AlgorithmES256:
+		return jwt.SigningMethodES256, nil
+	case AlgorithmEdDSA:
+		return jwt.SigningMethodEdDSA, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, algorithm)
+}
+
+func generateKey(algorithm string) (*Key, error) {
+	var (
+		signer crypto.Signer
+		err    error
+	)
+	switch algorithm {
+	case AlgorithmRS256:
+		signer, err = rsa.GenerateKey(rand.Reader, rsaKeySize)
+	case AlgorithmES256:
+		signer, err = ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	case AlgorithmEdDSA:
+		_, signer, err = ed25519.GenerateKey(rand.Reader)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedAlgorithm, algorithm)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate signing key: %w", err)
+	}
+
+	return newKey(algorithm, signer), nil
+}
+
+func loadKey(algorithm, path string) (*Key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read private key: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("failed to decode private key PEM")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+
+	var ok bool
+	switch algorithm {
+	case AlgorithmRS256:
+		_, ok = parsed.(*rsa.PrivateKey)
+	case AlgorithmES256:
+		var k *ecdsa.PrivateKey
+		k, ok = parsed.(*ecdsa.PrivateKey)
+		ok = ok && k.Curve == elliptic.P256()
+	case AlgorithmEdDSA:
+		_, ok = parsed.(ed25519.PrivateKey)
+	}
+	if !ok {
+		return nil, fmt.Errorf("private key does not match algorithm %s", algorithm)
+	}
+
+	return newKey(algorithm, parsed.(crypto.Signer)), nil
+}
+
+func newKey(algorithm string, signer crypto.Signer) *Key {
+	return &Key{
+		ID:        thumbprint(publicJWK(signer.Public())),
+		Algorithm: algorithm,
+		Signer:    signer,
+		CreatedAt: time.Now(),
+	}
+}
+
+func publicJWK(public crypto.PublicKey) JWK {
+	switch k := public.(type) {
+	case *rsa.PublicKey:
+		return JWK{
+			Kty: "RSA",
+			N:   encode(k.N.Bytes()),
+			E:   encode(big.NewInt(int64(k.E)).Bytes()),
+		}
+	case *ecdsa.PublicKey:
+		size := (k.Curve.Params().BitSize + 7) / 8
+		return JWK{
+			Kty: "EC",
+			Crv: k.Curve.Params().Name,
+			X:   encode(k.X.FillBytes(make([]byte, size))),
+			Y:   encode(k.Y.FillBytes(make([]byte, size))),
+		}
+	case ed25519.PublicKey:
+		return JWK{
+			Kty: "OKP",
+			Crv: "Ed25519",
+			X:   encode(k),
+		}
+	}
+	return JWK{}
+}
+
+// PublicKey разбирает публичный ключ из JWK. Нужен для проверки
+// токенов, подписанных внешними провайдерами.
+func (k JWK) PublicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := base64.RawURLEncoding.DecodeString(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid RSA modulus: %w", err)
+		}
+		e, err := base64.RawURLEncoding.DecodeString(k.E)
+		if err != nil || len(e) == 0 || len(e) > 4 {
+			return nil, errors.New("invalid RSA exponent")
+		}
+		return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+
+	case "EC":
+		if k.Crv != elliptic.P256().Params().Name {
+			return nil, fmt.Errorf("%w: curve %s", ErrUnsupportedAlgorithm, k.Crv)
+		}
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC x: %w", err)
+		}
+		y, err := base64.RawURLEncoding.DecodeString(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid EC y: %w", err)
+		}
+		public := &ecdsa.PublicKey{Curve: elliptic.P256(), X: new(big.Int).SetBytes(x), Y: new(big.Int).SetBytes(y)}
+		if !public.Curve.IsOnCurve(public.X, public.Y) {
+			return nil, errors.New("EC point is not on curve")
+		}
+		return public, nil
+
+	case "OKP":
+		x, err := base64.RawURLEncoding.DecodeString(k.X)
+		if err != nil || k.Crv != "Ed25519" || len(x) != ed25519.PublicKeySize {
+			return nil, errors.New("invalid Ed25519 key")
+		}
+		return ed25519.PublicKey(x), nil
+	}
+
+	return nil, fmt.Errorf("%w: key type %s", ErrUnsupportedAlgorithm, k.Kty)
+}
+
+// thumbprint считает RFC 7638 отпечаток ключа, он же kid.
+func thumbprint(jwk JWK) string {
+	var members string
+	switch jwk.Kty {
+	case "RSA":
+		members = fmt.Sprintf(`{"e":%q,"kty":"RSA","n":%q}`, jwk.E, jwk.N)
+	case "EC":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"EC","x":%q,"y":%q}`, jwk.Crv, jwk.X, jwk.Y)
+	case "OKP":
+		members = fmt.Sprintf(`{"crv":%q,"kty":"OKP","x":%q}`, jwk.Crv, jwk.X)
+	}
+	sum := sha256.Sum256([]byte(members))
+	return encode(sum[:])
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
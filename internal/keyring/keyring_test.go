@@ -0,0 +1,448 @@
+package keyring
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func testLogger() *slog.Logger {
+	return slog.New(slog.NewTextHandler(io.Discard, nil))
+}
+
+func newTestRing(t *testing.T, algorithm string, retention time.Duration) *KeyRing {
+	t.Helper()
+
+	ring, err := New(algorithm, "", retention, testLogger())
+	if err != nil {
+		t.Fatalf("New(%s): %v", algorithm, err)
+	}
+	return ring
+}
+
+// verify разбирает токен ключами связки так же, как token.Manager.
+func verify(ring *KeyRing, signed string) error {
+	_, err := jwt.Parse(signed, ring.Keyfunc, jwt.WithValidMethods(Algorithms))
+	return err
+}
+
+func sign(t *testing.T, ring *KeyRing) string {
+	t.Helper()
+
+	signed, err := ring.Sign(jwt.RegisteredClaims{Subject: "1", ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute))})
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	return signed
+}
+
+func TestSignAndVerify(t *testing.T) {
+	for _, algorithm := range Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			ring := newTestRing(t, algorithm, time.Hour)
+			signed := sign(t, ring)
+
+			token, _, err := jwt.NewParser().ParseUnverified(signed, &jwt.RegisteredClaims{})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if token.Header["alg"] != algorithm || token.Header["kid"] != ring.Keys()[0].ID {
+				t.Errorf("header = %v", token.Header)
+			}
+			if err := verify(ring, signed); err != nil {
+				t.Fatalf("verify: %v", err)
+			}
+
+			// Подпись другой связки не принимается
+			if err := verify(newTestRing(t, algorithm, time.Hour), signed); err == nil {
+				t.Error("token signed by another ring accepted")
+			}
+		})
+	}
+}
+
+func TestNewUnsupportedAlgorithm(t *testing.T) {
+	for _, algorithm := range []string{"", "HS256", "none", "ES384"} {
+		if _, err := New(algorithm, "", time.Hour, testLogger()); !errors.Is(err, ErrUnsupportedAlgorithm) {
+			t.Errorf("New(%q): err = %v, want ErrUnsupportedAlgorithm", algorithm, err)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	ring := newTestRing(t, AlgorithmES256, time.Hour)
+	before := sign(t, ring)
+	oldKID := ring.Keys()[0].ID
+
+	if err := ring.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+
+	keys := ring.Keys()
+	if len(keys) != 2 || keys[0].ID == oldKID || keys[1].ID != oldKID {
+		t.Fatalf("keys after rotation = %d, active %s", len(keys), keys[0].ID)
+	}
+	if keys[1].RetiredAt.IsZero() {
+		t.Error("previous key has no RetiredAt")
+	}
+
+	// Выданные прежним ключом токены проверяются до конца retention
+	if err := verify(ring, before); err != nil {
+		t.Fatalf("token of the previous key: %v", err)
+	}
+	after := sign(t, ring)
+	if err := verify(ring, after); err != nil {
+		t.Fatalf("token of the active key: %v", err)
+	}
+
+	if set := ring.JWKS(); len(set.Keys) != 2 {
+		t.Errorf("jwks keys = %d, want 2", len(set.Keys))
+	}
+}
+
+func TestRotateDropsExpiredKeys(t *testing.T) {
+	ring := newTestRing(t, AlgorithmES256, time.Hour)
+	before := sign(t, ring)
+
+	if err := ring.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	// Ключ выведен раньше, чем retention назад
+	ring.previous[0].RetiredAt = time.Now().Add(-2 * time.Hour)
+
+	if keys := ring.Keys(); len(keys) != 1 {
+		t.Fatalf("keys = %d, want 1", len(keys))
+	}
+	if err := verify(ring, before); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("err = %v, want ErrUnknownKey", err)
+	}
+
+	// При следующей ротации просроченный ключ удаляется совсем
+	if err := ring.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if len(ring.previous) != 1 {
+		t.Errorf("previous keys = %d, want 1", len(ring.previous))
+	}
+}
+
+func TestKeyfuncRejects(t *testing.T) {
+	ring := newTestRing(t, AlgorithmES256, time.Hour)
+	kid := ring.Keys()[0].ID
+
+	tests := []struct {
+		name   string
+		method jwt.SigningMethod
+		kid    interface{}
+		err    error
+	}{
+		{"unknown kid", jwt.SigningMethodES256, "unknown", ErrUnknownKey},
+		{"missing kid", jwt.SigningMethodES256, nil, ErrUnknownKey},
+		{"kid is not a string", jwt.SigningMethodES256, 42, ErrUnknownKey},
+		{"algorithm mismatch", jwt.SigningMethodRS256, kid, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			token := jwt.New(tt.method)
+			if tt.kid != nil {
+				token.Header["kid"] = tt.kid
+			}
+
+			key, err := ring.Keyfunc(token)
+			if err == nil || key != nil {
+				t.Fatalf("Keyfunc = %v, %v", key, err)
+			}
+			if tt.err != nil && !errors.Is(err, tt.err) {
+				t.Errorf("err = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func writePEM(t *testing.T, key interface{}) string {
+	t.Helper()
+
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "key.pem")
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadKey(t *testing.T) {
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p384Key, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey, err := rsa.GenerateKey(rand.Reader, rsaKeySize)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		algorithm string
+		key       interface{}
+		wantErr   bool
+	}{
+		{"es256", AlgorithmES256, ecKey, false},
+		{"eddsa", AlgorithmEdDSA, edKey, false},
+		{"rs256", AlgorithmRS256, rsaKey, false},
+		{"es256 with p-384", AlgorithmES256, p384Key, true},
+		{"rs256 with ec key", AlgorithmRS256, ecKey, true},
+		{"eddsa with rsa key", AlgorithmEdDSA, rsaKey, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := writePEM(t, tt.key)
+
+			ring, err := New(tt.algorithm, path, time.Hour, testLogger())
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("New accepted a key of another algorithm")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("New: %v", err)
+			}
+
+			// Один и тот же файл дает один и тот же kid во всех экземплярах
+			again, err := New(tt.algorithm, path, time.Hour, testLogger())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if ring.Keys()[0].ID != again.Keys()[0].ID {
+				t.Error("kid differs between instances loading the same key")
+			}
+			if err := verify(again, sign(t, ring)); err != nil {
+				t.Errorf("token of one instance rejected by another: %v", err)
+			}
+		})
+	}
+}
+
+func TestLoadKeyInvalidFile(t *testing.T) {
+	dir := t.TempDir()
+	notPEM := filepath.Join(dir, "not-pem")
+	if err := os.WriteFile(notPEM, []byte("not a key"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	notPKCS8 := filepath.Join(dir, "not-pkcs8")
+	if err := os.WriteFile(notPKCS8, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: []byte{1, 2, 3}}), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, path := range []string{filepath.Join(dir, "missing"), notPEM, notPKCS8} {
+		if _, err := New(AlgorithmES256, path, time.Hour, testLogger()); err == nil {
+			t.Errorf("New(%s) succeeded", filepath.Base(path))
+		}
+	}
+}
+
+func TestThumbprint(t *testing.T) {
+	// RFC 7638, раздел 3.1
+	jwk := JWK{
+		Kty: "RSA",
+		N:   "0vx7agoebGcQSuuPiLJXZptN9nndrQmbXEps2aiAFbWhM78LhWx4cbbfAAtVT86zwu1RK7aPFFxuhDR1L6tSoc_BJECPebWKRXjBZCiFV4n3oknjhMstn64tZ_2W-5JsGY4Hc5n9yBXArwl93lqt7_RN5w6Cf0h4QyQ5v-65YGjQR0_FDW2QvzqY368QQMicAtaSqzs8KJZgnYb9c7d0zgdAZHzu6qMQvRL5hajrn1n91CbOpbISD08qNLyrdkt-bFTWhAI4vMQFh6WeZu0fM4lFd2NcRwr3XPksINHaQ-G_xBniIqbw0Ls1jF44-csFCur-kEgU8awapJzKnqDKgw",
+		E:   "AQAB",
+	}
+	const want = "NzbLsXh8uDCcd-6MNwXF4W_7noWXFZAfHkxZsRGC9Xs"
+
+	if got := thumbprint(jwk); got != want {
+		t.Errorf("thumbprint = %s, want %s", got, want)
+	}
+}
+
+func TestJWKPublicKeyRoundTrip(t *testing.T) {
+	for _, algorithm := range Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			ring := newTestRing(t, algorithm, time.Hour)
+			jwk := ring.JWKS().Keys[0]
+			if jwk.Use != "sig" || jwk.Alg != algorithm || jwk.Kid != ring.Keys()[0].ID {
+				t.Fatalf("jwk = %+v", jwk)
+			}
+
+			public, err := jwk.PublicKey()
+			if err != nil {
+				t.Fatalf("PublicKey: %v", err)
+			}
+			if thumbprint(publicJWK(public)) != jwk.Kid {
+				t.Error("parsed key differs from the published one")
+			}
+		})
+	}
+}
+
+func TestJWKPublicKeyInvalid(t *testing.T) {
+	valid := newTestRing(t, AlgorithmES256, time.Hour).JWKS().Keys[0]
+	offCurve := valid
+	offCurve.Y = valid.X
+
+	tests := []struct {
+		name string
+		jwk  JWK
+	}{
+		{"unknown kty", JWK{Kty: "oct"}},
+		{"ec on another curve", JWK{Kty: "EC", Crv: "P-384", X: valid.X, Y: valid.Y}},
+		{"ec point off curve", offCurve},
+		{"ec invalid base64", JWK{Kty: "EC", Crv: "P-256", X: "*", Y: valid.Y}},
+		{"rsa without exponent", JWK{Kty: "RSA", N: "AQAB"}},
+		{"rsa long exponent", JWK{Kty: "RSA", N: "AQAB", E: "AQABAQAB"}},
+		{"okp wrong size", JWK{Kty: "OKP", Crv: "Ed25519", X: "AQAB"}},
+		{"okp wrong curve", JWK{Kty: "OKP", Crv: "X25519", X: encode(make([]byte, 32))}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := tt.jwk.PublicKey(); err == nil {
+				t.Fatal("PublicKey accepted an invalid key")
+			}
+		})
+	}
+}
+
+func TestServeHTTP(t *testing.T) {
+	ring := newTestRing(t, AlgorithmEdDSA, time.Hour)
+
+	rec := httptest.NewRecorder()
+	ring.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "application/json" {
+		t.Fatalf("status = %d, content type = %q", rec.Code, rec.Header().Get("Content-Type"))
+	}
+
+	var set JWKSet
+	if err := json.Unmarshal(rec.Body.Bytes(), &set); err != nil {
+		t.Fatal(err)
+	}
+	if len(set.Keys) != 1 || set.Keys[0].Kty != "OKP" || set.Keys[0].Crv != "Ed25519" {
+		t.Errorf("jwks = %+v", set)
+	}
+
+	rec = httptest.NewRecorder()
+	ring.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/.well-known/jwks.json", nil))
+	if rec.Code != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", rec.Code, http.StatusMethodNotAllowed)
+	}
+}
+
+func TestKeyfuncRejectsKeyPastRetention(t *testing.T) {
+	ring := newTestRing(t, AlgorithmES256, time.Hour)
+	before := sign(t, ring)
+
+	if err := ring.Rotate(); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	// Ключ остается в previous до следующей ротации, но уже не принимается
+	ring.previous[0].RetiredAt = time.Now().Add(-time.Hour)
+
+	if err := verify(ring, before); !errors.Is(err, ErrUnknownKey) {
+		t.Fatalf("err = %v, want ErrUnknownKey", err)
+	}
+	if len(ring.previous) != 1 {
+		t.Fatalf("previous keys = %d, want 1", len(ring.previous))
+	}
+}
+
+// publishedKeyfunc проверяет токены только ключами из опубликованного JWKS,
+// как это делает сторонний сервис.
+func publishedKeyfunc(set JWKSet) jwt.Keyfunc {
+	return func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		for _, jwk := range set.Keys {
+			if jwk.Kid == kid {
+				return jwk.PublicKey()
+			}
+		}
+		return nil, ErrUnknownKey
+	}
+}
+
+func fetchJWKS(t *testing.T, url string) JWKSet {
+	t.Helper()
+
+	response, err := http.Get(url)
+	if err != nil {
+		t.Fatalf("GET %s: %v", url, err)
+	}
+	defer response.Body.Close()
+
+	var set JWKSet
+	if err := json.NewDecoder(response.Body).Decode(&set); err != nil {
+		t.Fatal(err)
+	}
+	return set
+}
+
+func TestServeHTTPAfterRotate(t *testing.T) {
+	for _, algorithm := range Algorithms {
+		t.Run(algorithm, func(t *testing.T) {
+			ring := newTestRing(t, algorithm, time.Hour)
+			server := httptest.NewServer(ring)
+			defer server.Close()
+			url := server.URL + "/.well-known/jwks.json"
+
+			oldKid := ring.Keys()[0].ID
+			before := sign(t, ring)
+			if err := ring.Rotate(); err != nil {
+				t.Fatalf("Rotate: %v", err)
+			}
+			after := sign(t, ring)
+
+			set := fetchJWKS(t, url)
+			for name, signed := range map[string]string{"after rotation": after, "before rotation": before} {
+				if _, err := jwt.Parse(signed, publishedKeyfunc(set), jwt.WithValidMethods(Algorithms)); err != nil {
+					t.Fatalf("token signed %s does not verify against published jwks: %v", name, err)
+				}
+			}
+
+			kids := make(map[string]bool)
+			for _, jwk := range set.Keys {
+				kids[jwk.Kid] = true
+			}
+			if len(set.Keys) != 2 || !kids[oldKid] || !kids[ring.Keys()[0].ID] {
+				t.Fatalf("published kids = %v, want the active and the retired %s", kids, oldKid)
+			}
+
+			// После срока хранения старый ключ из JWKS пропадает
+			ring.previous[0].RetiredAt = time.Now().Add(-2 * time.Hour)
+			set = fetchJWKS(t, url)
+			if len(set.Keys) != 1 || set.Keys[0].Kid == oldKid {
+				t.Fatalf("jwks = %+v, want only the active key", set)
+			}
+			if _, err := jwt.Parse(before, publishedKeyfunc(set), jwt.WithValidMethods(Algorithms)); err == nil {
+				t.Fatal("token of a key past retention verified against published jwks")
+			}
+		})
+	}
+}
@@ -0,0 +1,113 @@
+package lockout
+
+import (
+	"auth/internal/config"
+	"auth/internal/redis"
+	"errors"
+	"strconv"
+	"time"
+)
+
+const (
+	defaultBaseDuration = time.Minute
+	defaultMaxDuration  = time.Hour
+	defaultWindow       = 24 * time.Hour
+)
+
+// Guard считает неудачные входы по учетным записям и временно блокирует
+// их с экспоненциально растущим сроком.
+type Guard struct {
+	cfg   config.LockoutConfig
+	cache redis.Redis
+}
+
+func NewGuard(cfg config.LockoutConfig, cache redis.Redis) *Guard {
+	if cfg.BaseDuration <= 0 {
+		cfg.BaseDuration = defaultBaseDuration
+	}
+	if cfg.MaxDuration < cfg.BaseDuration {
+		cfg.MaxDuration = max(defaultMaxDuration, cfg.BaseDuration)
+	}
+	// Счетчик должен пережить самую длинную блокировку, иначе после нее
+	// отсчет начнется заново
+	if cfg.Window < cfg.MaxDuration {
+		cfg.Window = max(defaultWindow, cfg.MaxDuration)
+	}
+	return &Guard{cfg: cfg, cache: cache}
+}
+
+// Enabled сообщает, включена ли блокировка в конфигурации.
+func (g *Guard) Enabled() bool {
+	return g.cfg.Threshold > 0
+}
+
+// LockedFor возвращает оставшееся время блокировки или ноль.
+func (g *Guard) LockedFor(userID uint) (time.Duration, error) {
+	if !g.Enabled() {
+		return 0, nil
+	}
+
+	value, err := g.cache.Get(lockKey(userID))
+	if err != nil {
+		if errors.Is(err, redis.ErrNotFound) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	until, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		return 0, nil
+	}
+
+	return max(time.Until(time.Unix(until, 0)), 0), nil
+}
+
+// Fail учитывает неудачную попытку. Если она привела к блокировке,
+// возвращается ее срок.
+func (g *Guard) Fail(userID uint) (time.Duration, error) {
+	if !g.Enabled() {
+		return 0, nil
+	}
+
+	failures, err := g.cache.Incr(failuresKey(userID), g.cfg.Window)
+	if err != nil {
+		return 0, err
+	}
+	if failures < int64(g.cfg.Threshold) {
+		return 0, nil
+	}
+
+	duration := g.duration(failures - int64(g.cfg.Threshold))
+	until := time.Now().Add(duration).Unix()
+	if err := g.cache.Put(lockKey(userID), strconv.FormatInt(until, 10), duration); err != nil {
+		return 0, err
+	}
+
+	return duration, nil
+}
+
+// Reset снимает блокировку и обнуляет счетчик.
+func (g *Guard) Reset(userID uint) error {
+	if err := g.cache.Delete(failuresKey(userID)); err != nil {
+		return err
+	}
+	return g.cache.Delete(lockKey(userID))
+}
+
+// duration - base_duration * 2^step, но не больше max_duration.
+func (g *Guard) duration(step int64) time.Duration {
+	duration := g.cfg.BaseDuration
+	for ; step > 0 && duration < g.cfg.MaxDuration; step-- {
+		duration *= 2
+	}
+	return min(duration, g.cfg.MaxDuration)
+}
+
+func failuresKey(userID uint) string {
+	return "login_failures:" + strconv.FormatUint(uint64(userID), 10)
+}
+
+func lockKey(userID uint) string {
+	return "lockout:" + strconv.FormatUint(uint64(userID), 10)
+}
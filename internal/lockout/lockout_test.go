@@ -0,0 +1,163 @@
+package lockout
+
+import (
+	"auth/internal/config"
+	"auth/internal/redis"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestNewGuardDefaults(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.LockoutConfig
+		want config.LockoutConfig
+	}{
+		{
+			name: "empty",
+			cfg:  config.LockoutConfig{Threshold: 5},
+			want: config.LockoutConfig{Threshold: 5, BaseDuration: time.Minute, MaxDuration: time.Hour, Window: 24 * time.Hour},
+		},
+		{
+			name: "explicit",
+			cfg:  config.LockoutConfig{Threshold: 3, BaseDuration: time.Second, MaxDuration: time.Minute, Window: time.Hour},
+			want: config.LockoutConfig{Threshold: 3, BaseDuration: time.Second, MaxDuration: time.Minute, Window: time.Hour},
+		},
+		{
+			name: "max below base",
+			cfg:  config.LockoutConfig{Threshold: 3, BaseDuration: 2 * time.Hour, MaxDuration: time.Minute},
+			want: config.LockoutConfig{Threshold: 3, BaseDuration: 2 * time.Hour, MaxDuration: 2 * time.Hour, Window: 24 * time.Hour},
+		},
+		{
+			name: "window shorter than max",
+			cfg:  config.LockoutConfig{Threshold: 3, BaseDuration: time.Hour, MaxDuration: 48 * time.Hour, Window: time.Hour},
+			want: config.LockoutConfig{Threshold: 3, BaseDuration: time.Hour, MaxDuration: 48 * time.Hour, Window: 48 * time.Hour},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := NewGuard(tt.cfg, redis.NewInMemory()).cfg; got != tt.want {
+				t.Fatalf("cfg = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDuration(t *testing.T) {
+	guard := NewGuard(config.LockoutConfig{Threshold: 3, BaseDuration: time.Minute, MaxDuration: 10 * time.Minute}, redis.NewInMemory())
+
+	tests := []struct {
+		step int64
+		want time.Duration
+	}{
+		{step: 0, want: time.Minute},
+		{step: 1, want: 2 * time.Minute},
+		{step: 2, want: 4 * time.Minute},
+		{step: 3, want: 8 * time.Minute},
+		{step: 4, want: 10 * time.Minute},
+		{step: 1000, want: 10 * time.Minute},
+	}
+
+	for _, tt := range tests {
+		if got := guard.duration(tt.step); got != tt.want {
+			t.Errorf("duration(%d) = %v, want %v", tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestGuard(t *testing.T) {
+	guard := NewGuard(config.LockoutConfig{Threshold: 3, BaseDuration: time.Minute, MaxDuration: time.Hour}, redis.NewInMemory())
+
+	// Неудачи до порога не блокируют
+	for i := range 2 {
+		duration, err := guard.Fail(1)
+		if err != nil || duration != 0 {
+			t.Fatalf("Fail #%d = %v, %v; want no lock", i+1, duration, err)
+		}
+	}
+	if remaining, _ := guard.LockedFor(1); remaining != 0 {
+		t.Fatalf("LockedFor = %v before the threshold", remaining)
+	}
+
+	// Каждая неудача после порога удваивает срок
+	for _, want := range []time.Duration{time.Minute, 2 * time.Minute, 4 * time.Minute} {
+		duration, err := guard.Fail(1)
+		if err != nil || duration != want {
+			t.Fatalf("Fail = %v, %v; want %v", duration, err, want)
+		}
+		remaining, err := guard.LockedFor(1)
+		if err != nil || remaining <= want-2*time.Second || remaining > want+time.Second {
+			t.Fatalf("LockedFor = %v, %v; want about %v", remaining, err, want)
+		}
+	}
+
+	// Счетчики у учетных записей раздельные
+	if remaining, _ := guard.LockedFor(2); remaining != 0 {
+		t.Fatalf("LockedFor(2) = %v", remaining)
+	}
+
+	if err := guard.Reset(1); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if remaining, _ := guard.LockedFor(1); remaining != 0 {
+		t.Fatalf("LockedFor after reset = %v", remaining)
+	}
+	if duration, _ := guard.Fail(1); duration != 0 {
+		t.Fatalf("Fail after reset = %v, want the counter to start over", duration)
+	}
+}
+
+func TestGuardDisabled(t *testing.T) {
+	guard := NewGuard(config.LockoutConfig{}, failingCache{})
+	if guard.Enabled() {
+		t.Fatal("guard with zero threshold is enabled")
+	}
+
+	// Выключенная блокировка не обращается к хранилищу
+	for range 10 {
+		if duration, err := guard.Fail(1); duration != 0 || err != nil {
+			t.Fatalf("Fail = %v, %v", duration, err)
+		}
+	}
+	if remaining, err := guard.LockedFor(1); remaining != 0 || err != nil {
+		t.Fatalf("LockedFor = %v, %v", remaining, err)
+	}
+}
+
+func TestGuardCacheErrors(t *testing.T) {
+	guard := NewGuard(config.LockoutConfig{Threshold: 1}, failingCache{})
+
+	if _, err := guard.Fail(1); !errors.Is(err, errCache) {
+		t.Fatalf("Fail error = %v, want %v", err, errCache)
+	}
+	if _, err := guard.LockedFor(1); !errors.Is(err, errCache) {
+		t.Fatalf("LockedFor error = %v, want %v", err, errCache)
+	}
+	if err := guard.Reset(1); !errors.Is(err, errCache) {
+		t.Fatalf("Reset error = %v, want %v", err, errCache)
+	}
+}
+
+func TestLockedForIgnoresMalformedValue(t *testing.T) {
+	cache := redis.NewInMemory()
+	guard := NewGuard(config.LockoutConfig{Threshold: 1}, cache)
+	if err := cache.Put(lockKey(1), "soon", time.Minute); err != nil {
+		t.Fatal(err)
+	}
+
+	if remaining, err := guard.LockedFor(1); remaining != 0 || err != nil {
+		t.Fatalf("LockedFor = %v, %v", remaining, err)
+	}
+}
+
+var errCache = errors.New("cache is down")
+
+type failingCache struct{}
+
+func (failingCache) Put(string, string, time.Duration) error   { return errCache }
+func (failingCache) Get(string) (string, error)                { return "", errCache }
+func (failingCache) Delete(string) error                       { return errCache }
+func (failingCache) Take(string) (string, error)               { return "", errCache }
+func (failingCache) Incr(string, time.Duration) (int64, error) { return 0, errCache }
@@ -0,0 +1,471 @@
+package oauth
+
+import (
+	"auth/internal/entity"
+	"auth/internal/redis"
+	"auth/internal/token"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	AuthorizationCodeExpiration = 5 * time.Minute
+	consentChallengeExpiration  = 10 * time.Minute
+	consentChallengePrefix      = "oauth:consent:"
+
+	codeChallengeMethodS256 = "S256"
+)
+
+var errLoginRequired = errors.New("login required")
+
+// authorizeRequest - проверенные параметры запроса к /authorize.
+type authorizeRequest struct {
+	ClientID            string `json:"client_id"`
+	RedirectURI         string `json:"redirect_uri"`
+	RedirectURIProvided bool   `json:"redirect_uri_provided,omitempty"`
+	Scope               string `json:"scope"`
+	State               string `json:"state"`
+	CodeChallenge       string `json:"code_challenge"`
+	CodeChallengeMethod string `json:"code_challenge_method"`
+	Prompt              string `json:"prompt,omitempty"`
+	Nonce               string `json:"nonce,omitempty"`
+}
+
+// consentChallenge привязывает форму согласия к пользователю и запросу:
+// без него чужая страница могла бы отправить форму от имени пользователя.
+type consentChallenge struct {
+	UserID  uint             `json:"user_id"`
+	Request authorizeRequest `json:"request"`
+}
+
+func (s *Server) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		s.authorize(w, r)
+	case http.MethodPost:
+		s.consent(w, r)
+	default:
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (s *Server) authorize(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	// Пока клиент и redirect_uri не проверены, перенаправлять нельзя:
+	// ошибка показывается самому пользователю
+	client, redirectURI, err := s.authorizeClient(query.Get("client_id"), query.Get("redirect_uri"))
+	if err != nil {
+		s.logger.Warn("invalid authorization request", "client_id", query.Get("client_id"), "error", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	req := &authorizeRequest{
+		ClientID:            client.ClientID,
+		RedirectURI:         redirectURI,
+		RedirectURIProvided: query.Get("redirect_uri") != "",
+		Scope:               strings.Join(splitList(query.Get("scope")), " "),
+		State:               query.Get("state"),
+		CodeChallenge:       query.Get("code_challenge"),
+		CodeChallengeMethod: query.Get("code_challenge_method"),
+		Prompt:              query.Get("prompt"),
+		Nonce:               query.Get("nonce"),
+	}
+
+	if oauthErr := validateAuthorizeRequest(client, query.Get("response_type"), req); oauthErr != nil {
+		s.redirectError(w, r, req, oauthErr)
+		return
+	}
+
+	if req.Prompt == "login" {
+		s.loginRequired(w, r, req)
+		return
+	}
+
+	user, err := s.currentUser(r)
+	if err != nil {
+		if errors.Is(err, errLoginRequired) {
+			s.loginRequired(w, r, req)
+			return
+		}
+		s.logger.Error("failed to authenticate user", "error", err)
+		s.redirectError(w, r, req, newError("server_error", ""))
+		return
+	}
+
+	consented, err := s.hasConsent(user.ID, client.ClientID, req.Scope)
+	if err != nil {
+		s.logger.Error("failed to get consent", "error", err)
+		s.redirectError(w, r, req, newError("server_error", ""))
+		return
+	}
+
+	if consented && req.Prompt != "consent" {
+		s.issueCode(w, r, req, user)
+		return
+	}
+	if req.Prompt == "none" {
+		s.redirectError(w, r, req, newError("consent_required", ""))
+		return
+	}
+
+	s.renderConsent(w, r, client, req, user)
+}
+
+// consent обрабатывает ответ пользователя на форму согласия.
+func (s *Server) consent(w http.ResponseWriter, r *http.Request) {
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "invalid form", http.StatusBadRequest)
+		return
+	}
+
+	challenge, err := s.takeConsentChallenge(r.PostForm.Get("consent_challenge"))
+	if err != nil {
+		if !errors.Is(err, redis.ErrNotFound) {
+			s.logger.Error("failed to load consent challenge", "error", err)
+		}
+		http.Error(w, "consent request has expired, start over", http.StatusBadRequest)
+		return
+	}
+	req := &challenge.Request
+
+	user, err := s.currentUser(r)
+	if err != nil || user.ID != challenge.UserID {
+		s.logger.Warn("consent submitted by another session", "user_id", challenge.UserID)
+		http.Error(w, "consent request does not belong to the current user", http.StatusForbidden)
+		return
+	}
+
+	if r.PostForm.Get("decision") != "allow" {
+		s.logger.Info("consent denied", "user_id", user.ID, "client_id", req.ClientID)
+		s.redirectError(w, r, req, newError("access_denied", "the user denied the request"))
+		return
+	}
+
+	// Новые scope добавляются к уже выданному согласию
+	scope := req.Scope
+	if existing, err := s.storage.GetOAuthConsent(user.ID, req.ClientID); err == nil {
+		scope = mergeLists(existing.Scope, req.Scope)
+	} else if !errors.Is(err, gorm.ErrRecordNotFound) {
+		s.logger.Error("failed to get consent", "error", err)
+		s.redirectError(w, r, req, newError("server_error", ""))
+		return
+	}
+
+	if err := s.storage.SaveOAuthConsent(user.ID, req.ClientID, scope); err != nil {
+		s.logger.Error("failed to save consent", "error", err)
+		s.redirectError(w, r, req, newError("server_error", ""))
+		return
+	}
+
+	s.logger.Info("consent granted", "user_id", user.ID, "client_id", req.ClientID, "scope", req.Scope)
+	s.issueCode(w, r, req, user)
+}
+
+// authorizeClient находит клиента и проверяет redirect_uri на точное
+// совпадение с зарегистрированным. Если redirect_uri не передан, берется
+// единственный зарегистрированный.
+func (s *Server) authorizeClient(clientID, redirectURI string) (*entity.OAuthClient, string, error) {
+	if clientID == "" {
+		return nil, "", errors.New("client_id is required")
+	}
+
+	client, err := s.storage.GetOAuthClient(clientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, "", errors.New("unknown client")
+		}
+		return nil, "", err
+	}
+
+	registered := splitList(client.RedirectURIs)
+	if redirectURI == "" {
+		if len(registered) != 1 {
+			return nil, "", errors.New("redirect_uri is required")
+		}
+		return client, registered[0], nil
+	}
+
+	if !contains(client.RedirectURIs, redirectURI) {
+		return nil, "", errors.New("redirect_uri is not registered for this client")
+	}
+
+	return client, redirectURI, nil
+}
+
+func validateAuthorizeRequest(client *entity.OAuthClient, responseType string, req *authorizeRequest) *Error {
+	if responseType != "code" {
+		return newError("unsupported_response_type", "only response_type=code is supported")
+	}
+	if !contains(client.GrantTypes, GrantAuthorizationCode) {
+		return newError("unauthorized_client", "client may not use the authorization code grant")
+	}
+	if !containsAll(client.Scopes, req.Scope) {
+		return newError("invalid_scope", "requested scope is not allowed for this client")
+	}
+
+	// PKCE обязателен для всех клиентов, plain не принимается
+	if req.CodeChallenge == "" {
+		return newError("invalid_request", "code_challenge is required")
+	}
+	if req.CodeChallengeMethod != codeChallengeMethodS256 {
+		return newError("invalid_request", "code_challenge_method must be S256")
+	}
+
+	if len(req.Nonce) > maxNonceLength {
+		return newError("invalid_request", "nonce is too long")
+	}
+
+	switch req.Prompt {
+	case "", "none", "consent", "login":
+	default:
+		return newError("invalid_request", "unsupported prompt value")
+	}
+
+	return nil
+}
+
+// currentUser определяет пользователя по access-токену из заголовка
+// Authorization или из cookie сессии.
+func (s *Server) currentUser(r *http.Request) (*entity.User, error) {
+	raw, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found && s.cfg.OAuthConfig.SessionCookie != "" {
+		if cookie, err := r.Cookie(s.cfg.OAuthConfig.SessionCookie); err == nil {
+			raw = cookie.Value
+		}
+	}
+	if raw == "" {
+		return nil, errLoginRequired
+	}
+
+	claims, err := s.tokens.Parse(raw)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrTokenRevoked) {
+			return nil, errLoginRequired
+		}
+		return nil, err
+	}
+
+	// Токен, выданный другому OAuth-клиенту, не является сессией
+	if claims.ClientID != "" {
+		return nil, errLoginRequired
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		return nil, errLoginRequired
+	}
+
+	return s.storage.GetUserByID(userID)
+}
+
+func (s *Server) loginRequired(w http.ResponseWriter, r *http.Request, req *authorizeRequest) {
+	if req.Prompt == "none" || s.cfg.OAuthConfig.LoginURL == "" {
+		s.redirectError(w, r, req, newError("login_required", ""))
+		return
+	}
+
+	// После входа страница логина возвращает пользователя на тот же
+	// запрос. prompt=login снимается, иначе вход потребуется снова.
+	query := r.URL.Query()
+	query.Del("prompt")
+	returnTo := *r.URL
+	returnTo.RawQuery = query.Encode()
+
+	loginURL, err := url.Parse(s.cfg.OAuthConfig.LoginURL)
+	if err != nil {
+		s.logger.Error("invalid login url", "error", err)
+		s.redirectError(w, r, req, newError("server_error", ""))
+		return
+	}
+	params := loginURL.Query()
+	params.Set("return_to", returnTo.RequestURI())
+	loginURL.RawQuery = params.Encode()
+
+	http.Redirect(w, r, loginURL.String(), http.StatusFound)
+}
+
+func (s *Server) hasConsent(userID uint, clientID, scope string) (bool, error) {
+	consent, err := s.storage.GetOAuthConsent(userID, clientID)
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	return containsAll(consent.Scope, scope), nil
+}
+
+func (s *Server) issueCode(w http.ResponseWriter, r *http.Request, req *authorizeRequest, user *entity.User) {
+	code, err := token.RandomString(32)
+	if err != nil {
+		s.logger.Error("failed to generate authorization code", "error", err)
+		s.redirectError(w, r, req, newError("server_error", ""))
+		return
+	}
+
+	familyID, err := token.RandomString(16)
+	if err != nil {
+		s.logger.Error("failed to generate token family", "error", err)
+		s.redirectError(w, r, req, newError("server_error", ""))
+		return
+	}
+
+	err = s.storage.SaveAuthorizationCode(&entity.AuthorizationCode{
+		CodeHash:            token.Hash(code),
+		ClientID:            req.ClientID,
+		UserID:              user.ID,
+		RedirectURI:         req.RedirectURI,
+		RedirectURIProvided: req.RedirectURIProvided,
+		Scope:               req.Scope,
+		CodeChallenge:       req.CodeChallenge,
+		CodeChallengeMethod: req.CodeChallengeMethod,
+		Nonce:               req.Nonce,
+		FamilyID:            familyID,
+		ExpiresAt:           time.Now().Add(AuthorizationCodeExpiration),
+	})
+	if err != nil {
+		s.logger.Error("failed to save authorization code", "error", err)
+		s.redirectError(w, r, req, newError("server_error", ""))
+		return
+	}
+
+	s.logger.Info("authorization code issued", "user_id", user.ID, "client_id", req.ClientID)
+	s.redirect(w, r, req, url.Values{"code": {code}})
+}
+
+// redirectError возвращает ошибку клиенту через redirect_uri.
+func (s *Server) redirectError(w http.ResponseWriter, r *http.Request, req *authorizeRequest, oauthErr *Error) {
+	params := url.Values{"error": {oauthErr.Code}}
+	if oauthErr.Description != "" {
+		params.Set("error_description", oauthErr.Description)
+	}
+	s.redirect(w, r, req, params)
+}
+
+func (s *Server) redirect(w http.ResponseWriter, r *http.Request, req *authorizeRequest, params url.Values) {
+	target, err := url.Parse(req.RedirectURI)
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	query := target.Query()
+	for key, values := range params {
+		query[key] = values
+	}
+	if req.State != "" {
+		query.Set("state", req.State)
+	}
+	// RFC 9207: клиент сверяет iss, чтобы не перепутать серверы авторизации
+	if s.cfg.JWTConfig.Issuer != "" {
+		query.Set("iss", s.cfg.JWTConfig.Issuer)
+	}
+	target.RawQuery = query.Encode()
+
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+var consentTemplate = template.Must(template.New("consent").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Authorize {{.Client}}</title></head>
+<body>
+<p><b>{{.Client}}</b> requests access to your account <b>{{.Username}}</b>.</p>
+{{if .Scopes}}<ul>{{range .Scopes}}<li>{{.}}</li>{{end}}</ul>{{end}}
+<form method="post" action="/authorize">
+<input type="hidden" name="consent_challenge" value="{{.Challenge}}">
+<button type="submit" name="decision" value="allow">Allow</button>
+<button type="submit" name="decision" value="deny">Deny</button>
+</form>
+</body>
+</html>
+`))
+
+func (s *Server) renderConsent(w http.ResponseWriter, r *http.Request, client *entity.OAuthClient, req *authorizeRequest, user *entity.User) {
+	challenge, err := s.saveConsentChallenge(&consentChallenge{UserID: user.ID, Request: *req})
+	if err != nil {
+		s.logger.Error("failed to save consent challenge", "error", err)
+		s.redirectError(w, r, req, newError("server_error", ""))
+		return
+	}
+
+	name := client.Name
+	if name == "" {
+		name = client.ClientID
+	}
+
+	// Форму согласия нельзя встраивать в чужие страницы (clickjacking)
+	w.Header().Set("X-Frame-Options", "DENY")
+	w.Header().Set("Content-Security-Policy", "frame-ancestors 'none'")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+
+	err = consentTemplate.Execute(w, map[string]interface{}{
+		"Client":    name,
+		"Username":  user.UserName,
+		"Scopes":    splitList(req.Scope),
+		"Challenge": challenge,
+	})
+	if err != nil {
+		s.logger.Error("failed to render consent page", "error", err)
+	}
+}
+
+func (s *Server) saveConsentChallenge(challenge *consentChallenge) (string, error) {
+	id, err := token.RandomString(32)
+	if err != nil {
+		return "", err
+	}
+
+	data, err := json.Marshal(challenge)
+	if err != nil {
+		return "", err
+	}
+
+	if err := s.cache.Put(consentChallengePrefix+id, string(data), consentChallengeExpiration); err != nil {
+		return "", err
+	}
+
+	return id, nil
+}
+
+func (s *Server) takeConsentChallenge(id string) (*consentChallenge, error) {
+	if id == "" {
+		return nil, redis.ErrNotFound
+	}
+
+	// Атомарно: одно согласие не выпустит два кода при параллельной отправке
+	data, err := s.cache.Take(consentChallengePrefix + id)
+	if err != nil {
+		return nil, err
+	}
+
+	var challenge consentChallenge
+	if err := json.Unmarshal([]byte(data), &challenge); err != nil {
+		return nil, err
+	}
+
+	return &challenge, nil
+}
+
+// verifyCodeChallenge проверяет code_verifier по RFC 7636.
+func verifyCodeChallenge(challenge, method, verifier string) bool {
+	if method != codeChallengeMethodS256 || len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:]) == challenge
+}
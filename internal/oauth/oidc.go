@@ -0,0 +1,148 @@
+package oauth
+
+import (
+	"auth/internal/entity"
+	"auth/internal/token"
+	"errors"
+	"net/http"
+	"strings"
+)
+
+// Scope OpenID Connect.
+const (
+	ScopeOpenID  = "openid"
+	ScopeProfile = "profile"
+	ScopeEmail   = "email"
+)
+
+// maxNonceLength ограничивает nonce, который попадает в ID Token как есть.
+const maxNonceLength = 512
+
+// discoveryDocument - метаданные провайдера (OpenID Connect Discovery 1.0).
+type discoveryDocument struct {
+	Issuer                            string   `json:"issuer"`
+	AuthorizationEndpoint             string   `json:"authorization_endpoint"`
+	TokenEndpoint                     string   `json:"token_endpoint"`
+	UserinfoEndpoint                  string   `json:"userinfo_endpoint"`
+	JWKSURI                           string   `json:"jwks_uri"`
+	ScopesSupported                   []string `json:"scopes_supported"`
+	ResponseTypesSupported            []string `json:"response_types_supported"`
+	GrantTypesSupported               []string `json:"grant_types_supported"`
+	SubjectTypesSupported             []string `json:"subject_types_supported"`
+	IDTokenSigningAlgValuesSupported  []string `json:"id_token_signing_alg_values_supported"`
+	TokenEndpointAuthMethodsSupported []string `json:"token_endpoint_auth_methods_supported"`
+	CodeChallengeMethodsSupported     []string `json:"code_challenge_methods_supported"`
+	ClaimsSupported                   []string `json:"claims_supported"`
+	PromptValuesSupported             []string `json:"prompt_values_supported"`
+	AuthorizationResponseIssParameter bool     `json:"authorization_response_iss_parameter_supported"`
+}
+
+// userInfo - ответ /userinfo.
+type userInfo struct {
+	Subject string `json:"sub"`
+	token.ProfileClaims
+}
+
+func (s *Server) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		w.Header().Set("Allow", "GET")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	issuer := strings.TrimSuffix(s.cfg.JWTConfig.Issuer, "/")
+	document := &discoveryDocument{
+		Issuer:                            s.cfg.JWTConfig.Issuer,
+		AuthorizationEndpoint:             issuer + "/authorize",
+		TokenEndpoint:                     issuer + "/token",
+		UserinfoEndpoint:                  issuer + "/userinfo",
+		JWKSURI:                           issuer + "/.well-known/jwks.json",
+		ScopesSupported:                   []string{ScopeOpenID, ScopeProfile, ScopeEmail},
+		ResponseTypesSupported:            []string{"code"},
+		GrantTypesSupported:               []string{GrantAuthorizationCode, GrantRefreshToken, GrantClientCredentials},
+		SubjectTypesSupported:             []string{"public"},
+		IDTokenSigningAlgValuesSupported:  []string{s.cfg.JWTConfig.Algorithm},
+		TokenEndpointAuthMethodsSupported: []string{"client_secret_basic", "client_secret_post", "none"},
+		CodeChallengeMethodsSupported:     []string{codeChallengeMethodS256},
+		ClaimsSupported:                   []string{"sub", "iss", "aud", "exp", "iat", "nonce", "azp", "email", "email_verified", "preferred_username"},
+		PromptValuesSupported:             []string{"none", "login", "consent"},
+		AuthorizationResponseIssParameter: true,
+	}
+
+	writeJSON(w, http.StatusOK, document)
+}
+
+// handleUserInfo отдает claims пользователя по access-токену, выданному
+// клиенту со scope openid.
+func (s *Server) handleUserInfo(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		w.Header().Set("Allow", "GET, POST")
+		http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	raw, found := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !found || raw == "" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="userinfo"`)
+		writeJSON(w, http.StatusUnauthorized, newError("invalid_request", "missing bearer token"))
+		return
+	}
+
+	claims, err := s.tokens.Parse(raw)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidToken) || errors.Is(err, token.ErrTokenRevoked) {
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			writeJSON(w, http.StatusUnauthorized, newError("invalid_token", ""))
+			return
+		}
+		s.logger.Error("failed to validate token", "error", err)
+		writeJSON(w, http.StatusInternalServerError, newError("server_error", ""))
+		return
+	}
+
+	if claims.ClientID == "" || !contains(claims.Scope, ScopeOpenID) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="insufficient_scope", scope="openid"`)
+		writeJSON(w, http.StatusForbidden, newError("insufficient_scope", ""))
+		return
+	}
+
+	userID, err := claims.UserID()
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, newError("invalid_token", ""))
+		return
+	}
+
+	user, err := s.storage.GetUserByID(userID)
+	if err != nil {
+		s.logger.Error("failed to get user", "error", err)
+		writeJSON(w, http.StatusInternalServerError, newError("server_error", ""))
+		return
+	}
+
+	writeJSON(w, http.StatusOK, &userInfo{
+		Subject:       claims.Subject,
+		ProfileClaims: profileClaims(user, claims.Scope),
+	})
+}
+
+// profileClaims заполняет claims, на которые у клиента есть scope.
+func profileClaims(user *entity.User, scope string) token.ProfileClaims {
+	var profile token.ProfileClaims
+	if contains(scope, ScopeEmail) {
+		verified := user.EmailVerified
+		profile.Email = user.Email
+		profile.EmailVerified = &verified
+	}
+	if contains(scope, ScopeProfile) {
+		profile.PreferredUsername = user.UserName
+	}
+	return profile
+}
+
+// idToken выдает ID Token, если клиенту выдан scope openid.
+func (s *Server) idToken(user *entity.User, clientID, scope, nonce string) (string, error) {
+	if !contains(scope, ScopeOpenID) {
+		return "", nil
+	}
+	return s.tokens.IssueIDToken(user, clientID, nonce, profileClaims(user, scope))
+}
@@ -0,0 +1,245 @@
+package oauth
+
+import (
+	"auth/internal/token"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func TestDiscovery(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp, err := http.Get(ts.URL + "/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusOK)
+	}
+
+	var document discoveryDocument
+	if err := json.NewDecoder(resp.Body).Decode(&document); err != nil {
+		t.Fatalf("decode discovery document: %v", err)
+	}
+
+	endpoints := map[string]string{
+		"issuer":                 document.Issuer,
+		"authorization_endpoint": document.AuthorizationEndpoint,
+		"token_endpoint":         document.TokenEndpoint,
+		"userinfo_endpoint":      document.UserinfoEndpoint,
+		"jwks_uri":               document.JWKSURI,
+	}
+	want := map[string]string{
+		"issuer":                 testIssuer,
+		"authorization_endpoint": testIssuer + "/authorize",
+		"token_endpoint":         testIssuer + "/token",
+		"userinfo_endpoint":      testIssuer + "/userinfo",
+		"jwks_uri":               testIssuer + "/.well-known/jwks.json",
+	}
+	for name, value := range want {
+		if endpoints[name] != value {
+			t.Errorf("%s = %q, want %q", name, endpoints[name], value)
+		}
+	}
+	if len(document.IDTokenSigningAlgValuesSupported) != 1 || document.IDTokenSigningAlgValuesSupported[0] != "ES256" {
+		t.Errorf("id_token_signing_alg_values_supported = %v", document.IDTokenSigningAlgValuesSupported)
+	}
+	if len(document.CodeChallengeMethodsSupported) != 1 || document.CodeChallengeMethodsSupported[0] != codeChallengeMethodS256 {
+		t.Errorf("code_challenge_methods_supported = %v", document.CodeChallengeMethodsSupported)
+	}
+
+	post, err := http.Post(ts.URL+"/.well-known/openid-configuration", "application/json", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	post.Body.Close()
+	if post.StatusCode != http.StatusMethodNotAllowed {
+		t.Errorf("POST status = %d, want %d", post.StatusCode, http.StatusMethodNotAllowed)
+	}
+}
+
+// parseIDToken проверяет подпись, издателя и аудиторию ID Token.
+func (ts *testServer) parseIDToken(t *testing.T, raw string) *token.IDClaims {
+	t.Helper()
+
+	claims := &token.IDClaims{}
+	_, err := jwt.ParseWithClaims(raw, claims, ts.keys.Keyfunc,
+		jwt.WithIssuer(testIssuer),
+		jwt.WithAudience("public-app"),
+		jwt.WithExpirationRequired(),
+	)
+	if err != nil {
+		t.Fatalf("parse id token: %v", err)
+	}
+	return claims
+}
+
+func TestIDToken(t *testing.T) {
+	ts := newTestServer(t)
+
+	result := ts.token(t, exchangeForm(ts.issueCode(t), testVerifier))
+	if result.status != http.StatusOK {
+		t.Fatalf("status = %d, error = %q", result.status, result.Error)
+	}
+
+	claims := ts.parseIDToken(t, result.IDToken)
+	if claims.Subject != fmt.Sprint(ts.user.ID) {
+		t.Errorf("sub = %q, want %d", claims.Subject, ts.user.ID)
+	}
+	if claims.Nonce != authorizeQuery().Get("nonce") {
+		t.Errorf("nonce = %q, want %q", claims.Nonce, authorizeQuery().Get("nonce"))
+	}
+	if claims.AuthorizedParty != "public-app" {
+		t.Errorf("azp = %q, want public-app", claims.AuthorizedParty)
+	}
+	// Запрошены openid и email, поэтому имени пользователя в токене нет
+	if claims.Email != ts.user.Email || claims.EmailVerified == nil || !*claims.EmailVerified {
+		t.Errorf("email = %q, email_verified = %v", claims.Email, claims.EmailVerified)
+	}
+	if claims.PreferredUsername != "" {
+		t.Errorf("preferred_username = %q without profile scope", claims.PreferredUsername)
+	}
+
+	// ID Token выдан клиенту и не принимается как access-токен
+	if _, err := ts.tokens.Parse(result.IDToken); err == nil {
+		t.Error("id token accepted as an access token")
+	}
+}
+
+func TestIDTokenRequiresOpenIDScope(t *testing.T) {
+	ts := newTestServer(t)
+	if err := ts.storage.SaveOAuthConsent(ts.user.ID, "public-app", "profile email"); err != nil {
+		t.Fatal(err)
+	}
+
+	query := authorizeQuery()
+	query.Set("scope", "profile email")
+	resp := ts.authorize(t, query)
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in redirect %s", location)
+	}
+
+	result := ts.token(t, exchangeForm(code, testVerifier))
+	if result.status != http.StatusOK {
+		t.Fatalf("status = %d, error = %q", result.status, result.Error)
+	}
+	if result.IDToken != "" {
+		t.Error("id token issued without openid scope")
+	}
+}
+
+func TestProfileClaims(t *testing.T) {
+	ts := newTestServer(t)
+
+	tests := []struct {
+		scope        string
+		wantEmail    bool
+		wantUsername bool
+	}{
+		{scope: "openid"},
+		{scope: "openid email", wantEmail: true},
+		{scope: "openid profile", wantUsername: true},
+		{scope: "openid profile email", wantEmail: true, wantUsername: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.scope, func(t *testing.T) {
+			profile := profileClaims(ts.user, tt.scope)
+			if hasEmail := profile.Email != "" && profile.EmailVerified != nil; hasEmail != tt.wantEmail {
+				t.Errorf("email claims present = %v, want %v", hasEmail, tt.wantEmail)
+			}
+			if hasUsername := profile.PreferredUsername != ""; hasUsername != tt.wantUsername {
+				t.Errorf("preferred_username present = %v, want %v", hasUsername, tt.wantUsername)
+			}
+		})
+	}
+}
+
+func TestUserInfo(t *testing.T) {
+	ts := newTestServer(t)
+
+	grant := func(scope string) string {
+		pair, err := ts.tokens.IssueGrant(ts.user, token.Grant{ClientID: "public-app", Scope: scope})
+		if err != nil {
+			t.Fatalf("IssueGrant: %v", err)
+		}
+		return pair.AccessToken
+	}
+	clientToken, err := ts.tokens.IssueClientToken("service", "openid")
+	if err != nil {
+		t.Fatalf("IssueClientToken: %v", err)
+	}
+	revoked := grant("openid email")
+	if err := ts.tokens.RevokeAccessToken(revoked); err != nil {
+		t.Fatalf("RevokeAccessToken: %v", err)
+	}
+
+	tests := []struct {
+		name       string
+		method     string
+		token      string
+		wantStatus int
+		wantEmail  string
+	}{
+		{name: "openid email", method: http.MethodGet, token: grant("openid email"), wantStatus: http.StatusOK, wantEmail: ts.user.Email},
+		{name: "post", method: http.MethodPost, token: grant("openid email"), wantStatus: http.StatusOK, wantEmail: ts.user.Email},
+		{name: "openid only", method: http.MethodGet, token: grant("openid"), wantStatus: http.StatusOK},
+		{name: "no bearer token", method: http.MethodGet, wantStatus: http.StatusUnauthorized},
+		{name: "malformed token", method: http.MethodGet, token: "not-a-token", wantStatus: http.StatusUnauthorized},
+		{name: "revoked token", method: http.MethodGet, token: revoked, wantStatus: http.StatusUnauthorized},
+		{name: "without openid scope", method: http.MethodGet, token: grant("email"), wantStatus: http.StatusForbidden},
+		{name: "own session token", method: http.MethodGet, token: ts.session, wantStatus: http.StatusForbidden},
+		{name: "client credentials token", method: http.MethodGet, token: clientToken, wantStatus: http.StatusUnauthorized},
+		{name: "unsupported method", method: http.MethodPut, token: grant("openid"), wantStatus: http.StatusMethodNotAllowed},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, ts.URL+"/userinfo", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if tt.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tt.token)
+			}
+
+			resp, err := http.DefaultClient.Do(req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer resp.Body.Close()
+
+			if resp.StatusCode != tt.wantStatus {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, tt.wantStatus)
+			}
+			if resp.StatusCode == http.StatusUnauthorized && resp.Header.Get("WWW-Authenticate") == "" {
+				t.Error("401 without WWW-Authenticate")
+			}
+			if resp.StatusCode != http.StatusOK {
+				return
+			}
+
+			var info userInfo
+			if err := json.NewDecoder(resp.Body).Decode(&info); err != nil {
+				t.Fatalf("decode userinfo: %v", err)
+			}
+			if info.Subject != fmt.Sprint(ts.user.ID) {
+				t.Errorf("sub = %q, want %d", info.Subject, ts.user.ID)
+			}
+			if info.Email != tt.wantEmail {
+				t.Errorf("email = %q, want %q", info.Email, tt.wantEmail)
+			}
+		})
+	}
+}
@@ -0,0 +1,137 @@
+package oauth
+
+import (
+	"auth/internal/config"
+	"auth/internal/redis"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strings"
+)
+
+// Типы грантов, которые поддерживает /token.
+const (
+	GrantAuthorizationCode = "authorization_code"
+	GrantRefreshToken      = "refresh_token"
+	GrantClientCredentials = "client_credentials"
+)
+
+// Server - сервер авторизации OAuth 2.0 поверх общего хранилища
+// пользователей и подписи токенов.
+type Server struct {
+	cfg     *config.Config
+	storage postgres.Storage
+	tokens  *token.Manager
+	cache   redis.Redis
+	logger  *slog.Logger
+	mux     *http.ServeMux
+}
+
+func NewServer(cfg *config.Config, storage postgres.Storage, tokens *token.Manager, cache redis.Redis, logger *slog.Logger) *Server {
+	s := &Server{
+		cfg:     cfg,
+		storage: storage,
+		tokens:  tokens,
+		cache:   cache,
+		logger:  logger,
+		mux:     http.NewServeMux(),
+	}
+
+	s.mux.HandleFunc("/authorize", s.handleAuthorize)
+	s.mux.HandleFunc("/token", s.handleToken)
+	s.mux.HandleFunc("/userinfo", s.handleUserInfo)
+	s.mux.HandleFunc("/.well-known/openid-configuration", s.handleDiscovery)
+
+	return s
+}
+
+// ServeHTTP позволяет поднять сервер целиком, например через httptest.NewServer.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// RegisterRoutes регистрирует эндпоинты сервера на общем mux.
+func (s *Server) RegisterRoutes(mux *http.ServeMux) {
+	mux.Handle("/authorize", s)
+	mux.Handle("/token", s)
+	mux.Handle("/userinfo", s)
+	mux.Handle("/.well-known/openid-configuration", s)
+}
+
+// Error - ошибка протокола OAuth (RFC 6749, раздел 5.2).
+type Error struct {
+	Code        string `json:"error"`
+	Description string `json:"error_description,omitempty"`
+	status      int
+}
+
+func (e *Error) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return e.Code + ": " + e.Description
+}
+
+func newError(code, description string) *Error {
+	return &Error{Code: code, Description: description, status: http.StatusBadRequest}
+}
+
+func errInvalidClient() *Error {
+	return &Error{Code: "invalid_client", Description: "client authentication failed", status: http.StatusUnauthorized}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+	w.WriteHeader(status)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, err *Error) {
+	if err.status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Basic realm="oauth"`)
+	}
+	writeJSON(w, err.status, err)
+}
+
+// Списки в OAuth (scope, redirect_uri клиента и т.п.) разделяются пробелами.
+
+func splitList(s string) []string {
+	return strings.Fields(s)
+}
+
+func contains(list string, value string) bool {
+	for _, v := range splitList(list) {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+// containsAll сообщает, входят ли все элементы requested в allowed.
+func containsAll(allowed, requested string) bool {
+	for _, v := range splitList(requested) {
+		if !contains(allowed, v) {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeLists объединяет списки без повторов, сохраняя порядок.
+func mergeLists(a, b string) string {
+	seen := make(map[string]struct{})
+	var merged []string
+	for _, v := range append(splitList(a), splitList(b)...) {
+		if _, ok := seen[v]; ok {
+			continue
+		}
+		seen[v] = struct{}{}
+		merged = append(merged, v)
+	}
+	return strings.Join(merged, " ")
+}
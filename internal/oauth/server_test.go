@@ -0,0 +1,853 @@
+package oauth
+
+import (
+	"auth/internal/config"
+	"auth/internal/entity"
+	"auth/internal/keyring"
+	"auth/internal/redis"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+const (
+	testIssuer       = "https://auth.test"
+	testRedirectURI  = "https://app.test/callback"
+	testClientSecret = "confidential-secret"
+	testVerifier     = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+)
+
+// memoryStorage хранит в памяти только то, что нужно серверу OAuth.
+// Остальные методы Storage не реализованы и паникуют при вызове.
+type memoryStorage struct {
+	postgres.Storage
+
+	mu       sync.Mutex
+	nextID   uint
+	users    map[uint]*entity.User
+	clients  map[string]*entity.OAuthClient
+	consents map[string]string
+	codes    map[string]*entity.AuthorizationCode
+	refresh  map[string]*entity.RefreshToken
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		users:    make(map[uint]*entity.User),
+		clients:  make(map[string]*entity.OAuthClient),
+		consents: make(map[string]string),
+		codes:    make(map[string]*entity.AuthorizationCode),
+		refresh:  make(map[string]*entity.RefreshToken),
+	}
+}
+
+func (m *memoryStorage) id() uint {
+	m.nextID++
+	return m.nextID
+}
+
+func (m *memoryStorage) GetUserByID(id uint) (*entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (m *memoryStorage) GetUserRoles(userID uint) ([]entity.Role, error) {
+	return nil, nil
+}
+
+func (m *memoryStorage) ListMemberships(userID uint) ([]entity.Membership, error) {
+	return nil, nil
+}
+
+func (m *memoryStorage) GetOAuthClient(clientID string) (*entity.OAuthClient, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	client, ok := m.clients[clientID]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *client
+	return &copied, nil
+}
+
+func (m *memoryStorage) GetOAuthConsent(userID uint, clientID string) (*entity.OAuthConsent, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	scope, ok := m.consents[fmt.Sprint(userID, "/", clientID)]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	return &entity.OAuthConsent{UserID: userID, ClientID: clientID, Scope: scope}, nil
+}
+
+func (m *memoryStorage) SaveOAuthConsent(userID uint, clientID string, scope string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.consents[fmt.Sprint(userID, "/", clientID)] = scope
+	return nil
+}
+
+func (m *memoryStorage) SaveAuthorizationCode(code *entity.AuthorizationCode) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	copied := *code
+	copied.ID = m.id()
+	m.codes[code.CodeHash] = &copied
+	return nil
+}
+
+func (m *memoryStorage) GetAuthorizationCode(codeHash string) (*entity.AuthorizationCode, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	code, ok := m.codes[codeHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *code
+	return &copied, nil
+}
+
+func (m *memoryStorage) MarkAuthorizationCodeUsed(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, code := range m.codes {
+		if code.ID != id {
+			continue
+		}
+		if code.UsedAt != nil {
+			return postgres.ErrAuthorizationCodeUsed
+		}
+		now := time.Now()
+		code.UsedAt = &now
+		return nil
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) SaveRefreshToken(userID uint, familyID string, clientID string, organizationID uint, scope string, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored := &entity.RefreshToken{
+		UserID:         userID,
+		FamilyID:       familyID,
+		ClientID:       clientID,
+		OrganizationID: organizationID,
+		Scope:          scope,
+		TokenHash:      tokenHash,
+		ExpiresAt:      expiresAt,
+	}
+	stored.ID = m.id()
+	m.refresh[tokenHash] = stored
+	return nil
+}
+
+func (m *memoryStorage) GetRefreshToken(tokenHash string) (*entity.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.refresh[tokenHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+func (m *memoryStorage) MarkRefreshTokenUsed(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, stored := range m.refresh {
+		if stored.ID != id {
+			continue
+		}
+		if stored.UsedAt != nil {
+			return postgres.ErrRefreshTokenAlreadyUsed
+		}
+		now := time.Now()
+		stored.UsedAt = &now
+		return nil
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) RevokeRefreshTokenFamily(familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, stored := range m.refresh {
+		if stored.FamilyID == familyID && stored.RevokedAt == nil {
+			stored.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+type testServer struct {
+	*httptest.Server
+	storage *memoryStorage
+	tokens  *token.Manager
+	keys    *keyring.KeyRing
+	user    *entity.User
+	session string
+}
+
+func newTestServer(t *testing.T) *testServer {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{}
+	cfg.JWTConfig.Algorithm = keyring.AlgorithmES256
+	cfg.JWTConfig.Issuer = testIssuer
+	cfg.JWTConfig.Audience = "auth"
+
+	keys, err := keyring.New(cfg.JWTConfig.Algorithm, "", time.Hour, logger)
+	if err != nil {
+		t.Fatalf("keyring.New: %v", err)
+	}
+
+	storage := newMemoryStorage()
+	user := &entity.User{UserName: "alice", Email: "alice@example.com", EmailVerified: true}
+	user.ID = storage.id()
+	storage.users[user.ID] = user
+
+	storage.clients["public-app"] = &entity.OAuthClient{
+		ClientID:     "public-app",
+		RedirectURIs: testRedirectURI + " https://app.test/other",
+		GrantTypes:   GrantAuthorizationCode + " " + GrantRefreshToken,
+		Scopes:       "openid profile email",
+		Public:       true,
+	}
+	storage.clients["service"] = &entity.OAuthClient{
+		ClientID:   "service",
+		SecretHash: token.Hash(testClientSecret),
+		GrantTypes: GrantClientCredentials,
+		Scopes:     "reports:read reports:write",
+	}
+
+	tokens := token.NewManager(cfg, storage, keys, redis.NewInMemory(), logger)
+	pair, err := tokens.Issue(user)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	server := httptest.NewServer(NewServer(cfg, storage, tokens, redis.NewInMemory(), logger))
+	t.Cleanup(server.Close)
+
+	return &testServer{
+		Server:  server,
+		storage: storage,
+		tokens:  tokens,
+		keys:    keys,
+		user:    user,
+		session: pair.AccessToken,
+	}
+}
+
+func codeChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func authorizeQuery() url.Values {
+	return url.Values{
+		"response_type":         {"code"},
+		"client_id":             {"public-app"},
+		"redirect_uri":          {testRedirectURI},
+		"scope":                 {"openid email"},
+		"state":                 {"xyz"},
+		"nonce":                 {"n-0S6_WzA2Mj"},
+		"code_challenge":        {codeChallenge(testVerifier)},
+		"code_challenge_method": {codeChallengeMethodS256},
+	}
+}
+
+// authorize выполняет GET /authorize от имени пользователя и не следует
+// за перенаправлением.
+func (ts *testServer) authorize(t *testing.T, query url.Values) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodGet, ts.URL+"/authorize?"+query.Encode(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer "+ts.session)
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { resp.Body.Close() })
+	return resp
+}
+
+// issueCode получает код авторизации для public-app с уже выданным согласием.
+func (ts *testServer) issueCode(t *testing.T) string {
+	t.Helper()
+
+	if err := ts.storage.SaveOAuthConsent(ts.user.ID, "public-app", "openid profile email"); err != nil {
+		t.Fatal(err)
+	}
+	resp := ts.authorize(t, authorizeQuery())
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		t.Fatalf("no code in redirect %s", location)
+	}
+	return code
+}
+
+type tokenResult struct {
+	status int
+	tokenResponse
+	Error string `json:"error"`
+}
+
+func (ts *testServer) token(t *testing.T, form url.Values, basic ...string) tokenResult {
+	t.Helper()
+
+	req, err := http.NewRequest(http.MethodPost, ts.URL+"/token", strings.NewReader(form.Encode()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if len(basic) == 2 {
+		req.SetBasicAuth(basic[0], basic[1])
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+
+	result := tokenResult{status: resp.StatusCode}
+	if err := json.NewDecoder(resp.Body).Decode(&result); err != nil {
+		t.Fatalf("decode token response: %v", err)
+	}
+	return result
+}
+
+func exchangeForm(code, verifier string) url.Values {
+	return url.Values{
+		"grant_type":    {GrantAuthorizationCode},
+		"client_id":     {"public-app"},
+		"code":          {code},
+		"redirect_uri":  {testRedirectURI},
+		"code_verifier": {verifier},
+	}
+}
+
+func TestAuthorizeIssuesCode(t *testing.T) {
+	ts := newTestServer(t)
+	if err := ts.storage.SaveOAuthConsent(ts.user.ID, "public-app", "openid email"); err != nil {
+		t.Fatal(err)
+	}
+
+	resp := ts.authorize(t, authorizeQuery())
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusFound)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := location.Scheme + "://" + location.Host + location.Path; got != testRedirectURI {
+		t.Errorf("redirected to %s, want %s", got, testRedirectURI)
+	}
+	params := location.Query()
+	if params.Get("state") != "xyz" || params.Get("iss") != testIssuer {
+		t.Errorf("state = %q, iss = %q", params.Get("state"), params.Get("iss"))
+	}
+
+	stored, err := ts.storage.GetAuthorizationCode(token.Hash(params.Get("code")))
+	if err != nil {
+		t.Fatalf("code is not stored: %v", err)
+	}
+	if stored.CodeChallenge != codeChallenge(testVerifier) || stored.CodeChallengeMethod != codeChallengeMethodS256 {
+		t.Errorf("stored challenge = %q %q", stored.CodeChallenge, stored.CodeChallengeMethod)
+	}
+}
+
+func TestAuthorizeRequiresConsent(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp := ts.authorize(t, authorizeQuery())
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("status = %d, want consent page", resp.StatusCode)
+	}
+	if resp.Header.Get("X-Frame-Options") != "DENY" {
+		t.Error("consent page can be framed")
+	}
+}
+
+func TestAuthorizeRejectsRequest(t *testing.T) {
+	tests := []struct {
+		name  string
+		query func(url.Values)
+		error string
+	}{
+		{"missing code_challenge", func(q url.Values) { q.Del("code_challenge") }, "invalid_request"},
+		{"plain challenge method", func(q url.Values) { q.Set("code_challenge_method", "plain") }, "invalid_request"},
+		{"missing challenge method", func(q url.Values) { q.Del("code_challenge_method") }, "invalid_request"},
+		{"token response type", func(q url.Values) { q.Set("response_type", "token") }, "unsupported_response_type"},
+		{"scope not allowed", func(q url.Values) { q.Set("scope", "openid admin") }, "invalid_scope"},
+		{"unknown prompt", func(q url.Values) { q.Set("prompt", "select_account") }, "invalid_request"},
+		{"nonce too long", func(q url.Values) { q.Set("nonce", strings.Repeat("n", maxNonceLength+1)) }, "invalid_request"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			query := authorizeQuery()
+			tt.query(query)
+
+			resp := ts.authorize(t, query)
+			if resp.StatusCode != http.StatusFound {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusFound)
+			}
+			location, err := url.Parse(resp.Header.Get("Location"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := location.Query().Get("error"); got != tt.error {
+				t.Errorf("error = %q, want %q", got, tt.error)
+			}
+			if location.Query().Get("code") != "" {
+				t.Error("code issued for invalid request")
+			}
+		})
+	}
+}
+
+func TestAuthorizeRedirectURIMismatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		redirectURI string
+	}{
+		{"unregistered", "https://evil.test/callback"},
+		{"prefix of registered", "https://app.test/call"},
+		{"extra query", testRedirectURI + "?next=/"},
+		{"missing with several registered", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			query := authorizeQuery()
+			query.Set("redirect_uri", tt.redirectURI)
+
+			// На непроверенный redirect_uri перенаправлять нельзя
+			resp := ts.authorize(t, query)
+			if resp.StatusCode != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", resp.StatusCode, http.StatusBadRequest)
+			}
+			if location := resp.Header.Get("Location"); location != "" {
+				t.Errorf("redirected to %s", location)
+			}
+		})
+	}
+}
+
+func TestTokenAuthorizationCode(t *testing.T) {
+	ts := newTestServer(t)
+	code := ts.issueCode(t)
+
+	result := ts.token(t, exchangeForm(code, testVerifier))
+	if result.status != http.StatusOK {
+		t.Fatalf("status = %d, error = %q", result.status, result.Error)
+	}
+	if result.AccessToken == "" || result.RefreshToken == "" || result.IDToken == "" {
+		t.Fatalf("incomplete response: %+v", result.tokenResponse)
+	}
+	if result.TokenType != "Bearer" || result.Scope != "openid email" {
+		t.Errorf("token_type = %q, scope = %q", result.TokenType, result.Scope)
+	}
+
+	claims, err := ts.tokens.Parse(result.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+	if claims.ClientID != "public-app" || claims.Subject != fmt.Sprint(ts.user.ID) {
+		t.Errorf("client_id = %q, sub = %q", claims.ClientID, claims.Subject)
+	}
+}
+
+func TestTokenAuthorizationCodeRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		form func(code string) url.Values
+	}{
+		{"wrong verifier", func(code string) url.Values {
+			return exchangeForm(code, strings.Repeat("a", 43))
+		}},
+		{"missing verifier", func(code string) url.Values {
+			return exchangeForm(code, "")
+		}},
+		{"short verifier", func(code string) url.Values {
+			return exchangeForm(code, testVerifier[:42])
+		}},
+		{"redirect_uri mismatch", func(code string) url.Values {
+			form := exchangeForm(code, testVerifier)
+			form.Set("redirect_uri", "https://app.test/other")
+			return form
+		}},
+		{"redirect_uri omitted", func(code string) url.Values {
+			form := exchangeForm(code, testVerifier)
+			form.Del("redirect_uri")
+			return form
+		}},
+		{"unknown code", func(code string) url.Values {
+			return exchangeForm(code+"x", testVerifier)
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			code := ts.issueCode(t)
+
+			result := ts.token(t, tt.form(code))
+			if result.status != http.StatusBadRequest || result.Error != "invalid_grant" {
+				t.Fatalf("status = %d, error = %q, want invalid_grant", result.status, result.Error)
+			}
+		})
+	}
+}
+
+func TestTokenRedirectURIOptional(t *testing.T) {
+	tests := []struct {
+		name       string
+		authorize  bool
+		exchange   bool
+		wantStatus int
+	}{
+		{name: "omitted in both requests", wantStatus: http.StatusOK},
+		{name: "sent in both requests", authorize: true, exchange: true, wantStatus: http.StatusOK},
+		{name: "sent only to token endpoint", exchange: true, wantStatus: http.StatusOK},
+		{name: "sent only to authorize", authorize: true, wantStatus: http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+			// С единственным зарегистрированным адресом redirect_uri можно не передавать
+			ts.storage.clients["public-app"].RedirectURIs = testRedirectURI
+			if err := ts.storage.SaveOAuthConsent(ts.user.ID, "public-app", "openid email"); err != nil {
+				t.Fatal(err)
+			}
+
+			query := authorizeQuery()
+			if !tt.authorize {
+				query.Del("redirect_uri")
+			}
+			resp := ts.authorize(t, query)
+			location, err := url.Parse(resp.Header.Get("Location"))
+			if err != nil || resp.StatusCode != http.StatusFound {
+				t.Fatalf("authorize: status = %d, location = %q", resp.StatusCode, resp.Header.Get("Location"))
+			}
+
+			form := exchangeForm(location.Query().Get("code"), testVerifier)
+			if !tt.exchange {
+				form.Del("redirect_uri")
+			}
+			result := ts.token(t, form)
+			if result.status != tt.wantStatus {
+				t.Fatalf("status = %d, error = %q, want %d", result.status, result.Error, tt.wantStatus)
+			}
+			if tt.wantStatus != http.StatusOK && result.Error != "invalid_grant" {
+				t.Fatalf("error = %q, want invalid_grant", result.Error)
+			}
+		})
+	}
+}
+
+func TestTokenAuthorizationCodeExpired(t *testing.T) {
+	ts := newTestServer(t)
+	code := ts.issueCode(t)
+	ts.storage.codes[token.Hash(code)].ExpiresAt = time.Now().Add(-time.Second)
+
+	result := ts.token(t, exchangeForm(code, testVerifier))
+	if result.Error != "invalid_grant" {
+		t.Fatalf("error = %q, want invalid_grant", result.Error)
+	}
+}
+
+func TestTokenAuthorizationCodeReuse(t *testing.T) {
+	ts := newTestServer(t)
+	code := ts.issueCode(t)
+
+	first := ts.token(t, exchangeForm(code, testVerifier))
+	if first.status != http.StatusOK {
+		t.Fatalf("first exchange: status = %d, error = %q", first.status, first.Error)
+	}
+
+	second := ts.token(t, exchangeForm(code, testVerifier))
+	if second.status != http.StatusBadRequest || second.Error != "invalid_grant" {
+		t.Fatalf("second exchange: status = %d, error = %q", second.status, second.Error)
+	}
+
+	// Токены, выданные по перехваченному коду, отозваны
+	refresh := ts.token(t, url.Values{
+		"grant_type":    {GrantRefreshToken},
+		"client_id":     {"public-app"},
+		"refresh_token": {first.RefreshToken},
+	})
+	if refresh.Error != "invalid_grant" {
+		t.Errorf("refresh after code reuse: error = %q, want invalid_grant", refresh.Error)
+	}
+}
+
+func TestTokenRefresh(t *testing.T) {
+	ts := newTestServer(t)
+	issued := ts.token(t, exchangeForm(ts.issueCode(t), testVerifier))
+	if issued.status != http.StatusOK {
+		t.Fatalf("exchange: status = %d, error = %q", issued.status, issued.Error)
+	}
+
+	form := func(refreshToken string) url.Values {
+		return url.Values{
+			"grant_type":    {GrantRefreshToken},
+			"client_id":     {"public-app"},
+			"refresh_token": {refreshToken},
+		}
+	}
+
+	rotated := ts.token(t, form(issued.RefreshToken))
+	if rotated.status != http.StatusOK {
+		t.Fatalf("refresh: status = %d, error = %q", rotated.status, rotated.Error)
+	}
+	if rotated.RefreshToken == issued.RefreshToken || rotated.IDToken == "" || rotated.Scope != issued.Scope {
+		t.Errorf("unexpected refresh response: %+v", rotated.tokenResponse)
+	}
+
+	// Повторное предъявление старого токена отзывает всю семью,
+	// включая только что выданный
+	if reused := ts.token(t, form(issued.RefreshToken)); reused.Error != "invalid_grant" {
+		t.Fatalf("reuse: error = %q, want invalid_grant", reused.Error)
+	}
+	if revoked := ts.token(t, form(rotated.RefreshToken)); revoked.Error != "invalid_grant" {
+		t.Errorf("refresh after reuse: error = %q, want invalid_grant", revoked.Error)
+	}
+}
+
+func TestTokenRefreshOtherClient(t *testing.T) {
+	ts := newTestServer(t)
+	ts.storage.clients["other-app"] = &entity.OAuthClient{
+		ClientID:   "other-app",
+		GrantTypes: GrantRefreshToken,
+		Public:     true,
+	}
+	issued := ts.token(t, exchangeForm(ts.issueCode(t), testVerifier))
+
+	result := ts.token(t, url.Values{
+		"grant_type":    {GrantRefreshToken},
+		"client_id":     {"other-app"},
+		"refresh_token": {issued.RefreshToken},
+	})
+	if result.Error != "invalid_grant" {
+		t.Fatalf("error = %q, want invalid_grant", result.Error)
+	}
+}
+
+func TestTokenClientCredentials(t *testing.T) {
+	tests := []struct {
+		name   string
+		form   url.Values
+		basic  []string
+		status int
+		error  string
+		scope  string
+	}{
+		{
+			name:   "basic auth",
+			form:   url.Values{"grant_type": {GrantClientCredentials}},
+			basic:  []string{"service", testClientSecret},
+			status: http.StatusOK,
+			scope:  "reports:read reports:write",
+		},
+		{
+			name: "post auth with narrower scope",
+			form: url.Values{
+				"grant_type":    {GrantClientCredentials},
+				"client_id":     {"service"},
+				"client_secret": {testClientSecret},
+				"scope":         {"reports:read"},
+			},
+			status: http.StatusOK,
+			scope:  "reports:read",
+		},
+		{
+			name:   "wrong secret",
+			form:   url.Values{"grant_type": {GrantClientCredentials}},
+			basic:  []string{"service", "wrong"},
+			status: http.StatusUnauthorized,
+			error:  "invalid_client",
+		},
+		{
+			name:   "missing secret",
+			form:   url.Values{"grant_type": {GrantClientCredentials}, "client_id": {"service"}},
+			status: http.StatusUnauthorized,
+			error:  "invalid_client",
+		},
+		{
+			name:   "scope not allowed",
+			form:   url.Values{"grant_type": {GrantClientCredentials}, "scope": {"reports:delete"}},
+			basic:  []string{"service", testClientSecret},
+			status: http.StatusBadRequest,
+			error:  "invalid_scope",
+		},
+		{
+			name:   "grant not allowed",
+			form:   url.Values{"grant_type": {GrantClientCredentials}, "client_id": {"public-app"}},
+			status: http.StatusBadRequest,
+			error:  "unauthorized_client",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ts := newTestServer(t)
+
+			result := ts.token(t, tt.form, tt.basic...)
+			if result.status != tt.status || result.Error != tt.error {
+				t.Fatalf("status = %d, error = %q, want %d %q", result.status, result.Error, tt.status, tt.error)
+			}
+			if tt.status != http.StatusOK {
+				return
+			}
+
+			if result.RefreshToken != "" || result.Scope != tt.scope {
+				t.Errorf("refresh_token = %q, scope = %q", result.RefreshToken, result.Scope)
+			}
+			claims, err := ts.tokens.ParseClientToken(result.AccessToken)
+			if err != nil {
+				t.Fatalf("ParseClientToken: %v", err)
+			}
+			if claims.Subject != "service" || claims.ClientID != "service" {
+				t.Errorf("sub = %q, client_id = %q", claims.Subject, claims.ClientID)
+			}
+			// Токен клиента не принимается как токен пользователя
+			if _, err := ts.tokens.Parse(result.AccessToken); err == nil {
+				t.Error("client token accepted as access token")
+			}
+		})
+	}
+}
+
+func TestTokenPublicClientCredentials(t *testing.T) {
+	ts := newTestServer(t)
+	ts.storage.clients["public-app"].GrantTypes += " " + GrantClientCredentials
+
+	result := ts.token(t, url.Values{"grant_type": {GrantClientCredentials}, "client_id": {"public-app"}})
+	if result.Error != "unauthorized_client" {
+		t.Fatalf("error = %q, want unauthorized_client", result.Error)
+	}
+}
+
+func TestVerifyCodeChallenge(t *testing.T) {
+	tests := []struct {
+		name      string
+		challenge string
+		method    string
+		verifier  string
+		want      bool
+	}{
+		// RFC 7636, приложение B
+		{"rfc example", "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM", "S256", testVerifier, true},
+		{"wrong verifier", codeChallenge(testVerifier), "S256", strings.Repeat("b", 43), false},
+		{"plain method", testVerifier, "plain", testVerifier, false},
+		{"too short", codeChallenge(testVerifier[:42]), "S256", testVerifier[:42], false},
+		{"too long", codeChallenge(strings.Repeat("c", 129)), "S256", strings.Repeat("c", 129), false},
+		{"max length", codeChallenge(strings.Repeat("c", 128)), "S256", strings.Repeat("c", 128), true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyCodeChallenge(tt.challenge, tt.method, tt.verifier); got != tt.want {
+				t.Errorf("verifyCodeChallenge() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestConsentChallengeUsedOnce(t *testing.T) {
+	ts := newTestServer(t)
+
+	resp := ts.authorize(t, authorizeQuery())
+	page, err := io.ReadAll(resp.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	match := regexp.MustCompile(`name="consent_challenge" value="([^"]+)"`).FindSubmatch(page)
+	if match == nil {
+		t.Fatalf("no consent challenge in page:\n%s", page)
+	}
+	form := url.Values{"consent_challenge": {string(match[1])}, "decision": {"allow"}}
+
+	// Одновременная повторная отправка формы не выпускает второй код
+	const attempts = 8
+	var wg sync.WaitGroup
+	codes := make(chan string, attempts)
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	for range attempts {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			req, err := http.NewRequest(http.MethodPost, ts.URL+"/authorize", strings.NewReader(form.Encode()))
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+			req.Header.Set("Authorization", "Bearer "+ts.session)
+			resp, err := client.Do(req)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			resp.Body.Close()
+			if location, err := url.Parse(resp.Header.Get("Location")); err == nil && location.Query().Get("code") != "" {
+				codes <- location.Query().Get("code")
+			}
+		}()
+	}
+	wg.Wait()
+	close(codes)
+
+	if issued := len(codes); issued != 1 {
+		t.Fatalf("consent issued %d codes, want 1", issued)
+	}
+}
@@ -0,0 +1,264 @@
+package oauth
+
+import (
+	"auth/internal/entity"
+	"auth/internal/storage/postgres"
+	"auth/internal/token"
+	"crypto/subtle"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// tokenResponse - ответ /token (RFC 6749, раздел 5.1).
+type tokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope,omitempty"`
+	IDToken      string `json:"id_token,omitempty"`
+}
+
+func (s *Server) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.Header().Set("Allow", "POST")
+		writeError(w, &Error{Code: "invalid_request", Description: "method not allowed", status: http.StatusMethodNotAllowed})
+		return
+	}
+
+	if err := r.ParseForm(); err != nil {
+		writeError(w, newError("invalid_request", "invalid form body"))
+		return
+	}
+
+	client, oauthErr := s.authenticateClient(r)
+	if oauthErr != nil {
+		writeError(w, oauthErr)
+		return
+	}
+
+	grantType := r.PostForm.Get("grant_type")
+	if !contains(client.GrantTypes, grantType) {
+		writeError(w, newError("unauthorized_client", "grant type is not allowed for this client"))
+		return
+	}
+
+	var (
+		response *tokenResponse
+		err      error
+	)
+	switch grantType {
+	case GrantAuthorizationCode:
+		response, err = s.exchangeAuthorizationCode(client, r.PostForm)
+	case GrantRefreshToken:
+		response, err = s.exchangeRefreshToken(client, r.PostForm)
+	case GrantClientCredentials:
+		response, err = s.exchangeClientCredentials(client, r.PostForm)
+	default:
+		err = newError("unsupported_grant_type", "")
+	}
+
+	if err != nil {
+		var oauthErr *Error
+		if errors.As(err, &oauthErr) {
+			s.logger.Warn("token request rejected", "client_id", client.ClientID, "grant_type", grantType, "error", err)
+			writeError(w, oauthErr)
+			return
+		}
+		s.logger.Error("failed to issue token", "client_id", client.ClientID, "grant_type", grantType, "error", err)
+		writeError(w, &Error{Code: "server_error", status: http.StatusInternalServerError})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+// authenticateClient проверяет клиента по client_secret_basic или
+// client_secret_post. Публичный клиент передает только client_id.
+func (s *Server) authenticateClient(r *http.Request) (*entity.OAuthClient, *Error) {
+	clientID, secret, basic := r.BasicAuth()
+	if basic {
+		// В Basic значения дополнительно закодированы form-urlencoded
+		var err error
+		if clientID, err = url.QueryUnescape(clientID); err != nil {
+			return nil, errInvalidClient()
+		}
+		if secret, err = url.QueryUnescape(secret); err != nil {
+			return nil, errInvalidClient()
+		}
+	} else {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+
+	if clientID == "" {
+		return nil, errInvalidClient()
+	}
+
+	client, err := s.storage.GetOAuthClient(clientID)
+	if err != nil {
+		if !errors.Is(err, gorm.ErrRecordNotFound) {
+			s.logger.Error("failed to get oauth client", "error", err)
+			return nil, &Error{Code: "server_error", status: http.StatusInternalServerError}
+		}
+		s.logger.Warn("unknown oauth client", "client_id", clientID)
+		return nil, errInvalidClient()
+	}
+
+	if client.Public {
+		if secret != "" {
+			return nil, errInvalidClient()
+		}
+		return client, nil
+	}
+
+	if secret == "" || subtle.ConstantTimeCompare([]byte(token.Hash(secret)), []byte(client.SecretHash)) != 1 {
+		s.logger.Warn("invalid client secret", "client_id", clientID)
+		return nil, errInvalidClient()
+	}
+
+	return client, nil
+}
+
+func (s *Server) exchangeAuthorizationCode(client *entity.OAuthClient, form url.Values) (*tokenResponse, error) {
+	code, err := s.storage.GetAuthorizationCode(token.Hash(form.Get("code")))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, newError("invalid_grant", "invalid authorization code")
+		}
+		return nil, err
+	}
+
+	if code.ClientID != client.ClientID {
+		return nil, newError("invalid_grant", "invalid authorization code")
+	}
+
+	// Повторное предъявление кода - признак перехвата: отзываем то,
+	// что по нему уже выдано
+	if code.UsedAt != nil {
+		return nil, s.authorizationCodeReused(code)
+	}
+
+	if time.Now().After(code.ExpiresAt) {
+		return nil, newError("invalid_grant", "authorization code has expired")
+	}
+
+	// RFC 6749 4.1.3: если redirect_uri был в запросе авторизации, он
+	// обязателен и здесь
+	redirectURI := form.Get("redirect_uri")
+	if redirectURI == "" && code.RedirectURIProvided {
+		return nil, newError("invalid_grant", "redirect_uri is required")
+	}
+	if redirectURI != "" && redirectURI != code.RedirectURI {
+		return nil, newError("invalid_grant", "redirect_uri does not match")
+	}
+
+	if !verifyCodeChallenge(code.CodeChallenge, code.CodeChallengeMethod, form.Get("code_verifier")) {
+		return nil, newError("invalid_grant", "invalid code_verifier")
+	}
+
+	if err := s.storage.MarkAuthorizationCodeUsed(code.ID); err != nil {
+		if errors.Is(err, postgres.ErrAuthorizationCodeUsed) {
+			return nil, s.authorizationCodeReused(code)
+		}
+		return nil, err
+	}
+
+	user, err := s.storage.GetUserByID(code.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	pair, err := s.tokens.IssueGrant(user, token.Grant{
+		ClientID: client.ClientID,
+		Scope:    code.Scope,
+		FamilyID: code.FamilyID,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	idToken, err := s.idToken(user, client.ClientID, code.Scope, code.Nonce)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("authorization code exchanged", "user_id", user.ID, "client_id", client.ClientID)
+	response := newTokenResponse(pair)
+	response.IDToken = idToken
+	return response, nil
+}
+
+func (s *Server) authorizationCodeReused(code *entity.AuthorizationCode) error {
+	s.logger.Warn("authorization code reuse detected", "client_id", code.ClientID, "user_id", code.UserID)
+	if err := s.tokens.RevokeFamily(code.FamilyID); err != nil {
+		return err
+	}
+	return newError("invalid_grant", "authorization code has already been used")
+}
+
+func (s *Server) exchangeRefreshToken(client *entity.OAuthClient, form url.Values) (*tokenResponse, error) {
+	pair, err := s.tokens.RefreshGrant(form.Get("refresh_token"), client.ClientID)
+	if err != nil {
+		if errors.Is(err, token.ErrInvalidRefreshToken) || errors.Is(err, token.ErrRefreshTokenReused) {
+			return nil, newError("invalid_grant", "invalid refresh token")
+		}
+		return nil, err
+	}
+
+	response := newTokenResponse(pair)
+	if contains(pair.Scope, ScopeOpenID) {
+		user, err := s.storage.GetUserByID(pair.UserID)
+		if err != nil {
+			return nil, err
+		}
+
+		// При обновлении nonce не передается (OpenID Connect Core, 12.2)
+		if response.IDToken, err = s.idToken(user, client.ClientID, pair.Scope, ""); err != nil {
+			return nil, err
+		}
+	}
+
+	return response, nil
+}
+
+func (s *Server) exchangeClientCredentials(client *entity.OAuthClient, form url.Values) (*tokenResponse, error) {
+	if client.Public {
+		return nil, newError("unauthorized_client", "public clients may not use client credentials")
+	}
+
+	scope := form.Get("scope")
+	if scope == "" {
+		scope = client.Scopes
+	}
+	if !containsAll(client.Scopes, scope) {
+		return nil, newError("invalid_scope", "requested scope is not allowed for this client")
+	}
+
+	accessToken, err := s.tokens.IssueClientToken(client.ClientID, scope)
+	if err != nil {
+		return nil, err
+	}
+
+	s.logger.Info("client token issued", "client_id", client.ClientID)
+	return &tokenResponse{
+		AccessToken: accessToken,
+		TokenType:   "Bearer",
+		ExpiresIn:   int64(token.AccessTokenExpiration.Seconds()),
+		Scope:       scope,
+	}, nil
+}
+
+func newTokenResponse(pair *token.Pair) *tokenResponse {
+	return &tokenResponse{
+		AccessToken:  pair.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    pair.ExpiresIn,
+		RefreshToken: pair.RefreshToken,
+		Scope:        pair.Scope,
+	}
+}
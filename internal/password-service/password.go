@@ -1,17 +1,22 @@
 package passwordservice
 
 import (
+	"auth/internal/audit"
 	"auth/internal/config"
 	mock_reader "auth/internal/kafka/kafka-reader/mock_reader"
 	mock_writer "auth/internal/kafka/kafka-writer/mock_writer"
+	"auth/internal/passwordpolicy"
 	"auth/internal/storage/postgres"
 	pb "auth/proto/password"
 	"context"
 	"encoding/json"
 	"log"
+	"log/slog"
 
 	"github.com/segmentio/kafka-go"
 	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type PasswordService struct {
@@ -20,17 +25,39 @@ type PasswordService struct {
 	storage     postgres.Storage
 	kafkaWriter mock_writer.KafkaWriterInterface
 	kafkaReader mock_reader.KafkaReaderInterface
+	audit       *audit.Log
+	policy      *passwordpolicy.Policy
+	// serviceToken подтверждает вызовы ChangePassword от сервиса аутентификации
+	serviceToken string
 }
 
-func NewPasswordService(cfg *config.Config, strg postgres.Storage, kafkaWriter mock_writer.KafkaWriterInterface) *PasswordService {
+func NewPasswordService(cfg *config.Config, strg postgres.Storage, kafkaWriter mock_writer.KafkaWriterInterface, policy *passwordpolicy.Policy, serviceToken string) *PasswordService {
 	return &PasswordService{
-		cfg:         cfg,
-		storage:     strg,
-		kafkaWriter: kafkaWriter,
+		cfg:          cfg,
+		storage:      strg,
+		kafkaWriter:  kafkaWriter,
+		audit:        audit.NewLog(strg, slog.Default()),
+		policy:       policy,
+		serviceToken: serviceToken,
 	}
 }
 
+// ChangePassword устанавливает пароль без проверки старого. Вызывается только
+// сервисом аутентификации после сброса пароля по коду.
 func (ps *PasswordService) ChangePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	if err := ps.authorizeService(ctx); err != nil {
+		log.Printf("Unauthorized ChangePassword call: %v", err)
+		return nil, err
+	}
+
+	return ps.changePassword(ctx, req)
+}
+
+func (ps *PasswordService) changePassword(ctx context.Context, req *pb.ChangePasswordRequest) (*pb.ChangePasswordResponse, error) {
+	if err := ps.checkPassword(req.GetEmail(), req.GetNewPassword()); err != nil {
+		return nil, err
+	}
+
 	newPassword, err := bcrypt.GenerateFromPassword([]byte(req.GetNewPassword()), bcrypt.DefaultCost)
 	if err != nil {
 		log.Printf("Failed to generate password hash: %v", err)
@@ -39,7 +66,7 @@ func (ps *PasswordService) ChangePassword(ctx context.Context, req *pb.ChangePas
 		}, err
 	}
 
-	if err := ps.storage.ChangePassword(req.GetEmail(), newPassword); err != nil {
+	if err := ps.storage.ChangePassword(req.GetEmail(), newPassword, ps.policy.HistorySize()); err != nil {
 		log.Printf("Failed to change password in storage: %v", err)
 		return &pb.ChangePasswordResponse{
 			Message: "internal server error",
@@ -47,6 +74,7 @@ func (ps *PasswordService) ChangePassword(ctx context.Context, req *pb.ChangePas
 	}
 
 	log.Println("Password successfully changed")
+	ps.recordPasswordChange(ctx, req.GetEmail())
 
 	if err := ps.sendNotificationEvent(req.GetEmail(), "password successfully changed"); err != nil {
 		log.Printf("Failed to send notification: %v", err)
@@ -67,17 +95,28 @@ func (ps *PasswordService) UpdatePassword(ctx context.Context, req *pb.UpdatePas
 	}
 
 	if err := bcrypt.CompareHashAndPassword(user.HashedPassword, []byte(req.GetOldPassword())); err != nil {
-		log.Printf("Old password is incorrect for user %s", req.GetEmail())
+		log.Printf("Old password is incorrect for user %d", user.ID)
+		ps.audit.Record(ctx, audit.Event{
+			Action:    audit.ActionPasswordChange,
+			ActorID:   user.ID,
+			SubjectID: user.ID,
+			Result:    audit.ResultFailure,
+			Details:   map[string]string{"reason": "old password is incorrect"},
+		})
 		return &pb.UpdatePasswordResponse{
 			Message: "old password is incorrect",
 		}, nil
 	}
 
-	resp, err := ps.ChangePassword(ctx, &pb.ChangePasswordRequest{
+	resp, err := ps.changePassword(ctx, &pb.ChangePasswordRequest{
 		Email:       req.GetEmail(),
 		NewPassword: req.GetNewPassword(),
 	})
 	if err != nil {
+		// Нарушения политики возвращаем клиенту как есть
+		if _, ok := status.FromError(err); ok {
+			return nil, err
+		}
 		log.Printf("Failed to change password: %v", err)
 		return &pb.UpdatePasswordResponse{
 			Message: "internal server error",
@@ -89,6 +128,44 @@ func (ps *PasswordService) UpdatePassword(ctx context.Context, req *pb.UpdatePas
 	}, nil
 }
 
+// checkPassword проверяет новый пароль по политике и истории паролей.
+// Пользователь ищется по email ради имени для правила contains_user_info
+// и его прежних хешей.
+func (ps *PasswordService) checkPassword(email, password string) error {
+	info := passwordpolicy.UserInfo{Email: email}
+	user, err := ps.storage.GetUserByEmail(email)
+	if err == nil {
+		info.Username = user.UserName
+	}
+
+	result := ps.policy.Evaluate(password, info)
+	if user != nil && ps.policy.HistorySize() > 0 {
+		hashes, err := ps.storage.GetPasswordHistory(user.ID, ps.policy.HistorySize()-1)
+		if err != nil {
+			log.Printf("Failed to get password history: %v", err)
+			return status.Errorf(codes.Internal, "internal server error")
+		}
+		result.CheckReuse(password, append([][]byte{user.HashedPassword}, hashes...))
+	}
+	if !result.Acceptable() && user != nil {
+		log.Printf("New password for user %d rejected by policy: %d violations", user.ID, len(result.Violations))
+	}
+
+	return result.Err()
+}
+
+// recordPasswordChange пишет успешную смену пароля в журнал аудита.
+// Пользователь ищется по email только ради его ID: адрес в неизменяемый
+// журнал не пишется.
+func (ps *PasswordService) recordPasswordChange(ctx context.Context, email string) {
+	event := audit.Event{Action: audit.ActionPasswordChange}
+	if user, err := ps.storage.GetUserByEmail(email); err == nil {
+		event.SubjectID = user.ID
+	}
+
+	ps.audit.Record(ctx, event)
+}
+
 func (ps *PasswordService) sendNotificationEvent(email, message string) error {
 	event := map[string]string{
 		"email":   email,
@@ -110,4 +187,4 @@ func (ps *PasswordService) sendNotificationEvent(email, message string) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
@@ -0,0 +1,41 @@
+package passwordservice
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// ServiceTokenMetadata - заголовок, которым внутренние вызовы подтверждают,
+// что пришли от сервиса аутентификации, а не от клиента.
+const ServiceTokenMetadata = "x-service-token"
+
+// NewServiceToken генерирует секрет для внутренних вызовов. Оба сервиса
+// работают в одном процессе, поэтому секрет живет только в памяти.
+func NewServiceToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// WithServiceToken добавляет секрет к исходящему вызову.
+func WithServiceToken(ctx context.Context, token string) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, ServiceTokenMetadata, token)
+}
+
+func (ps *PasswordService) authorizeService(ctx context.Context) error {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(ServiceTokenMetadata)
+	if ps.serviceToken == "" || len(values) == 0 ||
+		subtle.ConstantTimeCompare([]byte(values[0]), []byte(ps.serviceToken)) != 1 {
+		return status.Errorf(codes.PermissionDenied, "internal call is not authorized")
+	}
+	return nil
+}
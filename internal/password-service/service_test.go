@@ -0,0 +1,313 @@
+package passwordservice
+
+import (
+	"auth/internal/config"
+	"auth/internal/entity"
+	"auth/internal/identity"
+	"auth/internal/kafka/kafka-writer/mock_writer"
+	"auth/internal/passwordpolicy"
+	"auth/internal/storage/postgres"
+	pb "auth/proto/password"
+	"context"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"gorm.io/gorm"
+)
+
+const (
+	testServiceToken = "service-token"
+	oldPassword      = "violet-harbor-lantern-58"
+	newPassword      = "amber-glacier-compass-91"
+)
+
+func TestMain(m *testing.M) {
+	log.SetOutput(io.Discard)
+	os.Exit(m.Run())
+}
+
+// memoryStorage хранит в памяти пользователей и историю их паролей.
+// Остальные методы Storage не реализованы и паникуют при вызове.
+type memoryStorage struct {
+	postgres.Storage
+
+	mu       sync.Mutex
+	users    map[string]*entity.User
+	history  map[uint][][]byte
+	auditLog []entity.AuditEntry
+}
+
+func newMemoryStorage(t *testing.T, email string) *memoryStorage {
+	t.Helper()
+	hashed, err := bcrypt.GenerateFromPassword([]byte(oldPassword), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	user := &entity.User{UserName: "alice", Email: email, HashedPassword: hashed}
+	user.ID = 1
+	return &memoryStorage{
+		users:   map[string]*entity.User{email: user},
+		history: make(map[uint][][]byte),
+	}
+}
+
+func (m *memoryStorage) GetUserByEmail(email string) (*entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[identity.Canonical(email)]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (m *memoryStorage) ChangePassword(email string, newPassword []byte, historySize int) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[identity.Canonical(email)]
+	if !ok {
+		return gorm.ErrRecordNotFound
+	}
+	if historySize > 1 {
+		previous := append([][]byte{user.HashedPassword}, m.history[user.ID]...)
+		m.history[user.ID] = previous[:min(len(previous), historySize-1)]
+	}
+	user.HashedPassword = newPassword
+	return nil
+}
+
+func (m *memoryStorage) GetPasswordHistory(userID uint, limit int) ([][]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	hashes := m.history[userID]
+	return hashes[:min(len(hashes), limit)], nil
+}
+
+func (m *memoryStorage) AppendAuditEntry(entry *entity.AuditEntry, seal func(entry *entity.AuditEntry) string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	entry.ID = uint64(len(m.auditLog) + 1)
+	if len(m.auditLog) > 0 {
+		entry.PrevHash = m.auditLog[len(m.auditLog)-1].Hash
+	}
+	entry.Hash = seal(entry)
+	m.auditLog = append(m.auditLog, *entry)
+	return nil
+}
+
+// passwordMatches сравнивает сохраненный хеш пользователя с паролем.
+func (m *memoryStorage) passwordMatches(t *testing.T, email, password string) bool {
+	t.Helper()
+	user, err := m.GetUserByEmail(email)
+	if err != nil {
+		t.Fatalf("GetUserByEmail: %v", err)
+	}
+	return bcrypt.CompareHashAndPassword(user.HashedPassword, []byte(password)) == nil
+}
+
+func newTestService(t *testing.T, policyConfig config.PasswordPolicyConfig, serviceToken string) (*PasswordService, *memoryStorage) {
+	t.Helper()
+	policy, err := passwordpolicy.New(policyConfig)
+	if err != nil {
+		t.Fatalf("passwordpolicy.New: %v", err)
+	}
+	storage := newMemoryStorage(t, "alice@example.com")
+	return NewPasswordService(&config.Config{}, storage, &mock_writer.MockKafkaWriterImpl{}, policy, serviceToken), storage
+}
+
+func TestChangePasswordRequiresServiceToken(t *testing.T) {
+	tests := []struct {
+		name       string
+		configured string
+		// nil - вызов без метаданных
+		sent []string
+		want codes.Code
+	}{
+		{name: "valid token", configured: testServiceToken, sent: []string{testServiceToken}, want: codes.OK},
+		{name: "no metadata", configured: testServiceToken, want: codes.PermissionDenied},
+		{name: "wrong token", configured: testServiceToken, sent: []string{"guess"}, want: codes.PermissionDenied},
+		{name: "token prefix", configured: testServiceToken, sent: []string{"service"}, want: codes.PermissionDenied},
+		{name: "empty token", configured: testServiceToken, sent: []string{""}, want: codes.PermissionDenied},
+		// Без настроенного секрета внутренние вызовы закрыты полностью
+		{name: "not configured", configured: "", sent: []string{""}, want: codes.PermissionDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, storage := newTestService(t, config.PasswordPolicyConfig{}, tt.configured)
+
+			ctx := context.Background()
+			if tt.sent != nil {
+				ctx = metadata.NewIncomingContext(ctx, metadata.Pairs(ServiceTokenMetadata, tt.sent[0]))
+			}
+
+			_, err := service.ChangePassword(ctx, &pb.ChangePasswordRequest{Email: "alice@example.com", NewPassword: newPassword})
+			if got := status.Code(err); got != tt.want {
+				t.Fatalf("code = %v, want %v (err: %v)", got, tt.want, err)
+			}
+			if changed := storage.passwordMatches(t, "alice@example.com", newPassword); changed != (tt.want == codes.OK) {
+				t.Fatalf("password changed = %v", changed)
+			}
+		})
+	}
+}
+
+func TestWithServiceToken(t *testing.T) {
+	ctx := WithServiceToken(context.Background(), testServiceToken)
+	md, _ := metadata.FromOutgoingContext(ctx)
+	if got := md.Get(ServiceTokenMetadata); len(got) != 1 || got[0] != testServiceToken {
+		t.Fatalf("outgoing %s = %v", ServiceTokenMetadata, got)
+	}
+
+	first, err := NewServiceToken()
+	if err != nil {
+		t.Fatalf("NewServiceToken: %v", err)
+	}
+	second, err := NewServiceToken()
+	if err != nil {
+		t.Fatalf("NewServiceToken: %v", err)
+	}
+	if first == "" || first == second {
+		t.Fatalf("service tokens %q and %q are not random", first, second)
+	}
+}
+
+func TestUpdatePassword(t *testing.T) {
+	tests := []struct {
+		name        string
+		oldPassword string
+		newPassword string
+		wantCode    codes.Code
+		wantChanged bool
+	}{
+		{name: "changes password", oldPassword: oldPassword, newPassword: newPassword, wantChanged: true},
+		{name: "wrong old password", oldPassword: "not-the-password", newPassword: newPassword},
+		{name: "policy violation", oldPassword: oldPassword, newPassword: "short", wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// Служебный секрет UpdatePassword не нужен: проверяется старый пароль
+			service, storage := newTestService(t, config.PasswordPolicyConfig{}, testServiceToken)
+
+			_, err := service.UpdatePassword(context.Background(), &pb.UpdatePasswordRequest{
+				Email:       "alice@example.com",
+				OldPassword: tt.oldPassword,
+				NewPassword: tt.newPassword,
+			})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v (err: %v)", got, tt.wantCode, err)
+			}
+			if changed := storage.passwordMatches(t, "alice@example.com", tt.newPassword); changed != tt.wantChanged {
+				t.Fatalf("password changed = %v, want %v", changed, tt.wantChanged)
+			}
+		})
+	}
+}
+
+func TestPasswordHistory(t *testing.T) {
+	const thirdPassword, fourthPassword = "copper-meadow-signal-37", "silver-canyon-beacon-64"
+
+	// Запрещены три последних пароля, включая текущий
+	service, storage := newTestService(t, config.PasswordPolicyConfig{HistorySize: 3}, testServiceToken)
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ServiceTokenMetadata, testServiceToken))
+
+	steps := []struct {
+		password string
+		wantCode codes.Code
+	}{
+		{password: oldPassword, wantCode: codes.InvalidArgument},
+		{password: newPassword},
+		{password: oldPassword, wantCode: codes.InvalidArgument},
+		{password: thirdPassword},
+		{password: oldPassword, wantCode: codes.InvalidArgument},
+		{password: newPassword, wantCode: codes.InvalidArgument},
+		{password: fourthPassword},
+		// oldPassword вытеснен из истории и снова разрешен
+		{password: oldPassword},
+	}
+
+	current := oldPassword
+	for i, step := range steps {
+		_, err := service.ChangePassword(ctx, &pb.ChangePasswordRequest{Email: "alice@example.com", NewPassword: step.password})
+		if got := status.Code(err); got != step.wantCode {
+			t.Fatalf("step %d: code = %v, want %v (err: %v)", i+1, got, step.wantCode, err)
+		}
+		if step.wantCode == codes.OK {
+			current = step.password
+		}
+		if !storage.passwordMatches(t, "alice@example.com", current) {
+			t.Fatalf("step %d: stored password is not %q", i+1, current)
+		}
+	}
+	if got := len(storage.history[1]); got != 2 {
+		t.Fatalf("history holds %d hashes, want 2", got)
+	}
+}
+
+func TestUpdatePasswordRejectsReuse(t *testing.T) {
+	tests := []struct {
+		name        string
+		historySize int
+		wantCode    codes.Code
+	}{
+		{name: "history disabled", historySize: 0},
+		{name: "current password", historySize: 1, wantCode: codes.InvalidArgument},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			service, _ := newTestService(t, config.PasswordPolicyConfig{HistorySize: tt.historySize}, testServiceToken)
+
+			_, err := service.UpdatePassword(context.Background(), &pb.UpdatePasswordRequest{
+				Email:       "alice@example.com",
+				OldPassword: oldPassword,
+				NewPassword: oldPassword,
+			})
+			if got := status.Code(err); got != tt.wantCode {
+				t.Fatalf("code = %v, want %v (err: %v)", got, tt.wantCode, err)
+			}
+		})
+	}
+}
+
+func TestPasswordChangeAudit(t *testing.T) {
+	service, storage := newTestService(t, config.PasswordPolicyConfig{}, testServiceToken)
+
+	_, err := service.UpdatePassword(context.Background(), &pb.UpdatePasswordRequest{
+		Email:       "alice@example.com",
+		OldPassword: "not-the-password",
+		NewPassword: newPassword,
+	})
+	if err != nil {
+		t.Fatalf("UpdatePassword: %v", err)
+	}
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(ServiceTokenMetadata, testServiceToken))
+	if _, err := service.ChangePassword(ctx, &pb.ChangePasswordRequest{Email: "alice@example.com", NewPassword: newPassword}); err != nil {
+		t.Fatalf("ChangePassword: %v", err)
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if len(storage.auditLog) != 2 {
+		t.Fatalf("audit entries = %d, want 2", len(storage.auditLog))
+	}
+	// Журнал неизменяем, поэтому адрес в него не пишется
+	for _, entry := range storage.auditLog {
+		if entry.SubjectID == nil || *entry.SubjectID != 1 {
+			t.Fatalf("entry %s subject = %v, want user 1", entry.Action, entry.SubjectID)
+		}
+		if strings.Contains(entry.Details, "alice") {
+			t.Fatalf("entry %s details = %s, want no email", entry.Action, entry.Details)
+		}
+	}
+}
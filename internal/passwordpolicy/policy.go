@@ -0,0 +1,309 @@
+package passwordpolicy
+
+import (
+	"auth/internal/breach"
+	"auth/internal/config"
+	"bufio"
+	_ "embed"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Правила, которые может нарушить пароль.
+const (
+	RuleMinLength        = "min_length"
+	RuleMaxLength        = "max_length"
+	RuleLowercase        = "lowercase"
+	RuleUppercase        = "uppercase"
+	RuleDigit            = "digit"
+	RuleSymbol           = "symbol"
+	RuleCommonPassword   = "common_password"
+	RuleContainsUserInfo = "contains_user_info"
+	RuleBreachedPassword = "breached_password"
+	RulePasswordReused   = "password_reused"
+	RuleWeak             = "weak"
+)
+
+const (
+	defaultMinLength = 8
+	// bcrypt учитывает только первые 72 байта пароля
+	bcryptMaxLength = 72
+	// Имя или часть почты короче этого в пароле не ищутся
+	minUserInfoLength = 3
+)
+
+// Оценки стойкости от 0 до 4 и пороги энтропии в битах для них.
+var scoreThresholds = []float64{28, 36, 60, 80}
+
+var ScoreLabels = []string{"very_weak", "weak", "fair", "strong", "very_strong"}
+
+//go:embed common-passwords.txt
+var commonPasswords string
+
+// UserInfo - данные пользователя, которых не должно быть в пароле.
+type UserInfo struct {
+	Username string
+	Email    string
+}
+
+type Violation struct {
+	Rule        string
+	Description string
+}
+
+// Result - оценка пароля. Score от 0 до 4, Entropy - оценка в битах.
+type Result struct {
+	Score      int
+	Entropy    float64
+	Violations []Violation
+}
+
+func (r Result) Acceptable() bool {
+	return len(r.Violations) == 0
+}
+
+// CheckReuse добавляет нарушение, если пароль совпадает с одним из
+// bcrypt-хешей недавних паролей пользователя.
+func (r *Result) CheckReuse(password string, hashes [][]byte) {
+	for _, hash := range hashes {
+		if len(hash) > 0 && bcrypt.CompareHashAndPassword(hash, []byte(password)) == nil {
+			r.Violations = append(r.Violations, Violation{Rule: RulePasswordReused, Description: "password was used recently, choose a different one"})
+			return
+		}
+	}
+}
+
+// Policy проверяет пароли по правилам из конфигурации.
+type Policy struct {
+	cfg       config.PasswordPolicyConfig
+	blocklist map[string]struct{}
+	breached  *breach.Corpus
+}
+
+func New(cfg config.PasswordPolicyConfig) (*Policy, error) {
+	if cfg.MinLength <= 0 {
+		cfg.MinLength = defaultMinLength
+	}
+	if cfg.MaxLength <= 0 || cfg.MaxLength > bcryptMaxLength {
+		cfg.MaxLength = bcryptMaxLength
+	}
+	if cfg.MinLength > cfg.MaxLength {
+		return nil, fmt.Errorf("password min_length %d exceeds max_length %d", cfg.MinLength, cfg.MaxLength)
+	}
+	cfg.MinScore = min(max(cfg.MinScore, 0), len(scoreThresholds))
+	cfg.BreachedMinCount = max(cfg.BreachedMinCount, 1)
+
+	policy := &Policy{cfg: cfg, blocklist: make(map[string]struct{})}
+	if err := policy.addBlocklist(strings.NewReader(commonPasswords)); err != nil {
+		return nil, err
+	}
+
+	if cfg.BlocklistPath != "" {
+		file, err := os.Open(cfg.BlocklistPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open password blocklist: %w", err)
+		}
+		defer file.Close()
+
+		if err := policy.addBlocklist(file); err != nil {
+			return nil, fmt.Errorf("failed to read password blocklist: %w", err)
+		}
+	}
+
+	if cfg.BreachedPasswordsPath != "" {
+		corpus, err := breach.Open(cfg.BreachedPasswordsPath)
+		if err != nil {
+			return nil, err
+		}
+		policy.breached = corpus
+	}
+
+	return policy, nil
+}
+
+func (p *Policy) addBlocklist(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if word := strings.ToLower(strings.TrimSpace(scanner.Text())); word != "" {
+			p.blocklist[word] = struct{}{}
+		}
+	}
+	return scanner.Err()
+}
+
+// HistorySize - сколько последних паролей, включая текущий, нельзя повторять.
+func (p *Policy) HistorySize() int {
+	return p.cfg.HistorySize
+}
+
+// Close освобождает отображенный в память файл утекших паролей.
+func (p *Policy) Close() error {
+	if p.breached == nil {
+		return nil
+	}
+	return p.breached.Close()
+}
+
+// Evaluate оценивает пароль и перечисляет все нарушенные правила.
+func (p *Policy) Evaluate(password string, user UserInfo) Result {
+	var violations []Violation
+	add := func(rule, description string) {
+		violations = append(violations, Violation{Rule: rule, Description: description})
+	}
+
+	if utf8.RuneCountInString(password) < p.cfg.MinLength {
+		add(RuleMinLength, fmt.Sprintf("password must be at least %d characters long", p.cfg.MinLength))
+	}
+	if len(password) > p.cfg.MaxLength {
+		add(RuleMaxLength, fmt.Sprintf("password must be at most %d bytes long", p.cfg.MaxLength))
+	}
+
+	classes := characterClasses(password)
+	if p.cfg.RequireLower && !classes.lower {
+		add(RuleLowercase, "password must contain a lowercase letter")
+	}
+	if p.cfg.RequireUpper && !classes.upper {
+		add(RuleUppercase, "password must contain an uppercase letter")
+	}
+	if p.cfg.RequireDigit && !classes.digit {
+		add(RuleDigit, "password must contain a digit")
+	}
+	if p.cfg.RequireSymbol && !classes.symbol {
+		add(RuleSymbol, "password must contain a symbol")
+	}
+
+	common := p.isCommon(password)
+	if common {
+		add(RuleCommonPassword, "password is too common")
+	}
+	breached := p.breached != nil && p.breached.Count(password) >= p.cfg.BreachedMinCount
+	if breached {
+		add(RuleBreachedPassword, "password has appeared in a data breach")
+	}
+	if p.cfg.ForbidUserInfo && containsUserInfo(password, user) {
+		add(RuleContainsUserInfo, "password must not contain the username or email")
+	}
+
+	entropy := estimateEntropy(password, classes)
+	if common || breached {
+		entropy = 0
+	}
+	score := scoreFor(entropy)
+	if score < p.cfg.MinScore {
+		add(RuleWeak, fmt.Sprintf("password is too weak, strength must be at least %s", ScoreLabels[p.cfg.MinScore]))
+	}
+
+	return Result{Score: score, Entropy: entropy, Violations: violations}
+}
+
+// isCommon ищет пароль в списке как есть и без цифр и символов по краям,
+// чтобы "Password123!" тоже считался распространенным.
+func (p *Policy) isCommon(password string) bool {
+	lower := strings.ToLower(password)
+	if _, ok := p.blocklist[lower]; ok {
+		return true
+	}
+
+	base := strings.TrimFunc(lower, func(r rune) bool { return !unicode.IsLetter(r) })
+	if base == "" {
+		return false
+	}
+	_, ok := p.blocklist[base]
+	return ok
+}
+
+func containsUserInfo(password string, user UserInfo) bool {
+	lower := strings.ToLower(password)
+
+	candidates := []string{strings.ToLower(user.Username)}
+	if email := strings.ToLower(user.Email); email != "" {
+		candidates = append(candidates, email)
+		if local, _, found := strings.Cut(email, "@"); found {
+			candidates = append(candidates, local)
+		}
+	}
+
+	for _, candidate := range candidates {
+		if utf8.RuneCountInString(candidate) >= minUserInfoLength && strings.Contains(lower, candidate) {
+			return true
+		}
+	}
+	return false
+}
+
+type classes struct {
+	lower, upper, digit, symbol, other bool
+}
+
+func characterClasses(password string) classes {
+	var c classes
+	for _, r := range password {
+		switch {
+		case r >= 'a' && r <= 'z':
+			c.lower = true
+		case r >= 'A' && r <= 'Z':
+			c.upper = true
+		case r >= '0' && r <= '9':
+			c.digit = true
+		case r < unicode.MaxASCII && (unicode.IsPunct(r) || unicode.IsSymbol(r) || r == ' '):
+			c.symbol = true
+		default:
+			c.other = true
+		}
+	}
+	return c
+}
+
+// estimateEntropy - длина на log2 размера алфавита из использованных
+// классов символов. Повторы и шаги по соседним символам (aaa, abc, 321)
+// почти не добавляют стойкости и учитываются с меньшим весом.
+func estimateEntropy(password string, c classes) float64 {
+	pool := 0
+	if c.lower {
+		pool += 26
+	}
+	if c.upper {
+		pool += 26
+	}
+	if c.digit {
+		pool += 10
+	}
+	if c.symbol {
+		pool += 33
+	}
+	if c.other {
+		pool += 100
+	}
+	if pool == 0 {
+		return 0
+	}
+
+	var length float64
+	var prev rune
+	for i, r := range []rune(password) {
+		if i > 0 && (r == prev || r == prev+1 || r == prev-1) {
+			length += 0.25
+		} else {
+			length++
+		}
+		prev = r
+	}
+
+	return length * math.Log2(float64(pool))
+}
+
+func scoreFor(entropy float64) int {
+	for score, threshold := range scoreThresholds {
+		if entropy < threshold {
+			return score
+		}
+	}
+	return len(scoreThresholds)
+}
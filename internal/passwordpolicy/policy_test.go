@@ -0,0 +1,386 @@
+package passwordpolicy
+
+import (
+	"auth/internal/breach"
+	"auth/internal/config"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// strictConfig включает все правила сразу.
+var strictConfig = config.PasswordPolicyConfig{
+	MinLength:      10,
+	RequireLower:   true,
+	RequireUpper:   true,
+	RequireDigit:   true,
+	RequireSymbol:  true,
+	MinScore:       3,
+	ForbidUserInfo: true,
+}
+
+func newTestPolicy(t *testing.T, cfg config.PasswordPolicyConfig) *Policy {
+	t.Helper()
+	policy, err := New(cfg)
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return policy
+}
+
+func rules(result Result) []string {
+	rules := make([]string, 0, len(result.Violations))
+	for _, violation := range result.Violations {
+		rules = append(rules, violation.Rule)
+	}
+	return rules
+}
+
+func TestNew(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.PasswordPolicyConfig
+		want config.PasswordPolicyConfig
+	}{
+		{name: "defaults", cfg: config.PasswordPolicyConfig{}, want: config.PasswordPolicyConfig{MinLength: 8, MaxLength: 72, BreachedMinCount: 1}},
+		{name: "bcrypt limit", cfg: config.PasswordPolicyConfig{MaxLength: 100}, want: config.PasswordPolicyConfig{MinLength: 8, MaxLength: 72, BreachedMinCount: 1}},
+		{name: "score above the scale", cfg: config.PasswordPolicyConfig{MinScore: 10}, want: config.PasswordPolicyConfig{MinLength: 8, MaxLength: 72, MinScore: 4, BreachedMinCount: 1}},
+		{name: "explicit", cfg: config.PasswordPolicyConfig{MinLength: 12, MaxLength: 64, BreachedMinCount: 5}, want: config.PasswordPolicyConfig{MinLength: 12, MaxLength: 64, BreachedMinCount: 5}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newTestPolicy(t, tt.cfg).cfg; got != tt.want {
+				t.Fatalf("cfg = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  config.PasswordPolicyConfig
+	}{
+		{name: "min above max", cfg: config.PasswordPolicyConfig{MinLength: 20, MaxLength: 16}},
+		{name: "missing blocklist", cfg: config.PasswordPolicyConfig{BlocklistPath: filepath.Join(t.TempDir(), "missing.txt")}},
+		{name: "missing breached passwords", cfg: config.PasswordPolicyConfig{BreachedPasswordsPath: filepath.Join(t.TempDir(), "missing.txt")}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := New(tt.cfg); err == nil {
+				t.Fatal("New accepted an invalid config")
+			}
+		})
+	}
+}
+
+func TestBlocklistPath(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "blocklist.txt")
+	if err := os.WriteFile(path, []byte("\n  CorrectHorse  \n\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	policy := newTestPolicy(t, config.PasswordPolicyConfig{BlocklistPath: path})
+
+	// Свой список дополняет встроенный, а не заменяет его
+	for _, password := range []string{"correcthorse", "CORRECTHORSE", "password"} {
+		if !policy.isCommon(password) {
+			t.Errorf("isCommon(%q) = false", password)
+		}
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	alice := UserInfo{Username: "alice", Email: "alice.smith@example.com"}
+
+	tests := []struct {
+		name      string
+		cfg       config.PasswordPolicyConfig
+		password  string
+		user      UserInfo
+		wantRules []string
+	}{
+		{name: "default policy", password: "violet-harbor-lantern-58"},
+		{name: "too short", password: "a1b2c3", wantRules: []string{RuleMinLength}},
+		// Длина считается в символах, а не в байтах
+		{name: "multibyte length", password: "пароль!", wantRules: []string{RuleMinLength}},
+		{name: "too long", password: strings.Repeat("ab1-", 19), wantRules: []string{RuleMaxLength}},
+		{name: "common", password: "qwerty123", wantRules: []string{RuleCommonPassword}},
+		{name: "default ignores user info", password: "alice-harbor-58", user: alice},
+		{name: "strict accepts", cfg: strictConfig, password: "Violet-Harbor-Lantern-58", user: alice},
+		{
+			name:      "strict character classes",
+			cfg:       strictConfig,
+			password:  "violetharborlantern",
+			wantRules: []string{RuleUppercase, RuleDigit, RuleSymbol},
+		},
+		{
+			name:      "strict common",
+			cfg:       strictConfig,
+			password:  "Password123!",
+			wantRules: []string{RuleCommonPassword, RuleWeak},
+		},
+		{name: "strict username", cfg: strictConfig, password: "Alice-Harbor-Lantern-58", user: alice, wantRules: []string{RuleContainsUserInfo}},
+		{name: "strict email local part", cfg: strictConfig, password: "Harbor-ALICE.SMITH-58", user: alice, wantRules: []string{RuleContainsUserInfo}},
+		// Повторы почти не добавляют стойкости
+		{name: "strict repeats", cfg: strictConfig, password: "Aaaaaaaaaaa1!", wantRules: []string{RuleWeak}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := newTestPolicy(t, tt.cfg).Evaluate(tt.password, tt.user)
+			if got := rules(result); !slices.Equal(got, tt.wantRules) && len(got)+len(tt.wantRules) > 0 {
+				t.Fatalf("rules = %v, want %v", got, tt.wantRules)
+			}
+			if result.Acceptable() != (len(tt.wantRules) == 0) {
+				t.Fatalf("Acceptable = %v", result.Acceptable())
+			}
+			for _, violation := range result.Violations {
+				if violation.Description == "" {
+					t.Fatalf("violation %s has no description", violation.Rule)
+				}
+			}
+		})
+	}
+}
+
+func TestEvaluateScore(t *testing.T) {
+	policy := newTestPolicy(t, config.PasswordPolicyConfig{})
+
+	tests := []struct {
+		password  string
+		wantScore int
+	}{
+		{password: "", wantScore: 0},
+		{password: "password", wantScore: 0},
+		{password: "abcdefgh", wantScore: 0},
+		{password: "kxqzvm", wantScore: 1},
+		{password: "kxqzvmwtrp", wantScore: 2},
+		{password: "Kxqz-vmwt-58", wantScore: 3},
+		{password: "violet-harbor-lantern-58", wantScore: 4},
+	}
+
+	for _, tt := range tests {
+		result := policy.Evaluate(tt.password, UserInfo{})
+		if result.Score != tt.wantScore {
+			t.Errorf("Evaluate(%q) score = %d (%.1f bits), want %d", tt.password, result.Score, result.Entropy, tt.wantScore)
+		}
+		if len(ScoreLabels) <= result.Score {
+			t.Errorf("no label for score %d", result.Score)
+		}
+	}
+}
+
+func TestIsCommon(t *testing.T) {
+	policy := newTestPolicy(t, config.PasswordPolicyConfig{})
+
+	tests := []struct {
+		password string
+		want     bool
+	}{
+		{password: "password", want: true},
+		{password: "PASSWORD", want: true},
+		{password: "123456", want: true},
+		{password: "Password123!", want: true},
+		{password: "!!password", want: true},
+		{password: "pass-word", want: false},
+		{password: "12345!", want: false},
+		{password: "violet-harbor", want: false},
+	}
+
+	for _, tt := range tests {
+		if got := policy.isCommon(tt.password); got != tt.want {
+			t.Errorf("isCommon(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestContainsUserInfo(t *testing.T) {
+	tests := []struct {
+		name     string
+		password string
+		user     UserInfo
+		want     bool
+	}{
+		{name: "username", password: "my-bob99-pass", user: UserInfo{Username: "bob99"}, want: true},
+		{name: "case insensitive", password: "my-BOB99-pass", user: UserInfo{Username: "bob99"}, want: true},
+		{name: "whole email", password: "x-bob@example.com", user: UserInfo{Email: "bob@example.com"}, want: true},
+		{name: "email local part", password: "robert.smith-2024", user: UserInfo{Email: "robert.smith@example.com"}, want: true},
+		{name: "short username", password: "al-harbor-58", user: UserInfo{Username: "al"}},
+		{name: "short local part", password: "al-harbor-58", user: UserInfo{Email: "al@example.com"}},
+		{name: "unrelated", password: "violet-harbor-58", user: UserInfo{Username: "alice", Email: "alice@example.com"}},
+		{name: "no user", password: "violet-harbor-58"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := containsUserInfo(tt.password, tt.user); got != tt.want {
+				t.Fatalf("containsUserInfo = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCharacterClasses(t *testing.T) {
+	tests := []struct {
+		password string
+		want     classes
+	}{
+		{password: "abc", want: classes{lower: true}},
+		{password: "ABC", want: classes{upper: true}},
+		{password: "123", want: classes{digit: true}},
+		{password: "-_ !~", want: classes{symbol: true}},
+		{password: "пароль", want: classes{other: true}},
+		{password: "aB3$", want: classes{lower: true, upper: true, digit: true, symbol: true}},
+	}
+
+	for _, tt := range tests {
+		if got := characterClasses(tt.password); got != tt.want {
+			t.Errorf("characterClasses(%q) = %+v, want %+v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestEstimateEntropy(t *testing.T) {
+	tests := []struct {
+		password string
+		want     float64
+	}{
+		{password: "", want: 0},
+		{password: "kxq", want: 3 * math.Log2(26)},
+		// Повтор и шаги к соседнему символу весят по четверти
+		{password: "aaa", want: 1.5 * math.Log2(26)},
+		{password: "abc", want: 1.5 * math.Log2(26)},
+		{password: "cba", want: 1.5 * math.Log2(26)},
+		{password: "k1Q-", want: 4 * math.Log2(95)},
+	}
+
+	for _, tt := range tests {
+		got := estimateEntropy(tt.password, characterClasses(tt.password))
+		if math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("estimateEntropy(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestScoreFor(t *testing.T) {
+	tests := []struct {
+		entropy float64
+		want    int
+	}{
+		{entropy: 0, want: 0},
+		{entropy: 27.9, want: 0},
+		{entropy: 28, want: 1},
+		{entropy: 36, want: 2},
+		{entropy: 60, want: 3},
+		{entropy: 79.9, want: 3},
+		{entropy: 80, want: 4},
+		{entropy: 500, want: 4},
+	}
+
+	for _, tt := range tests {
+		if got := scoreFor(tt.entropy); got != tt.want {
+			t.Errorf("scoreFor(%v) = %d, want %d", tt.entropy, got, tt.want)
+		}
+	}
+}
+
+func TestEvaluateBreached(t *testing.T) {
+	var buf bytes.Buffer
+	writer := breach.NewWriter(&buf)
+	hashes := []string{sha1Hex("amber-glacier-compass-91") + ":1", sha1Hex("violet-harbor-lantern-58") + ":12"}
+	slices.Sort(hashes)
+	for _, line := range hashes {
+		hash, count, err := breach.ParseLine(line)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := writer.Add(hash, count); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "breached.txt")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name      string
+		minCount  int
+		password  string
+		wantRules []string
+	}{
+		{name: "breached", password: "violet-harbor-lantern-58", wantRules: []string{RuleBreachedPassword}},
+		{name: "seen once", password: "amber-glacier-compass-91", wantRules: []string{RuleBreachedPassword}},
+		{name: "below min count", minCount: 5, password: "amber-glacier-compass-91"},
+		{name: "clean", password: "copper-meadow-signal-37"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			policy := newTestPolicy(t, config.PasswordPolicyConfig{BreachedPasswordsPath: path, BreachedMinCount: tt.minCount})
+			defer policy.Close()
+
+			result := policy.Evaluate(tt.password, UserInfo{})
+			if got := rules(result); !slices.Equal(got, tt.wantRules) && len(got)+len(tt.wantRules) > 0 {
+				t.Fatalf("rules = %v, want %v", got, tt.wantRules)
+			}
+			// Утекший пароль не считается стойким, как бы длинен он ни был
+			if len(tt.wantRules) > 0 && result.Score != 0 {
+				t.Fatalf("score = %d for a breached password", result.Score)
+			}
+		})
+	}
+}
+
+func sha1Hex(password string) string {
+	sum := sha1.Sum([]byte(password))
+	return strings.ToUpper(hex.EncodeToString(sum[:]))
+}
+
+func TestCheckReuse(t *testing.T) {
+	hash := func(password string) []byte {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return hashed
+	}
+	history := [][]byte{hash("violet-harbor-lantern-58"), nil, hash("amber-glacier-compass-91")}
+
+	tests := []struct {
+		name     string
+		password string
+		history  [][]byte
+		want     bool
+	}{
+		{name: "current", password: "violet-harbor-lantern-58", history: history, want: true},
+		{name: "older", password: "amber-glacier-compass-91", history: history, want: true},
+		{name: "new", password: "copper-meadow-signal-37", history: history},
+		// Пустой хеш, например у аккаунта без пароля, ничему не равен
+		{name: "empty password", password: "", history: history},
+		{name: "no history", password: "violet-harbor-lantern-58"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var result Result
+			result.CheckReuse(tt.password, tt.history)
+			if got := slices.Equal(rules(result), []string{RulePasswordReused}); got != tt.want {
+				t.Fatalf("reused = %v, want %v (rules %v)", got, tt.want, rules(result))
+			}
+		})
+	}
+}
@@ -0,0 +1,42 @@
+package passwordpolicy
+
+import (
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	errorReason = "PASSWORD_POLICY_VIOLATION"
+	errorDomain = "auth"
+	// Поле запроса, к которому относятся нарушения
+	passwordField = "password"
+)
+
+// Err возвращает nil для допустимого пароля, иначе InvalidArgument с
+// нарушениями в BadRequest и кодами правил в ErrorInfo.
+func (r Result) Err() error {
+	if r.Acceptable() {
+		return nil
+	}
+
+	badRequest := &errdetails.BadRequest{}
+	info := &errdetails.ErrorInfo{
+		Reason:   errorReason,
+		Domain:   errorDomain,
+		Metadata: make(map[string]string, len(r.Violations)),
+	}
+	for _, violation := range r.Violations {
+		badRequest.FieldViolations = append(badRequest.FieldViolations, &errdetails.BadRequest_FieldViolation{
+			Field:       passwordField,
+			Description: violation.Description,
+		})
+		info.Metadata[violation.Rule] = violation.Description
+	}
+
+	st := status.New(codes.InvalidArgument, "password does not meet the policy")
+	if detailed, err := st.WithDetails(badRequest, info); err == nil {
+		st = detailed
+	}
+	return st.Err()
+}
@@ -0,0 +1,54 @@
+package passwordpolicy
+
+import (
+	"testing"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestResultErr(t *testing.T) {
+	if err := (Result{Score: 4}).Err(); err != nil {
+		t.Fatalf("Err for an acceptable password = %v", err)
+	}
+
+	result := Result{Violations: []Violation{
+		{Rule: RuleMinLength, Description: "password must be at least 8 characters long"},
+		{Rule: RuleDigit, Description: "password must contain a digit"},
+	}}
+	st := status.Convert(result.Err())
+	if st.Code() != codes.InvalidArgument {
+		t.Fatalf("code = %v, want InvalidArgument", st.Code())
+	}
+
+	var badRequest *errdetails.BadRequest
+	var info *errdetails.ErrorInfo
+	for _, detail := range st.Details() {
+		switch detail := detail.(type) {
+		case *errdetails.BadRequest:
+			badRequest = detail
+		case *errdetails.ErrorInfo:
+			info = detail
+		}
+	}
+	if badRequest == nil || info == nil {
+		t.Fatalf("details = %v, want BadRequest and ErrorInfo", st.Details())
+	}
+
+	if len(badRequest.GetFieldViolations()) != 2 {
+		t.Fatalf("field violations = %v", badRequest.GetFieldViolations())
+	}
+	for i, violation := range badRequest.GetFieldViolations() {
+		if violation.GetField() != "password" || violation.GetDescription() != result.Violations[i].Description {
+			t.Fatalf("field violation %d = %v", i, violation)
+		}
+	}
+
+	if info.GetReason() != "PASSWORD_POLICY_VIOLATION" || info.GetDomain() != "auth" {
+		t.Fatalf("error info = %v", info)
+	}
+	if len(info.GetMetadata()) != 2 || info.GetMetadata()[RuleDigit] != "password must contain a digit" {
+		t.Fatalf("error info metadata = %v", info.GetMetadata())
+	}
+}
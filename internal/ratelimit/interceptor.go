@@ -0,0 +1,124 @@
+package ratelimit
+
+import (
+	"auth/internal/identity"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"math"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// RetryAfterHeader - заголовок ответа с числом секунд до следующей попытки.
+const RetryAfterHeader = "retry-after"
+
+// UnaryServerInterceptor отклоняет вызовы сверх лимита с
+// codes.ResourceExhausted, заголовком retry-after и RetryInfo в деталях.
+func (l *Limiter) UnaryServerInterceptor(ctx context.Context, req any, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (any, error) {
+	rules := l.rules[info.FullMethod]
+
+	var wait time.Duration
+	for _, rule := range rules {
+		client := clientKey(ctx, req, rule.Key)
+		if ok, retry := l.allow(rule, client); !ok {
+			wait = max(wait, retry)
+		}
+	}
+	if wait == 0 {
+		return handler(ctx, req)
+	}
+
+	seconds := int64(math.Ceil(wait.Seconds()))
+	l.logger.Warn("rate limit exceeded", "method", info.FullMethod, "retry_after", seconds)
+
+	if err := grpc.SetHeader(ctx, metadata.Pairs(RetryAfterHeader, strconv.FormatInt(seconds, 10))); err != nil {
+		l.logger.Warn("failed to set retry-after header", "error", err)
+	}
+
+	st := status.New(codes.ResourceExhausted, "too many requests, retry after "+strconv.FormatInt(seconds, 10)+" seconds")
+	if detailed, err := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(time.Duration(seconds) * time.Second)}); err == nil {
+		st = detailed
+	}
+	return nil, st.Err()
+}
+
+// clientKey возвращает ключ клиента по правилу. Имя и API-ключ хешируются,
+// чтобы не хранить их в ключах хранилища; если их нет в запросе, клиент
+// различается по адресу.
+func clientKey(ctx context.Context, req any, key string) string {
+	switch key {
+	case KeyUsername:
+		if name := username(req); name != "" {
+			return "u:" + digest(canonicalLogin(name))
+		}
+	case KeyAPIKey:
+		if apiKey := apiKey(ctx, req); apiKey != "" {
+			return "k:" + digest(apiKey)
+		}
+	}
+	return "ip:" + peerIP(ctx)
+}
+
+func username(req any) string {
+	if r, ok := req.(interface{ GetLogin() string }); ok && strings.TrimSpace(r.GetLogin()) != "" {
+		return strings.TrimSpace(r.GetLogin())
+	}
+	if r, ok := req.(interface{ GetUsername() string }); ok && strings.TrimSpace(r.GetUsername()) != "" {
+		return strings.TrimSpace(r.GetUsername())
+	}
+	if r, ok := req.(interface{ GetEmail() string }); ok {
+		return strings.TrimSpace(r.GetEmail())
+	}
+	return ""
+}
+
+// canonicalLogin приводит логин к виду, в котором его ищет сервис, иначе
+// "ALICE" и "ａｌｉｃｅ" расходовали бы разные лимиты одной учетной
+// записи.
+func canonicalLogin(login string) string {
+	if identity.IsEmail(login) {
+		if email, err := identity.NormalizeEmail(login); err == nil {
+			return email
+		}
+	}
+	return identity.Canonical(login)
+}
+
+func apiKey(ctx context.Context, req any) string {
+	if r, ok := req.(interface{ GetApiKey() string }); ok && r.GetApiKey() != "" {
+		return r.GetApiKey()
+	}
+	md, _ := metadata.FromIncomingContext(ctx)
+	if values := md.Get("x-api-key"); len(values) > 0 {
+		return values[0]
+	}
+	return ""
+}
+
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return "unknown"
+	}
+	host, _, err := net.SplitHostPort(p.Addr.String())
+	if err != nil {
+		return p.Addr.String()
+	}
+	return host
+}
+
+func digest(value string) string {
+	sum := sha256.Sum256([]byte(value))
+	return hex.EncodeToString(sum[:16])
+}
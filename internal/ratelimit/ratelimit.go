@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"auth/internal/config"
+	"auth/internal/redis"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+)
+
+// Ключи клиентов, по которым считаются вызовы.
+const (
+	KeyIP       = "ip"
+	KeyUsername = "username"
+	KeyAPIKey   = "api_key"
+)
+
+// Limiter считает вызовы по скользящему окну: число вызовов в текущем
+// фиксированном окне плюс доля предыдущего окна, пропорциональная его
+// перекрытию со скользящим. Счетчики хранятся в общем хранилище, а при
+// его ошибках - в памяти процесса.
+type Limiter struct {
+	rules  map[string][]config.RateLimitRule
+	store  redis.Redis
+	local  *redis.InMemory
+	logger *slog.Logger
+	now    func() time.Time
+}
+
+func New(cfg config.RateLimitConfig, store redis.Redis, logger *slog.Logger) (*Limiter, error) {
+	rules := make(map[string][]config.RateLimitRule)
+	if cfg.Enabled {
+		for _, rule := range cfg.Rules {
+			if err := validateRule(rule); err != nil {
+				return nil, err
+			}
+			rules[rule.Method] = append(rules[rule.Method], rule)
+		}
+	}
+
+	return &Limiter{
+		rules:  rules,
+		store:  store,
+		local:  redis.NewInMemory(),
+		logger: logger,
+		now:    time.Now,
+	}, nil
+}
+
+func validateRule(rule config.RateLimitRule) error {
+	if rule.Method == "" {
+		return errors.New("rate limit rule without method")
+	}
+	switch rule.Key {
+	case KeyIP, KeyUsername, KeyAPIKey:
+	default:
+		return fmt.Errorf("rate limit rule for %s: unknown key %q", rule.Method, rule.Key)
+	}
+	if rule.Limit <= 0 || rule.Window <= 0 {
+		return fmt.Errorf("rate limit rule for %s: limit and window must be positive", rule.Method)
+	}
+	return nil
+}
+
+// allow учитывает вызов клиента client по правилу и сообщает, пропущен ли
+// он. Для отклоненного вызова возвращается время до следующей попытки.
+func (l *Limiter) allow(rule config.RateLimitRule, client string) (bool, time.Duration) {
+	now := l.now()
+	window := now.UnixNano() / int64(rule.Window)
+	elapsed := time.Duration(now.UnixNano() - window*int64(rule.Window))
+
+	prefix := "ratelimit:" + rule.Method + ":" + rule.Key + ":" + client + ":"
+	current, previous, err := count(l.store, prefix, window, rule.Window)
+	if err != nil {
+		l.logger.Warn("rate limit store is unavailable, counting locally", "error", err)
+		current, previous, _ = count(l.local, prefix, window, rule.Window)
+	}
+
+	rate := float64(previous)*float64(rule.Window-elapsed)/float64(rule.Window) + float64(current)
+	if rate <= float64(rule.Limit) {
+		return true, 0
+	}
+
+	return false, retryAfter(rule, current, previous, elapsed)
+}
+
+// count увеличивает счетчик текущего окна и читает счетчик предыдущего.
+// Отклоненные вызовы тоже учитываются, чтобы непрерывный перебор не
+// получал новых попыток.
+func count(store redis.Redis, prefix string, window int64, length time.Duration) (int64, int64, error) {
+	current, err := store.Incr(prefix+strconv.FormatInt(window, 10), 2*length)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	value, err := store.Get(prefix + strconv.FormatInt(window-1, 10))
+	if err != nil {
+		if errors.Is(err, redis.ErrNotFound) {
+			return current, 0, nil
+		}
+		return 0, 0, err
+	}
+	previous, _ := strconv.ParseInt(value, 10, 64)
+
+	return current, previous, nil
+}
+
+// retryAfter оценивает, когда следующий вызов уложится в лимит, если до
+// тех пор вызовов не будет.
+func retryAfter(rule config.RateLimitRule, current, previous int64, elapsed time.Duration) time.Duration {
+	limit := float64(rule.Limit)
+	length := float64(rule.Window)
+
+	// Доля предыдущего окна убывает до конца текущего
+	if float64(current+1) <= limit && previous > 0 {
+		wait := length - float64(elapsed) - length*(limit-float64(current+1))/float64(previous)
+		return max(time.Duration(wait), time.Second)
+	}
+
+	// Иначе ждем, пока в следующем окне убудет доля текущего
+	wait := length - float64(elapsed)
+	if limit > 1 {
+		wait += max(length*(1-(limit-1)/float64(current)), 0)
+	} else {
+		wait += length
+	}
+	return max(time.Duration(wait), time.Second)
+}
@@ -0,0 +1,317 @@
+package ratelimit
+
+import (
+	"auth/internal/config"
+	"auth/internal/redis"
+	pb "auth/proto/auth"
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+)
+
+const loginMethod = "/auth.AuthService/Login"
+
+// windowStart - начало фиксированного окна длиной в минуту.
+var windowStart = time.Unix(1_700_000_040, 0)
+
+func newTestLimiter(t *testing.T, store redis.Redis, rules ...config.RateLimitRule) (*Limiter, *time.Time) {
+	t.Helper()
+	limiter, err := New(config.RateLimitConfig{Enabled: true, Rules: rules}, store, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	now := windowStart
+	limiter.now = func() time.Time { return now }
+	return limiter, &now
+}
+
+func TestNewRejects(t *testing.T) {
+	tests := []struct {
+		name string
+		rule config.RateLimitRule
+	}{
+		{name: "no method", rule: config.RateLimitRule{Key: KeyIP, Limit: 1, Window: time.Minute}},
+		{name: "unknown key", rule: config.RateLimitRule{Method: loginMethod, Key: "session", Limit: 1, Window: time.Minute}},
+		{name: "zero limit", rule: config.RateLimitRule{Method: loginMethod, Key: KeyIP, Window: time.Minute}},
+		{name: "negative window", rule: config.RateLimitRule{Method: loginMethod, Key: KeyIP, Limit: 1, Window: -time.Minute}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := config.RateLimitConfig{Enabled: true, Rules: []config.RateLimitRule{tt.rule}}
+			if _, err := New(cfg, redis.NewInMemory(), slog.Default()); err == nil {
+				t.Fatal("New accepted an invalid rule")
+			}
+
+			// Правила выключенного ограничения не проверяются и не действуют
+			cfg.Enabled = false
+			limiter, err := New(cfg, redis.NewInMemory(), slog.Default())
+			if err != nil || len(limiter.rules) != 0 {
+				t.Fatalf("New(disabled) = %v rules, %v", len(limiter.rules), err)
+			}
+		})
+	}
+}
+
+func TestAllowSlidingWindow(t *testing.T) {
+	rule := config.RateLimitRule{Method: loginMethod, Key: KeyIP, Limit: 10, Window: time.Minute}
+	limiter, now := newTestLimiter(t, redis.NewInMemory(), rule)
+
+	allowed := func() int {
+		n := 0
+		for range 20 {
+			if ok, _ := limiter.allow(rule, "client"); ok {
+				n++
+			}
+		}
+		return n
+	}
+
+	tests := []struct {
+		name    string
+		advance time.Duration
+		want    int
+	}{
+		// 20 вызовов в первом окне, из них 10 сверх лимита
+		{name: "first window", want: 10},
+		// Предыдущее окно (20 вызовов) учитывается наполовину, и лимит уже
+		// исчерпан
+		{name: "half of the next window", advance: 90 * time.Second, want: 0},
+		// Отклоненные вызовы тоже считаются: 20 * 0.25 + 20 сверх лимита
+		{name: "three quarters of the window", advance: 15 * time.Second, want: 0},
+		// Через два окна старые вызовы не учитываются
+		{name: "two windows later", advance: 2 * time.Minute, want: 10},
+	}
+
+	for _, tt := range tests {
+		*now = now.Add(tt.advance)
+		if got := allowed(); got != tt.want {
+			t.Fatalf("%s: allowed %d calls, want %d", tt.name, got, tt.want)
+		}
+	}
+
+	// Счетчики раздельные по клиентам
+	if ok, _ := limiter.allow(rule, "other"); !ok {
+		t.Fatal("call of another client rejected")
+	}
+}
+
+func TestAllowPartialPreviousWindow(t *testing.T) {
+	rule := config.RateLimitRule{Method: loginMethod, Key: KeyIP, Limit: 10, Window: time.Minute}
+	limiter, now := newTestLimiter(t, redis.NewInMemory(), rule)
+
+	for range 8 {
+		limiter.allow(rule, "client")
+	}
+
+	// Через полтора окна от предыдущего остается 8 * 0.5 = 4
+	*now = now.Add(90 * time.Second)
+	for i := range 6 {
+		if ok, _ := limiter.allow(rule, "client"); !ok {
+			t.Fatalf("call %d rejected", i+1)
+		}
+	}
+	ok, retry := limiter.allow(rule, "client")
+	if ok {
+		t.Fatal("call over the limit allowed")
+	}
+	if retry < time.Second || retry > 2*time.Minute {
+		t.Fatalf("retry = %v", retry)
+	}
+}
+
+func TestRetryAfter(t *testing.T) {
+	rule := func(limit int) config.RateLimitRule {
+		return config.RateLimitRule{Method: loginMethod, Key: KeyIP, Limit: limit, Window: time.Minute}
+	}
+
+	tests := []struct {
+		name     string
+		rule     config.RateLimitRule
+		current  int64
+		previous int64
+		elapsed  time.Duration
+		want     time.Duration
+	}{
+		{
+			// 60 - 30 - 60*4/11: к этому моменту 11*(21.8/60) + 6 = 10
+			name: "previous window decays", rule: rule(10), current: 5, previous: 11, elapsed: 30 * time.Second,
+			want: 8181818181 * time.Nanosecond,
+		},
+		{
+			// Конец окна плюс 60*(1 - 9/11) следующего
+			name: "current window is full", rule: rule(10), current: 11, elapsed: 0,
+			want: 70909090909 * time.Nanosecond,
+		},
+		{name: "limit of one", rule: rule(1), current: 2, elapsed: 10 * time.Second, want: 110 * time.Second},
+		{name: "at least a second", rule: rule(10), current: 5, previous: 11, elapsed: 59 * time.Second, want: time.Second},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := retryAfter(tt.rule, tt.current, tt.previous, tt.elapsed)
+			if diff := got - tt.want; diff < -time.Microsecond || diff > time.Microsecond {
+				t.Fatalf("retryAfter = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestAllowFallsBackToLocal(t *testing.T) {
+	rule := config.RateLimitRule{Method: loginMethod, Key: KeyIP, Limit: 2, Window: time.Minute}
+	limiter, _ := newTestLimiter(t, failingStore{}, rule)
+
+	// Без общего хранилища лимит все равно действует в пределах процесса
+	for i := range 2 {
+		if ok, _ := limiter.allow(rule, "client"); !ok {
+			t.Fatalf("call %d rejected", i+1)
+		}
+	}
+	if ok, _ := limiter.allow(rule, "client"); ok {
+		t.Fatal("call over the limit allowed")
+	}
+}
+
+func TestClientKey(t *testing.T) {
+	addr := &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 51234}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: addr})
+	withHeader := metadata.NewIncomingContext(ctx, metadata.Pairs("x-api-key", "ak_header"))
+
+	tests := []struct {
+		name string
+		ctx  context.Context
+		req  any
+		key  string
+		want string
+	}{
+		{name: "ip", ctx: ctx, req: &pb.LoginRequest{Login: "alice"}, key: KeyIP, want: "ip:203.0.113.7"},
+		{name: "no peer", ctx: context.Background(), req: &pb.LoginRequest{}, key: KeyIP, want: "ip:unknown"},
+		{name: "login", ctx: ctx, req: &pb.LoginRequest{Login: " Alice "}, key: KeyUsername, want: "u:" + digest("alice")},
+		{name: "username", ctx: ctx, req: &pb.RegisterRequest{Username: "alice"}, key: KeyUsername, want: "u:" + digest("alice")},
+		{name: "email", ctx: ctx, req: &pb.RequestPasswordResetRequest{Email: "Alice@Example.com"}, key: KeyUsername, want: "u:" + digest("alice@example.com")},
+		{name: "login compatibility form", ctx: ctx, req: &pb.LoginRequest{Login: "ＡＬＩＣＥ"}, key: KeyUsername, want: "u:" + digest("alice")},
+		{name: "login folded", ctx: ctx, req: &pb.LoginRequest{Login: "Straße"}, key: KeyUsername, want: "u:" + digest("strasse")},
+		{name: "login email", ctx: ctx, req: &pb.LoginRequest{Login: " ALICE@Example.COM "}, key: KeyUsername, want: "u:" + digest("alice@example.com")},
+		{name: "empty login", ctx: ctx, req: &pb.LoginRequest{Login: "  "}, key: KeyUsername, want: "ip:203.0.113.7"},
+		{name: "api key in request", ctx: withHeader, req: &pb.ValidateAPIKeyRequest{ApiKey: "ak_request"}, key: KeyAPIKey, want: "k:" + digest("ak_request")},
+		{name: "api key in metadata", ctx: withHeader, req: &pb.LoginRequest{}, key: KeyAPIKey, want: "k:" + digest("ak_header")},
+		{name: "no api key", ctx: ctx, req: &pb.LoginRequest{}, key: KeyAPIKey, want: "ip:203.0.113.7"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := clientKey(tt.ctx, tt.req, tt.key); got != tt.want {
+				t.Fatalf("clientKey = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestUnaryServerInterceptor(t *testing.T) {
+	limiter, _ := newTestLimiter(t, redis.NewInMemory(),
+		config.RateLimitRule{Method: loginMethod, Key: KeyUsername, Limit: 2, Window: time.Minute},
+		config.RateLimitRule{Method: loginMethod, Key: KeyIP, Limit: 3, Window: time.Minute},
+	)
+	info := &grpc.UnaryServerInfo{FullMethod: loginMethod}
+	handled := 0
+	handler := func(ctx context.Context, req any) (any, error) {
+		handled++
+		return "ok", nil
+	}
+	peerCtx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP("203.0.113.7"), Port: 1}})
+
+	call := func(login string) (*headerStream, error) {
+		stream := &headerStream{}
+		ctx := grpc.NewContextWithServerTransportStream(peerCtx, stream)
+		_, err := limiter.UnaryServerInterceptor(ctx, &pb.LoginRequest{Login: login}, info, handler)
+		return stream, err
+	}
+
+	tests := []struct {
+		login string
+		want  codes.Code
+	}{
+		{login: "alice"},
+		{login: "alice"},
+		// Лимит по имени исчерпан
+		{login: "alice", want: codes.ResourceExhausted},
+		// Другое имя проходит, пока не исчерпан лимит по адресу
+		{login: "bob", want: codes.ResourceExhausted},
+	}
+
+	for i, tt := range tests {
+		stream, err := call(tt.login)
+		if status.Code(err) != tt.want {
+			t.Fatalf("call %d (%s): code = %v, want %v", i+1, tt.login, status.Code(err), tt.want)
+		}
+		if tt.want == codes.OK {
+			continue
+		}
+
+		retry := stream.header.Get(RetryAfterHeader)
+		if len(retry) != 1 || retry[0] == "0" {
+			t.Fatalf("retry-after = %v", retry)
+		}
+		var info *errdetails.RetryInfo
+		for _, detail := range status.Convert(err).Details() {
+			if d, ok := detail.(*errdetails.RetryInfo); ok {
+				info = d
+			}
+		}
+		if info == nil || info.GetRetryDelay().AsDuration() < time.Second {
+			t.Fatalf("RetryInfo = %v", info)
+		}
+		if !strings.Contains(status.Convert(err).Message(), "retry after "+retry[0]+" seconds") {
+			t.Fatalf("message = %q, retry-after = %s", status.Convert(err).Message(), retry[0])
+		}
+	}
+	if handled != 2 {
+		t.Fatalf("handler called %d times, want 2", handled)
+	}
+
+	// Методы без правил не ограничиваются
+	other := &grpc.UnaryServerInfo{FullMethod: "/auth.AuthService/ValidateToken"}
+	for range 10 {
+		if _, err := limiter.UnaryServerInterceptor(peerCtx, &pb.ValidateTokenRequest{}, other, handler); err != nil {
+			t.Fatalf("unlimited method: %v", err)
+		}
+	}
+}
+
+// headerStream запоминает заголовки, выставленные обработчиком.
+type headerStream struct {
+	header metadata.MD
+}
+
+func (s *headerStream) Method() string { return loginMethod }
+
+func (s *headerStream) SetHeader(md metadata.MD) error {
+	s.header = metadata.Join(s.header, md)
+	return nil
+}
+
+func (s *headerStream) SendHeader(md metadata.MD) error { return s.SetHeader(md) }
+
+func (s *headerStream) SetTrailer(metadata.MD) error { return nil }
+
+var errStore = errors.New("store is down")
+
+type failingStore struct{}
+
+func (failingStore) Put(string, string, time.Duration) error   { return errStore }
+func (failingStore) Get(string) (string, error)                { return "", errStore }
+func (failingStore) Delete(string) error                       { return errStore }
+func (failingStore) Take(string) (string, error)               { return "", errStore }
+func (failingStore) Incr(string, time.Duration) (int64, error) { return 0, errStore }
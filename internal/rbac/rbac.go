@@ -0,0 +1,88 @@
+package rbac
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"regexp"
+)
+
+// PermissionManageRoles дает доступ к административным RPC ролей. Первую
+// роль с этим правом назначают через cmd/rbac.
+const PermissionManageRoles = "roles:manage"
+
+// PermissionWriteRelations дает право записывать и удалять кортежи
+// AuthzService.
+const PermissionWriteRelations = "relations:write"
+
+// PermissionReadRelations дает право проверять отношения любых субъектов и
+// раскрывать множества субъектов в AuthzService.
+const PermissionReadRelations = "relations:read"
+
+// PermissionUnlockAccounts дает право снимать блокировку входа.
+const PermissionUnlockAccounts = "accounts:unlock"
+
+// PermissionReadAudit дает доступ к журналу аудита.
+const PermissionReadAudit = "audit:read"
+
+// Роли участника внутри организации.
+const (
+	OrgRoleOwner  = "owner"
+	OrgRoleAdmin  = "admin"
+	OrgRoleMember = "member"
+)
+
+// ValidOrgRole сообщает, является ли role ролью в организации.
+func ValidOrgRole(role string) bool {
+	return role == OrgRoleOwner || role == OrgRoleAdmin || role == OrgRoleMember
+}
+
+const (
+	maxNameLength = 64
+	// MaxPermissionsPerRole ограничивает размер роли и claims в токене
+	MaxPermissionsPerRole = 100
+)
+
+var (
+	ErrInvalidRoleName   = errors.New("role name may contain lowercase letters, digits, '.', '_' and '-'")
+	ErrInvalidPermission = errors.New("permission must look like resource:action, e.g. users:read")
+)
+
+var (
+	roleNamePattern   = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*$`)
+	permissionPattern = regexp.MustCompile(`^[a-z0-9][a-z0-9._-]*(:[a-z0-9][a-z0-9._-]*)+$`)
+)
+
+func ValidateRoleName(name string) error {
+	if len(name) > maxNameLength || !roleNamePattern.MatchString(name) {
+		return ErrInvalidRoleName
+	}
+	return nil
+}
+
+func ValidatePermission(permission string) error {
+	if len(permission) > maxNameLength || !permissionPattern.MatchString(permission) {
+		return ErrInvalidPermission
+	}
+	return nil
+}
+
+// RoleNames возвращает имена ролей для claim roles.
+func RoleNames(roles []entity.Role) []string {
+	names := make([]string, 0, len(roles))
+	for _, role := range roles {
+		names = append(names, role.Name)
+	}
+	return names
+}
+
+// HasPermission сообщает, дает ли хотя бы одна из ролей право permission.
+func HasPermission(roles []entity.Role, permission string) bool {
+	for _, role := range roles {
+		for _, p := range role.Permissions {
+			if p.Name == permission {
+				return true
+			}
+		}
+	}
+	return false
+}
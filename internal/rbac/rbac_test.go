@@ -0,0 +1,137 @@
+package rbac
+
+import (
+	"auth/internal/entity"
+	"errors"
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestValidateRoleName(t *testing.T) {
+	tests := []struct {
+		name    string
+		wantErr bool
+	}{
+		{name: "admin"},
+		{name: "billing-admin"},
+		{name: "team.lead_2"},
+		{name: "0day"},
+		{name: strings.Repeat("r", maxNameLength)},
+		{name: "", wantErr: true},
+		{name: "Admin", wantErr: true},
+		{name: "-admin", wantErr: true},
+		{name: ".admin", wantErr: true},
+		{name: "billing admin", wantErr: true},
+		{name: "billing:admin", wantErr: true},
+		{name: "админ", wantErr: true},
+		{name: strings.Repeat("r", maxNameLength+1), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateRoleName(tt.name)
+			if tt.wantErr != errors.Is(err, ErrInvalidRoleName) || (!tt.wantErr && err != nil) {
+				t.Fatalf("ValidateRoleName(%q) = %v, want error %v", tt.name, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidatePermission(t *testing.T) {
+	tests := []struct {
+		permission string
+		wantErr    bool
+	}{
+		{permission: "users:read"},
+		{permission: "roles:manage"},
+		{permission: "reports.v2:export-csv"},
+		{permission: "org:members:invite"},
+		{permission: "users", wantErr: true},
+		{permission: "users:", wantErr: true},
+		{permission: ":read", wantErr: true},
+		{permission: "users::read", wantErr: true},
+		{permission: "Users:read", wantErr: true},
+		{permission: "users:read all", wantErr: true},
+		{permission: "users:*", wantErr: true},
+		{permission: "", wantErr: true},
+		{permission: "users:" + strings.Repeat("r", maxNameLength), wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.permission, func(t *testing.T) {
+			err := ValidatePermission(tt.permission)
+			if tt.wantErr != errors.Is(err, ErrInvalidPermission) || (!tt.wantErr && err != nil) {
+				t.Fatalf("ValidatePermission(%q) = %v, want error %v", tt.permission, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidOrgRole(t *testing.T) {
+	tests := []struct {
+		role string
+		want bool
+	}{
+		{role: OrgRoleOwner, want: true},
+		{role: OrgRoleAdmin, want: true},
+		{role: OrgRoleMember, want: true},
+		{role: "Owner"},
+		{role: "guest"},
+		{role: ""},
+	}
+
+	for _, tt := range tests {
+		if got := ValidOrgRole(tt.role); got != tt.want {
+			t.Errorf("ValidOrgRole(%q) = %v, want %v", tt.role, got, tt.want)
+		}
+	}
+}
+
+func role(name string, permissions ...string) entity.Role {
+	r := entity.Role{Name: name}
+	for _, permission := range permissions {
+		r.Permissions = append(r.Permissions, entity.Permission{Name: permission})
+	}
+	return r
+}
+
+func TestHasPermission(t *testing.T) {
+	roles := []entity.Role{
+		role("viewer", "users:read", "reports:read"),
+		role("auditor", PermissionReadAudit),
+		role("empty"),
+	}
+
+	tests := []struct {
+		name       string
+		roles      []entity.Role
+		permission string
+		want       bool
+	}{
+		{name: "first role", roles: roles, permission: "users:read", want: true},
+		{name: "second role", roles: roles, permission: PermissionReadAudit, want: true},
+		{name: "missing permission", roles: roles, permission: "users:write"},
+		{name: "prefix of a permission", roles: roles, permission: "users"},
+		{name: "role name is not a permission", roles: roles, permission: "viewer"},
+		{name: "no roles", permission: "users:read"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HasPermission(tt.roles, tt.permission); got != tt.want {
+				t.Fatalf("HasPermission(%q) = %v, want %v", tt.permission, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoleNames(t *testing.T) {
+	got := RoleNames([]entity.Role{role("viewer"), role("auditor")})
+	if want := []string{"viewer", "auditor"}; !slices.Equal(got, want) {
+		t.Fatalf("RoleNames = %v, want %v", got, want)
+	}
+	if got := RoleNames(nil); got == nil || len(got) != 0 {
+		t.Fatalf("RoleNames(nil) = %#v, want an empty slice", got)
+	}
+}
@@ -0,0 +1,119 @@
+package redis
+
+import (
+	"strconv"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type entry struct {
+	value     string
+	expiresAt time.Time
+}
+
+func (e entry) expired(now time.Time) bool {
+	return !e.expiresAt.IsZero() && now.After(e.expiresAt)
+}
+
+// InMemory - замена Redis для запуска без него. Данные живут только
+// в памяти процесса и не разделяются между репликами.
+type InMemory struct {
+	mu        sync.Mutex
+	data      map[string]entry
+	lastSweep time.Time
+}
+
+func NewInMemory() *InMemory {
+	return &InMemory{
+		data: make(map[string]entry),
+	}
+}
+
+func (m *InMemory) Put(key, value string, expiration time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.evict(now)
+
+	e := entry{value: value}
+	if expiration > 0 {
+		e.expiresAt = now.Add(expiration)
+	}
+	m.data[key] = e
+
+	return nil
+}
+
+func (m *InMemory) Get(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.data[key]
+	if !ok || e.expired(time.Now()) {
+		delete(m.data, key)
+		return "", ErrNotFound
+	}
+
+	return e.value, nil
+}
+
+func (m *InMemory) Delete(key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.data, key)
+	return nil
+}
+
+func (m *InMemory) Take(key string) (string, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	e, ok := m.data[key]
+	delete(m.data, key)
+	if !ok || e.expired(time.Now()) {
+		return "", ErrNotFound
+	}
+
+	return e.value, nil
+}
+
+// Incr увеличивает счетчик; нечисловое значение считается нулем.
+func (m *InMemory) Incr(key string, expiration time.Duration) (int64, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	m.evict(now)
+
+	var value int64
+	if e, ok := m.data[key]; ok && !e.expired(now) {
+		value, _ = strconv.ParseInt(e.value, 10, 64)
+	}
+	value++
+
+	e := entry{value: strconv.FormatInt(value, 10)}
+	if expiration > 0 {
+		e.expiresAt = now.Add(expiration)
+	}
+	m.data[key] = e
+
+	return value, nil
+}
+
+// evict удаляет просроченные записи не чаще раза в sweepInterval.
+func (m *InMemory) evict(now time.Time) {
+	if now.Sub(m.lastSweep) < sweepInterval {
+		return
+	}
+	m.lastSweep = now
+
+	for key, e := range m.data {
+		if e.expired(now) {
+			delete(m.data, key)
+		}
+	}
+}
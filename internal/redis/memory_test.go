@@ -0,0 +1,192 @@
+package redis
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+// expire переводит срок записи в прошлое, не дожидаясь его.
+func (m *InMemory) expire(key string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	e := m.data[key]
+	e.expiresAt = time.Now().Add(-time.Second)
+	m.data[key] = e
+}
+
+func TestInMemoryPutGet(t *testing.T) {
+	tests := []struct {
+		name       string
+		expiration time.Duration
+		expire     bool
+		want       string
+		wantErr    error
+	}{
+		{"without expiration", 0, false, "value", nil},
+		{"not expired", time.Hour, false, "value", nil},
+		{"expired", time.Hour, true, "", ErrNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := NewInMemory()
+			if err := m.Put("key", "value", tt.expiration); err != nil {
+				t.Fatalf("Put: %v", err)
+			}
+			if tt.expire {
+				m.expire("key")
+			}
+
+			got, err := m.Get("key")
+			if !errors.Is(err, tt.wantErr) || got != tt.want {
+				t.Fatalf("Get = %q, %v, want %q, %v", got, err, tt.want, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInMemoryDelete(t *testing.T) {
+	m := NewInMemory()
+	if err := m.Put("key", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Delete("key"); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if _, err := m.Get("key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Get after Delete: err = %v, want ErrNotFound", err)
+	}
+	// Удаление отсутствующего ключа не ошибка
+	if err := m.Delete("missing"); err != nil {
+		t.Errorf("Delete missing: %v", err)
+	}
+}
+
+func TestInMemoryTake(t *testing.T) {
+	m := NewInMemory()
+	if err := m.Put("key", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := m.Take("key")
+	if err != nil || got != "value" {
+		t.Fatalf("Take = %q, %v, want value", got, err)
+	}
+	if _, err := m.Take("key"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("second Take: err = %v, want ErrNotFound", err)
+	}
+
+	if err := m.Put("stale", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	m.expire("stale")
+	if _, err := m.Take("stale"); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Take of expired key: err = %v, want ErrNotFound", err)
+	}
+}
+
+func TestInMemoryTakeConcurrent(t *testing.T) {
+	m := NewInMemory()
+	if err := m.Put("key", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+
+	const workers = 8
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	taken := 0
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if _, err := m.Take("key"); err == nil {
+				mu.Lock()
+				taken++
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	if taken != 1 {
+		t.Fatalf("value taken %d times, want once", taken)
+	}
+}
+
+func TestInMemoryIncr(t *testing.T) {
+	m := NewInMemory()
+
+	for want := int64(1); want <= 3; want++ {
+		got, err := m.Incr("counter", time.Hour)
+		if err != nil || got != want {
+			t.Fatalf("Incr = %d, %v, want %d", got, err, want)
+		}
+	}
+
+	// Просроченный счетчик начинается заново
+	m.expire("counter")
+	if got, _ := m.Incr("counter", time.Hour); got != 1 {
+		t.Errorf("Incr after expiration = %d, want 1", got)
+	}
+
+	// Нечисловое значение считается нулем
+	if err := m.Put("text", "abc", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if got, _ := m.Incr("text", time.Hour); got != 1 {
+		t.Errorf("Incr of text value = %d, want 1", got)
+	}
+}
+
+func TestInMemoryIncrConcurrent(t *testing.T) {
+	m := NewInMemory()
+
+	const workers, increments = 8, 100
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < increments; j++ {
+				if _, err := m.Incr("counter", time.Hour); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if got, _ := m.Get("counter"); got != "800" {
+		t.Errorf("counter = %s, want %d", got, workers*increments)
+	}
+}
+
+func TestInMemoryEvict(t *testing.T) {
+	m := NewInMemory()
+	if err := m.Put("stale", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	if err := m.Put("fresh", "value", time.Hour); err != nil {
+		t.Fatal(err)
+	}
+	m.expire("stale")
+
+	// Просроченные записи удаляются при записи не чаще раза в sweepInterval
+	m.mu.Lock()
+	m.lastSweep = time.Now().Add(-2 * sweepInterval)
+	m.mu.Unlock()
+	if err := m.Put("other", "value", 0); err != nil {
+		t.Fatal(err)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if _, ok := m.data["stale"]; ok {
+		t.Error("expired entry was not evicted")
+	}
+	if _, ok := m.data["fresh"]; !ok {
+		t.Error("live entry was evicted")
+	}
+}
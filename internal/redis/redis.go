@@ -1,33 +1,82 @@
 package redis
 
-import "github.com/go-redis/redis"
+import (
+	"errors"
+	"time"
 
+	"github.com/go-redis/redis"
+)
 
+var ErrNotFound = errors.New("key not found")
 
 type Redis interface {
-	Put(key, value string) error
+	Put(key, value string, expiration time.Duration) error
 	Get(key string) (string, error)
+	Delete(key string) error
+	// Take атомарно читает и удаляет значение: из нескольких одновременных
+	// вызовов его получит только один
+	Take(key string) (string, error)
+	Incr(key string, expiration time.Duration) (int64, error)
 }
 
 type RedisImpl struct {
 	redisClient *redis.Client
 }
 
-func NewRedisImpl(dsn string) *RedisImpl {
+func NewRedisImpl(dsn, password string, db int) *RedisImpl {
 	return &RedisImpl{
 		redisClient: redis.NewClient(&redis.Options{
 			Addr:     dsn,
-			Password: "", 
-			DB:       0,
+			Password: password,
+			DB:       db,
 		}),
 	}
 }
 
-func (r *RedisImpl) Put(key, value string) error {
-	return nil
+// Put сохраняет значение. Нулевой expiration означает хранение без срока.
+func (r *RedisImpl) Put(key, value string, expiration time.Duration) error {
+	return r.redisClient.Set(key, value, expiration).Err()
 }
 
 func (r *RedisImpl) Get(key string) (string, error) {
-	return "", nil
+	value, err := r.redisClient.Get(key).Result()
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	return value, err
+}
+
+func (r *RedisImpl) Delete(key string) error {
+	return r.redisClient.Del(key).Err()
 }
 
+// Take читает и удаляет ключ в одной транзакции MULTI/EXEC.
+func (r *RedisImpl) Take(key string) (string, error) {
+	var get *redis.StringCmd
+	_, err := r.redisClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		get = pipe.Get(key)
+		pipe.Del(key)
+		return nil
+	})
+	if errors.Is(err, redis.Nil) {
+		return "", ErrNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return get.Val(), nil
+}
+
+// Incr атомарно увеличивает счетчик и продлевает его срок на expiration.
+func (r *RedisImpl) Incr(key string, expiration time.Duration) (int64, error) {
+	var incr *redis.IntCmd
+	_, err := r.redisClient.TxPipelined(func(pipe redis.Pipeliner) error {
+		incr = pipe.Incr(key)
+		pipe.Expire(key, expiration)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return incr.Val(), nil
+}
@@ -3,12 +3,16 @@ package postgres
 import (
 	"auth/internal/config"
 	"auth/internal/entity"
+	"auth/internal/identity"
 	"errors"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 type Storage interface {
@@ -16,9 +20,100 @@ type Storage interface {
 	DeleteUser(userName string) error
 	GetUserByUserName(userName string) (*entity.User, error)
 	GetUserByEmail(email string) (*entity.User, error)
-	ChangePassword(email string, newPassword []byte) error
+	ChangePassword(email string, newPassword []byte, historySize int) error
+	GetPasswordHistory(userID uint, limit int) ([][]byte, error)
+	GetUserByID(id uint) (*entity.User, error)
+
+	SaveRefreshToken(userID uint, familyID string, clientID string, organizationID uint, scope string, tokenHash string, expiresAt time.Time) error
+	GetRefreshToken(tokenHash string) (*entity.RefreshToken, error)
+	MarkRefreshTokenUsed(id uint) error
+	RevokeRefreshTokenFamily(familyID string) error
+
+	SetEmailVerified(userID uint) error
+	SaveOneTimeToken(userID uint, purpose string, tokenHash string, expiresAt time.Time) error
+	GetOneTimeToken(purpose string, tokenHash string) (*entity.OneTimeToken, error)
+	MarkOneTimeTokenUsed(id uint) error
+	InvalidateOneTimeTokens(userID uint, purpose string) error
+	CountOneTimeTokens(userID uint, purpose string, since time.Time) (int64, error)
+
+	SetTOTPSecret(userID uint, encryptedSecret []byte) error
+	EnableTOTP(userID uint) error
+	DisableTOTP(userID uint) error
+	UseTOTPCounter(userID uint, counter int64) error
+
+	ReplaceRecoveryCodes(userID uint, codeHashes []string) error
+	UseRecoveryCode(userID uint, codeHash string) error
+	CountRecoveryCodes(userID uint) (int64, error)
+
+	SaveWebAuthnCredential(userID uint, credentialID []byte, publicKey []byte, signCount uint32, transports []string) error
+	GetWebAuthnCredential(credentialID []byte) (*entity.WebAuthnCredential, error)
+	ListWebAuthnCredentials(userID uint) ([]entity.WebAuthnCredential, error)
+	UpdateWebAuthnSignCount(id uint, signCount uint32) error
+
+	SaveOAuthClient(client *entity.OAuthClient) error
+	GetOAuthClient(clientID string) (*entity.OAuthClient, error)
+	SaveAuthorizationCode(code *entity.AuthorizationCode) error
+	GetAuthorizationCode(codeHash string) (*entity.AuthorizationCode, error)
+	MarkAuthorizationCodeUsed(id uint) error
+	GetOAuthConsent(userID uint, clientID string) (*entity.OAuthConsent, error)
+	SaveOAuthConsent(userID uint, clientID string, scope string) error
+
+	GetFederatedIdentity(issuer string, subject string) (*entity.FederatedIdentity, error)
+	SaveFederatedIdentity(userID uint, issuer string, subject string, email string) error
+	CreateFederatedUser(userName string, email string, emailVerified bool, issuer string, subject string) (*entity.User, error)
+
+	SaveAPIKey(key *entity.APIKey) error
+	GetAPIKeyByHash(keyHash string) (*entity.APIKey, error)
+	ListAPIKeys(userID uint, organizationID uint) ([]entity.APIKey, error)
+	RevokeAPIKey(userID uint, organizationID uint, id uint) error
+	TouchAPIKey(id uint) error
+
+	CreateRole(name string, description string, permissions []string) (*entity.Role, error)
+	GetRoleByName(name string) (*entity.Role, error)
+	ListRoles() ([]entity.Role, error)
+	AssignRole(userID uint, roleID uint) error
+	UnassignRole(userID uint, roleID uint) error
+	GetUserRoles(userID uint) ([]entity.Role, error)
+
+	WriteRelationTuples(writes []entity.RelationTuple, deletes []entity.RelationTuple) (uint64, error)
+	ReadRelationTuples(filter entity.RelationTupleFilter, revision uint64) ([]entity.RelationTuple, error)
+	LatestRelationRevision() (uint64, error)
+
+	CreateOrganization(name string, slug string, ownerID uint, ownerRole string) (*entity.Organization, error)
+	GetOrganization(id uint) (*entity.Organization, error)
+	GetMembership(organizationID uint, userID uint) (*entity.Membership, error)
+	ListMemberships(userID uint) ([]entity.Membership, error)
+	ListMembers(organizationID uint) ([]entity.Membership, error)
+
+	SaveInvitation(invitation *entity.Invitation) error
+	GetInvitationByTokenHash(tokenHash string) (*entity.Invitation, error)
+	ListInvitations(organizationID uint) ([]entity.Invitation, error)
+	RevokeInvitation(organizationID uint, id uint) error
+	AcceptInvitation(invitationID uint, userID uint) error
+	CreateUserFromInvitation(invitationID uint, userName string, email string, age int32, hashedPassword []byte) (*entity.User, error)
+
+	SaveLoginEvent(event *entity.LoginEvent) error
+	ListLoginEvents(userID uint, beforeID uint, limit int) ([]entity.LoginEvent, error)
+	HasSuccessfulLogin(userID uint, fingerprint string) (bool, error)
+
+	AppendAuditEntry(entry *entity.AuditEntry, seal func(entry *entity.AuditEntry) string) error
+	ListAuditEntries(filter entity.AuditFilter, beforeID uint64, limit int) ([]entity.AuditEntry, error)
+	AuditEntriesAfter(afterID uint64, limit int) ([]entity.AuditEntry, error)
 }
 
+var (
+	ErrRefreshTokenAlreadyUsed = errors.New("refresh token already used")
+	ErrOneTimeTokenAlreadyUsed = errors.New("one-time token already used")
+	ErrTOTPCodeAlreadyUsed     = errors.New("totp code already used")
+	ErrRecoveryCodeNotFound    = errors.New("recovery code not found")
+	ErrUserAlreadyExists       = errors.New("user already exists")
+	ErrAuthorizationCodeUsed   = errors.New("authorization code already used")
+	ErrRoleAlreadyExists       = errors.New("role already exists")
+	ErrOrganizationExists      = errors.New("organization already exists")
+	ErrInvitationUsed          = errors.New("invitation already accepted or revoked")
+	ErrAlreadyMember           = errors.New("user is already a member of the organization")
+)
+
 type StorageImpl struct {
 	db *gorm.DB
 }
@@ -32,15 +127,20 @@ func NewStoragePostgres(cfg *config.Config) (*StorageImpl, error) {
 	return &StorageImpl{db: db}, nil
 }
 
+// SaveUser сохраняет пользователя с каноническими именем и почтой.
+// Если имя или почта заняты, возвращает ErrUserAlreadyExists.
 func (s *StorageImpl) SaveUser(userName string, email string, age int32, hashedPassword []byte) error {
 	user := &entity.User{
-		UserName:       userName,
+		UserName:       identity.Canonical(userName),
 		HashedPassword: hashedPassword,
 		Age:            age,
-		Email:          email,
+		Email:          identity.Canonical(email),
 	}
 
 	if err := s.db.Create(user).Error; err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return ErrUserAlreadyExists
+		}
 		return fmt.Errorf("failed to save user: %w", err)
 	}
 
@@ -62,7 +162,7 @@ func (s *StorageImpl) DeleteUser(userName string) error {
 
 func (s *StorageImpl) GetUserByUserName(userName string) (*entity.User, error) {
 	var user entity.User
-	if err := s.db.Where("user_name = ?", userName).First(&user).Error; err != nil {
+	if err := s.db.Where("user_name = ?", identity.Canonical(userName)).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			log.Println("user record not found")
 			return nil, gorm.ErrRecordNotFound
@@ -76,7 +176,7 @@ func (s *StorageImpl) GetUserByUserName(userName string) (*entity.User, error) {
 
 func (s *StorageImpl) GetUserByEmail(email string) (*entity.User, error) {
 	var user entity.User
-	if err := s.db.Where("email = ?", email).First(&user).Error; err != nil {
+	if err := s.db.Where("email = ?", identity.Canonical(email)).First(&user).Error; err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			log.Println("user record not found")
 			return nil, gorm.ErrRecordNotFound
@@ -88,8 +188,31 @@ func (s *StorageImpl) GetUserByEmail(email string) (*entity.User, error) {
 	return &user, nil
 }
 
-func (s *StorageImpl) ChangePassword(email string, newPassword []byte) error {
-	if err := s.db.Model(&entity.User{}).Where("email = ?", email).Update("hashed_password", newPassword).Error; err != nil {
+// ChangePassword меняет пароль и гасит все неиспользованные коды сброса.
+// Прежний хеш уходит в историю; вместе с текущим хранится historySize
+// последних паролей, более старые удаляются.
+func (s *StorageImpl) ChangePassword(email string, newPassword []byte, historySize int) error {
+	var userID uint
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		var user entity.User
+		if err := tx.Where("email = ?", identity.Canonical(email)).First(&user).Error; err != nil {
+			return err
+		}
+		userID = user.ID
+
+		if err := rotatePasswordHistory(tx, &user, historySize); err != nil {
+			return err
+		}
+
+		if err := tx.Model(&user).Update("hashed_password", newPassword).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&entity.OneTimeToken{}).
+			Where("user_id = ? AND purpose = ? AND used_at IS NULL", user.ID, entity.PurposePasswordReset).
+			Update("used_at", time.Now()).Error
+	})
+	if err != nil {
 		if errors.Is(err, gorm.ErrRecordNotFound) {
 			log.Println("user not found")
 			return err
@@ -97,11 +220,1084 @@ func (s *StorageImpl) ChangePassword(email string, newPassword []byte) error {
 		log.Printf("error changing the password: %v", err)
 		return err
 	}
-	log.Println("password changed", email, newPassword)
+	log.Println("password changed", userID)
+
+	return nil
+}
+
+func (s *StorageImpl) GetUserByID(id uint) (*entity.User, error) {
+	var user entity.User
+	if err := s.db.First(&user, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("user record not found")
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching user: %v", err)
+		return nil, err
+	}
+
+	return &user, nil
+}
+
+func (s *StorageImpl) SaveRefreshToken(userID uint, familyID string, clientID string, organizationID uint, scope string, tokenHash string, expiresAt time.Time) error {
+	token := &entity.RefreshToken{
+		UserID:         userID,
+		FamilyID:       familyID,
+		ClientID:       clientID,
+		OrganizationID: organizationID,
+		Scope:          scope,
+		TokenHash:      tokenHash,
+		ExpiresAt:      expiresAt,
+	}
+
+	if err := s.db.Create(token).Error; err != nil {
+		return fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) GetRefreshToken(tokenHash string) (*entity.RefreshToken, error) {
+	var token entity.RefreshToken
+	if err := s.db.Where("token_hash = ?", tokenHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("refresh token not found")
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching refresh token: %v", err)
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+// MarkRefreshTokenUsed помечает токен использованным. Условие на used_at
+// не дает двум параллельным запросам ротировать один и тот же токен.
+func (s *StorageImpl) MarkRefreshTokenUsed(id uint) error {
+	result := s.db.Model(&entity.RefreshToken{}).
+		Where("id = ? AND used_at IS NULL AND revoked_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		log.Printf("error marking refresh token as used: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRefreshTokenAlreadyUsed
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) RevokeRefreshTokenFamily(familyID string) error {
+	if err := s.db.Model(&entity.RefreshToken{}).
+		Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", time.Now()).Error; err != nil {
+		log.Printf("error revoking refresh token family: %v", err)
+		return err
+	}
+	log.Println("refresh token family revoked", familyID)
+
+	return nil
+}
+
+func (s *StorageImpl) SetEmailVerified(userID uint) error {
+	if err := s.db.Model(&entity.User{}).Where("id = ?", userID).Update("email_verified", true).Error; err != nil {
+		log.Printf("error verifying email: %v", err)
+		return err
+	}
+	log.Println("email verified", userID)
+
+	return nil
+}
+
+func (s *StorageImpl) SaveOneTimeToken(userID uint, purpose string, tokenHash string, expiresAt time.Time) error {
+	token := &entity.OneTimeToken{
+		UserID:    userID,
+		Purpose:   purpose,
+		TokenHash: tokenHash,
+		ExpiresAt: expiresAt,
+	}
+
+	if err := s.db.Create(token).Error; err != nil {
+		return fmt.Errorf("failed to save one-time token: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) GetOneTimeToken(purpose string, tokenHash string) (*entity.OneTimeToken, error) {
+	var token entity.OneTimeToken
+	if err := s.db.Where("purpose = ? AND token_hash = ?", purpose, tokenHash).First(&token).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("one-time token not found")
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching one-time token: %v", err)
+		return nil, err
+	}
+
+	return &token, nil
+}
+
+func (s *StorageImpl) MarkOneTimeTokenUsed(id uint) error {
+	result := s.db.Model(&entity.OneTimeToken{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		log.Printf("error marking one-time token as used: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrOneTimeTokenAlreadyUsed
+	}
+
+	return nil
+}
+
+// InvalidateOneTimeTokens гасит все неиспользованные токены пользователя
+// с заданной целью.
+func (s *StorageImpl) InvalidateOneTimeTokens(userID uint, purpose string) error {
+	if err := s.db.Model(&entity.OneTimeToken{}).
+		Where("user_id = ? AND purpose = ? AND used_at IS NULL", userID, purpose).
+		Update("used_at", time.Now()).Error; err != nil {
+		log.Printf("error invalidating one-time tokens: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) CountOneTimeTokens(userID uint, purpose string, since time.Time) (int64, error) {
+	var count int64
+	if err := s.db.Model(&entity.OneTimeToken{}).
+		Where("user_id = ? AND purpose = ? AND created_at >= ?", userID, purpose, since).
+		Count(&count).Error; err != nil {
+		log.Printf("error counting one-time tokens: %v", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// SetTOTPSecret сохраняет новый, еще не подтвержденный секрет.
+func (s *StorageImpl) SetTOTPSecret(userID uint, encryptedSecret []byte) error {
+	if err := s.db.Model(&entity.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+		"totp_secret":       encryptedSecret,
+		"totp_enabled":      false,
+		"totp_last_counter": 0,
+	}).Error; err != nil {
+		log.Printf("error saving totp secret: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) EnableTOTP(userID uint) error {
+	if err := s.db.Model(&entity.User{}).Where("id = ?", userID).Update("totp_enabled", true).Error; err != nil {
+		log.Printf("error enabling totp: %v", err)
+		return err
+	}
+	log.Println("totp enabled", userID)
+
+	return nil
+}
+
+// DisableTOTP снимает второй фактор вместе с резервными кодами.
+func (s *StorageImpl) DisableTOTP(userID uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(&entity.User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"totp_secret":       nil,
+			"totp_enabled":      false,
+			"totp_last_counter": 0,
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error
+	})
+	if err != nil {
+		log.Printf("error disabling totp: %v", err)
+		return err
+	}
+	log.Println("totp disabled", userID)
+
+	return nil
+}
+
+// UseTOTPCounter запоминает шаг последнего принятого кода. Код с тем же
+// или более ранним шагом больше не будет принят.
+func (s *StorageImpl) UseTOTPCounter(userID uint, counter int64) error {
+	result := s.db.Model(&entity.User{}).
+		Where("id = ? AND totp_last_counter < ?", userID, counter).
+		Update("totp_last_counter", counter)
+	if result.Error != nil {
+		log.Printf("error saving totp counter: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrTOTPCodeAlreadyUsed
+	}
+
+	return nil
+}
+
+// ReplaceRecoveryCodes удаляет прежний набор кодов и сохраняет новый.
+func (s *StorageImpl) ReplaceRecoveryCodes(userID uint, codeHashes []string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Unscoped().Where("user_id = ?", userID).Delete(&entity.RecoveryCode{}).Error; err != nil {
+			return err
+		}
+
+		codes := make([]entity.RecoveryCode, 0, len(codeHashes))
+		for _, hash := range codeHashes {
+			codes = append(codes, entity.RecoveryCode{UserID: userID, CodeHash: hash})
+		}
+		if len(codes) == 0 {
+			return nil
+		}
+
+		return tx.Create(&codes).Error
+	})
+	if err != nil {
+		log.Printf("error replacing recovery codes: %v", err)
+		return err
+	}
+	log.Println("recovery codes replaced", userID)
+
+	return nil
+}
+
+func (s *StorageImpl) UseRecoveryCode(userID uint, codeHash string) error {
+	result := s.db.Model(&entity.RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", userID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		log.Printf("error using recovery code: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrRecoveryCodeNotFound
+	}
+
+	return nil
+}
+
+// CountRecoveryCodes возвращает число неиспользованных кодов.
+func (s *StorageImpl) CountRecoveryCodes(userID uint) (int64, error) {
+	var count int64
+	if err := s.db.Model(&entity.RecoveryCode{}).
+		Where("user_id = ? AND used_at IS NULL", userID).
+		Count(&count).Error; err != nil {
+		log.Printf("error counting recovery codes: %v", err)
+		return 0, err
+	}
+
+	return count, nil
+}
+
+func (s *StorageImpl) SaveWebAuthnCredential(userID uint, credentialID []byte, publicKey []byte, signCount uint32, transports []string) error {
+	credential := &entity.WebAuthnCredential{
+		UserID:       userID,
+		CredentialID: credentialID,
+		PublicKey:    publicKey,
+		SignCount:    signCount,
+		Transports:   strings.Join(transports, ","),
+	}
+
+	if err := s.db.Create(credential).Error; err != nil {
+		return fmt.Errorf("failed to save webauthn credential: %w", err)
+	}
+	log.Println("webauthn credential saved", userID)
+
+	return nil
+}
+
+func (s *StorageImpl) GetWebAuthnCredential(credentialID []byte) (*entity.WebAuthnCredential, error) {
+	var credential entity.WebAuthnCredential
+	if err := s.db.Where("credential_id = ?", credentialID).First(&credential).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			log.Println("webauthn credential not found")
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching webauthn credential: %v", err)
+		return nil, err
+	}
+
+	return &credential, nil
+}
+
+func (s *StorageImpl) ListWebAuthnCredentials(userID uint) ([]entity.WebAuthnCredential, error) {
+	var credentials []entity.WebAuthnCredential
+	if err := s.db.Where("user_id = ?", userID).Find(&credentials).Error; err != nil {
+		log.Printf("error fetching webauthn credentials: %v", err)
+		return nil, err
+	}
+
+	return credentials, nil
+}
+
+func (s *StorageImpl) UpdateWebAuthnSignCount(id uint, signCount uint32) error {
+	if err := s.db.Model(&entity.WebAuthnCredential{}).Where("id = ?", id).Updates(map[string]interface{}{
+		"sign_count":   signCount,
+		"last_used_at": time.Now(),
+	}).Error; err != nil {
+		log.Printf("error updating webauthn sign count: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) SaveOAuthClient(client *entity.OAuthClient) error {
+	if err := s.db.Create(client).Error; err != nil {
+		return fmt.Errorf("failed to save oauth client: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) GetOAuthClient(clientID string) (*entity.OAuthClient, error) {
+	var client entity.OAuthClient
+	if err := s.db.Where("client_id = ?", clientID).First(&client).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching oauth client: %v", err)
+		return nil, err
+	}
+
+	return &client, nil
+}
+
+func (s *StorageImpl) SaveAuthorizationCode(code *entity.AuthorizationCode) error {
+	if err := s.db.Create(code).Error; err != nil {
+		return fmt.Errorf("failed to save authorization code: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) GetAuthorizationCode(codeHash string) (*entity.AuthorizationCode, error) {
+	var code entity.AuthorizationCode
+	if err := s.db.Where("code_hash = ?", codeHash).First(&code).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching authorization code: %v", err)
+		return nil, err
+	}
+
+	return &code, nil
+}
+
+// MarkAuthorizationCodeUsed помечает код использованным. Условие в запросе
+// гарантирует, что из двух одновременных обменов успешен только один.
+func (s *StorageImpl) MarkAuthorizationCodeUsed(id uint) error {
+	result := s.db.Model(&entity.AuthorizationCode{}).
+		Where("id = ? AND used_at IS NULL", id).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		log.Printf("error marking authorization code as used: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrAuthorizationCodeUsed
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) GetOAuthConsent(userID uint, clientID string) (*entity.OAuthConsent, error) {
+	var consent entity.OAuthConsent
+	if err := s.db.Where("user_id = ? AND client_id = ?", userID, clientID).First(&consent).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching oauth consent: %v", err)
+		return nil, err
+	}
+
+	return &consent, nil
+}
+
+// SaveOAuthConsent создает или заменяет согласие пользователя для клиента.
+func (s *StorageImpl) SaveOAuthConsent(userID uint, clientID string, scope string) error {
+	consent := &entity.OAuthConsent{
+		UserID:   userID,
+		ClientID: clientID,
+		Scope:    scope,
+	}
+
+	err := s.db.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}, {Name: "client_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"scope", "updated_at"}),
+	}).Create(consent).Error
+	if err != nil {
+		log.Printf("error saving oauth consent: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) GetFederatedIdentity(issuer string, subject string) (*entity.FederatedIdentity, error) {
+	var federated entity.FederatedIdentity
+	if err := s.db.Where("issuer = ? AND subject = ?", issuer, subject).First(&federated).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching federated identity: %v", err)
+		return nil, err
+	}
+
+	return &federated, nil
+}
+
+func (s *StorageImpl) SaveFederatedIdentity(userID uint, issuer string, subject string, email string) error {
+	federated := &entity.FederatedIdentity{
+		UserID:  userID,
+		Issuer:  issuer,
+		Subject: subject,
+		Email:   email,
+	}
+
+	if err := s.db.Create(federated).Error; err != nil {
+		return fmt.Errorf("failed to save federated identity: %w", err)
+	}
 
 	return nil
 }
 
+// CreateFederatedUser создает пользователя без пароля вместе с привязкой
+// к внешнему провайдеру. Если имя или почта заняты, возвращает
+// ErrUserAlreadyExists.
+func (s *StorageImpl) CreateFederatedUser(userName string, email string, emailVerified bool, issuer string, subject string) (*entity.User, error) {
+	user := &entity.User{
+		UserName:      identity.Canonical(userName),
+		Email:         identity.Canonical(email),
+		EmailVerified: emailVerified,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&entity.FederatedIdentity{
+			UserID:  user.ID,
+			Issuer:  issuer,
+			Subject: subject,
+			Email:   user.Email,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrUserAlreadyExists
+		}
+		log.Printf("error creating federated user: %v", err)
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func (s *StorageImpl) SaveAPIKey(key *entity.APIKey) error {
+	if err := s.db.Create(key).Error; err != nil {
+		return fmt.Errorf("failed to save api key: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) GetAPIKeyByHash(keyHash string) (*entity.APIKey, error) {
+	var key entity.APIKey
+	if err := s.db.Where("key_hash = ?", keyHash).First(&key).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching api key: %v", err)
+		return nil, err
+	}
+
+	return &key, nil
+}
+
+// ListAPIKeys возвращает ключи пользователя, созданные в организации;
+// нулевой organizationID - личные ключи вне организаций.
+func (s *StorageImpl) ListAPIKeys(userID uint, organizationID uint) ([]entity.APIKey, error) {
+	var keys []entity.APIKey
+	if err := s.db.Where("user_id = ? AND organization_id = ?", userID, organizationID).Order("created_at").Find(&keys).Error; err != nil {
+		log.Printf("error listing api keys: %v", err)
+		return nil, err
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey отзывает ключ пользователя в организации. Чужой, созданный
+// в другой организации или уже отозванный ключ дает gorm.ErrRecordNotFound.
+func (s *StorageImpl) RevokeAPIKey(userID uint, organizationID uint, id uint) error {
+	result := s.db.Model(&entity.APIKey{}).
+		Where("id = ? AND user_id = ? AND organization_id = ? AND revoked_at IS NULL", id, userID, organizationID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Printf("error revoking api key: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) TouchAPIKey(id uint) error {
+	if err := s.db.Model(&entity.APIKey{}).Where("id = ?", id).Update("last_used_at", time.Now()).Error; err != nil {
+		log.Printf("error updating api key last use: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// CreateRole создает роль; недостающие права создаются вместе с ней.
+func (s *StorageImpl) CreateRole(name string, description string, permissions []string) (*entity.Role, error) {
+	role := &entity.Role{
+		Name:        name,
+		Description: description,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		for _, permissionName := range permissions {
+			permission := entity.Permission{Name: permissionName}
+			err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&permission).Error
+			if err != nil {
+				return err
+			}
+			if permission.ID == 0 {
+				if err := tx.Where("name = ?", permissionName).First(&permission).Error; err != nil {
+					return err
+				}
+			}
+			role.Permissions = append(role.Permissions, permission)
+		}
+
+		// Права уже сохранены выше, повторно их не создаем
+		return tx.Omit("Permissions.*").Create(role).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrRoleAlreadyExists
+		}
+		log.Printf("error creating role: %v", err)
+		return nil, err
+	}
+
+	return role, nil
+}
+
+func (s *StorageImpl) GetRoleByName(name string) (*entity.Role, error) {
+	var role entity.Role
+	if err := s.db.Preload("Permissions").Where("name = ?", name).First(&role).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching role: %v", err)
+		return nil, err
+	}
+
+	return &role, nil
+}
+
+func (s *StorageImpl) ListRoles() ([]entity.Role, error) {
+	var roles []entity.Role
+	if err := s.db.Preload("Permissions").Order("name").Find(&roles).Error; err != nil {
+		log.Printf("error listing roles: %v", err)
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// AssignRole назначает роль пользователю; повторное назначение не ошибка.
+func (s *StorageImpl) AssignRole(userID uint, roleID uint) error {
+	err := s.db.Clauses(clause.OnConflict{DoNothing: true}).Create(&entity.UserRole{
+		UserID: userID,
+		RoleID: roleID,
+	}).Error
+	if err != nil {
+		log.Printf("error assigning role: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) UnassignRole(userID uint, roleID uint) error {
+	result := s.db.Unscoped().Where("user_id = ? AND role_id = ?", userID, roleID).Delete(&entity.UserRole{})
+	if result.Error != nil {
+		log.Printf("error unassigning role: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) GetUserRoles(userID uint) ([]entity.Role, error) {
+	var roles []entity.Role
+	err := s.db.Preload("Permissions").
+		Joins("JOIN user_roles ON user_roles.role_id = roles.id").
+		Where("user_roles.user_id = ? AND user_roles.deleted_at IS NULL", userID).
+		Order("roles.name").
+		Find(&roles).Error
+	if err != nil {
+		log.Printf("error fetching user roles: %v", err)
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+// relationWriteLock - ключ advisory lock, которым сериализуются записи
+// кортежей: ревизии фиксируются строго по возрастанию, и чтение на
+// последней ревизии не пропускает более раннюю незавершенную запись.
+const relationWriteLock = 7420160
+
+// WriteRelationTuples атомарно добавляет и удаляет кортежи и возвращает
+// новую ревизию. Запись существующего и удаление отсутствующего кортежа
+// не ошибка.
+func (s *StorageImpl) WriteRelationTuples(writes []entity.RelationTuple, deletes []entity.RelationTuple) (uint64, error) {
+	var revision entity.RelationRevision
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", relationWriteLock).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Create(&revision).Error; err != nil {
+			return err
+		}
+
+		for _, tuple := range deletes {
+			err := tx.Model(&entity.RelationTuple{}).
+				Where("namespace = ? AND object_id = ? AND relation = ?", tuple.Namespace, tuple.ObjectID, tuple.Relation).
+				Where("subject_namespace = ? AND subject_id = ? AND subject_relation = ?", tuple.SubjectNamespace, tuple.SubjectID, tuple.SubjectRelation).
+				Where("deleted_revision IS NULL").
+				Update("deleted_revision", revision.ID).Error
+			if err != nil {
+				return err
+			}
+		}
+
+		for _, tuple := range writes {
+			tuple.ID = 0
+			tuple.CreatedRevision = revision.ID
+			tuple.DeletedRevision = nil
+			if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&tuple).Error; err != nil {
+				return err
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		log.Printf("error writing relation tuples: %v", err)
+		return 0, err
+	}
+
+	return revision.ID, nil
+}
+
+// ReadRelationTuples возвращает кортежи, существовавшие на ревизии revision.
+func (s *StorageImpl) ReadRelationTuples(filter entity.RelationTupleFilter, revision uint64) ([]entity.RelationTuple, error) {
+	query := s.db.Where("created_revision <= ? AND (deleted_revision IS NULL OR deleted_revision > ?)", revision, revision)
+	if filter.Namespace != "" {
+		query = query.Where("namespace = ?", filter.Namespace)
+	}
+	if filter.ObjectID != "" {
+		query = query.Where("object_id = ?", filter.ObjectID)
+	}
+	if filter.Relation != "" {
+		query = query.Where("relation = ?", filter.Relation)
+	}
+
+	var tuples []entity.RelationTuple
+	if err := query.Order("id").Find(&tuples).Error; err != nil {
+		log.Printf("error reading relation tuples: %v", err)
+		return nil, err
+	}
+
+	return tuples, nil
+}
+
+func (s *StorageImpl) LatestRelationRevision() (uint64, error) {
+	var revision uint64
+	if err := s.db.Model(&entity.RelationRevision{}).Select("COALESCE(MAX(id), 0)").Scan(&revision).Error; err != nil {
+		log.Printf("error fetching relation revision: %v", err)
+		return 0, err
+	}
+
+	return revision, nil
+}
+
+// CreateOrganization создает организацию и делает ownerID ее участником
+// с ролью ownerRole.
+func (s *StorageImpl) CreateOrganization(name string, slug string, ownerID uint, ownerRole string) (*entity.Organization, error) {
+	organization := &entity.Organization{
+		Name: name,
+		Slug: slug,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(organization).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&entity.Membership{
+			OrganizationID: organization.ID,
+			UserID:         ownerID,
+			Role:           ownerRole,
+		}).Error
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrOrganizationExists
+		}
+		log.Printf("error creating organization: %v", err)
+		return nil, err
+	}
+
+	return organization, nil
+}
+
+func (s *StorageImpl) GetOrganization(id uint) (*entity.Organization, error) {
+	var organization entity.Organization
+	if err := s.db.First(&organization, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching organization: %v", err)
+		return nil, err
+	}
+
+	return &organization, nil
+}
+
+func (s *StorageImpl) GetMembership(organizationID uint, userID uint) (*entity.Membership, error) {
+	var membership entity.Membership
+	err := s.db.Preload("Organization").
+		Where("organization_id = ? AND user_id = ?", organizationID, userID).
+		First(&membership).Error
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching membership: %v", err)
+		return nil, err
+	}
+
+	return &membership, nil
+}
+
+// ListMemberships возвращает организации пользователя в порядке вступления.
+func (s *StorageImpl) ListMemberships(userID uint) ([]entity.Membership, error) {
+	var memberships []entity.Membership
+	if err := s.db.Preload("Organization").Where("user_id = ?", userID).Order("created_at, id").Find(&memberships).Error; err != nil {
+		log.Printf("error listing memberships: %v", err)
+		return nil, err
+	}
+
+	return memberships, nil
+}
+
+func (s *StorageImpl) ListMembers(organizationID uint) ([]entity.Membership, error) {
+	var members []entity.Membership
+	if err := s.db.Preload("User").Where("organization_id = ?", organizationID).Order("created_at, id").Find(&members).Error; err != nil {
+		log.Printf("error listing members: %v", err)
+		return nil, err
+	}
+
+	return members, nil
+}
+
+func (s *StorageImpl) SaveInvitation(invitation *entity.Invitation) error {
+	if err := s.db.Create(invitation).Error; err != nil {
+		return fmt.Errorf("failed to save invitation: %w", err)
+	}
+
+	return nil
+}
+
+func (s *StorageImpl) GetInvitationByTokenHash(tokenHash string) (*entity.Invitation, error) {
+	var invitation entity.Invitation
+	if err := s.db.Where("token_hash = ?", tokenHash).First(&invitation).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, gorm.ErrRecordNotFound
+		}
+		log.Printf("error fetching invitation: %v", err)
+		return nil, err
+	}
+
+	return &invitation, nil
+}
+
+func (s *StorageImpl) ListInvitations(organizationID uint) ([]entity.Invitation, error) {
+	var invitations []entity.Invitation
+	if err := s.db.Where("organization_id = ?", organizationID).Order("created_at DESC, id DESC").Find(&invitations).Error; err != nil {
+		log.Printf("error listing invitations: %v", err)
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+// RevokeInvitation отзывает еще не принятое приглашение организации.
+func (s *StorageImpl) RevokeInvitation(organizationID uint, id uint) error {
+	result := s.db.Model(&entity.Invitation{}).
+		Where("id = ? AND organization_id = ? AND accepted_at IS NULL AND revoked_at IS NULL", id, organizationID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		log.Printf("error revoking invitation: %v", result.Error)
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+
+	return nil
+}
+
+// AcceptInvitation помечает приглашение принятым и добавляет пользователя
+// в организацию одной транзакцией.
+func (s *StorageImpl) AcceptInvitation(invitationID uint, userID uint) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		return acceptInvitation(tx, invitationID, userID)
+	})
+	if err != nil && !errors.Is(err, ErrInvitationUsed) && !errors.Is(err, ErrAlreadyMember) {
+		log.Printf("error accepting invitation: %v", err)
+	}
+
+	return err
+}
+
+// CreateUserFromInvitation завершает регистрацию по приглашению: почта
+// считается подтвержденной, так как токен пришел на нее.
+func (s *StorageImpl) CreateUserFromInvitation(invitationID uint, userName string, email string, age int32, hashedPassword []byte) (*entity.User, error) {
+	user := &entity.User{
+		UserName:       identity.Canonical(userName),
+		Email:          identity.Canonical(email),
+		Age:            age,
+		HashedPassword: hashedPassword,
+		EmailVerified:  true,
+	}
+
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+
+		return acceptInvitation(tx, invitationID, user.ID)
+	})
+	if err != nil {
+		if errors.Is(err, gorm.ErrDuplicatedKey) {
+			return nil, ErrUserAlreadyExists
+		}
+		if !errors.Is(err, ErrInvitationUsed) {
+			log.Printf("error creating invited user: %v", err)
+		}
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func acceptInvitation(tx *gorm.DB, invitationID uint, userID uint) error {
+	var invitation entity.Invitation
+	if err := tx.First(&invitation, invitationID).Error; err != nil {
+		return err
+	}
+
+	result := tx.Model(&entity.Invitation{}).
+		Where("id = ? AND accepted_at IS NULL AND revoked_at IS NULL", invitationID).
+		Updates(map[string]interface{}{"accepted_at": time.Now(), "accepted_by": userID})
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrInvitationUsed
+	}
+
+	err := tx.Create(&entity.Membership{
+		OrganizationID: invitation.OrganizationID,
+		UserID:         userID,
+		Role:           invitation.Role,
+	}).Error
+	if errors.Is(err, gorm.ErrDuplicatedKey) {
+		return ErrAlreadyMember
+	}
+
+	return err
+}
+
+func (s *StorageImpl) SaveLoginEvent(event *entity.LoginEvent) error {
+	if err := s.db.Create(event).Error; err != nil {
+		log.Printf("error saving login event: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListLoginEvents возвращает события пользователя от новых к старым.
+// Ненулевой beforeID продолжает список после события с этим ID.
+func (s *StorageImpl) ListLoginEvents(userID uint, beforeID uint, limit int) ([]entity.LoginEvent, error) {
+	query := s.db.Where("user_id = ?", userID)
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var events []entity.LoginEvent
+	if err := query.Order("id DESC").Limit(limit).Find(&events).Error; err != nil {
+		log.Printf("error listing login events: %v", err)
+		return nil, err
+	}
+
+	return events, nil
+}
+
+func rotatePasswordHistory(tx *gorm.DB, user *entity.User, historySize int) error {
+	stale := tx.Where("user_id = ?", user.ID)
+	if historySize <= 1 {
+		return stale.Delete(&entity.PasswordHistory{}).Error
+	}
+
+	if len(user.HashedPassword) > 0 {
+		if err := tx.Create(&entity.PasswordHistory{UserID: user.ID, HashedPassword: user.HashedPassword}).Error; err != nil {
+			return err
+		}
+	}
+
+	keep := tx.Model(&entity.PasswordHistory{}).Select("id").
+		Where("user_id = ?", user.ID).Order("id DESC").Limit(historySize - 1)
+	return stale.Where("id NOT IN (?)", keep).Delete(&entity.PasswordHistory{}).Error
+}
+
+// GetPasswordHistory возвращает прежние хеши пароля, от новых к старым.
+func (s *StorageImpl) GetPasswordHistory(userID uint, limit int) ([][]byte, error) {
+	if limit <= 0 {
+		return nil, nil
+	}
+
+	var hashes [][]byte
+	err := s.db.Model(&entity.PasswordHistory{}).Where("user_id = ?", userID).
+		Order("id DESC").Limit(limit).Pluck("hashed_password", &hashes).Error
+	if err != nil {
+		log.Printf("error fetching password history: %v", err)
+		return nil, err
+	}
+
+	return hashes, nil
+}
+
+// HasSuccessfulLogin сообщает, был ли у пользователя успешный вход с
+// отпечатком fingerprint; пустой fingerprint - с любого устройства.
+func (s *StorageImpl) HasSuccessfulLogin(userID uint, fingerprint string) (bool, error) {
+	query := s.db.Model(&entity.LoginEvent{}).Where("user_id = ? AND result = ?", userID, entity.LoginResultSuccess)
+	if fingerprint != "" {
+		query = query.Where("fingerprint = ?", fingerprint)
+	}
+
+	var count int64
+	if err := query.Limit(1).Count(&count).Error; err != nil {
+		log.Printf("error checking login events: %v", err)
+		return false, err
+	}
+
+	return count > 0, nil
+}
+
+// auditAppendLock - ключ advisory lock, которым сериализуется дописывание
+// журнала аудита: каждая запись ссылается на хеш предыдущей.
+const auditAppendLock = 7420161
+
+// AppendAuditEntry дописывает запись в конец цепочки. seal вызывается с
+// уже заполненным PrevHash и возвращает хеш записи.
+func (s *StorageImpl) AppendAuditEntry(entry *entity.AuditEntry, seal func(entry *entity.AuditEntry) string) error {
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("SELECT pg_advisory_xact_lock(?)", auditAppendLock).Error; err != nil {
+			return err
+		}
+
+		var last entity.AuditEntry
+		err := tx.Order("id DESC").Limit(1).Take(&last).Error
+		switch {
+		case err == nil:
+			entry.PrevHash = last.Hash
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			entry.PrevHash = ""
+		default:
+			return err
+		}
+
+		entry.Hash = seal(entry)
+		return tx.Create(entry).Error
+	})
+	if err != nil {
+		log.Printf("error appending audit entry: %v", err)
+		return err
+	}
+
+	return nil
+}
+
+// ListAuditEntries возвращает записи от новых к старым. Ненулевой beforeID
+// продолжает список после записи с этим ID.
+func (s *StorageImpl) ListAuditEntries(filter entity.AuditFilter, beforeID uint64, limit int) ([]entity.AuditEntry, error) {
+	query := s.db.Model(&entity.AuditEntry{})
+	if filter.Action != "" {
+		query = query.Where("action = ?", filter.Action)
+	}
+	if filter.ActorID != 0 {
+		query = query.Where("actor_id = ?", filter.ActorID)
+	}
+	if filter.SubjectID != 0 {
+		query = query.Where("subject_id = ?", filter.SubjectID)
+	}
+	if !filter.Since.IsZero() {
+		query = query.Where("created_at >= ?", filter.Since)
+	}
+	if !filter.Until.IsZero() {
+		query = query.Where("created_at < ?", filter.Until)
+	}
+	if beforeID != 0 {
+		query = query.Where("id < ?", beforeID)
+	}
+
+	var entries []entity.AuditEntry
+	if err := query.Order("id DESC").Limit(limit).Find(&entries).Error; err != nil {
+		log.Printf("error listing audit entries: %v", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
+// AuditEntriesAfter возвращает записи цепочки по порядку, начиная со
+// следующей после afterID.
+func (s *StorageImpl) AuditEntriesAfter(afterID uint64, limit int) ([]entity.AuditEntry, error) {
+	var entries []entity.AuditEntry
+	if err := s.db.Where("id > ?", afterID).Order("id").Limit(limit).Find(&entries).Error; err != nil {
+		log.Printf("error reading audit entries: %v", err)
+		return nil, err
+	}
+
+	return entries, nil
+}
+
 func ConnectToDb(cfg *config.Config) (*gorm.DB, error) {
 	dsn := fmt.Sprintf(
 		"host=%s user=%s password=%s dbname=%s port=%d sslmode=disable TimeZone=UTC",
@@ -112,7 +1308,8 @@ func ConnectToDb(cfg *config.Config) (*gorm.DB, error) {
 		cfg.DatabasePort,
 	)
 
-	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{})
+	// TranslateError превращает нарушение уникального индекса в gorm.ErrDuplicatedKey
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{TranslateError: true})
 	if err != nil {
 		return nil, fmt.Errorf("failed to connect to database: %w", err)
 	}
@@ -0,0 +1,47 @@
+package token
+
+import (
+	"auth/internal/entity"
+	"fmt"
+	"strconv"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// ProfileClaims - стандартные claims OpenID Connect о пользователе. Какие
+// из них заполнены, зависит от выданных клиенту scope.
+type ProfileClaims struct {
+	Email             string `json:"email,omitempty"`
+	EmailVerified     *bool  `json:"email_verified,omitempty"`
+	PreferredUsername string `json:"preferred_username,omitempty"`
+}
+
+// IDClaims - содержимое ID Token (OpenID Connect Core, раздел 2).
+type IDClaims struct {
+	jwt.RegisteredClaims
+	ProfileClaims
+	Nonce           string `json:"nonce,omitempty"`
+	AuthorizedParty string `json:"azp,omitempty"`
+}
+
+// IssueIDToken выдает ID Token для клиента clientID. Аудитория токена -
+// сам клиент, поэтому вместо access-токена он не принимается.
+func (m *Manager) IssueIDToken(user *entity.User, clientID, nonce string, profile ProfileClaims) (string, error) {
+	registered, err := m.registeredClaims(strconv.FormatUint(uint64(user.ID), 10), AccessTokenExpiration)
+	if err != nil {
+		return "", err
+	}
+	registered.Audience = jwt.ClaimStrings{clientID}
+
+	idToken, err := m.keys.Sign(&IDClaims{
+		RegisteredClaims: registered,
+		ProfileClaims:    profile,
+		Nonce:            nonce,
+		AuthorizedParty:  clientID,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to sign id token: %w", err)
+	}
+
+	return idToken, nil
+}
@@ -0,0 +1,450 @@
+package token
+
+import (
+	"auth/internal/config"
+	"auth/internal/entity"
+	"auth/internal/keyring"
+	"auth/internal/rbac"
+	"auth/internal/redis"
+	"auth/internal/storage/postgres"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+const (
+	AccessTokenExpiration  = 15 * time.Minute
+	RefreshTokenExpiration = 30 * 24 * time.Hour
+	MFAChallengeExpiration = 5 * time.Minute
+	InvitationExpiration   = 7 * 24 * time.Hour
+)
+
+// Назначение токена в claim token_use: токен второго шага входа нельзя
+// предъявить вместо access-токена.
+const (
+	TokenUseAccess = "access"
+	TokenUseMFA    = "mfa"
+	TokenUseClient = "client"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrRefreshTokenReused  = errors.New("refresh token reuse detected")
+	ErrInvalidToken        = errors.New("invalid token")
+	ErrTokenRevoked        = errors.New("token has been revoked")
+)
+
+const revokedKeyPrefix = "revoked:"
+
+// Claims - содержимое access-токена.
+type Claims struct {
+	jwt.RegisteredClaims
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+	TokenUse string `json:"token_use"`
+	ClientID string `json:"client_id,omitempty"`
+	Scope    string `json:"scope,omitempty"`
+	// Roles - роли пользователя на момент выдачи токена
+	Roles []string `json:"roles,omitempty"`
+	// OrgID и OrgRole - активная организация и роль в ней
+	OrgID   string `json:"org_id,omitempty"`
+	OrgRole string `json:"org_role,omitempty"`
+}
+
+// UserID возвращает идентификатор пользователя из sub.
+func (c *Claims) UserID() (uint, error) {
+	id, err := strconv.ParseUint(c.Subject, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid subject", ErrInvalidToken)
+	}
+	return uint(id), nil
+}
+
+// OrganizationID возвращает активную организацию; 0, если ее нет.
+func (c *Claims) OrganizationID() uint {
+	id, err := strconv.ParseUint(c.OrgID, 10, 64)
+	if err != nil {
+		return 0
+	}
+	return uint(id)
+}
+
+// Grant описывает, кому и с какими scope выдаются токены. Пустой ClientID
+// означает собственный вход через AuthService.
+type Grant struct {
+	ClientID string
+	Scope    string
+	// FamilyID можно задать заранее, иначе создается новая семья
+	FamilyID string
+	// OrganizationID - активная организация; пользователь должен в ней состоять
+	OrganizationID uint
+}
+
+// Pair - пара токенов, выдаваемая при логине и при обновлении.
+type Pair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    int64
+	Scope        string
+	UserID       uint
+	// OrganizationID - организация, попавшая в токен
+	OrganizationID uint
+	OrgRole        string
+}
+
+type Manager struct {
+	cfg     *config.Config
+	storage postgres.Storage
+	keys    *keyring.KeyRing
+	revoked redis.Redis
+	logger  *slog.Logger
+}
+
+func NewManager(cfg *config.Config, storage postgres.Storage, keys *keyring.KeyRing, revoked redis.Redis, logger *slog.Logger) *Manager {
+	return &Manager{
+		cfg:     cfg,
+		storage: storage,
+		keys:    keys,
+		revoked: revoked,
+		logger:  logger,
+	}
+}
+
+// Issue выдает access-токен и refresh-токен из новой семьи. Активной
+// становится первая организация, в которую вступил пользователь.
+func (m *Manager) Issue(user *entity.User) (*Pair, error) {
+	memberships, err := m.storage.ListMemberships(user.ID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memberships: %w", err)
+	}
+
+	var grant Grant
+	if len(memberships) > 0 {
+		grant.OrganizationID = memberships[0].OrganizationID
+	}
+
+	return m.IssueGrant(user, grant)
+}
+
+// IssueGrant выдает пару токенов OAuth-клиенту от имени пользователя.
+func (m *Manager) IssueGrant(user *entity.User, grant Grant) (*Pair, error) {
+	if grant.FamilyID == "" {
+		familyID, err := RandomString(16)
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate token family: %w", err)
+		}
+		grant.FamilyID = familyID
+	}
+
+	return m.issue(user, grant)
+}
+
+// Refresh обменивает refresh-токен на новую пару. Старый токен становится
+// недействительным; его повторное предъявление отзывает всю семью.
+func (m *Manager) Refresh(refreshToken string) (*Pair, error) {
+	return m.RefreshGrant(refreshToken, "")
+}
+
+// RefreshGrant работает как Refresh, но принимает только токены,
+// выданные клиенту clientID.
+func (m *Manager) RefreshGrant(refreshToken, clientID string) (*Pair, error) {
+	stored, err := m.storage.GetRefreshToken(Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrInvalidRefreshToken
+		}
+		return nil, fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	if stored.ClientID != clientID {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if stored.UsedAt != nil || stored.RevokedAt != nil {
+		return nil, m.reuseDetected(stored)
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	if err := m.storage.MarkRefreshTokenUsed(stored.ID); err != nil {
+		if errors.Is(err, postgres.ErrRefreshTokenAlreadyUsed) {
+			return nil, m.reuseDetected(stored)
+		}
+		return nil, fmt.Errorf("failed to mark refresh token as used: %w", err)
+	}
+
+	user, err := m.storage.GetUserByID(stored.UserID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get user: %w", err)
+	}
+
+	return m.issue(user, Grant{
+		ClientID:       stored.ClientID,
+		Scope:          stored.Scope,
+		FamilyID:       stored.FamilyID,
+		OrganizationID: stored.OrganizationID,
+	})
+}
+
+// IssueClientToken выдает access-токен самому клиенту (client_credentials).
+// Пользователя у такого токена нет, sub равен client_id.
+func (m *Manager) IssueClientToken(clientID, scope string) (string, error) {
+	claims, err := m.registeredClaims(clientID, AccessTokenExpiration)
+	if err != nil {
+		return "", err
+	}
+
+	return m.keys.Sign(&Claims{
+		RegisteredClaims: claims,
+		TokenUse:         TokenUseClient,
+		ClientID:         clientID,
+		Scope:            scope,
+	})
+}
+
+// ParseClientToken проверяет токен, выданный по client_credentials.
+func (m *Manager) ParseClientToken(tokenString string) (*Claims, error) {
+	return m.parse(tokenString, TokenUseClient)
+}
+
+// Parse проверяет подпись, срок действия, издателя и аудиторию
+// access-токена, а также что он не был отозван.
+func (m *Manager) Parse(tokenString string) (*Claims, error) {
+	return m.parse(tokenString, TokenUseAccess)
+}
+
+// IssueMFAChallenge выдает короткоживущий токен, который подтверждает,
+// что пароль проверен и остался второй фактор.
+func (m *Manager) IssueMFAChallenge(user *entity.User) (string, error) {
+	claims, err := m.newClaims(user, TokenUseMFA, MFAChallengeExpiration)
+	if err != nil {
+		return "", err
+	}
+
+	return m.keys.Sign(claims)
+}
+
+func (m *Manager) ParseMFAChallenge(tokenString string) (*Claims, error) {
+	return m.parse(tokenString, TokenUseMFA)
+}
+
+func (m *Manager) parse(tokenString, use string) (*Claims, error) {
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(keyring.Algorithms),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithLeeway(m.cfg.JWTConfig.Leeway),
+	}
+	if m.cfg.JWTConfig.Issuer != "" {
+		options = append(options, jwt.WithIssuer(m.cfg.JWTConfig.Issuer))
+	}
+	if m.cfg.JWTConfig.Audience != "" {
+		options = append(options, jwt.WithAudience(m.cfg.JWTConfig.Audience))
+	}
+
+	claims := &Claims{}
+	token, err := jwt.ParseWithClaims(tokenString, claims, m.keys.Keyfunc, options...)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidToken, err)
+	}
+	if !token.Valid {
+		return nil, fmt.Errorf("%w: invalid token claims", ErrInvalidToken)
+	}
+
+	if claims.ID == "" || claims.IssuedAt == nil {
+		return nil, fmt.Errorf("%w: token has no jti or iat", ErrInvalidToken)
+	}
+	if claims.TokenUse != use {
+		return nil, fmt.Errorf("%w: unexpected token use", ErrInvalidToken)
+	}
+	if use != TokenUseClient {
+		if _, err := claims.UserID(); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := m.revoked.Get(revokedKeyPrefix + claims.ID); err == nil {
+		return nil, ErrTokenRevoked
+	} else if !errors.Is(err, redis.ErrNotFound) {
+		return nil, fmt.Errorf("failed to check token revocation: %w", err)
+	}
+
+	return claims, nil
+}
+
+// RevokeAccessToken заносит jti токена в список отозванных. Запись живет,
+// пока токен не истек бы сам.
+func (m *Manager) RevokeAccessToken(tokenString string) error {
+	claims, err := m.Parse(tokenString)
+	if err != nil {
+		return err
+	}
+
+	return m.Revoke(claims)
+}
+
+// Revoke заносит jti уже проверенного токена в список отозванных.
+func (m *Manager) Revoke(claims *Claims) error {
+	// Запас на leeway: токен принимается и немного после exp
+	ttl := time.Until(claims.ExpiresAt.Time) + m.cfg.JWTConfig.Leeway
+	if ttl <= 0 {
+		return nil
+	}
+
+	if err := m.revoked.Put(revokedKeyPrefix+claims.ID, "1", ttl); err != nil {
+		return fmt.Errorf("failed to revoke token: %w", err)
+	}
+
+	return nil
+}
+
+// RevokeRefreshToken отзывает всю семью, к которой относится refresh-токен.
+func (m *Manager) RevokeRefreshToken(refreshToken string) error {
+	stored, err := m.storage.GetRefreshToken(Hash(refreshToken))
+	if err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return ErrInvalidRefreshToken
+		}
+		return fmt.Errorf("failed to get refresh token: %w", err)
+	}
+
+	return m.RevokeFamily(stored.FamilyID)
+}
+
+// RevokeFamily отзывает все refresh-токены семьи.
+func (m *Manager) RevokeFamily(familyID string) error {
+	if err := m.storage.RevokeRefreshTokenFamily(familyID); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+
+	return nil
+}
+
+func (m *Manager) registeredClaims(subject string, expiration time.Duration) (jwt.RegisteredClaims, error) {
+	jti, err := RandomString(16)
+	if err != nil {
+		return jwt.RegisteredClaims{}, fmt.Errorf("failed to generate jti: %w", err)
+	}
+
+	now := time.Now()
+	claims := jwt.RegisteredClaims{
+		Issuer:    m.cfg.JWTConfig.Issuer,
+		Subject:   subject,
+		ExpiresAt: jwt.NewNumericDate(now.Add(expiration)),
+		NotBefore: jwt.NewNumericDate(now),
+		IssuedAt:  jwt.NewNumericDate(now),
+		ID:        jti,
+	}
+	if m.cfg.JWTConfig.Audience != "" {
+		claims.Audience = jwt.ClaimStrings{m.cfg.JWTConfig.Audience}
+	}
+
+	return claims, nil
+}
+
+func (m *Manager) newClaims(user *entity.User, use string, expiration time.Duration) (*Claims, error) {
+	registered, err := m.registeredClaims(strconv.FormatUint(uint64(user.ID), 10), expiration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Claims{
+		RegisteredClaims: registered,
+		Username:         user.UserName,
+		Email:            user.Email,
+		TokenUse:         use,
+	}, nil
+}
+
+func (m *Manager) issue(user *entity.User, grant Grant) (*Pair, error) {
+	claims, err := m.newClaims(user, TokenUseAccess, AccessTokenExpiration)
+	if err != nil {
+		return nil, err
+	}
+	claims.ClientID = grant.ClientID
+	claims.Scope = grant.Scope
+
+	// Роли кладем только в токены собственного входа: OAuth-клиенты
+	// ограничены scope. Изменения ролей попадают в токен при обновлении
+	if grant.ClientID == "" {
+		roles, err := m.storage.GetUserRoles(user.ID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get user roles: %w", err)
+		}
+		claims.Roles = rbac.RoleNames(roles)
+	}
+
+	// Членство проверяется при каждой выдаче: исключенный из организации
+	// пользователь теряет ее при следующем обновлении токена
+	if grant.OrganizationID != 0 {
+		membership, err := m.storage.GetMembership(grant.OrganizationID, user.ID)
+		switch {
+		case err == nil:
+			claims.OrgID = strconv.FormatUint(uint64(grant.OrganizationID), 10)
+			claims.OrgRole = membership.Role
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			grant.OrganizationID = 0
+		default:
+			return nil, fmt.Errorf("failed to get membership: %w", err)
+		}
+	}
+
+	accessToken, err := m.keys.Sign(claims)
+	if err != nil {
+		return nil, fmt.Errorf("failed to sign access token: %w", err)
+	}
+
+	refreshToken, err := RandomString(32)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate refresh token: %w", err)
+	}
+
+	expiresAt := time.Now().Add(RefreshTokenExpiration)
+	if err := m.storage.SaveRefreshToken(user.ID, grant.FamilyID, grant.ClientID, grant.OrganizationID, grant.Scope, Hash(refreshToken), expiresAt); err != nil {
+		return nil, fmt.Errorf("failed to save refresh token: %w", err)
+	}
+
+	return &Pair{
+		AccessToken:    accessToken,
+		RefreshToken:   refreshToken,
+		ExpiresIn:      int64(AccessTokenExpiration.Seconds()),
+		Scope:          grant.Scope,
+		UserID:         user.ID,
+		OrganizationID: grant.OrganizationID,
+		OrgRole:        claims.OrgRole,
+	}, nil
+}
+
+func (m *Manager) reuseDetected(stored *entity.RefreshToken) error {
+	m.logger.Warn("refresh token reuse detected", "user_id", stored.UserID, "family_id", stored.FamilyID)
+	if err := m.storage.RevokeRefreshTokenFamily(stored.FamilyID); err != nil {
+		return fmt.Errorf("failed to revoke token family: %w", err)
+	}
+	return ErrRefreshTokenReused
+}
+
+// RandomString возвращает n случайных байт в base64url.
+func RandomString(n int) (string, error) {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// Hash возвращает SHA-256 хеш секрета для хранения в базе.
+func Hash(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
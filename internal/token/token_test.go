@@ -0,0 +1,574 @@
+package token
+
+import (
+	"auth/internal/config"
+	"auth/internal/entity"
+	"auth/internal/keyring"
+	"auth/internal/redis"
+	"auth/internal/storage/postgres"
+	"errors"
+	"io"
+	"log/slog"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"gorm.io/gorm"
+)
+
+// memoryStorage хранит в памяти пользователей и refresh-токены.
+// Остальные методы Storage не реализованы и паникуют при вызове.
+type memoryStorage struct {
+	postgres.Storage
+
+	mu      sync.Mutex
+	nextID  uint
+	users   map[uint]*entity.User
+	refresh map[string]*entity.RefreshToken
+	// markErr подменяет результат MarkRefreshTokenUsed
+	markErr error
+}
+
+func newMemoryStorage() *memoryStorage {
+	return &memoryStorage{
+		users:   make(map[uint]*entity.User),
+		refresh: make(map[string]*entity.RefreshToken),
+	}
+}
+
+func (m *memoryStorage) addUser(username string) *entity.User {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	user := &entity.User{UserName: username, Email: username + "@example.com"}
+	user.ID = m.nextID
+	m.users[user.ID] = user
+	return user
+}
+
+func (m *memoryStorage) GetUserByID(id uint) (*entity.User, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	user, ok := m.users[id]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *user
+	return &copied, nil
+}
+
+func (m *memoryStorage) GetUserRoles(userID uint) ([]entity.Role, error) {
+	return nil, nil
+}
+
+func (m *memoryStorage) ListMemberships(userID uint) ([]entity.Membership, error) {
+	return nil, nil
+}
+
+func (m *memoryStorage) SaveRefreshToken(userID uint, familyID string, clientID string, organizationID uint, scope string, tokenHash string, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.nextID++
+	stored := &entity.RefreshToken{
+		UserID:         userID,
+		FamilyID:       familyID,
+		ClientID:       clientID,
+		OrganizationID: organizationID,
+		Scope:          scope,
+		TokenHash:      tokenHash,
+		ExpiresAt:      expiresAt,
+	}
+	stored.ID = m.nextID
+	m.refresh[tokenHash] = stored
+	return nil
+}
+
+func (m *memoryStorage) GetRefreshToken(tokenHash string) (*entity.RefreshToken, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	stored, ok := m.refresh[tokenHash]
+	if !ok {
+		return nil, gorm.ErrRecordNotFound
+	}
+	copied := *stored
+	return &copied, nil
+}
+
+func (m *memoryStorage) MarkRefreshTokenUsed(id uint) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if m.markErr != nil {
+		return m.markErr
+	}
+	for _, stored := range m.refresh {
+		if stored.ID != id {
+			continue
+		}
+		if stored.UsedAt != nil {
+			return postgres.ErrRefreshTokenAlreadyUsed
+		}
+		now := time.Now()
+		stored.UsedAt = &now
+		return nil
+	}
+	return gorm.ErrRecordNotFound
+}
+
+func (m *memoryStorage) RevokeRefreshTokenFamily(familyID string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, stored := range m.refresh {
+		if stored.FamilyID == familyID && stored.RevokedAt == nil {
+			stored.RevokedAt = &now
+		}
+	}
+	return nil
+}
+
+func (m *memoryStorage) stored(refreshToken string) *entity.RefreshToken {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.refresh[Hash(refreshToken)]
+}
+
+func newTestManager(t *testing.T) (*Manager, *memoryStorage) {
+	t.Helper()
+
+	logger := slog.New(slog.NewTextHandler(io.Discard, nil))
+	cfg := &config.Config{}
+	cfg.JWTConfig.Algorithm = keyring.AlgorithmES256
+	cfg.JWTConfig.Issuer = "https://auth.test"
+	cfg.JWTConfig.Audience = "auth"
+	cfg.JWTConfig.Leeway = time.Second
+
+	keys, err := keyring.New(cfg.JWTConfig.Algorithm, "", time.Hour, logger)
+	if err != nil {
+		t.Fatalf("keyring.New: %v", err)
+	}
+
+	storage := newMemoryStorage()
+	return NewManager(cfg, storage, keys, redis.NewInMemory(), logger), storage
+}
+
+func TestRefreshRotates(t *testing.T) {
+	manager, storage := newTestManager(t)
+	user := storage.addUser("alice")
+
+	pair, err := manager.Issue(user)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	family := storage.stored(pair.RefreshToken).FamilyID
+
+	for i := 0; i < 3; i++ {
+		next, err := manager.Refresh(pair.RefreshToken)
+		if err != nil {
+			t.Fatalf("Refresh #%d: %v", i, err)
+		}
+		if next.RefreshToken == pair.RefreshToken || next.AccessToken == pair.AccessToken {
+			t.Fatalf("Refresh #%d returned the same tokens", i)
+		}
+		if next.UserID != user.ID || next.ExpiresIn != int64(AccessTokenExpiration.Seconds()) {
+			t.Errorf("Refresh #%d: user = %d, expires_in = %d", i, next.UserID, next.ExpiresIn)
+		}
+
+		// Новый токен остается в той же семье, старый помечен использованным
+		if got := storage.stored(next.RefreshToken).FamilyID; got != family {
+			t.Errorf("family = %q, want %q", got, family)
+		}
+		if storage.stored(pair.RefreshToken).UsedAt == nil {
+			t.Error("rotated token is not marked as used")
+		}
+		pair = next
+	}
+}
+
+func TestRefreshReuseRevokesFamily(t *testing.T) {
+	manager, storage := newTestManager(t)
+	user := storage.addUser("alice")
+
+	first, err := manager.Issue(user)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	other, err := manager.Issue(user)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	second, err := manager.Refresh(first.RefreshToken)
+	if err != nil {
+		t.Fatalf("Refresh: %v", err)
+	}
+
+	if _, err := manager.Refresh(first.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("reuse: err = %v, want ErrRefreshTokenReused", err)
+	}
+
+	// Отозвана вся семья, включая законно полученный токен
+	if _, err := manager.Refresh(second.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("refresh after reuse: err = %v, want ErrRefreshTokenReused", err)
+	}
+	if storage.stored(second.RefreshToken).RevokedAt == nil {
+		t.Error("family member is not revoked")
+	}
+
+	// Другие сессии пользователя не затронуты
+	if _, err := manager.Refresh(other.RefreshToken); err != nil {
+		t.Errorf("other family: %v", err)
+	}
+}
+
+func TestRefreshConcurrentUse(t *testing.T) {
+	manager, storage := newTestManager(t)
+	user := storage.addUser("alice")
+
+	pair, err := manager.Issue(user)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	// Параллельный запрос успел пометить токен между чтением и записью
+	storage.markErr = postgres.ErrRefreshTokenAlreadyUsed
+	if _, err := manager.Refresh(pair.RefreshToken); !errors.Is(err, ErrRefreshTokenReused) {
+		t.Fatalf("err = %v, want ErrRefreshTokenReused", err)
+	}
+	if storage.stored(pair.RefreshToken).RevokedAt == nil {
+		t.Error("family is not revoked")
+	}
+}
+
+func TestRefreshRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(storage *memoryStorage, refreshToken string) string
+		client  string
+	}{
+		{"unknown token", func(storage *memoryStorage, refreshToken string) string {
+			return refreshToken + "x"
+		}, ""},
+		{"empty token", func(storage *memoryStorage, refreshToken string) string {
+			return ""
+		}, ""},
+		{"expired", func(storage *memoryStorage, refreshToken string) string {
+			storage.stored(refreshToken).ExpiresAt = time.Now().Add(-time.Second)
+			return refreshToken
+		}, ""},
+		{"issued to a user, presented by a client", func(storage *memoryStorage, refreshToken string) string {
+			return refreshToken
+		}, "some-client"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, storage := newTestManager(t)
+			pair, err := manager.Issue(storage.addUser("alice"))
+			if err != nil {
+				t.Fatalf("Issue: %v", err)
+			}
+
+			refreshToken := tt.prepare(storage, pair.RefreshToken)
+			if _, err := manager.RefreshGrant(refreshToken, tt.client); !errors.Is(err, ErrInvalidRefreshToken) {
+				t.Fatalf("err = %v, want ErrInvalidRefreshToken", err)
+			}
+			// Отказ не расходует токен
+			if storage.stored(pair.RefreshToken).UsedAt != nil {
+				t.Error("rejected refresh marked the token as used")
+			}
+		})
+	}
+}
+
+func TestRefreshGrantKeepsClientAndScope(t *testing.T) {
+	manager, storage := newTestManager(t)
+	user := storage.addUser("alice")
+
+	pair, err := manager.IssueGrant(user, Grant{ClientID: "app", Scope: "openid email"})
+	if err != nil {
+		t.Fatalf("IssueGrant: %v", err)
+	}
+
+	// Токен клиента нельзя обменять как токен собственного входа
+	if _, err := manager.Refresh(pair.RefreshToken); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Fatalf("Refresh: err = %v, want ErrInvalidRefreshToken", err)
+	}
+
+	next, err := manager.RefreshGrant(pair.RefreshToken, "app")
+	if err != nil {
+		t.Fatalf("RefreshGrant: %v", err)
+	}
+	if next.Scope != "openid email" {
+		t.Errorf("scope = %q", next.Scope)
+	}
+	if stored := storage.stored(next.RefreshToken); stored.ClientID != "app" || stored.Scope != "openid email" {
+		t.Errorf("stored token = %+v", stored)
+	}
+}
+
+func TestRevokeRefreshToken(t *testing.T) {
+	manager, storage := newTestManager(t)
+	pair, err := manager.Issue(storage.addUser("alice"))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	if err := manager.RevokeRefreshToken(pair.RefreshToken); err != nil {
+		t.Fatalf("RevokeRefreshToken: %v", err)
+	}
+	if _, err := manager.Refresh(pair.RefreshToken); err == nil {
+		t.Fatal("revoked refresh token accepted")
+	}
+	if err := manager.RevokeRefreshToken("unknown"); !errors.Is(err, ErrInvalidRefreshToken) {
+		t.Errorf("unknown token: err = %v, want ErrInvalidRefreshToken", err)
+	}
+}
+
+func TestHash(t *testing.T) {
+	// SHA-256("abc")
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := Hash("abc"); got != want {
+		t.Errorf("Hash(abc) = %s, want %s", got, want)
+	}
+}
+
+func TestRandomString(t *testing.T) {
+	seen := make(map[string]struct{})
+	for i := 0; i < 100; i++ {
+		s, err := RandomString(32)
+		if err != nil {
+			t.Fatalf("RandomString: %v", err)
+		}
+		// 32 байта в base64url без выравнивания
+		if len(s) != 43 {
+			t.Fatalf("len = %d, want 43", len(s))
+		}
+		if _, ok := seen[s]; ok {
+			t.Fatalf("duplicate random string %q", s)
+		}
+		seen[s] = struct{}{}
+	}
+}
+
+func TestRevokeAccessToken(t *testing.T) {
+	manager, storage := newTestManager(t)
+	pair, err := manager.Issue(storage.addUser("alice"))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	other, err := manager.Issue(storage.addUser("bob"))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+
+	if _, err := manager.Parse(pair.AccessToken); err != nil {
+		t.Fatalf("Parse before revocation: %v", err)
+	}
+	if err := manager.RevokeAccessToken(pair.AccessToken); err != nil {
+		t.Fatalf("RevokeAccessToken: %v", err)
+	}
+
+	if _, err := manager.Parse(pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Fatalf("Parse after revocation: err = %v, want ErrTokenRevoked", err)
+	}
+	if _, err := manager.Parse(other.AccessToken); err != nil {
+		t.Errorf("other token: %v", err)
+	}
+
+	// Повторный отзыв уже отозванного токена отклоняется проверкой
+	if err := manager.RevokeAccessToken(pair.AccessToken); !errors.Is(err, ErrTokenRevoked) {
+		t.Errorf("second revocation: err = %v, want ErrTokenRevoked", err)
+	}
+	if err := manager.RevokeAccessToken("not a token"); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("invalid token: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestRevokeExpiredClaims(t *testing.T) {
+	manager, storage := newTestManager(t)
+	pair, err := manager.Issue(storage.addUser("alice"))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	claims, err := manager.Parse(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	// Токен, истекший с учетом leeway, в список отозванных не попадает
+	claims.ExpiresAt.Time = time.Now().Add(-time.Minute)
+	if err := manager.Revoke(claims); err != nil {
+		t.Fatalf("Revoke: %v", err)
+	}
+	if _, err := manager.revoked.Get(revokedKeyPrefix + claims.ID); !errors.Is(err, redis.ErrNotFound) {
+		t.Errorf("expired token stored as revoked: %v", err)
+	}
+}
+
+func TestParseClaims(t *testing.T) {
+	manager, storage := newTestManager(t)
+	user := storage.addUser("alice")
+
+	pair, err := manager.Issue(user)
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	claims, err := manager.Parse(pair.AccessToken)
+	if err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	if claims.Issuer != "https://auth.test" || len(claims.Audience) != 1 || claims.Audience[0] != "auth" {
+		t.Errorf("iss = %q, aud = %v", claims.Issuer, claims.Audience)
+	}
+	if claims.Subject != "1" || claims.Username != "alice" || claims.Email != "alice@example.com" {
+		t.Errorf("sub = %q, username = %q, email = %q", claims.Subject, claims.Username, claims.Email)
+	}
+	if claims.ID == "" || claims.IssuedAt == nil || claims.NotBefore == nil || claims.TokenUse != TokenUseAccess {
+		t.Errorf("jti = %q, iat = %v, nbf = %v, token_use = %q", claims.ID, claims.IssuedAt, claims.NotBefore, claims.TokenUse)
+	}
+	if got := claims.ExpiresAt.Sub(claims.IssuedAt.Time); got != AccessTokenExpiration {
+		t.Errorf("lifetime = %s, want %s", got, AccessTokenExpiration)
+	}
+	if id, err := claims.UserID(); err != nil || id != user.ID {
+		t.Errorf("UserID = %d, %v", id, err)
+	}
+}
+
+func TestParseRejects(t *testing.T) {
+	valid := func(m *Manager) *Claims {
+		registered, err := m.registeredClaims("1", time.Minute)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return &Claims{RegisteredClaims: registered, TokenUse: TokenUseAccess}
+	}
+
+	tests := []struct {
+		name   string
+		modify func(c *Claims)
+	}{
+		{"wrong issuer", func(c *Claims) { c.Issuer = "https://evil.test" }},
+		{"missing issuer", func(c *Claims) { c.Issuer = "" }},
+		{"wrong audience", func(c *Claims) { c.Audience = jwt.ClaimStrings{"other"} }},
+		{"missing audience", func(c *Claims) { c.Audience = nil }},
+		{"expired beyond leeway", func(c *Claims) { c.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-time.Minute)) }},
+		{"missing expiration", func(c *Claims) { c.ExpiresAt = nil }},
+		{"not yet valid", func(c *Claims) { c.NotBefore = jwt.NewNumericDate(time.Now().Add(time.Minute)) }},
+		{"issued in the future", func(c *Claims) { c.IssuedAt = jwt.NewNumericDate(time.Now().Add(time.Minute)) }},
+		{"missing iat", func(c *Claims) { c.IssuedAt = nil }},
+		{"missing jti", func(c *Claims) { c.ID = "" }},
+		{"mfa challenge", func(c *Claims) { c.TokenUse = TokenUseMFA }},
+		{"client token", func(c *Claims) { c.TokenUse = TokenUseClient }},
+		{"missing token use", func(c *Claims) { c.TokenUse = "" }},
+		{"non-numeric subject", func(c *Claims) { c.Subject = "alice" }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			manager, _ := newTestManager(t)
+			claims := valid(manager)
+			tt.modify(claims)
+
+			signed, err := manager.keys.Sign(claims)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if _, err := manager.Parse(signed); !errors.Is(err, ErrInvalidToken) {
+				t.Fatalf("err = %v, want ErrInvalidToken", err)
+			}
+		})
+	}
+}
+
+func TestParseLeeway(t *testing.T) {
+	manager, _ := newTestManager(t)
+	manager.cfg.JWTConfig.Leeway = 30 * time.Second
+	registered, err := manager.registeredClaims("1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Истек меньше чем leeway назад
+	registered.ExpiresAt = jwt.NewNumericDate(time.Now().Add(-10 * time.Second))
+
+	signed, err := manager.keys.Sign(&Claims{RegisteredClaims: registered, TokenUse: TokenUseAccess})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.Parse(signed); err != nil {
+		t.Fatalf("token within leeway rejected: %v", err)
+	}
+}
+
+func TestParseForeignSignature(t *testing.T) {
+	manager, storage := newTestManager(t)
+	other, _ := newTestManager(t)
+
+	pair, err := other.Issue(storage.addUser("alice"))
+	if err != nil {
+		t.Fatalf("Issue: %v", err)
+	}
+	if _, err := manager.Parse(pair.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Fatalf("err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestMFAChallenge(t *testing.T) {
+	manager, storage := newTestManager(t)
+	user := storage.addUser("alice")
+
+	challenge, err := manager.IssueMFAChallenge(user)
+	if err != nil {
+		t.Fatalf("IssueMFAChallenge: %v", err)
+	}
+	claims, err := manager.ParseMFAChallenge(challenge)
+	if err != nil {
+		t.Fatalf("ParseMFAChallenge: %v", err)
+	}
+	if got := claims.ExpiresAt.Sub(claims.IssuedAt.Time); got != MFAChallengeExpiration {
+		t.Errorf("lifetime = %s, want %s", got, MFAChallengeExpiration)
+	}
+
+	// Токен второго шага не заменяет access-токен и наоборот
+	if _, err := manager.Parse(challenge); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("Parse(challenge): err = %v, want ErrInvalidToken", err)
+	}
+	pair, err := manager.Issue(user)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := manager.ParseMFAChallenge(pair.AccessToken); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("ParseMFAChallenge(access): err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestClaimsIDs(t *testing.T) {
+	tests := []struct {
+		subject string
+		orgID   string
+		userID  uint
+		userErr bool
+		org     uint
+	}{
+		{"42", "7", 42, false, 7},
+		{"0", "", 0, false, 0},
+		{"service", "org", 0, true, 0},
+		{"-1", "-1", 0, true, 0},
+		{"", "", 0, true, 0},
+	}
+
+	for _, tt := range tests {
+		claims := &Claims{RegisteredClaims: jwt.RegisteredClaims{Subject: tt.subject}, OrgID: tt.orgID}
+
+		id, err := claims.UserID()
+		if (err != nil) != tt.userErr || id != tt.userID {
+			t.Errorf("UserID(%q) = %d, %v", tt.subject, id, err)
+		}
+		if err != nil && !errors.Is(err, ErrInvalidToken) {
+			t.Errorf("UserID(%q): err = %v, want ErrInvalidToken", tt.subject, err)
+		}
+		if got := claims.OrganizationID(); got != tt.org {
+			t.Errorf("OrganizationID(%q) = %d, want %d", tt.orgID, got, tt.org)
+		}
+	}
+}
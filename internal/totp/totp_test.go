@@ -0,0 +1,158 @@
+package totp
+
+import (
+	"net/url"
+	"testing"
+	"time"
+)
+
+// Секрет "12345678901234567890" из приложения B RFC 6238 в base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// Ожидаемые значения - последние шесть цифр восьмизначных кодов SHA1
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{unix: 59, want: "287082"},
+		{unix: 1111111109, want: "081804"},
+		{unix: 1111111111, want: "050471"},
+		{unix: 1234567890, want: "005924"},
+		{unix: 2000000000, want: "279037"},
+		{unix: 20000000000, want: "353130"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got, err := Code(rfcSecret, Counter(time.Unix(tt.unix, 0)))
+			if err != nil {
+				t.Fatalf("Code: %v", err)
+			}
+			if got != tt.want {
+				t.Fatalf("Code at %d = %s, want %s", tt.unix, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCodeSecretCase(t *testing.T) {
+	upper, err := Code(rfcSecret, 1)
+	if err != nil {
+		t.Fatalf("Code: %v", err)
+	}
+	lower, err := Code("gezdgnbvgy3tqojqgezdgnbvgy3tqojq", 1)
+	if err != nil {
+		t.Fatalf("Code with lower-case secret: %v", err)
+	}
+	if upper != lower {
+		t.Fatalf("codes differ: %s and %s", upper, lower)
+	}
+
+	if _, err := Code("not base32!", 1); err == nil {
+		t.Fatal("Code accepted an invalid secret")
+	}
+}
+
+func TestValidate(t *testing.T) {
+	now := time.Unix(1234567890, 0)
+	current := Counter(now)
+
+	codeAt := func(counter int64) string {
+		code, err := Code(rfcSecret, counter)
+		if err != nil {
+			t.Fatalf("Code: %v", err)
+		}
+		return code
+	}
+
+	tests := []struct {
+		name        string
+		secret      string
+		code        string
+		skew        int
+		wantOK      bool
+		wantCounter int64
+	}{
+		{name: "current step", secret: rfcSecret, code: codeAt(current), skew: 1, wantOK: true, wantCounter: current},
+		{name: "previous step", secret: rfcSecret, code: codeAt(current - 1), skew: 1, wantOK: true, wantCounter: current - 1},
+		{name: "next step", secret: rfcSecret, code: codeAt(current + 1), skew: 1, wantOK: true, wantCounter: current + 1},
+		{name: "outside skew", secret: rfcSecret, code: codeAt(current - 2), skew: 1},
+		{name: "no skew", secret: rfcSecret, code: codeAt(current - 1), skew: 0},
+		{name: "short code", secret: rfcSecret, code: codeAt(current)[:Digits-1], skew: 1},
+		{name: "long code", secret: rfcSecret, code: codeAt(current) + "0", skew: 1},
+		{name: "empty code", secret: rfcSecret, code: "", skew: 1},
+		{name: "invalid secret", secret: "not base32!", code: "000000", skew: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			counter, ok := Validate(tt.secret, tt.code, now, tt.skew)
+			if ok != tt.wantOK {
+				t.Fatalf("Validate ok = %v, want %v", ok, tt.wantOK)
+			}
+			if ok && counter != tt.wantCounter {
+				t.Fatalf("Validate counter = %d, want %d", counter, tt.wantCounter)
+			}
+		})
+	}
+}
+
+func TestGenerateSecret(t *testing.T) {
+	first, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	second, err := GenerateSecret()
+	if err != nil {
+		t.Fatalf("GenerateSecret: %v", err)
+	}
+	if first == second {
+		t.Fatal("GenerateSecret returned the same secret twice")
+	}
+
+	key, err := encoding.DecodeString(first)
+	if err != nil {
+		t.Fatalf("secret is not base32: %v", err)
+	}
+	if len(key) != secretSize {
+		t.Fatalf("secret has %d bytes, want %d", len(key), secretSize)
+	}
+	if _, err := Code(first, 0); err != nil {
+		t.Fatalf("Code with generated secret: %v", err)
+	}
+}
+
+func TestURI(t *testing.T) {
+	uri, err := url.Parse(URI("Example Corp", "alice@example.com", rfcSecret))
+	if err != nil {
+		t.Fatalf("url.Parse: %v", err)
+	}
+
+	if uri.Scheme != "otpauth" || uri.Host != "totp" {
+		t.Fatalf("uri = %s, want otpauth://totp/...", uri)
+	}
+	if want := "/Example Corp:alice@example.com"; uri.Path != want {
+		t.Fatalf("label = %q, want %q", uri.Path, want)
+	}
+
+	query := uri.Query()
+	want := map[string]string{
+		"secret":    rfcSecret,
+		"issuer":    "Example Corp",
+		"algorithm": "SHA1",
+		"digits":    "6",
+		"period":    "30",
+	}
+	for key, value := range want {
+		if got := query.Get(key); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+}
+
+func TestAssociatedData(t *testing.T) {
+	if string(AssociatedData(1)) == string(AssociatedData(2)) {
+		t.Fatal("associated data does not depend on the user")
+	}
+}
@@ -0,0 +1,125 @@
+package webauthn
+
+import (
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"math/big"
+)
+
+// Идентификаторы алгоритмов COSE (RFC 9053).
+const (
+	AlgES256 = -7
+	AlgEdDSA = -8
+	AlgRS256 = -257
+)
+
+// Ключи и значения параметров COSE_Key.
+const (
+	coseKeyType  = 1
+	coseKeyAlg   = 3
+	coseKeyCrv   = -1
+	coseKeyX     = -2
+	coseKeyY     = -3
+	coseKeyRSAN  = -1
+	coseKeyRSAE  = -2
+	coseKtyOKP   = 1
+	coseKtyEC2   = 2
+	coseKtyRSA   = 3
+	coseCrvP256  = 1
+	coseCrvEd255 = 6
+)
+
+var ErrInvalidSignature = errors.New("invalid signature")
+
+// SupportedAlgorithms перечисляет алгоритмы в порядке предпочтения.
+var SupportedAlgorithms = []int64{AlgES256, AlgEdDSA, AlgRS256}
+
+// parsePublicKey разбирает COSE ключ из attestedCredentialData.
+func parsePublicKey(data []byte) (int64, crypto.PublicKey, error) {
+	decoded, rest, err := decodeCBOR(data)
+	if err != nil {
+		return 0, nil, err
+	}
+	if len(rest) != 0 {
+		return 0, nil, errors.New("cose: trailing data after key")
+	}
+
+	key, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return 0, nil, errors.New("cose: key is not a map")
+	}
+
+	kty, _ := key[int64(coseKeyType)].(int64)
+	alg, _ := key[int64(coseKeyAlg)].(int64)
+
+	switch {
+	case kty == coseKtyEC2 && alg == AlgES256:
+		crv, _ := key[int64(coseKeyCrv)].(int64)
+		x, _ := key[int64(coseKeyX)].([]byte)
+		y, _ := key[int64(coseKeyY)].([]byte)
+		if crv != coseCrvP256 || len(x) != 32 || len(y) != 32 {
+			return 0, nil, errors.New("cose: invalid EC2 key")
+		}
+
+		public := &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}
+		if !public.Curve.IsOnCurve(public.X, public.Y) {
+			return 0, nil, errors.New("cose: point is not on curve")
+		}
+		return alg, public, nil
+
+	case kty == coseKtyOKP && alg == AlgEdDSA:
+		crv, _ := key[int64(coseKeyCrv)].(int64)
+		x, _ := key[int64(coseKeyX)].([]byte)
+		if crv != coseCrvEd255 || len(x) != ed25519.PublicKeySize {
+			return 0, nil, errors.New("cose: invalid OKP key")
+		}
+		return alg, ed25519.PublicKey(x), nil
+
+	case kty == coseKtyRSA && alg == AlgRS256:
+		n, _ := key[int64(coseKeyRSAN)].([]byte)
+		e, _ := key[int64(coseKeyRSAE)].([]byte)
+		if len(n) < 256 || len(e) == 0 || len(e) > 4 {
+			return 0, nil, errors.New("cose: invalid RSA key")
+		}
+
+		exponent := int(new(big.Int).SetBytes(e).Int64())
+		return alg, &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: exponent}, nil
+	}
+
+	return 0, nil, fmt.Errorf("cose: unsupported key type %d with algorithm %d", kty, alg)
+}
+
+// verifySignature проверяет подпись authenticatorData || SHA-256(clientDataJSON).
+func verifySignature(coseKey []byte, signed, signature []byte) error {
+	alg, public, err := parsePublicKey(coseKey)
+	if err != nil {
+		return err
+	}
+
+	digest := sha256.Sum256(signed)
+
+	var ok bool
+	switch alg {
+	case AlgES256:
+		ok = ecdsa.VerifyASN1(public.(*ecdsa.PublicKey), digest[:], signature)
+	case AlgEdDSA:
+		ok = ed25519.Verify(public.(ed25519.PublicKey), signed, signature)
+	case AlgRS256:
+		ok = rsa.VerifyPKCS1v15(public.(*rsa.PublicKey), crypto.SHA256, digest[:], signature) == nil
+	}
+	if !ok {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
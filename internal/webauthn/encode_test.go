@@ -0,0 +1,98 @@
+package webauthn
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Кодирование CBOR нужно только тестам: сервер ответы аутентификатора
+// лишь разбирает.
+
+// encodeCBOR кодирует значения типов int, int64, string, []byte,
+// []interface{} и map[interface{}]interface{}. Ключи map сортируются
+// по правилам каноничного CBOR (сначала короче, затем побайтово).
+func encodeCBOR(v interface{}) ([]byte, error) {
+	switch value := v.(type) {
+	case int:
+		return encodeCBORInt(int64(value)), nil
+	case int64:
+		return encodeCBORInt(value), nil
+	case []byte:
+		return append(encodeCBORHead(2, uint64(len(value))), value...), nil
+	case string:
+		return append(encodeCBORHead(3, uint64(len(value))), value...), nil
+	case []interface{}:
+		out := encodeCBORHead(4, uint64(len(value)))
+		for _, item := range value {
+			encoded, err := encodeCBOR(item)
+			if err != nil {
+				return nil, err
+			}
+			out = append(out, encoded...)
+		}
+		return out, nil
+	case map[interface{}]interface{}:
+		type pair struct{ key, value []byte }
+		pairs := make([]pair, 0, len(value))
+		for k, item := range value {
+			key, err := encodeCBOR(k)
+			if err != nil {
+				return nil, err
+			}
+			encoded, err := encodeCBOR(item)
+			if err != nil {
+				return nil, err
+			}
+			pairs = append(pairs, pair{key, encoded})
+		}
+		sort.Slice(pairs, func(i, j int) bool {
+			if len(pairs[i].key) != len(pairs[j].key) {
+				return len(pairs[i].key) < len(pairs[j].key)
+			}
+			return string(pairs[i].key) < string(pairs[j].key)
+		})
+		out := encodeCBORHead(5, uint64(len(pairs)))
+		for _, p := range pairs {
+			out = append(out, p.key...)
+			out = append(out, p.value...)
+		}
+		return out, nil
+	}
+	return nil, fmt.Errorf("cbor: unsupported type %T", v)
+}
+
+func encodeCBORInt(v int64) []byte {
+	if v < 0 {
+		return encodeCBORHead(1, uint64(-1-v))
+	}
+	return encodeCBORHead(0, uint64(v))
+}
+
+func encodeCBORHead(major byte, arg uint64) []byte {
+	m := major << 5
+	switch {
+	case arg < 24:
+		return []byte{m | byte(arg)}
+	case arg <= math.MaxUint8:
+		return []byte{m | 24, byte(arg)}
+	case arg <= math.MaxUint16:
+		return binary.BigEndian.AppendUint16([]byte{m | 25}, uint16(arg))
+	case arg <= math.MaxUint32:
+		return binary.BigEndian.AppendUint32([]byte{m | 26}, uint32(arg))
+	}
+	return binary.BigEndian.AppendUint64([]byte{m | 27}, arg)
+}
+
+// encodeES256PublicKey кодирует P-256 ключ как COSE_Key.
+func encodeES256PublicKey(public *ecdsa.PublicKey) ([]byte, error) {
+	return encodeCBOR(map[interface{}]interface{}{
+		int64(coseKeyType): int64(coseKtyEC2),
+		int64(coseKeyAlg):  int64(AlgES256),
+		int64(coseKeyCrv):  int64(coseCrvP256),
+		int64(coseKeyX):    public.X.FillBytes(make([]byte, 32)),
+		int64(coseKeyY):    public.Y.FillBytes(make([]byte, 32)),
+	})
+}
@@ -0,0 +1,463 @@
+package webauthn
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// Флаги authenticatorData (WebAuthn Level 2, 6.1).
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+	flagExtensionData      = 0x80
+)
+
+const (
+	challengeSize        = 32
+	DefaultTimeout       = 5 * time.Minute
+	UserVerificationReq  = "required"
+	UserVerificationPref = "preferred"
+)
+
+var ErrVerification = errors.New("webauthn verification failed")
+
+// Config описывает проверяющую сторону (relying party).
+type Config struct {
+	RPID             string
+	RPName           string
+	Origins          []string
+	Timeout          time.Duration
+	UserVerification string
+}
+
+type WebAuthn struct {
+	cfg Config
+}
+
+func New(cfg Config) (*WebAuthn, error) {
+	if cfg.RPID == "" || len(cfg.Origins) == 0 {
+		return nil, errors.New("webauthn: rp id and origins are required")
+	}
+	if cfg.Timeout <= 0 {
+		cfg.Timeout = DefaultTimeout
+	}
+	if cfg.UserVerification == "" {
+		cfg.UserVerification = UserVerificationPref
+	}
+
+	return &WebAuthn{cfg: cfg}, nil
+}
+
+// Timeout - время жизни церемонии, оно же TTL сессии в хранилище.
+func (w *WebAuthn) Timeout() time.Duration {
+	return w.cfg.Timeout
+}
+
+// Session - состояние незавершенной церемонии. Хранится на сервере
+// (Redis или память) между begin и finish.
+type Session struct {
+	Challenge        string `json:"challenge"`
+	UserID           uint   `json:"user_id,omitempty"`
+	UserVerification string `json:"user_verification"`
+}
+
+type RelyingParty struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type UserEntity struct {
+	ID          string `json:"id"`
+	Name        string `json:"name"`
+	DisplayName string `json:"displayName"`
+}
+
+type CredentialParameter struct {
+	Type string `json:"type"`
+	Alg  int64  `json:"alg"`
+}
+
+type CredentialDescriptor struct {
+	Type       string   `json:"type"`
+	ID         string   `json:"id"`
+	Transports []string `json:"transports,omitempty"`
+}
+
+type AuthenticatorSelection struct {
+	ResidentKey      string `json:"residentKey"`
+	UserVerification string `json:"userVerification"`
+}
+
+// CreationOptions - аргумент navigator.credentials.create().
+type CreationOptions struct {
+	Challenge              string                 `json:"challenge"`
+	RP                     RelyingParty           `json:"rp"`
+	User                   UserEntity             `json:"user"`
+	PubKeyCredParams       []CredentialParameter  `json:"pubKeyCredParams"`
+	Timeout                int64                  `json:"timeout"`
+	ExcludeCredentials     []CredentialDescriptor `json:"excludeCredentials"`
+	AuthenticatorSelection AuthenticatorSelection `json:"authenticatorSelection"`
+	Attestation            string                 `json:"attestation"`
+}
+
+// RequestOptions - аргумент navigator.credentials.get().
+type RequestOptions struct {
+	Challenge        string                 `json:"challenge"`
+	Timeout          int64                  `json:"timeout"`
+	RPID             string                 `json:"rpId"`
+	AllowCredentials []CredentialDescriptor `json:"allowCredentials"`
+	UserVerification string                 `json:"userVerification"`
+}
+
+// Descriptor - сохраненный ключ пользователя для allow/exclude списков.
+type Descriptor struct {
+	ID         []byte
+	Transports []string
+}
+
+// Credential - результат успешной регистрации ключа.
+type Credential struct {
+	ID           []byte
+	PublicKey    []byte
+	SignCount    uint32
+	Transports   []string
+	UserVerified bool
+}
+
+// Assertion - разобранный ответ navigator.credentials.get().
+type Assertion struct {
+	CredentialID      []byte
+	UserHandle        []byte
+	clientDataJSON    []byte
+	authenticatorData []byte
+	signature         []byte
+}
+
+// BeginRegistration формирует параметры создания ключа. Attestation
+// запрашивается "none": доверие к модели аутентификатора не проверяется.
+func (w *WebAuthn) BeginRegistration(userHandle []byte, name, displayName string, exclude []Descriptor) (*CreationOptions, *Session, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	params := make([]CredentialParameter, 0, len(SupportedAlgorithms))
+	for _, alg := range SupportedAlgorithms {
+		params = append(params, CredentialParameter{Type: "public-key", Alg: alg})
+	}
+
+	options := &CreationOptions{
+		Challenge: challenge,
+		RP: RelyingParty{
+			ID:   w.cfg.RPID,
+			Name: w.cfg.RPName,
+		},
+		User: UserEntity{
+			ID:          encode(userHandle),
+			Name:        name,
+			DisplayName: displayName,
+		},
+		PubKeyCredParams:   params,
+		Timeout:            w.cfg.Timeout.Milliseconds(),
+		ExcludeCredentials: descriptors(exclude),
+		AuthenticatorSelection: AuthenticatorSelection{
+			ResidentKey:      "preferred",
+			UserVerification: w.cfg.UserVerification,
+		},
+		Attestation: "none",
+	}
+
+	return options, &Session{Challenge: challenge, UserVerification: w.cfg.UserVerification}, nil
+}
+
+// FinishRegistration проверяет ответ navigator.credentials.create()
+// в JSON формате PublicKeyCredential.toJSON().
+func (w *WebAuthn) FinishRegistration(session *Session, body []byte) (*Credential, error) {
+	var credential struct {
+		ID       string `json:"id"`
+		RawID    string `json:"rawId"`
+		Type     string `json:"type"`
+		Response struct {
+			ClientDataJSON    string   `json:"clientDataJSON"`
+			AttestationObject string   `json:"attestationObject"`
+			Transports        []string `json:"transports"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(body, &credential); err != nil {
+		return nil, fmt.Errorf("%w: invalid credential json: %v", ErrVerification, err)
+	}
+	if credential.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrVerification)
+	}
+
+	rawID, err := decode(credential.RawID)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid raw id", ErrVerification)
+	}
+
+	clientDataJSON, err := decode(credential.Response.ClientDataJSON)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid client data", ErrVerification)
+	}
+	if err := w.verifyClientData(clientDataJSON, "webauthn.create", session); err != nil {
+		return nil, err
+	}
+
+	attestationObject, err := decode(credential.Response.AttestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid attestation object", ErrVerification)
+	}
+
+	decoded, _, err := decodeCBOR(attestationObject)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+	attestation, ok := decoded.(map[interface{}]interface{})
+	if !ok {
+		return nil, fmt.Errorf("%w: attestation object is not a map", ErrVerification)
+	}
+	authData, ok := attestation["authData"].([]byte)
+	if !ok {
+		return nil, fmt.Errorf("%w: missing authData", ErrVerification)
+	}
+
+	parsed, err := w.parseAuthenticatorData(authData, session)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.flags&flagAttestedCredential == 0 {
+		return nil, fmt.Errorf("%w: missing attested credential data", ErrVerification)
+	}
+	if !bytes.Equal(parsed.credentialID, rawID) {
+		return nil, fmt.Errorf("%w: credential id mismatch", ErrVerification)
+	}
+	if _, _, err := parsePublicKey(parsed.publicKey); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	return &Credential{
+		ID:           parsed.credentialID,
+		PublicKey:    parsed.publicKey,
+		SignCount:    parsed.signCount,
+		Transports:   credential.Response.Transports,
+		UserVerified: parsed.flags&flagUserVerified != 0,
+	}, nil
+}
+
+// BeginLogin формирует параметры входа. Пустой allow означает вход по
+// discoverable credential без указания имени пользователя.
+func (w *WebAuthn) BeginLogin(allow []Descriptor) (*RequestOptions, *Session, error) {
+	challenge, err := newChallenge()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	options := &RequestOptions{
+		Challenge:        challenge,
+		Timeout:          w.cfg.Timeout.Milliseconds(),
+		RPID:             w.cfg.RPID,
+		AllowCredentials: descriptors(allow),
+		UserVerification: w.cfg.UserVerification,
+	}
+
+	return options, &Session{Challenge: challenge, UserVerification: w.cfg.UserVerification}, nil
+}
+
+// ParseAssertion разбирает ответ navigator.credentials.get(), чтобы
+// вызывающий мог найти сохраненный ключ по CredentialID.
+func (w *WebAuthn) ParseAssertion(body []byte) (*Assertion, error) {
+	var credential struct {
+		RawID    string `json:"rawId"`
+		Type     string `json:"type"`
+		Response struct {
+			ClientDataJSON    string `json:"clientDataJSON"`
+			AuthenticatorData string `json:"authenticatorData"`
+			Signature         string `json:"signature"`
+			UserHandle        string `json:"userHandle"`
+		} `json:"response"`
+	}
+	if err := json.Unmarshal(body, &credential); err != nil {
+		return nil, fmt.Errorf("%w: invalid credential json: %v", ErrVerification, err)
+	}
+	if credential.Type != "public-key" {
+		return nil, fmt.Errorf("%w: unexpected credential type", ErrVerification)
+	}
+
+	var (
+		assertion Assertion
+		err       error
+	)
+	fields := []struct {
+		value string
+		dst   *[]byte
+	}{
+		{credential.RawID, &assertion.CredentialID},
+		{credential.Response.ClientDataJSON, &assertion.clientDataJSON},
+		{credential.Response.AuthenticatorData, &assertion.authenticatorData},
+		{credential.Response.Signature, &assertion.signature},
+		{credential.Response.UserHandle, &assertion.UserHandle},
+	}
+	for _, f := range fields {
+		if *f.dst, err = decode(f.value); err != nil {
+			return nil, fmt.Errorf("%w: invalid base64url field", ErrVerification)
+		}
+	}
+
+	return &assertion, nil
+}
+
+// FinishLogin проверяет подпись ответа сохраненным ключом и возвращает
+// новый счетчик подписей. Счетчик, который не растет, говорит о
+// клонированном аутентификаторе.
+func (w *WebAuthn) FinishLogin(session *Session, assertion *Assertion, publicKey []byte, storedSignCount uint32) (uint32, bool, error) {
+	if err := w.verifyClientData(assertion.clientDataJSON, "webauthn.get", session); err != nil {
+		return 0, false, err
+	}
+
+	parsed, err := w.parseAuthenticatorData(assertion.authenticatorData, session)
+	if err != nil {
+		return 0, false, err
+	}
+
+	clientDataHash := sha256.Sum256(assertion.clientDataJSON)
+	signed := append(append([]byte(nil), assertion.authenticatorData...), clientDataHash[:]...)
+	if err := verifySignature(publicKey, signed, assertion.signature); err != nil {
+		return 0, false, fmt.Errorf("%w: %v", ErrVerification, err)
+	}
+
+	if (parsed.signCount != 0 || storedSignCount != 0) && parsed.signCount <= storedSignCount {
+		return 0, false, fmt.Errorf("%w: sign count did not increase", ErrVerification)
+	}
+
+	return parsed.signCount, parsed.flags&flagUserVerified != 0, nil
+}
+
+func (w *WebAuthn) verifyClientData(data []byte, ceremony string, session *Session) error {
+	var clientData struct {
+		Type        string `json:"type"`
+		Challenge   string `json:"challenge"`
+		Origin      string `json:"origin"`
+		CrossOrigin bool   `json:"crossOrigin"`
+	}
+	if err := json.Unmarshal(data, &clientData); err != nil {
+		return fmt.Errorf("%w: invalid client data json", ErrVerification)
+	}
+
+	if clientData.Type != ceremony {
+		return fmt.Errorf("%w: unexpected ceremony type %q", ErrVerification, clientData.Type)
+	}
+	if subtle.ConstantTimeCompare([]byte(strings.TrimRight(clientData.Challenge, "=")), []byte(session.Challenge)) != 1 {
+		return fmt.Errorf("%w: challenge mismatch", ErrVerification)
+	}
+	if !slices.Contains(w.cfg.Origins, clientData.Origin) || clientData.CrossOrigin {
+		return fmt.Errorf("%w: unexpected origin %q", ErrVerification, clientData.Origin)
+	}
+
+	return nil
+}
+
+type authenticatorData struct {
+	flags        byte
+	signCount    uint32
+	credentialID []byte
+	publicKey    []byte
+}
+
+func (w *WebAuthn) parseAuthenticatorData(data []byte, session *Session) (*authenticatorData, error) {
+	if len(data) < 37 {
+		return nil, fmt.Errorf("%w: authenticator data is too short", ErrVerification)
+	}
+
+	rpIDHash := sha256.Sum256([]byte(w.cfg.RPID))
+	if subtle.ConstantTimeCompare(data[:32], rpIDHash[:]) != 1 {
+		return nil, fmt.Errorf("%w: rp id hash mismatch", ErrVerification)
+	}
+
+	parsed := &authenticatorData{
+		flags:     data[32],
+		signCount: binary.BigEndian.Uint32(data[33:37]),
+	}
+
+	if parsed.flags&flagUserPresent == 0 {
+		return nil, fmt.Errorf("%w: user presence flag is not set", ErrVerification)
+	}
+	if session.UserVerification == UserVerificationReq && parsed.flags&flagUserVerified == 0 {
+		return nil, fmt.Errorf("%w: user verification flag is not set", ErrVerification)
+	}
+
+	rest := data[37:]
+	if parsed.flags&flagAttestedCredential != 0 {
+		// aaguid (16) | длина id (2) | id | COSE ключ
+		if len(rest) < 18 {
+			return nil, fmt.Errorf("%w: attested credential data is too short", ErrVerification)
+		}
+		idLength := int(binary.BigEndian.Uint16(rest[16:18]))
+		rest = rest[18:]
+		if len(rest) < idLength {
+			return nil, fmt.Errorf("%w: credential id is truncated", ErrVerification)
+		}
+		parsed.credentialID = append([]byte(nil), rest[:idLength]...)
+		rest = rest[idLength:]
+
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid credential public key: %v", ErrVerification, err)
+		}
+		parsed.publicKey = append([]byte(nil), rest[:len(rest)-len(after)]...)
+		rest = after
+	}
+
+	if parsed.flags&flagExtensionData != 0 {
+		_, after, err := decodeCBOR(rest)
+		if err != nil {
+			return nil, fmt.Errorf("%w: invalid extension data: %v", ErrVerification, err)
+		}
+		rest = after
+	}
+
+	if len(rest) != 0 {
+		return nil, fmt.Errorf("%w: trailing authenticator data", ErrVerification)
+	}
+
+	return parsed, nil
+}
+
+func descriptors(list []Descriptor) []CredentialDescriptor {
+	result := make([]CredentialDescriptor, 0, len(list))
+	for _, d := range list {
+		result = append(result, CredentialDescriptor{
+			Type:       "public-key",
+			ID:         encode(d.ID),
+			Transports: d.Transports,
+		})
+	}
+	return result
+}
+
+func newChallenge() (string, error) {
+	b := make([]byte, challengeSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return encode(b), nil
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// decode принимает base64url как с выравниванием, так и без.
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(strings.TrimRight(s, "="))
+}
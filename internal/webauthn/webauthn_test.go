@@ -0,0 +1,604 @@
+package webauthn
+
+import (
+	"auth/internal/webauthn/webauthntest"
+	"bytes"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strings"
+	"testing"
+)
+
+const (
+	testRPID   = "example.com"
+	testOrigin = "https://example.com"
+)
+
+func newTestWebAuthn(t *testing.T, userVerification string) *WebAuthn {
+	t.Helper()
+
+	w, err := New(Config{
+		RPID:             testRPID,
+		RPName:           "Example",
+		Origins:          []string{testOrigin},
+		UserVerification: userVerification,
+	})
+	if err != nil {
+		t.Fatalf("New: %v", err)
+	}
+	return w
+}
+
+// register проходит церемонию регистрации программным аутентификатором.
+func register(t *testing.T, w *WebAuthn, authenticator *webauthntest.Authenticator) *Credential {
+	t.Helper()
+
+	options, session, err := w.BeginRegistration([]byte("user-1"), "alice", "Alice", nil)
+	if err != nil {
+		t.Fatalf("BeginRegistration: %v", err)
+	}
+	body, err := authenticator.Register(marshal(t, options))
+	if err != nil {
+		t.Fatalf("Register: %v", err)
+	}
+	credential, err := w.FinishRegistration(session, body)
+	if err != nil {
+		t.Fatalf("FinishRegistration: %v", err)
+	}
+	return credential
+}
+
+// login возвращает сессию и разобранный ответ аутентификатора.
+func login(t *testing.T, w *WebAuthn, authenticator *webauthntest.Authenticator, credential *Credential) (*Session, *Assertion) {
+	t.Helper()
+
+	options, session, err := w.BeginLogin([]Descriptor{{ID: credential.ID}})
+	if err != nil {
+		t.Fatalf("BeginLogin: %v", err)
+	}
+	body, err := authenticator.Login(marshal(t, options))
+	if err != nil {
+		t.Fatalf("Login: %v", err)
+	}
+	assertion, err := w.ParseAssertion(body)
+	if err != nil {
+		t.Fatalf("ParseAssertion: %v", err)
+	}
+	return session, assertion
+}
+
+// marshal кодирует параметры церемонии, как их получает браузер.
+func marshal(t *testing.T, options interface{}) []byte {
+	t.Helper()
+	data, err := json.Marshal(options)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+// rewrite меняет поле ответа аутентификатора, path - ключи через точку.
+func rewrite(t *testing.T, body []byte, path string, value interface{}) []byte {
+	t.Helper()
+
+	var credential map[string]interface{}
+	if err := json.Unmarshal(body, &credential); err != nil {
+		t.Fatal(err)
+	}
+	keys := strings.Split(path, ".")
+	node := credential
+	for _, key := range keys[:len(keys)-1] {
+		node = node[key].(map[string]interface{})
+	}
+	node[keys[len(keys)-1]] = value
+
+	rewritten, err := json.Marshal(credential)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return rewritten
+}
+
+func TestRegistrationAndLogin(t *testing.T) {
+	w := newTestWebAuthn(t, UserVerificationReq)
+	authenticator := webauthntest.New(testOrigin)
+
+	credential := register(t, w, authenticator)
+	if len(credential.ID) != 32 || !credential.UserVerified || credential.SignCount != 0 {
+		t.Fatalf("unexpected credential: %+v", credential)
+	}
+	if len(credential.Transports) != 1 || credential.Transports[0] != "internal" {
+		t.Errorf("transports = %v", credential.Transports)
+	}
+
+	signCount := credential.SignCount
+	for i := 1; i <= 3; i++ {
+		session, assertion := login(t, w, authenticator, credential)
+		if !bytes.Equal(assertion.CredentialID, credential.ID) || string(assertion.UserHandle) != "user-1" {
+			t.Fatalf("assertion id = %x, user handle = %q", assertion.CredentialID, assertion.UserHandle)
+		}
+
+		count, verified, err := w.FinishLogin(session, assertion, credential.PublicKey, signCount)
+		if err != nil {
+			t.Fatalf("FinishLogin #%d: %v", i, err)
+		}
+		if count != uint32(i) || !verified {
+			t.Fatalf("FinishLogin #%d = %d, %v", i, count, verified)
+		}
+		signCount = count
+	}
+}
+
+func TestLoginSignCount(t *testing.T) {
+	tests := []struct {
+		name     string
+		stored   uint32
+		wantErr  bool
+		wantNext uint32
+	}{
+		{"increases", 0, false, 1},
+		{"equal to stored", 1, true, 0},
+		{"behind stored", 5, true, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWebAuthn(t, UserVerificationPref)
+			authenticator := webauthntest.New(testOrigin)
+			credential := register(t, w, authenticator)
+
+			// Аутентификатор подпишет счетчик 1
+			session, assertion := login(t, w, authenticator, credential)
+			count, _, err := w.FinishLogin(session, assertion, credential.PublicKey, tt.stored)
+			if tt.wantErr {
+				if !errors.Is(err, ErrVerification) {
+					t.Fatalf("err = %v, want ErrVerification", err)
+				}
+				return
+			}
+			if err != nil || count != tt.wantNext {
+				t.Fatalf("FinishLogin = %d, %v", count, err)
+			}
+		})
+	}
+}
+
+func TestLoginWithoutSignCount(t *testing.T) {
+	w := newTestWebAuthn(t, UserVerificationPref)
+	authenticator := webauthntest.New(testOrigin)
+	credential := register(t, w, authenticator)
+
+	// Аутентификаторы без счетчика всегда присылают 0: после инкремента
+	// в Login счетчик переполнится в 0
+	authenticator.SetSignCount(^uint32(0))
+	session, assertion := login(t, w, authenticator, credential)
+	if count, _, err := w.FinishLogin(session, assertion, credential.PublicKey, 0); err != nil || count != 0 {
+		t.Fatalf("FinishLogin = %d, %v", count, err)
+	}
+}
+
+func TestRegistrationRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte
+	}{
+		{"wrong origin", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			a.Origin = "https://evil.example"
+			body, err := a.Register(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}},
+		{"wrong challenge", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			other, _, err := w.BeginRegistration([]byte("user-1"), "alice", "Alice", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err = a.Register(marshal(t, other))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}},
+		{"wrong rp id", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			options.RP.ID = "evil.example"
+			body, err := a.Register(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}},
+		{"user not verified", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			a.UserVerified = false
+			body, err := a.Register(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}},
+		{"raw id mismatch", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			return rewrite(t, body, "rawId", encode([]byte("another credential")))
+		}},
+		{"wrong type", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			return rewrite(t, body, "type", "password")
+		}},
+		{"invalid base64", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			return rewrite(t, body, "response.attestationObject", "not base64!")
+		}},
+		{"attestation is not cbor", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			return rewrite(t, body, "response.attestationObject", encode([]byte{0xff}))
+		}},
+		{"attestation is not a map", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			object, _ := encodeCBOR([]interface{}{"authData"})
+			return rewrite(t, body, "response.attestationObject", encode(object))
+		}},
+		{"missing authData", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			object, _ := encodeCBOR(map[interface{}]interface{}{"fmt": "none"})
+			return rewrite(t, body, "response.attestationObject", encode(object))
+		}},
+		{"client data is not json", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *CreationOptions, body []byte) []byte {
+			return rewrite(t, body, "response.clientDataJSON", encode([]byte("{")))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWebAuthn(t, UserVerificationReq)
+			authenticator := webauthntest.New(testOrigin)
+
+			options, session, err := w.BeginRegistration([]byte("user-1"), "alice", "Alice", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := authenticator.Register(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			body = tt.prepare(t, w, authenticator, options, body)
+			if _, err := w.FinishRegistration(session, body); !errors.Is(err, ErrVerification) {
+				t.Fatalf("err = %v, want ErrVerification", err)
+			}
+		})
+	}
+}
+
+func TestRegistrationMalformedAuthData(t *testing.T) {
+	w := newTestWebAuthn(t, UserVerificationPref)
+	authenticator := webauthntest.New(testOrigin)
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	publicKey, err := encodeES256PublicKey(&key.PublicKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := []byte("credential-id")
+
+	header := func(flags byte) []byte {
+		rpIDHash := sha256.Sum256([]byte(testRPID))
+		return append(rpIDHash[:], flags|flagUserPresent, 0, 0, 0, 0)
+	}
+	attested := func(idLength uint16, key []byte) []byte {
+		data := append(header(flagAttestedCredential), make([]byte, 16)...)
+		data = append(data, byte(idLength>>8), byte(idLength))
+		data = append(data, id...)
+		return append(data, key...)
+	}
+
+	// Флаг расширений без самих данных
+	withExtensions := attested(uint16(len(id)), publicKey)
+	withExtensions[32] |= flagExtensionData
+
+	tests := []struct {
+		name     string
+		authData []byte
+	}{
+		{"too short", header(flagAttestedCredential)[:36]},
+		{"no attested credential", header(0)},
+		{"truncated attested data", append(header(flagAttestedCredential), make([]byte, 10)...)},
+		{"truncated credential id", attested(64, publicKey)},
+		{"truncated cose key", attested(uint16(len(id)), publicKey[:len(publicKey)-5])},
+		{"cose key is not a map", attested(uint16(len(id)), []byte{0x01})},
+		{"trailing data", append(attested(uint16(len(id)), publicKey), 0x00)},
+		{"missing extensions", withExtensions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, session, err := w.BeginRegistration([]byte("user-1"), "alice", "Alice", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := authenticator.Register(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			object, err := encodeCBOR(map[interface{}]interface{}{
+				"fmt":      "none",
+				"attStmt":  map[interface{}]interface{}{},
+				"authData": tt.authData,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			body = rewrite(t, body, "rawId", encode(id))
+			body = rewrite(t, body, "response.attestationObject", encode(object))
+
+			if _, err := w.FinishRegistration(session, body); !errors.Is(err, ErrVerification) {
+				t.Fatalf("err = %v, want ErrVerification", err)
+			}
+		})
+	}
+}
+
+func TestLoginRejected(t *testing.T) {
+	tests := []struct {
+		name    string
+		prepare func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *RequestOptions) []byte
+	}{
+		{"wrong origin", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *RequestOptions) []byte {
+			a.Origin = "https://example.com.evil.example"
+			body, err := a.Login(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}},
+		{"wrong challenge", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *RequestOptions) []byte {
+			other, _, err := w.BeginLogin(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := a.Login(marshal(t, other))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}},
+		{"registration ceremony", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *RequestOptions) []byte {
+			body, err := a.Login(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var credential struct {
+				Response struct {
+					ClientDataJSON string `json:"clientDataJSON"`
+				} `json:"response"`
+			}
+			if err := json.Unmarshal(body, &credential); err != nil {
+				t.Fatal(err)
+			}
+			clientData, _ := decode(credential.Response.ClientDataJSON)
+			clientData = bytes.Replace(clientData, []byte("webauthn.get"), []byte("webauthn.create"), 1)
+			return rewrite(t, body, "response.clientDataJSON", encode(clientData))
+		}},
+		{"user not verified", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *RequestOptions) []byte {
+			a.UserVerified = false
+			body, err := a.Login(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}},
+		{"tampered authenticator data", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *RequestOptions) []byte {
+			a.SetSignCount(99)
+			body, err := a.Login(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			var credential struct {
+				Response struct {
+					AuthenticatorData string `json:"authenticatorData"`
+				} `json:"response"`
+			}
+			if err := json.Unmarshal(body, &credential); err != nil {
+				t.Fatal(err)
+			}
+			authData, _ := decode(credential.Response.AuthenticatorData)
+			authData[36]++
+			return rewrite(t, body, "response.authenticatorData", encode(authData))
+		}},
+		{"signature by another key", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *RequestOptions) []byte {
+			if err := a.ReplaceKeys(); err != nil {
+				t.Fatal(err)
+			}
+			body, err := a.Login(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return body
+		}},
+		{"signature is not der", func(t *testing.T, w *WebAuthn, a *webauthntest.Authenticator, options *RequestOptions) []byte {
+			body, err := a.Login(marshal(t, options))
+			if err != nil {
+				t.Fatal(err)
+			}
+			return rewrite(t, body, "response.signature", encode([]byte("garbage")))
+		}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := newTestWebAuthn(t, UserVerificationReq)
+			authenticator := webauthntest.New(testOrigin)
+			credential := register(t, w, authenticator)
+
+			options, session, err := w.BeginLogin([]Descriptor{{ID: credential.ID}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			body := tt.prepare(t, w, authenticator, options)
+
+			assertion, err := w.ParseAssertion(body)
+			if err != nil {
+				t.Fatalf("ParseAssertion: %v", err)
+			}
+			if _, _, err := w.FinishLogin(session, assertion, credential.PublicKey, credential.SignCount); !errors.Is(err, ErrVerification) {
+				t.Fatalf("err = %v, want ErrVerification", err)
+			}
+		})
+	}
+}
+
+func TestParseAssertionRejected(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{"not json", `{`},
+		{"wrong type", `{"rawId":"AA","type":"password","response":{}}`},
+		{"invalid base64", `{"rawId":"A*","type":"public-key","response":{}}`},
+		{"invalid signature base64", `{"rawId":"AA","type":"public-key","response":{"signature":"%%"}}`},
+	}
+
+	w := newTestWebAuthn(t, UserVerificationPref)
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := w.ParseAssertion([]byte(tt.body)); !errors.Is(err, ErrVerification) {
+				t.Fatalf("err = %v, want ErrVerification", err)
+			}
+		})
+	}
+}
+
+func TestCBORRoundTrip(t *testing.T) {
+	value := map[interface{}]interface{}{
+		"fmt":      "none",
+		int64(-7):  []interface{}{int64(1), int64(-1), int64(1 << 40), "x"},
+		"authData": bytes.Repeat([]byte{0xab}, 300),
+		int64(3):   map[interface{}]interface{}{},
+	}
+
+	encoded, err := encodeCBOR(value)
+	if err != nil {
+		t.Fatalf("encodeCBOR: %v", err)
+	}
+	decoded, rest, err := decodeCBOR(encoded)
+	if err != nil || len(rest) != 0 {
+		t.Fatalf("decodeCBOR: rest = %d, err = %v", len(rest), err)
+	}
+
+	again, err := encodeCBOR(decoded)
+	if err != nil {
+		t.Fatalf("encodeCBOR: %v", err)
+	}
+	if !bytes.Equal(encoded, again) {
+		t.Fatalf("round trip mismatch:\n%x\n%x", encoded, again)
+	}
+}
+
+func TestDecodeCBORMalformed(t *testing.T) {
+	nested := bytes.Repeat([]byte{0x81}, maxCBORDepth+2)
+	nested = append(nested, 0x00)
+
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"empty", nil},
+		{"truncated argument", []byte{0x19, 0x01}},
+		{"truncated bytes", []byte{0x45, 0x01, 0x02}},
+		{"truncated text", []byte{0x63, 'a'}},
+		{"truncated array", []byte{0x82, 0x01}},
+		{"truncated map", []byte{0xa1, 0x01}},
+		{"array length beyond data", []byte{0x9a, 0xff, 0xff, 0xff, 0xff}},
+		{"map length beyond data", []byte{0xbb, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"bytes length overflow", []byte{0x5b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"indefinite length", []byte{0x5f, 0x41, 0x00, 0xff}},
+		{"integer overflow", []byte{0x1b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"negative overflow", []byte{0x3b, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff}},
+		{"byte string map key", []byte{0xa1, 0x41, 0x00, 0x00}},
+		{"float", []byte{0xf9, 0x3c, 0x00}},
+		{"nesting too deep", nested},
+		{"reserved info", []byte{0x1c}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := decodeCBOR(tt.data); err == nil {
+				t.Fatal("decodeCBOR accepted malformed input")
+			}
+		})
+	}
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	x := key.X.FillBytes(make([]byte, 32))
+	y := key.Y.FillBytes(make([]byte, 32))
+
+	ec2 := func(modify func(map[interface{}]interface{})) []byte {
+		m := map[interface{}]interface{}{
+			int64(coseKeyType): int64(coseKtyEC2),
+			int64(coseKeyAlg):  int64(AlgES256),
+			int64(coseKeyCrv):  int64(coseCrvP256),
+			int64(coseKeyX):    x,
+			int64(coseKeyY):    y,
+		}
+		if modify != nil {
+			modify(m)
+		}
+		data, err := encodeCBOR(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data
+	}
+	valid := ec2(nil)
+
+	offCurve := new(big.Int).Add(key.Y, big.NewInt(1)).FillBytes(make([]byte, 32))
+
+	tests := []struct {
+		name    string
+		data    []byte
+		wantAlg int64
+		wantErr bool
+	}{
+		{"es256", valid, AlgES256, false},
+		{"trailing data", append(append([]byte(nil), valid...), 0x00), 0, true},
+		{"not a map", []byte{0x80}, 0, true},
+		{"malformed cbor", valid[:len(valid)-1], 0, true},
+		{"wrong curve", ec2(func(m map[interface{}]interface{}) { m[int64(coseKeyCrv)] = int64(2) }), 0, true},
+		{"short x", ec2(func(m map[interface{}]interface{}) { m[int64(coseKeyX)] = x[:31] }), 0, true},
+		{"missing y", ec2(func(m map[interface{}]interface{}) { delete(m, int64(coseKeyY)) }), 0, true},
+		{"point off curve", ec2(func(m map[interface{}]interface{}) { m[int64(coseKeyY)] = offCurve }), 0, true},
+		{"unsupported algorithm", ec2(func(m map[interface{}]interface{}) { m[int64(coseKeyAlg)] = int64(-35) }), 0, true},
+		{"okp with wrong curve", ec2(func(m map[interface{}]interface{}) {
+			m[int64(coseKeyType)] = int64(coseKtyOKP)
+			m[int64(coseKeyAlg)] = int64(AlgEdDSA)
+		}), 0, true},
+		{"short rsa modulus", ec2(func(m map[interface{}]interface{}) {
+			m[int64(coseKeyType)] = int64(coseKtyRSA)
+			m[int64(coseKeyAlg)] = int64(AlgRS256)
+			m[int64(coseKeyRSAN)] = make([]byte, 128)
+			m[int64(coseKeyRSAE)] = []byte{0x01, 0x00, 0x01}
+		}), 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			alg, public, err := parsePublicKey(tt.data)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("parsePublicKey accepted %x", tt.data)
+				}
+				return
+			}
+			if err != nil || alg != tt.wantAlg || public == nil {
+				t.Fatalf("parsePublicKey = %d, %v, %v", alg, public, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,245 @@
+// Package webauthntest - программный аутентификатор для тестов церемоний
+// WebAuthn без железа. Пакет не зависит от webauthn и принимает параметры
+// церемоний в том JSON виде, в каком их получает браузер.
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+)
+
+// Флаги authenticator data, WebAuthn §6.1
+const (
+	flagUserPresent        = 0x01
+	flagUserVerified       = 0x04
+	flagAttestedCredential = 0x40
+)
+
+// Authenticator - программный аутентификатор с ES256 ключами.
+type Authenticator struct {
+	Origin       string
+	UserVerified bool
+
+	credentials map[string]*credential
+}
+
+type credential struct {
+	id         []byte
+	rpID       string
+	userHandle []byte
+	key        *ecdsa.PrivateKey
+	signCount  uint32
+}
+
+func New(origin string) *Authenticator {
+	return &Authenticator{
+		Origin:       origin,
+		UserVerified: true,
+		credentials:  make(map[string]*credential),
+	}
+}
+
+type creationOptions struct {
+	Challenge string `json:"challenge"`
+	RP        struct {
+		ID string `json:"id"`
+	} `json:"rp"`
+	User struct {
+		ID string `json:"id"`
+	} `json:"user"`
+}
+
+type requestOptions struct {
+	Challenge        string `json:"challenge"`
+	RPID             string `json:"rpId"`
+	AllowCredentials []struct {
+		ID string `json:"id"`
+	} `json:"allowCredentials"`
+}
+
+// Register имитирует navigator.credentials.create(). options - параметры
+// церемонии, как есть или внутри {"publicKey": ...}.
+func (a *Authenticator) Register(options []byte) ([]byte, error) {
+	var creation creationOptions
+	if err := unmarshalOptions(options, &creation); err != nil {
+		return nil, err
+	}
+
+	userHandle, err := decode(creation.User.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		return nil, err
+	}
+
+	id := make([]byte, 32)
+	if _, err := rand.Read(id); err != nil {
+		return nil, err
+	}
+
+	c := &credential{
+		id:         id,
+		rpID:       creation.RP.ID,
+		userHandle: userHandle,
+		key:        key,
+	}
+
+	publicKey := encodeCOSEKey(&key.PublicKey)
+
+	// aaguid из нулей: модель аутентификатора не раскрывается
+	attested := make([]byte, 16, 16+2+len(id)+len(publicKey))
+	attested = binary.BigEndian.AppendUint16(attested, uint16(len(id)))
+	attested = append(attested, id...)
+	attested = append(attested, publicKey...)
+
+	authData := a.authenticatorData(c, flagAttestedCredential)
+	authData = append(authData, attested...)
+
+	clientDataJSON, err := a.clientData("webauthn.create", creation.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	a.credentials[encode(id)] = c
+
+	return json.Marshal(map[string]interface{}{
+		"id":    encode(id),
+		"rawId": encode(id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(clientDataJSON),
+			"attestationObject": encode(encodeAttestationObject(authData)),
+			"transports":        []string{"internal"},
+		},
+	})
+}
+
+// Login имитирует navigator.credentials.get(). При пустом allowCredentials
+// используется первый ключ для данного rp id.
+func (a *Authenticator) Login(options []byte) ([]byte, error) {
+	var request requestOptions
+	if err := unmarshalOptions(options, &request); err != nil {
+		return nil, err
+	}
+
+	c := a.find(&request)
+	if c == nil {
+		return nil, errors.New("webauthntest: no matching credential")
+	}
+
+	c.signCount++
+	authData := a.authenticatorData(c, 0)
+
+	clientDataJSON, err := a.clientData("webauthn.get", request.Challenge)
+	if err != nil {
+		return nil, err
+	}
+
+	clientDataHash := sha256.Sum256(clientDataJSON)
+	digest := sha256.Sum256(append(append([]byte(nil), authData...), clientDataHash[:]...))
+	signature, err := ecdsa.SignASN1(rand.Reader, c.key, digest[:])
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(map[string]interface{}{
+		"id":    encode(c.id),
+		"rawId": encode(c.id),
+		"type":  "public-key",
+		"response": map[string]interface{}{
+			"clientDataJSON":    encode(clientDataJSON),
+			"authenticatorData": encode(authData),
+			"signature":         encode(signature),
+			"userHandle":        encode(c.userHandle),
+		},
+	})
+}
+
+// SetSignCount выставляет счетчик подписей всех ключей. Следующий Login
+// пришлет count+1.
+func (a *Authenticator) SetSignCount(count uint32) {
+	for _, c := range a.credentials {
+		c.signCount = count
+	}
+}
+
+// ReplaceKeys подменяет закрытые ключи: подписи перестают сходиться с
+// зарегистрированными публичными ключами.
+func (a *Authenticator) ReplaceKeys() error {
+	for _, c := range a.credentials {
+		key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+		if err != nil {
+			return err
+		}
+		c.key = key
+	}
+	return nil
+}
+
+func (a *Authenticator) find(options *requestOptions) *credential {
+	if len(options.AllowCredentials) == 0 {
+		for _, c := range a.credentials {
+			if c.rpID == options.RPID {
+				return c
+			}
+		}
+		return nil
+	}
+
+	for _, d := range options.AllowCredentials {
+		if c, ok := a.credentials[d.ID]; ok && c.rpID == options.RPID {
+			return c
+		}
+	}
+	return nil
+}
+
+func (a *Authenticator) authenticatorData(c *credential, flags byte) []byte {
+	flags |= flagUserPresent
+	if a.UserVerified {
+		flags |= flagUserVerified
+	}
+
+	rpIDHash := sha256.Sum256([]byte(c.rpID))
+	data := append(rpIDHash[:], flags)
+	return binary.BigEndian.AppendUint32(data, c.signCount)
+}
+
+func (a *Authenticator) clientData(ceremony, challenge string) ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"type":        ceremony,
+		"challenge":   challenge,
+		"origin":      a.Origin,
+		"crossOrigin": false,
+	})
+}
+
+func unmarshalOptions(data []byte, v interface{}) error {
+	var wrapped struct {
+		PublicKey json.RawMessage `json:"publicKey"`
+	}
+	if err := json.Unmarshal(data, &wrapped); err != nil {
+		return err
+	}
+	if len(wrapped.PublicKey) != 0 {
+		data = wrapped.PublicKey
+	}
+	return json.Unmarshal(data, v)
+}
+
+func encode(b []byte) string {
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decode(s string) ([]byte, error) {
+	return base64.RawURLEncoding.DecodeString(s)
+}
@@ -0,0 +1,51 @@
+package webauthntest
+
+import (
+	"crypto/ecdsa"
+	"encoding/binary"
+)
+
+// Аутентификатору нужны только две CBOR структуры, они собираются вручную
+// в каноническом порядке ключей, RFC 8949 §4.2.1.
+
+// encodeCOSEKey кодирует P-256 ключ как COSE_Key: kty EC2, alg ES256, crv P-256.
+func encodeCOSEKey(public *ecdsa.PublicKey) []byte {
+	key := cborHead(5, 5)
+	key = append(key, 0x01, 0x02) // kty: EC2
+	key = append(key, 0x03, 0x26) // alg: -7
+	key = append(key, 0x20, 0x01) // crv: P-256
+	key = append(key, 0x21)       // x
+	key = append(key, cborBytes(public.X.FillBytes(make([]byte, 32)))...)
+	key = append(key, 0x22) // y
+	return append(key, cborBytes(public.Y.FillBytes(make([]byte, 32)))...)
+}
+
+// encodeAttestationObject собирает attestation object формата "none".
+func encodeAttestationObject(authData []byte) []byte {
+	object := cborHead(5, 3)
+	object = append(object, cborText("fmt")...)
+	object = append(object, cborText("none")...)
+	object = append(object, cborText("attStmt")...)
+	object = append(object, cborHead(5, 0)...)
+	object = append(object, cborText("authData")...)
+	return append(object, cborBytes(authData)...)
+}
+
+func cborBytes(b []byte) []byte {
+	return append(cborHead(2, len(b)), b...)
+}
+
+func cborText(s string) []byte {
+	return append(cborHead(3, len(s)), s...)
+}
+
+func cborHead(major byte, length int) []byte {
+	m := major << 5
+	switch {
+	case length < 24:
+		return []byte{m | byte(length)}
+	case length <= 0xff:
+		return []byte{m | 24, byte(length)}
+	}
+	return binary.BigEndian.AppendUint16([]byte{m | 25}, uint16(length))
+}